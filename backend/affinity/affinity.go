@@ -0,0 +1,211 @@
+// Package affinity infers which stores and store types a user prefers from
+// the offers they use. Each use adds 1 to a per-user score that halves every
+// Policy.HalfLifeDays, so old habits fade. Scores are kept in
+// user_affinities as of their last update and decayed on read; only the
+// top Policy.TopK per kind are kept.
+//
+// The strongest vendor and vendor type are mirrored into
+// users.most_frequent_vendor and users.most_frequent_vendor_type, which
+// drive the most_frequent_* segments.
+package affinity
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Kinds of affinity
+const (
+	KindVendor     = "vendor"
+	KindVendorType = "vendor_type"
+)
+
+// Policy is how fast scores fade and how many are kept
+type Policy struct {
+	HalfLifeDays float64 // A use counts half as much after this many days
+	TopK         int     // Scores kept per kind
+}
+
+// DefaultPolicy halves scores every 30 days and keeps 5 of each kind
+func DefaultPolicy() Policy {
+	return Policy{HalfLifeDays: 30, TopK: 5}
+}
+
+// Validate checks the policy is usable
+func (p Policy) Validate() error {
+	if p.HalfLifeDays <= 0 {
+		return fmt.Errorf("affinity half-life must be positive")
+	}
+	if p.TopK < 1 {
+		return fmt.Errorf("affinity top-k must be at least 1")
+	}
+	return nil
+}
+
+func (p Policy) halfLifeSeconds() float64 {
+	return p.HalfLifeDays * 24 * 60 * 60
+}
+
+// decay fades score by the time elapsed since it was stored. Matches the
+// decayed SQL expression.
+func (p Policy) decay(score float64, elapsed time.Duration) float64 {
+	return score * math.Pow(0.5, elapsed.Seconds()/p.halfLifeSeconds())
+}
+
+// decayed is a stored score faded to now; $2 is the half-life in seconds
+const decayed = `score * POWER(0.5, EXTRACT(EPOCH FROM (NOW() - updated_at)) / $2)`
+
+// Weight is one affinity as of now
+type Weight struct {
+	Key        string    `json:"key"`
+	Weight     float64   `json:"weight"` // Decayed score
+	Share      float64   `json:"share"`  // Weight as a fraction of this kind's total
+	Uses       int       `json:"uses"`   // Undecayed count of uses
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// Affinities are a user's strongest vendors and vendor types, strongest first
+type Affinities struct {
+	Vendors     []Weight `json:"vendors"`
+	VendorTypes []Weight `json:"vendor_types"`
+}
+
+// Record counts one use at vendorID towards userID's affinities, inside
+// the transaction that stored the engagement
+func Record(tx *sql.Tx, p Policy, userID, vendorID string) error {
+	var vendorType sql.NullString
+	err := tx.QueryRow(`SELECT vendor_type FROM vendors WHERE vendor_id = $1`, vendorID).Scan(&vendorType)
+	if err != nil {
+		return err
+	}
+
+	top := map[string]string{}
+	keys := map[string]string{KindVendor: vendorID}
+	if vendorType.Valid && vendorType.String != "" {
+		keys[KindVendorType] = vendorType.String
+	}
+	for kind, key := range keys {
+		if top[kind], err = bump(tx, p, userID, kind, key); err != nil {
+			return fmt.Errorf("%s affinity: %w", kind, err)
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users
+		SET most_frequent_vendor = COALESCE(NULLIF($2, ''), most_frequent_vendor),
+			most_frequent_vendor_type = COALESCE(NULLIF($3, ''), most_frequent_vendor_type),
+			updated_at = NOW()
+		WHERE user_id = $1`,
+		userID, top[KindVendor], top[KindVendorType])
+	return err
+}
+
+// bump decays and increments one score, drops the weakest beyond TopK and
+// returns the strongest key of the kind
+func bump(tx *sql.Tx, p Policy, userID, kind, key string) (string, error) {
+	_, err := tx.Exec(`
+		INSERT INTO user_affinities AS a (user_id, kind, key, score, uses, last_used_at, updated_at)
+		VALUES ($1, $3, $4, 1, 1, NOW(), NOW())
+		ON CONFLICT (user_id, kind, key) DO UPDATE
+		SET score = a.score * POWER(0.5, EXTRACT(EPOCH FROM (NOW() - a.updated_at)) / $2) + 1,
+			uses = a.uses + 1,
+			last_used_at = NOW(),
+			updated_at = NOW()`,
+		userID, p.halfLifeSeconds(), kind, key)
+	if err != nil {
+		return "", err
+	}
+
+	// The key just used always stays; it evicts the weakest faded habit
+	_, err = tx.Exec(`
+		DELETE FROM user_affinities
+		WHERE user_id = $1 AND kind = $3 AND key <> $4
+		  AND key NOT IN (
+			SELECT key FROM user_affinities
+			WHERE user_id = $1 AND kind = $3 AND key <> $4
+			ORDER BY `+decayed+` DESC
+			LIMIT $5
+		  )`,
+		userID, p.halfLifeSeconds(), kind, key, p.TopK-1)
+	if err != nil {
+		return "", err
+	}
+
+	var strongest string
+	err = tx.QueryRow(`
+		SELECT key FROM user_affinities
+		WHERE user_id = $1 AND kind = $3
+		ORDER BY `+decayed+` DESC, key
+		LIMIT 1`,
+		userID, p.halfLifeSeconds(), kind).Scan(&strongest)
+	return strongest, err
+}
+
+// Load reads userID's affinities decayed to now
+func Load(db *sql.DB, p Policy, userID string) (Affinities, error) {
+	a := Affinities{Vendors: []Weight{}, VendorTypes: []Weight{}}
+
+	rows, err := db.Query(`
+		SELECT kind, key, score, EXTRACT(EPOCH FROM (NOW() - updated_at)), uses, last_used_at
+		FROM user_affinities
+		WHERE user_id = $1`, userID)
+	if err != nil {
+		return a, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind string
+		var w Weight
+		var score, elapsedSeconds float64
+		if err := rows.Scan(&kind, &w.Key, &score, &elapsedSeconds, &w.Uses, &w.LastUsedAt); err != nil {
+			return a, err
+		}
+		w.Weight = p.decay(score, time.Duration(elapsedSeconds*float64(time.Second)))
+		switch kind {
+		case KindVendor:
+			a.Vendors = append(a.Vendors, w)
+		case KindVendorType:
+			a.VendorTypes = append(a.VendorTypes, w)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return a, err
+	}
+
+	a.Vendors = topK(rank(a.Vendors), p.TopK)
+	a.VendorTypes = topK(rank(a.VendorTypes), p.TopK)
+	return a, nil
+}
+
+// rank orders weights strongest first; ties go to the smaller key, the same
+// order bump picks the strongest key in
+func rank(weights []Weight) []Weight {
+	sort.SliceStable(weights, func(i, j int) bool {
+		if weights[i].Weight != weights[j].Weight {
+			return weights[i].Weight > weights[j].Weight
+		}
+		return weights[i].Key < weights[j].Key
+	})
+	return weights
+}
+
+// topK trims weights (strongest first) to k and fills in each share
+func topK(weights []Weight, k int) []Weight {
+	if len(weights) > k {
+		weights = weights[:k]
+	}
+	var total float64
+	for _, w := range weights {
+		total += w.Weight
+	}
+	for i := range weights {
+		if total > 0 {
+			weights[i].Share = weights[i].Weight / total
+		}
+	}
+	return weights
+}
@@ -0,0 +1,118 @@
+package affinity
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+func TestDecay(t *testing.T) {
+	monthly := Policy{HalfLifeDays: 30, TopK: 5}
+
+	for _, tc := range []struct {
+		name    string
+		policy  Policy
+		score   float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{"just stored", monthly, 1, 0, 1},
+		{"one half-life", monthly, 1, 30 * day, 0.5},
+		{"two half-lives", monthly, 1, 60 * day, 0.25},
+		{"half a half-life", monthly, 1, 15 * day, 1 / math.Sqrt2},
+		{"score scales", monthly, 3, 30 * day, 1.5},
+		{"short half-life", Policy{HalfLifeDays: 0.5, TopK: 5}, 4, day, 1},
+		{"a year fades to almost nothing", monthly, 1, 365 * day, math.Pow(0.5, 365.0/30)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.policy.decay(tc.score, tc.elapsed); math.Abs(got-tc.want) > 1e-9 {
+				t.Errorf("decay(%v, %v) = %v, want %v", tc.score, tc.elapsed, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRank(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		weights []Weight
+		want    []string
+	}{
+		{"strongest first", []Weight{{Key: "a", Weight: 1}, {Key: "b", Weight: 3}, {Key: "c", Weight: 2}},
+			[]string{"b", "c", "a"}},
+		{"ties by key", []Weight{{Key: "V0003", Weight: 2}, {Key: "V0001", Weight: 2}, {Key: "V0002", Weight: 5}},
+			[]string{"V0002", "V0001", "V0003"}},
+		{"all tied", []Weight{{Key: "coffee"}, {Key: "bakery"}, {Key: "deli"}},
+			[]string{"bakery", "coffee", "deli"}},
+		{"empty", []Weight{}, []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := rank(tc.weights)
+			if len(got) != len(tc.want) {
+				t.Fatalf("rank returned %d weights, want %d", len(got), len(tc.want))
+			}
+			for i, key := range tc.want {
+				if got[i].Key != key {
+					t.Errorf("rank[%d] = %s, want %s", i, got[i].Key, key)
+				}
+			}
+		})
+	}
+}
+
+func TestTopK(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		weights    []Weight
+		k          int
+		wantKeys   []string
+		wantShares []float64
+	}{
+		{"trimmed to k", []Weight{{Key: "a", Weight: 3}, {Key: "b", Weight: 2}, {Key: "c", Weight: 1}}, 2,
+			[]string{"a", "b"}, []float64{0.6, 0.4}},
+		{"fewer than k", []Weight{{Key: "a", Weight: 1}, {Key: "b", Weight: 1}}, 5,
+			[]string{"a", "b"}, []float64{0.5, 0.5}},
+		{"exactly k", []Weight{{Key: "a", Weight: 1}}, 1,
+			[]string{"a"}, []float64{1}},
+		{"faded to zero", []Weight{{Key: "a"}, {Key: "b"}}, 5,
+			[]string{"a", "b"}, []float64{0, 0}},
+		{"none", []Weight{}, 5, []string{}, []float64{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := topK(tc.weights, tc.k)
+			if len(got) != len(tc.wantKeys) {
+				t.Fatalf("topK returned %d weights, want %d", len(got), len(tc.wantKeys))
+			}
+			for i := range got {
+				if got[i].Key != tc.wantKeys[i] {
+					t.Errorf("topK[%d] = %s, want %s", i, got[i].Key, tc.wantKeys[i])
+				}
+				if math.Abs(got[i].Share-tc.wantShares[i]) > 1e-9 {
+					t.Errorf("topK[%d].Share = %v, want %v", i, got[i].Share, tc.wantShares[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy Policy
+		valid  bool
+	}{
+		{"default", DefaultPolicy(), true},
+		{"fractional half-life", Policy{HalfLifeDays: 0.5, TopK: 1}, true},
+		{"zero half-life", Policy{HalfLifeDays: 0, TopK: 5}, false},
+		{"negative half-life", Policy{HalfLifeDays: -1, TopK: 5}, false},
+		{"zero top-k", Policy{HalfLifeDays: 30, TopK: 0}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.policy.Validate(); (err == nil) != tc.valid {
+				t.Errorf("Validate() = %v, want valid %v", err, tc.valid)
+			}
+		})
+	}
+}
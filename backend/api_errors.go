@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// API errors: every failed /api/v1 request is answered with a JSON envelope
+//
+//	{"error": {"status": 404, "code": "user_not_found", "message": "User not found",
+//	           "details": [...], "request_id": "..."}}
+//
+// code is stable and meant for clients to branch on; message is for people
+// and may change. Validation failures list the offending fields in details.
+// The unversioned /api routes keep answering errors as plain text, as
+// shipped apps expect (see api_version.go).
+
+// Error codes
+const (
+	codeInvalidBody        = "invalid_body"        // Request body isn't the expected JSON
+	codeValidationFailed   = "validation_failed"   // A field or parameter is invalid; see details
+	codeInvalidRequest     = "invalid_request"     // Well-formed, but not allowed in this state
+	codeVerificationFail   = "verification_failed" // Wrong, expired or unknown verification code
+	codeUnauthorized       = "unauthorized"
+	codeUserNotFound       = "user_not_found"
+	codeLocationNotFound   = "location_not_found" // The user has never reported a location
+	codeCampaignNotFound   = "campaign_not_found"
+	codeVariantNotFound    = "variant_not_found"
+	codeVendorNotFound     = "vendor_not_found"
+	codeBrandNotFound      = "brand_not_found"
+	codeErasureNotFound    = "erasure_request_not_found"
+	codeAddressNotFound    = "address_not_found"
+	codeJobNotFound        = "job_not_found"
+	codeRouteNotFound      = "route_not_found"
+	codeMethodNotAllowed   = "method_not_allowed"
+	codeUnsupportedVersion = "unsupported_api_version"
+	codeStaleLocation      = "stale_location" // The user's newest location is too old to trust
+	codeBudgetExhausted    = "budget_exhausted"
+	codeNoPhoneNumber      = "no_phone_number"
+	codeDeviceAlreadyBound = "device_already_bound"
+	codeRateLimited        = "rate_limited"
+	codeUpstreamFailed     = "upstream_failed" // A service we depend on (such as SMS delivery) failed
+	codeInternal           = "internal_error"
+)
+
+// apiError is the body of an error response
+type apiError struct {
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []fieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// apiErrorEnvelope is how errors are sent
+type apiErrorEnvelope struct {
+	Error apiError `json:"error"`
+}
+
+// fieldError is a validation failure of one request field or query
+// parameter. Message names the field, as in "lat must be between -90 and 90".
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e fieldError) Error() string { return e.Message }
+
+// invalidField returns a fieldError for field
+func invalidField(field, format string, args ...interface{}) fieldError {
+	return fieldError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// inList places a validation error of item i of a list field, giving
+// fields like locations[1].lat and messages like "location 1: ..."
+func inList(err error, list, item string, i int) error {
+	fe, ok := err.(fieldError)
+	if !ok {
+		return fmt.Errorf("%s %d: %v", item, i, err)
+	}
+	return fieldError{
+		Field:   fmt.Sprintf("%s[%d].%s", list, i, fe.Field),
+		Message: fmt.Sprintf("%s %d: %s", item, i, fe.Message),
+	}
+}
+
+// writeError answers r with an error: the JSON envelope on versioned
+// routes, plain text on the legacy ones
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string, details ...fieldError) {
+	if requestAPIVersion(r) == legacyAPIVersion {
+		http.Error(w, message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiErrorEnvelope{apiError{
+		Status:    status,
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: w.Header().Get(requestIDHeader),
+	}})
+}
+
+// writeValidationError answers 400 for an invalid field. err is normally a
+// fieldError; any other error is reported without field details.
+func writeValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	if fe, ok := err.(fieldError); ok {
+		writeError(w, r, http.StatusBadRequest, codeValidationFailed, fe.Message, fe)
+		return
+	}
+	writeError(w, r, http.StatusBadRequest, codeValidationFailed, err.Error())
+}
+
+// writeInternalError answers 500; the cause has already been logged
+func writeInternalError(w http.ResponseWriter, r *http.Request, message string) {
+	writeError(w, r, http.StatusInternalServerError, codeInternal, message)
+}
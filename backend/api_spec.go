@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sync"
+
+	"streetsavvy-backend/geocode"
+	"streetsavvy-backend/health"
+	"streetsavvy-backend/jobs"
+	"streetsavvy-backend/loyalty"
+	"streetsavvy-backend/models"
+	"streetsavvy-backend/openapi"
+	"streetsavvy-backend/retention"
+)
+
+// The OpenAPI document of the API, served at /api/openapi.json. It is built
+// from apiEndpoints and the Go types the handlers decode and encode, so a
+// renamed field changes the document with it. openapi_test.go fails when a
+// route is added to newRouter without an entry here (or the other way
+// round), and when the checked-in client/openapi.json or the generated
+// client in package client is out of date. api_spec_test.go fails when a
+// handler encodes a different type than its entry's Response. Regenerate
+// the spec and client with:
+//
+//	go generate .
+
+//go:generate go test -run TestOpenAPI . -update
+
+const apiPrefix = "/api/v1"
+
+// openAPIOptions are the document-wide parts of the spec
+var openAPIOptions = openapi.Options{
+	Info: openapi.Info{
+		Title:   "StreetSavvy API",
+		Version: "1",
+		Description: "Geofenced vendor campaigns for nearby users.\n\n" +
+			"Paths are versioned: /api/v1 is the current API. The unversioned /api paths are " +
+			"deprecated; they behave like v1 except that errors are plain text.\n\n" +
+			"Failed requests are answered with {\"error\": {...}}; code is stable, message is for people. " +
+			"Every response carries an X-Request-ID header, which errors repeat as request_id.",
+	},
+	Tags: []openapi.Tag{
+		{Name: "users", Description: "Registration, profiles, devices and privacy"},
+		{Name: "campaigns", Description: "Campaign lists, engagements and campaign settings"},
+		{Name: "guests", Description: "Browsing without an account"},
+		{Name: "vendors", Description: "Brands, store locations and their analytics"},
+		{Name: "geocoding", Description: "Address search and reverse lookups"},
+		{Name: "admin", Description: "Background workers and jobs"},
+		{Name: "operations", Description: "Health checks, metrics, WebSockets and this document"},
+	},
+	Error: apiErrorEnvelope{},
+
+	// This package ("main" when built as the server) and models
+	Unprefixed: []string{
+		reflect.TypeOf(apiError{}).PkgPath(),
+		reflect.TypeOf(models.User{}).PkgPath(),
+	},
+}
+
+// campaignListQuery documents the query parameters of the user campaign lists
+var campaignListQuery = []openapi.Parameter{
+	openapi.Query("sort", "string", "distance or relevance"),
+	openapi.Query("limit", "integer", "Page size, 1-100 (default 50)"),
+	openapi.Query("cursor", "string", "X-Next-Cursor of the previous page"),
+	openapi.Query("vendor_type", "string", "Only this vendor type"),
+	openapi.Query("max_distance_m", "number", "Only campaigns this close, in meters"),
+	openapi.Query("q", "string", "Search in title and description"),
+	openapi.Query("expiring_soon", "boolean", "Only campaigns ending within 3 days"),
+	openapi.Query("lat", "number", "Use this position instead of the stored location"),
+	openapi.Query("lng", "number", "Use this position instead of the stored location"),
+	openapi.Query("accuracy", "number", "Accuracy of lat and lng, in meters"),
+	openapi.Query("save", "boolean", "Also record lat and lng as a location event"),
+}
+
+var nextCursorHeaders = map[string]string{nextCursorHeader: "Cursor of the next page, if there is one"}
+
+var guestTokenParam = openapi.RequestHeader(guestTokenHeader, "session_token of a guest session", true)
+
+// apiEndpoints lists every route registerAPIRoutes adds, relative to
+// apiPrefix
+var apiEndpoints = []openapi.Endpoint{
+	// Users
+	{ID: "registerUser", Method: "POST", Path: "/users/register", Tag: "users",
+		Summary: "Start registration; sends a verification code to the phone number",
+		Body:    registerRequest{}, Status: http.StatusAccepted, Response: verificationChallenge{}},
+	{ID: "verifyRegistration", Method: "POST", Path: "/users/register/verify", Tag: "users",
+		Summary: "Finish registration: 201 for a new account, 200 for an existing one on a new device",
+		Body:    verifyRegistrationRequest{}, Status: http.StatusOK, AltStatus: []int{http.StatusCreated},
+		Response: models.User{}},
+	{ID: "getUser", Method: "GET", Path: "/users/{id}", Tag: "users",
+		Summary: "Get a user profile", Status: http.StatusOK, Response: models.User{}},
+	{ID: "updateUser", Method: "PUT", Path: "/users/{id}", Tag: "users",
+		Summary: "Update notification and privacy settings",
+		Body:    userSettingsRequest{}, Status: http.StatusOK, Response: models.User{}},
+	{ID: "deleteUser", Method: "DELETE", Path: "/users/{id}", Tag: "users",
+		Summary: "Delete an account, keeping engagements under an anonymous ID",
+		Status:  http.StatusOK, Response: deletedUser{}},
+	{ID: "requestDeviceRebind", Method: "POST", Path: "/users/{id}/device", Tag: "users",
+		Summary: "Move the account to a new device; sends a code to the account's phone",
+		Body:    deviceRequest{}, Status: http.StatusAccepted, Response: verificationChallenge{}},
+	{ID: "verifyDeviceRebind", Method: "POST", Path: "/users/{id}/device/verify", Tag: "users",
+		Summary: "Confirm the new device",
+		Body:    verifyDeviceRequest{}, Status: http.StatusOK, Response: models.User{}},
+	{ID: "exportUserData", Method: "GET", Path: "/users/{id}/export", Tag: "users",
+		Summary: "Download a ZIP of everything stored about the user",
+		Status:  http.StatusOK, Response: []byte{}, ContentType: openapi.ZIP},
+	{ID: "requestErasure", Method: "POST", Path: "/users/{id}/erasure", Tag: "users",
+		Summary: "Request erasure after the grace period: 202, or 200 with the request already pending",
+		Status:  http.StatusOK, AltStatus: []int{http.StatusAccepted}, Response: erasureRequest{}},
+	{ID: "getErasure", Method: "GET", Path: "/users/{id}/erasure", Tag: "users",
+		Summary: "Status of the latest erasure request", Status: http.StatusOK, Response: erasureRequest{}},
+	{ID: "cancelErasure", Method: "DELETE", Path: "/users/{id}/erasure", Tag: "users",
+		Summary: "Cancel a pending erasure request", Status: http.StatusOK, Response: erasureRequest{}},
+	{ID: "getPrivacyAudit", Method: "GET", Path: "/users/{id}/audit", Tag: "users",
+		Summary: "Privacy audit trail, kept after erasure", Status: http.StatusOK, Response: []auditEntry{}},
+	{ID: "getUserLoyalty", Method: "GET", Path: "/users/{id}/loyalty", Tag: "users",
+		Summary: "Loyalty tier, points, progress to the next tier and history",
+		Status:  http.StatusOK, Response: userLoyalty{}},
+	{ID: "getUserAffinities", Method: "GET", Path: "/users/{id}/affinities", Tag: "users",
+		Summary: "Strongest stores and store types from the user's redemptions",
+		Status:  http.StatusOK, Response: userAffinities{}},
+	{ID: "getUserLocation", Method: "GET", Path: "/users/{id}/location", Tag: "users",
+		Summary: "The user's newest location fix", Status: http.StatusOK, Response: userLocation{}},
+	{ID: "recordUserLocation", Method: "POST", Path: "/users/{id}/location", Tag: "users",
+		Summary: "Record a location fix; it becomes the user's current location",
+		Body:    locationRequest{}, Status: http.StatusCreated, Response: userLocation{}},
+
+	// Campaigns
+	{ID: "getNearbyCampaigns", Method: "GET", Path: "/users/{id}/nearby-campaigns", Tag: "campaigns",
+		Summary: "Campaigns near the user, personalized; best match first by default",
+		Params:  campaignListQuery, Status: http.StatusOK, Response: []campaignListItem{}, Headers: nextCursorHeaders},
+	{ID: "getDistanceSortedCampaigns", Method: "GET", Path: "/users/{user_id}/campaigns/distance-sorted", Tag: "campaigns",
+		Summary: "Nearest active campaigns for the user",
+		Params:  campaignListQuery, Status: http.StatusOK, Response: []campaignListItem{}, Headers: nextCursorHeaders},
+	{ID: "recordEngagement", Method: "POST", Path: "/users/{user_id}/campaigns/{campaign_id}/engage", Tag: "campaigns",
+		Summary: "Record a click or use of a campaign",
+		Body:    engagementRequest{}, Status: http.StatusOK, Response: engagementResponse{}},
+	{ID: "getCampaignSchedule", Method: "GET", Path: "/campaigns/{campaign_id}/schedule", Tag: "campaigns",
+		Summary: "Dayparts, blackout dates and whether the campaign is live now",
+		Status:  http.StatusOK, Response: campaignScheduleStatus{}},
+	{ID: "updateCampaignSchedule", Method: "PUT", Path: "/campaigns/{campaign_id}/schedule", Tag: "campaigns",
+		Summary: "Replace a campaign's dayparts and blackout dates; the timezone comes from the vendor profile",
+		Body:    models.CampaignSchedule{}, Status: http.StatusOK, Response: models.CampaignSchedule{}},
+	{ID: "getCampaignBudget", Method: "GET", Path: "/campaigns/{campaign_id}/budget", Tag: "campaigns",
+		Summary: "Budget limits and current usage", Status: http.StatusOK, Response: models.CampaignBudget{}},
+	{ID: "updateCampaignBudget", Method: "PUT", Path: "/campaigns/{campaign_id}/budget", Tag: "campaigns",
+		Summary: "Set max uses, max uses per day and max distinct users",
+		Body:    models.CampaignBudget{}, Status: http.StatusOK, Response: models.CampaignBudget{}},
+	{ID: "getCampaignVariants", Method: "GET", Path: "/campaigns/{campaign_id}/variants", Tag: "campaigns",
+		Summary: "List A/B test variants", Status: http.StatusOK, Response: []models.CampaignVariant{}},
+	{ID: "createCampaignVariant", Method: "POST", Path: "/campaigns/{campaign_id}/variants", Tag: "campaigns",
+		Summary: "Add a variant", Body: models.CampaignVariant{}, Status: http.StatusCreated,
+		Response: models.CampaignVariant{}},
+	{ID: "updateCampaignVariant", Method: "PUT", Path: "/campaigns/{campaign_id}/variants/{variant_id}", Tag: "campaigns",
+		Summary: "Update a variant's creative or weight", Body: models.CampaignVariant{}, Status: http.StatusOK,
+		Response: models.CampaignVariant{}},
+	{ID: "deleteCampaignVariant", Method: "DELETE", Path: "/campaigns/{campaign_id}/variants/{variant_id}", Tag: "campaigns",
+		Summary: "Remove a variant", Status: http.StatusNoContent},
+	{ID: "getCampaignLocations", Method: "GET", Path: "/campaigns/{campaign_id}/locations", Tag: "campaigns",
+		Summary: "List the store locations a campaign runs at", Status: http.StatusOK, Response: campaignLocations{}},
+	{ID: "updateCampaignLocations", Method: "PUT", Path: "/campaigns/{campaign_id}/locations", Tag: "campaigns",
+		Summary: "Run a campaign at several of its brand's locations",
+		Body:    campaignLocations{}, Status: http.StatusOK, Response: campaignLocations{}},
+
+	// Guests
+	{ID: "createGuestSession", Method: "POST", Path: "/guest/sessions", Tag: "guests",
+		Summary: "Start a guest session", Status: http.StatusCreated, Response: guestSessionResponse{}},
+	{ID: "getGuestNearbyCampaigns", Method: "GET", Path: "/guest/nearby-campaigns", Tag: "guests",
+		Summary: "Campaigns for everyone whose geofence covers the position, nearest first",
+		Params: append([]openapi.Parameter{
+			guestTokenParam,
+			openapi.RequiredQuery("lat", "number", "Latitude of the guest"),
+			openapi.RequiredQuery("lng", "number", "Longitude of the guest"),
+		}, campaignListQuery[1:7]...), // Only sorted by distance
+		Status: http.StatusOK, Response: []campaignListItem{}, Headers: nextCursorHeaders},
+	{ID: "recordGuestClick", Method: "POST", Path: "/guest/engagements/{campaign_id}", Tag: "guests",
+		Summary: "Record a guest's click", Params: []openapi.Parameter{guestTokenParam},
+		Body: guestClickRequest{}, Status: http.StatusOK, Response: engagementResponse{}},
+
+	// Vendors and brands
+	{ID: "getVendorAnalytics", Method: "GET", Path: "/vendors/{vendor_id}/analytics", Tag: "vendors",
+		Summary: "Engagements with the campaigns running at a store",
+		Status:  http.StatusOK, Response: vendorAnalytics{}},
+	{ID: "registerVendor", Method: "POST", Path: "/vendors/register", Tag: "vendors",
+		Summary: "Register a brand with one or more store locations",
+		Body:    models.Brand{}, Status: http.StatusCreated, Response: models.Brand{}},
+	{ID: "getVendor", Method: "GET", Path: "/vendors/{vendor_id}", Tag: "vendors",
+		Summary: "Get a store location's profile", Status: http.StatusOK, Response: models.Vendor{}},
+	{ID: "updateVendor", Method: "PUT", Path: "/vendors/{vendor_id}", Tag: "vendors",
+		Summary: "Update a store location's profile and coordinates",
+		Body:    models.Vendor{}, Status: http.StatusOK, Response: models.Vendor{}},
+	{ID: "updateVendorLoyalty", Method: "PUT", Path: "/vendors/{vendor_id}/loyalty", Tag: "vendors",
+		Summary: "Set the loyalty points multiplier for offers used at a store",
+		Body:    vendorLoyaltyRequest{}, Status: http.StatusOK, Response: vendorLoyalty{}},
+	{ID: "getBrand", Method: "GET", Path: "/brands/{brand_id}", Tag: "vendors",
+		Summary: "Get a brand profile with its store locations", Status: http.StatusOK, Response: models.Brand{}},
+	{ID: "updateBrand", Method: "PUT", Path: "/brands/{brand_id}", Tag: "vendors",
+		Summary: "Update a brand's display name, logo and contact details",
+		Body:    models.Brand{}, Status: http.StatusOK, Response: models.Brand{}},
+	{ID: "addBrandLocation", Method: "POST", Path: "/brands/{brand_id}/locations", Tag: "vendors",
+		Summary: "Add a store location to a brand",
+		Body:    models.Vendor{}, Status: http.StatusCreated, Response: models.Vendor{}},
+	{ID: "getBrandAnalytics", Method: "GET", Path: "/brands/{brand_id}/analytics", Tag: "vendors",
+		Summary: "Clicks, uses and conversion across a brand, per location and per campaign",
+		Status:  http.StatusOK, Response: brandAnalytics{}},
+
+	// Geocoding
+	{ID: "geocodeSearch", Method: "GET", Path: "/geocode/search", Tag: "geocoding",
+		Summary: "Look up an address",
+		Params: []openapi.Parameter{
+			openapi.RequiredQuery("q", "string", "Address"),
+			openapi.Query("limit", "integer", "Most results, 1-10 (default 5)"),
+		},
+		Status: http.StatusOK, Response: geocodeSearchResult{}},
+	{ID: "reverseGeocode", Method: "GET", Path: "/geocode/reverse", Tag: "geocoding",
+		Summary: "Nearest known address to a point",
+		Params: []openapi.Parameter{
+			openapi.RequiredQuery("lat", "number", ""),
+			openapi.RequiredQuery("lng", "number", ""),
+		},
+		Status: http.StatusOK, Response: geocode.Result{}},
+
+	// Admin
+	{ID: "getRetentionStats", Method: "GET", Path: "/admin/retention", Tag: "admin",
+		Summary: "Location retention policy and worker counters", Status: http.StatusOK, Response: retentionStatus{}},
+	{ID: "runRetention", Method: "POST", Path: "/admin/retention/run", Tag: "admin",
+		Summary: "Run location retention now",
+		Params:  []openapi.Parameter{openapi.Query("dry_run", "boolean", "Only report what would change")},
+		Status:  http.StatusOK, Response: retention.Report{}},
+	{ID: "recalculateLoyalty", Method: "POST", Path: "/admin/loyalty/recalculate", Tag: "admin",
+		Summary: "Recalculate every user's loyalty tier now", Status: http.StatusOK, Response: loyalty.Report{}},
+	{ID: "getJobStats", Method: "GET", Path: "/admin/jobs", Tag: "admin",
+		Summary: "Job runner settings and counters, and the queue per job type",
+		Status:  http.StatusOK, Response: jobStats{}},
+	{ID: "listDeadJobs", Method: "GET", Path: "/admin/jobs/dead", Tag: "admin",
+		Summary: "Jobs that ran out of attempts, newest first",
+		Params: []openapi.Parameter{
+			openapi.Query("type", "string", "Only this job type"),
+			openapi.Query("limit", "integer", "Most jobs, 1-500 (default 50)"),
+		},
+		Status: http.StatusOK, Response: []jobs.DeadJob{}},
+	{ID: "retryDeadJob", Method: "POST", Path: "/admin/jobs/dead/{job_id}/retry", Tag: "admin",
+		Summary: "Put a dead job back on the queue with fresh attempts", Status: http.StatusOK, Response: requeuedJob{}},
+
+	// Health
+	{ID: "getHealth", Method: "GET", Path: "/health", Tag: "operations",
+		Summary: "Same as /health/ready", Status: http.StatusOK, AltStatus: []int{http.StatusServiceUnavailable},
+		Response: health.Report{}},
+	{ID: "getLiveness", Method: "GET", Path: "/health/live", Tag: "operations",
+		Summary: "200 while the process is serving", Status: http.StatusOK, Response: liveness{}},
+	{ID: "getReadiness", Method: "GET", Path: "/health/ready", Tag: "operations",
+		Summary: "Dependency checks; 503 when any fails", Status: http.StatusOK,
+		AltStatus: []int{http.StatusServiceUnavailable}, Response: health.Report{}},
+}
+
+// rootEndpoints are the routes outside the versioned API
+var rootEndpoints = []openapi.Endpoint{
+	{ID: "getOpenAPI", Method: "GET", Path: "/api/openapi.json", Tag: "operations",
+		Summary: "This document", Status: http.StatusOK, Response: json.RawMessage{}},
+	{ID: "getMetrics", Method: "GET", Path: "/metrics", Tag: "operations",
+		Summary: "Prometheus metrics", Status: http.StatusOK, Response: "", ContentType: openapi.Text},
+	{ID: "userWebSocket", Method: "GET", Path: "/ws/user/{user_id}", Tag: "operations",
+		Summary: "Campaign updates pushed to a user", WebSocket: true},
+	{ID: "vendorWebSocket", Method: "GET", Path: "/ws/vendor/{vendor_id}", Tag: "operations",
+		Summary: "Live analytics pushed to a vendor", WebSocket: true},
+}
+
+// buildOpenAPI documents apiEndpoints under apiPrefix, and rootEndpoints
+func buildOpenAPI() (*openapi.Document, error) {
+	endpoints := make([]openapi.Endpoint, 0, len(apiEndpoints)+len(rootEndpoints))
+	for _, e := range apiEndpoints {
+		e.Path = apiPrefix + e.Path
+		endpoints = append(endpoints, e)
+	}
+	endpoints = append(endpoints, rootEndpoints...)
+	return openapi.Build(openAPIOptions, endpoints)
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIJSON []byte
+	openAPIErr  error
+)
+
+// openAPIHandler serves the OpenAPI document: GET /api/openapi.json
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() {
+		var doc *openapi.Document
+		if doc, openAPIErr = buildOpenAPI(); openAPIErr == nil {
+			openAPIJSON, openAPIErr = json.MarshalIndent(doc, "", "  ")
+		}
+	})
+	if openAPIErr != nil {
+		errorf(r, "Error building OpenAPI document: %v", openAPIErr)
+		writeInternalError(w, r, "Failed to build API description")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIJSON)
+}
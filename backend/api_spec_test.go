@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// TestOpenAPIResponses checks that every JSON endpoint's handler encodes
+// the Response type apiEndpoints declares for it, and nothing else besides
+// the error envelope. Handlers are found through newRouter and read from
+// the package source; helpers they pass their http.ResponseWriter to count
+// as part of the handler.
+func TestOpenAPIResponses(t *testing.T) {
+	info, funcs := checkPackageSource(t)
+
+	handlers := map[string]string{} // "GET /api/v1/users/{id}" -> "getUserHandler"
+	err := newRouter().Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		h, ok := route.GetHandler().(http.HandlerFunc)
+		if !ok {
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, _ := route.GetMethods()
+		name := runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+		for _, m := range methods {
+			handlers[m+" "+path] = name[strings.LastIndex(name, ".")+1:]
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errorType := typeName(reflect.TypeOf(openAPIOptions.Error))
+	for _, e := range apiEndpoints {
+		if e.ContentType != "" {
+			continue // Not JSON
+		}
+		op := e.Method + " " + apiPrefix + e.Path
+		name, ok := handlers[op]
+		if !ok {
+			t.Errorf("%s: no handler routed", op)
+			continue
+		}
+		decl, ok := funcs[name]
+		if !ok {
+			t.Errorf("%s: %s not found in the package source", op, name)
+			continue
+		}
+
+		encoded := map[string]bool{}
+		collectEncoded(info, funcs, decl, encoded, map[string]bool{})
+		delete(encoded, errorType)
+
+		want := map[string]bool{}
+		if e.Response != nil {
+			want[typeName(reflect.TypeOf(e.Response))] = true
+		}
+		if !reflect.DeepEqual(encoded, want) {
+			t.Errorf("%s: %s encodes %v, apiEndpoints declares %v", op, name, sortedKeys(encoded), sortedKeys(want))
+		}
+	}
+}
+
+// checkPackageSource type-checks this package's non-test files and returns
+// its functions by name
+func checkPackageSource(t *testing.T) (*types.Info, map[string]*ast.FuncDecl) {
+	t.Helper()
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseDir(fset, ".", func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files []*ast.File
+	funcs := map[string]*ast.FuncDecl{}
+	for _, f := range parsed["main"].Files {
+		files = append(files, f)
+		for _, d := range f.Decls {
+			if fd, ok := d.(*ast.FuncDecl); ok && fd.Recv == nil {
+				funcs[fd.Name.Name] = fd
+			}
+		}
+	}
+
+	// Imports are read from their compiled export data, which go list
+	// finds (building them if needed)
+	out, err := exec.Command("go", "list", "-export", "-deps",
+		"-f", "{{if .Export}}{{.ImportPath}}={{.Export}}{{end}}", ".").Output()
+	if err != nil {
+		t.Fatalf("go list: %v", err)
+	}
+	exports := map[string]string{}
+	for _, line := range strings.Fields(string(out)) {
+		if path, file, ok := strings.Cut(line, "="); ok {
+			exports[path] = file
+		}
+	}
+	lookup := func(path string) (io.ReadCloser, error) {
+		file, ok := exports[path]
+		if !ok {
+			return nil, fmt.Errorf("no export data for %s", path)
+		}
+		return os.Open(file)
+	}
+
+	info := &types.Info{Types: map[ast.Expr]types.TypeAndValue{}, Uses: map[*ast.Ident]types.Object{}}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "gc", lookup)}
+	if _, err := conf.Check("main", fset, files, info); err != nil {
+		t.Fatal(err)
+	}
+	return info, funcs
+}
+
+// collectEncoded adds the types fn encodes with json.NewEncoder(w).Encode,
+// following calls to package functions that take an http.ResponseWriter
+func collectEncoded(info *types.Info, funcs map[string]*ast.FuncDecl, fn *ast.FuncDecl, encoded, seen map[string]bool) {
+	if seen[fn.Name.Name] {
+		return
+	}
+	seen[fn.Name.Name] = true
+
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if isEncoderEncode(info, call) && len(call.Args) == 1 {
+			typ := info.Types[call.Args[0]].Type
+			for {
+				p, ok := typ.(*types.Pointer)
+				if !ok {
+					break
+				}
+				typ = p.Elem()
+			}
+			encoded[types.TypeString(typ, typeQualifier)] = true
+			return true
+		}
+		if id, ok := call.Fun.(*ast.Ident); ok {
+			if callee, ok := funcs[id.Name]; ok && takesResponseWriter(info, id) {
+				collectEncoded(info, funcs, callee, encoded, seen)
+			}
+		}
+		return true
+	})
+}
+
+// isEncoderEncode reports whether call is json.NewEncoder(...).Encode(...)
+func isEncoderEncode(info *types.Info, call *ast.CallExpr) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Encode" {
+		return false
+	}
+	inner, ok := sel.X.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	fsel, ok := inner.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := fsel.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	pn, ok := info.Uses[pkg].(*types.PkgName)
+	return ok && pn.Imported().Path() == "encoding/json" && fsel.Sel.Name == "NewEncoder"
+}
+
+func takesResponseWriter(info *types.Info, id *ast.Ident) bool {
+	fn, ok := info.Uses[id].(*types.Func)
+	if !ok {
+		return false
+	}
+	params := fn.Type().(*types.Signature).Params()
+	for i := 0; i < params.Len(); i++ {
+		if types.TypeString(params.At(i).Type(), typeQualifier) == "http.ResponseWriter" {
+			return true
+		}
+	}
+	return false
+}
+
+// typeQualifier names types by package name, as reflect does
+func typeQualifier(p *types.Package) string { return p.Name() }
+
+// typeName is the go/types spelling of a reflect type, pointers dropped
+// since they encode the same
+func typeName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	name := t.String()
+	name = strings.ReplaceAll(name, "[]uint8", "[]byte")
+	return strings.ReplaceAll(name, "interface {}", "interface{}")
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// API versions: the major version is part of the path, /api/v1/users/{id}.
+// A new major version is mounted from the same route table
+// (registerAPIRoutes); handlers whose responses change between versions
+// branch on requestAPIVersion. Additive changes (new fields, new routes)
+// don't need a new version. Every versioned response carries an API-Version
+// header.
+//
+// The unversioned /api/... paths are the API as shipped before versioning
+// (version 0). They answer like v1 except that errors stay plain text, and
+// carry Deprecation and Link headers pointing at the /api/v1 equivalent.
+// Paths under an unsupported version (/api/v9/...) are answered 404
+// unsupported_api_version, listing the supported versions.
+
+const (
+	legacyAPIVersion  = 0
+	currentAPIVersion = 1
+)
+
+// supportedAPIVersions are mounted under /api/v<n>
+var supportedAPIVersions = []int{currentAPIVersion}
+
+const apiVersionHeader = "API-Version"
+
+var versionedAPIPath = regexp.MustCompile(`^/api/v(\d+)(/|$)`)
+
+type apiVersionKey struct{}
+
+// requestAPIVersion is the API version r was routed to. Requests outside
+// /api (and unmatched ones) get the current version.
+func requestAPIVersion(r *http.Request) int {
+	if v, ok := r.Context().Value(apiVersionKey{}).(int); ok {
+		return v
+	}
+	return currentAPIVersion
+}
+
+// mountAPI serves the routes added by register under /api/v<n> for every
+// supported version, and under the legacy /api prefix
+func mountAPI(r *mux.Router, register func(api *mux.Router)) {
+	for _, version := range supportedAPIVersions {
+		api := r.PathPrefix(fmt.Sprintf("/api/v%d", version)).Subrouter()
+		api.Use(withAPIVersion(version))
+		register(api)
+	}
+
+	// Versioned paths never fall through to the legacy routes
+	legacy := r.MatcherFunc(func(req *http.Request, _ *mux.RouteMatch) bool {
+		return !versionedAPIPath.MatchString(req.URL.Path)
+	}).PathPrefix("/api").Subrouter()
+	legacy.Use(withAPIVersion(legacyAPIVersion))
+	register(legacy)
+
+	r.NotFoundHandler = apiNotFoundHandler(r)
+	r.MethodNotAllowedHandler = r.NotFoundHandler
+}
+
+// apiNotFoundHandler answers requests no route of r matched: 405 if the
+// path is routed for other methods, otherwise 404. mux can't tell these
+// apart inside a subrouter, whose routes all start with the subrouter's
+// prefix matcher: matching it forgets an earlier route's method mismatch.
+func apiNotFoundHandler(r *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req = withPathAPIVersion(req)
+		if allowed := allowedMethods(r, req); len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			writeError(w, req, http.StatusMethodNotAllowed, codeMethodNotAllowed, req.Method+" is not allowed on "+req.URL.Path)
+			return
+		}
+		if m := versionedAPIPath.FindStringSubmatch(req.URL.Path); m != nil && !isSupportedAPIVersion(m[1]) {
+			writeError(w, req, http.StatusNotFound, codeUnsupportedVersion,
+				fmt.Sprintf("API version %s is not supported; use one of: %s", m[1], supportedVersionList()))
+			return
+		}
+		writeError(w, req, http.StatusNotFound, codeRouteNotFound, "No such endpoint: "+req.Method+" "+req.URL.Path)
+	})
+}
+
+// allowedMethods lists the methods r routes req's path for
+func allowedMethods(r *mux.Router, req *http.Request) []string {
+	var allowed []string
+	seen := map[string]bool{}
+	r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil || route.GetHandler() == nil {
+			return nil
+		}
+		for _, method := range methods {
+			probe := req.Clone(req.Context())
+			probe.Method = method
+			if !seen[method] && route.Match(probe, &mux.RouteMatch{}) {
+				seen[method] = true
+				allowed = append(allowed, method)
+			}
+		}
+		return nil
+	})
+	return allowed
+}
+
+// withAPIVersion is subrouter middleware recording the version in the
+// request and announcing it in the response headers
+func withAPIVersion(version int) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if version == legacyAPIVersion {
+				successor := fmt.Sprintf("/api/v%d", currentAPIVersion) + strings.TrimPrefix(r.URL.Path, "/api")
+				w.Header().Set("Deprecation", "true")
+				w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+			} else {
+				w.Header().Set(apiVersionHeader, strconv.Itoa(version))
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, version)))
+		})
+	}
+}
+
+// withPathAPIVersion works out the version of an unmatched request from its
+// path, so the error is answered in that version's format
+func withPathAPIVersion(r *http.Request) *http.Request {
+	version := currentAPIVersion
+	if versionedAPIPath.FindStringSubmatch(r.URL.Path) == nil && strings.HasPrefix(r.URL.Path, "/api/") {
+		version = legacyAPIVersion
+	}
+	return r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, version))
+}
+
+func isSupportedAPIVersion(s string) bool {
+	for _, v := range supportedAPIVersions {
+		if strconv.Itoa(v) == s {
+			return true
+		}
+	}
+	return false
+}
+
+func supportedVersionList() string {
+	names := make([]string, len(supportedAPIVersions))
+	for i, v := range supportedAPIVersions {
+		names[i] = fmt.Sprintf("v%d", v)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouterErrors(t *testing.T) {
+	router := newRouter()
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+		code         string // Empty for a plain-text legacy error
+	}{
+		{"GET", "/api/v1/no-such-thing", http.StatusNotFound, codeRouteNotFound},
+		{"GET", "/api/v1", http.StatusNotFound, codeRouteNotFound},
+		{"PATCH", "/api/v1/users/U0001", http.StatusMethodNotAllowed, codeMethodNotAllowed},
+		{"POST", "/api/v1/vendors/V0001/analytics", http.StatusMethodNotAllowed, codeMethodNotAllowed},
+		{"GET", "/api/v9/users/U0001", http.StatusNotFound, codeUnsupportedVersion},
+		{"GET", "/api/v0/users/U0001", http.StatusNotFound, codeUnsupportedVersion},
+		{"GET", "/api/no-such-thing", http.StatusNotFound, ""},
+		{"PATCH", "/api/users/U0001", http.StatusMethodNotAllowed, ""},
+		{"GET", "/no-such-thing", http.StatusNotFound, codeRouteNotFound},
+		{"POST", "/metrics", http.StatusMethodNotAllowed, codeMethodNotAllowed},
+	} {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+
+			if w.Code != tc.status {
+				t.Fatalf("status = %d, want %d; body %q", w.Code, tc.status, w.Body.String())
+			}
+			if tc.status == http.StatusMethodNotAllowed && w.Header().Get("Allow") == "" {
+				t.Error("405 without an Allow header")
+			}
+			if tc.code == "" {
+				if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+					t.Errorf("legacy error Content-Type = %q, want text/plain", ct)
+				}
+				return
+			}
+			var envelope apiErrorEnvelope
+			if err := json.Unmarshal(w.Body.Bytes(), &envelope); err != nil {
+				t.Fatalf("body %q is not an error envelope: %v", w.Body.String(), err)
+			}
+			if envelope.Error.Code != tc.code || envelope.Error.Status != tc.status {
+				t.Errorf("error = %d %s, want %d %s", envelope.Error.Status, envelope.Error.Code, tc.status, tc.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"streetsavvy-backend/config"
+	"streetsavvy-backend/jobs"
+
+	"github.com/gorilla/mux"
+)
+
+// Background jobs run from the Postgres queue in package jobs instead of
+// bare goroutines, so they are bounded, retried and visible to operators.
+// Each job type is declared next to the code that enqueues it and
+// registered here.
+
+const (
+	defaultDeadJobsLimit = 50
+	maxDeadJobsLimit     = 500
+)
+
+// jobRunner is created in main from JOBS_* (see config/jobs.go)
+var jobRunner *jobs.Runner
+
+// newJobRunner creates the runner with every job type this server handles
+func newJobRunner(opts jobs.Options) *jobs.Runner {
+	runner := jobs.NewRunner(config.DB, opts)
+	jobs.Handle(runner, annotateLocationJob, annotateLocationEvent)
+	return runner
+}
+
+// jobStats is the runner's settings and counters and the queue per job type
+type jobStats struct {
+	Runner jobRunnerStats    `json:"runner"`
+	Queues []jobs.QueueStats `json:"queues"`
+}
+
+type jobRunnerStats struct {
+	Concurrency    int           `json:"concurrency"`
+	PollIntervalMs int64         `json:"poll_interval_ms"`
+	RetryBaseMs    int64         `json:"retry_base_ms"`
+	RetryMaxMs     int64         `json:"retry_max_ms"`
+	TimeoutMs      int64         `json:"timeout_ms"`
+	Counters       jobs.Counters `json:"counters"`
+}
+
+// requeuedJob answers a dead job's retry
+type requeuedJob struct {
+	JobID   int64  `json:"job_id"`
+	Message string `json:"message"`
+}
+
+// getJobStatsHandler shows the runner's settings and counters and the
+// queue per job type: GET /api/admin/jobs
+func getJobStatsHandler(w http.ResponseWriter, r *http.Request) {
+	opts := jobRunner.Options()
+	queues, err := jobs.Stats(config.DB, opts.LockTimeout)
+	if err != nil {
+		errorf(r, "Error loading job queue stats: %v", err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+
+	response := jobStats{
+		Runner: jobRunnerStats{
+			Concurrency:    opts.Concurrency,
+			PollIntervalMs: opts.PollInterval.Milliseconds(),
+			RetryBaseMs:    opts.RetryBase.Milliseconds(),
+			RetryMaxMs:     opts.RetryMax.Milliseconds(),
+			TimeoutMs:      opts.JobTimeout.Milliseconds(),
+			Counters:       jobRunner.Counters(),
+		},
+		Queues: queues,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// listDeadJobsHandler lists jobs that ran out of attempts, newest first:
+// GET /api/admin/jobs/dead?type=&limit=
+func listDeadJobsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := defaultDeadJobsLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxDeadJobsLimit {
+			writeValidationError(w, r, invalidField("limit", "limit must be between 1 and 500"))
+			return
+		}
+		limit = n
+	}
+
+	dead, err := jobs.ListDead(config.DB, r.URL.Query().Get("type"), limit)
+	if err != nil {
+		errorf(r, "Error listing dead jobs: %v", err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dead)
+}
+
+// retryDeadJobHandler puts a dead job back on the queue with a fresh set of
+// attempts: POST /api/admin/jobs/dead/{job_id}/retry
+func retryDeadJobHandler(w http.ResponseWriter, r *http.Request) {
+	jobID, err := strconv.ParseInt(mux.Vars(r)["job_id"], 10, 64)
+	if err != nil {
+		writeValidationError(w, r, invalidField("job_id", "Invalid job ID"))
+		return
+	}
+
+	err = jobs.Retry(config.DB, jobID)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeJobNotFound, "Dead job not found")
+		return
+	}
+	if err != nil {
+		errorf(r, "Error retrying job %d: %v", jobID, err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+
+	logf(r, "Requeued dead job %d", jobID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(requeuedJob{JobID: jobID, Message: "Job requeued"})
+}
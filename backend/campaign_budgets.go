@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"streetsavvy-backend/config"
+	"streetsavvy-backend/models"
+
+	"github.com/gorilla/mux"
+)
+
+// Campaign budgets: lifetime, daily and distinct-user caps on redemptions.
+// The lifetime cap pauses the campaign (enabled = false); the daily cap
+// pauses the rest of the vendor-local day via campaign_budget_pauses.
+// The distinct-user cap only turns away users who haven't redeemed yet, so
+// it never pauses the campaign: campaign_open_to_user() hides it from new
+// users, and the vendor is notified when it's reached.
+
+// Budget exhaustion reasons, stored in campaign_budgets.exhausted_reason
+// and sent to the vendor
+const (
+	budgetReasonMaxUses          = "max_uses"
+	budgetReasonMaxUsesPerDay    = "max_uses_per_day"
+	budgetReasonMaxDistinctUsers = "max_distinct_users"
+)
+
+// errBudgetExhausted is returned when a redemption would exceed a budget
+var errBudgetExhausted = errors.New("campaign budget exhausted")
+
+// errAlreadyUsed is returned when the user already redeemed the campaign
+// today (the vendor-local day)
+var errAlreadyUsed = errors.New("campaign already used today")
+
+// budgetUsage is a campaign's consumption at the moment of a redemption
+type budgetUsage struct {
+	vendorID      string
+	uses          int
+	usesToday     int
+	distinctUsers int
+	userHasUsed   bool
+	userUsedToday bool
+}
+
+// recordUsedEngagement inserts a "used" engagement while holding the
+// campaign's row lock, so concurrent redemptions can't overshoot the budget
+// or redeem twice in a day. If this redemption exhausts a budget the
+// campaign is paused and the vendor notified. Returns errAlreadyUsed for a
+// second use today, errBudgetExhausted if the budget was already spent and
+// sql.ErrNoRows for an unknown campaign.
+func recordUsedEngagement(ctx context.Context, e engagementRecord) error {
+	tx, err := config.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The campaign row lock queues up its redemptions. NO KEY UPDATE still
+	// lets clicks, which reference the campaign, be inserted meanwhile.
+	var hasBudget bool
+	var budget models.CampaignBudget
+	err = tx.QueryRow(`
+		SELECT b.campaign_id IS NOT NULL, b.max_uses, b.max_uses_per_day, b.max_distinct_users
+		FROM campaigns c
+		LEFT JOIN campaign_budgets b ON b.campaign_id = c.campaign_id
+		WHERE c.campaign_id = $1
+		FOR NO KEY UPDATE OF c`, e.CampaignID).Scan(
+		&hasBudget, &budget.MaxUses, &budget.MaxUsesPerDay, &budget.MaxDistinctUsers)
+	if err != nil {
+		return err
+	}
+
+	usage, err := loadBudgetUsage(tx, e.CampaignID, e.UserID)
+	if err != nil {
+		return err
+	}
+	if usage.userUsedToday {
+		return errAlreadyUsed
+	}
+	if !hasBudget {
+		// No budget configured: nothing to enforce
+		if err = insertUsedEngagement(ctx, tx, e); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	// Already over budget (e.g. the pause raced with a cached campaign list)
+	if reason := budgetExceeded(budget, usage, 0); reason != "" {
+		// Only new users are turned away at the distinct-user cap
+		if reason == budgetReasonMaxDistinctUsers {
+			return errBudgetExhausted
+		}
+		if err = pauseCampaignForBudget(tx, e.CampaignID, reason); err != nil {
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+		log.Printf("Campaign %s paused: %s budget exhausted", e.CampaignID, reason)
+		notifyVendorBudgetExhausted(ctx, usage.vendorID, e.CampaignID, reason)
+		return errBudgetExhausted
+	}
+
+	if err = insertUsedEngagement(ctx, tx, e); err != nil {
+		return err
+	}
+
+	// Did this redemption use up the budget (or close it to new users)?
+	reason := budgetExceeded(budget, usage, 1)
+	if reason != "" {
+		if err = pauseCampaignForBudget(tx, e.CampaignID, reason); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	if reason == budgetReasonMaxDistinctUsers {
+		log.Printf("Campaign %s closed to new users: %s budget exhausted", e.CampaignID, reason)
+		notifyVendorBudgetExhausted(ctx, usage.vendorID, e.CampaignID, reason)
+	} else if reason != "" {
+		log.Printf("Campaign %s paused: %s budget exhausted", e.CampaignID, reason)
+		notifyVendorBudgetExhausted(ctx, usage.vendorID, e.CampaignID, reason)
+	}
+	return nil
+}
+
+// loadBudgetUsage counts a campaign's redemptions, and whether userID is
+// among them; "today" is the vendor-local day, matching how schedules are
+// evaluated
+func loadBudgetUsage(q queryRower, campaignID, userID string) (budgetUsage, error) {
+	var u budgetUsage
+	err := q.QueryRow(`
+		SELECT
+			c.vendor_id,
+			COUNT(e.user_id),
+			COUNT(e.user_id) FILTER (
+				WHERE (e.engagement_time::timestamptz AT TIME ZONE v.timezone)::date
+					= (NOW() AT TIME ZONE v.timezone)::date
+			),
+			COUNT(DISTINCT e.user_id),
+			COUNT(e.user_id) FILTER (WHERE e.user_id = $2) > 0,
+			COUNT(e.user_id) FILTER (
+				WHERE e.user_id = $2
+				  AND (e.engagement_time::timestamptz AT TIME ZONE v.timezone)::date
+					= (NOW() AT TIME ZONE v.timezone)::date
+			) > 0
+		FROM campaigns c
+		JOIN vendors v ON c.vendor_id = v.vendor_id
+		LEFT JOIN campaign_user_engagements e
+			ON e.campaign_id = c.campaign_id AND e.engagement_type = 'used'
+		WHERE c.campaign_id = $1
+		GROUP BY c.vendor_id`, campaignID, userID).Scan(
+		&u.vendorID, &u.uses, &u.usesToday, &u.distinctUsers, &u.userHasUsed, &u.userUsedToday)
+	return u, err
+}
+
+// budgetExceeded reports which limit is reached once `pending` more uses by
+// the current user are counted, or "" if the budget still has room. Only
+// users who haven't redeemed yet count towards (or are stopped by) the
+// distinct-user cap, and it's reported last since it doesn't pause.
+func budgetExceeded(b models.CampaignBudget, u budgetUsage, pending int) string {
+	if b.MaxUses != nil && u.uses+pending >= *b.MaxUses {
+		return budgetReasonMaxUses
+	}
+	if b.MaxUsesPerDay != nil && u.usesToday+pending >= *b.MaxUsesPerDay {
+		return budgetReasonMaxUsesPerDay
+	}
+	if b.MaxDistinctUsers != nil && !u.userHasUsed && u.distinctUsers+pending >= *b.MaxDistinctUsers {
+		return budgetReasonMaxDistinctUsers
+	}
+	return ""
+}
+
+// pauseCampaignForBudget stops a campaign from being served: the lifetime
+// limit disables it, the daily limit pauses the rest of today. The
+// distinct-user limit leaves it running for users who already redeemed.
+func pauseCampaignForBudget(tx *sql.Tx, campaignID, reason string) error {
+	if reason == budgetReasonMaxDistinctUsers {
+		return nil
+	}
+	if reason == budgetReasonMaxUsesPerDay {
+		_, err := tx.Exec(`
+			INSERT INTO campaign_budget_pauses (campaign_id, paused_date)
+			SELECT c.campaign_id, (NOW() AT TIME ZONE v.timezone)::date
+			FROM campaigns c
+			JOIN vendors v ON c.vendor_id = v.vendor_id
+			WHERE c.campaign_id = $1
+			ON CONFLICT (campaign_id, paused_date) DO NOTHING`,
+			campaignID)
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE campaigns SET enabled = false WHERE campaign_id = $1`, campaignID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		UPDATE campaign_budgets
+		SET exhausted_at = NOW(), exhausted_reason = $2
+		WHERE campaign_id = $1 AND exhausted_at IS NULL`,
+		campaignID, reason)
+	return err
+}
+
+// notifyVendorBudgetExhausted tells a connected vendor that a campaign was
+// paused, or closed to new users
+func notifyVendorBudgetExhausted(ctx context.Context, vendorID, campaignID, reason string) {
+	connManager.mutex.RLock()
+	conn, exists := connManager.vendorConnections[vendorID]
+	connManager.mutex.RUnlock()
+
+	if !exists {
+		return
+	}
+
+	msg := WSMessage{
+		Type:     "budget_exhausted",
+		VendorID: vendorID,
+		Data: map[string]interface{}{
+			"campaign_id": campaignID,
+			"reason":      reason,
+			"timestamp":   time.Now().Format(time.RFC3339),
+		},
+	}
+
+	if err := writeWS(ctx, conn, wsClientVendor, msg); err != nil {
+		log.Printf("Error sending budget notification to vendor %s: %v", vendorID, err)
+	}
+}
+
+// getCampaignBudgetHandler returns a campaign's limits and current consumption
+func getCampaignBudgetHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	campaignID := vars["campaign_id"]
+
+	budget, err := loadCampaignBudget(r.Context(), campaignID)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeCampaignNotFound, "Campaign not found")
+		return
+	}
+	if err != nil {
+		errorf(r, "Error loading budget for campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Failed to load campaign budget")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(budget)
+}
+
+// updateCampaignBudgetHandler sets a campaign's limits. A campaign paused by
+// an exhausted budget is resumed; the next redemption re-checks the new limits.
+func updateCampaignBudgetHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	campaignID := vars["campaign_id"]
+
+	var req models.CampaignBudget
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorf(r, "Error parsing budget request: %v", err)
+		writeError(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+
+	limits := []struct {
+		field string
+		value *int
+	}{{"max_uses", req.MaxUses}, {"max_uses_per_day", req.MaxUsesPerDay}, {"max_distinct_users", req.MaxDistinctUsers}}
+	for _, limit := range limits {
+		if limit.value != nil && *limit.value <= 0 {
+			writeValidationError(w, r, invalidField(limit.field, "Budget limits must be positive or null"))
+			return
+		}
+	}
+
+	tx, err := config.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorf(r, "Error starting budget transaction: %v", err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+	defer tx.Rollback()
+
+	var wasExhausted bool
+	err = tx.QueryRow(`
+		SELECT COALESCE(b.exhausted_at IS NOT NULL, false)
+		FROM campaigns c
+		LEFT JOIN campaign_budgets b ON b.campaign_id = c.campaign_id
+		WHERE c.campaign_id = $1
+		FOR UPDATE OF c`, campaignID).Scan(&wasExhausted)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeCampaignNotFound, "Campaign not found")
+		return
+	}
+	if err != nil {
+		errorf(r, "Error locking campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO campaign_budgets (campaign_id, max_uses, max_uses_per_day, max_distinct_users, updated_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (campaign_id) DO UPDATE SET
+			max_uses = EXCLUDED.max_uses,
+			max_uses_per_day = EXCLUDED.max_uses_per_day,
+			max_distinct_users = EXCLUDED.max_distinct_users,
+			exhausted_at = NULL,
+			exhausted_reason = NULL,
+			updated_at = NOW()`,
+		campaignID, req.MaxUses, req.MaxUsesPerDay, req.MaxDistinctUsers)
+	if err != nil {
+		errorf(r, "Error saving budget for campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Failed to update campaign budget")
+		return
+	}
+
+	// Resume a campaign that the budget (not the vendor) switched off
+	if wasExhausted {
+		if _, err = tx.Exec(`UPDATE campaigns SET enabled = true WHERE campaign_id = $1`, campaignID); err != nil {
+			errorf(r, "Error resuming campaign %s: %v", campaignID, err)
+			writeInternalError(w, r, "Failed to update campaign budget")
+			return
+		}
+	}
+
+	// Lift today's daily-cap pause; the cap is re-checked on the next use
+	_, err = tx.Exec(`DELETE FROM campaign_budget_pauses WHERE campaign_id = $1`, campaignID)
+	if err != nil {
+		errorf(r, "Error clearing budget pause for campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Failed to update campaign budget")
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		errorf(r, "Error committing budget for campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Failed to update campaign budget")
+		return
+	}
+
+	logf(r, "Updated budget for campaign %s", campaignID)
+
+	budget, err := loadCampaignBudget(r.Context(), campaignID)
+	if err != nil {
+		errorf(r, "Error reloading budget for campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Failed to load campaign budget")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(budget)
+}
+
+// loadCampaignBudget reads limits (all nil if none are set) and current
+// usage. Returns sql.ErrNoRows for an unknown campaign.
+func loadCampaignBudget(ctx context.Context, campaignID string) (*models.CampaignBudget, error) {
+	budget := &models.CampaignBudget{CampaignID: campaignID}
+
+	usage, err := loadBudgetUsage(config.DB, campaignID, "")
+	if err != nil {
+		return nil, err
+	}
+	budget.Uses = usage.uses
+	budget.UsesToday = usage.usesToday
+	budget.DistinctUsers = usage.distinctUsers
+
+	err = config.DB.QueryRowContext(ctx, `
+		SELECT max_uses, max_uses_per_day, max_distinct_users, exhausted_at, exhausted_reason
+		FROM campaign_budgets
+		WHERE campaign_id = $1`, campaignID).Scan(
+		&budget.MaxUses, &budget.MaxUsesPerDay, &budget.MaxDistinctUsers,
+		&budget.ExhaustedAt, &budget.ExhaustedReason)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	return budget, nil
+}
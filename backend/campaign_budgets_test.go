@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"streetsavvy-backend/models"
+)
+
+func TestBudgetExceeded(t *testing.T) {
+	n := func(v int) *int { return &v }
+
+	for _, tc := range []struct {
+		name    string
+		budget  models.CampaignBudget
+		usage   budgetUsage
+		pending int
+		want    string
+	}{
+		{"no limits", models.CampaignBudget{}, budgetUsage{uses: 100, distinctUsers: 50}, 1, ""},
+		{"room left", models.CampaignBudget{MaxUses: n(10)}, budgetUsage{uses: 8}, 1, ""},
+		{"last use", models.CampaignBudget{MaxUses: n(10)}, budgetUsage{uses: 9}, 1, budgetReasonMaxUses},
+		{"already spent", models.CampaignBudget{MaxUses: n(10)}, budgetUsage{uses: 10}, 0, budgetReasonMaxUses},
+		{"daily room left", models.CampaignBudget{MaxUsesPerDay: n(3)}, budgetUsage{uses: 40, usesToday: 1}, 1, ""},
+		{"daily last use", models.CampaignBudget{MaxUsesPerDay: n(3)}, budgetUsage{usesToday: 2}, 1, budgetReasonMaxUsesPerDay},
+		{"daily spent", models.CampaignBudget{MaxUsesPerDay: n(3)}, budgetUsage{usesToday: 3}, 0, budgetReasonMaxUsesPerDay},
+		{"lifetime before daily", models.CampaignBudget{MaxUses: n(5), MaxUsesPerDay: n(5)},
+			budgetUsage{uses: 4, usesToday: 4}, 1, budgetReasonMaxUses},
+
+		{"new user under the cap", models.CampaignBudget{MaxDistinctUsers: n(3)},
+			budgetUsage{distinctUsers: 2}, 0, ""},
+		{"new user at the cap", models.CampaignBudget{MaxDistinctUsers: n(3)},
+			budgetUsage{distinctUsers: 3}, 0, budgetReasonMaxDistinctUsers},
+		{"returning user at the cap", models.CampaignBudget{MaxDistinctUsers: n(3)},
+			budgetUsage{distinctUsers: 3, userHasUsed: true}, 0, ""},
+		{"new user reaches the cap", models.CampaignBudget{MaxDistinctUsers: n(3)},
+			budgetUsage{distinctUsers: 2}, 1, budgetReasonMaxDistinctUsers},
+		{"returning user doesn't reach the cap", models.CampaignBudget{MaxDistinctUsers: n(3)},
+			budgetUsage{distinctUsers: 2, userHasUsed: true}, 1, ""},
+		{"daily before distinct", models.CampaignBudget{MaxUsesPerDay: n(3), MaxDistinctUsers: n(3)},
+			budgetUsage{usesToday: 2, distinctUsers: 2}, 1, budgetReasonMaxUsesPerDay},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := budgetExceeded(tc.budget, tc.usage, tc.pending); got != tc.want {
+				t.Errorf("budgetExceeded = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
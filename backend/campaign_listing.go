@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"streetsavvy-backend/ranking"
+)
+
+// Paging and filtering shared by the campaign list endpoints
+// (/nearby-campaigns and /campaigns/distance-sorted).
+//
+// Both orders page with a keyset cursor so results don't shift or repeat
+// while scrolling: distance order on (distance_meters, campaign_id),
+// relevance order on (score, distance_meters, campaign_id). Relevance order
+// only ranks the rankPoolSize nearest matches (CAMPAIGN_RANK_POOL); farther
+// campaigns are reachable with sort=distance.
+// The next page's cursor is returned in the X-Next-Cursor header, keeping
+// the response body the plain JSON array existing clients expect.
+
+// Page sizes are set in main from CAMPAIGN_* (see config.CampaignConfig)
+var (
+	defaultCampaignPageSize = 50
+	maxCampaignPageSize     = 100
+	rankPoolSize            = 500 // Nearest candidates considered for relevance order
+)
+
+const (
+	expiringSoonDays = 3 // ?expiring_soon=true: ends within this many days
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+// campaignCursor marks where the previous page ended
+type campaignCursor struct {
+	Score          *float64 `json:"s,omitempty"` // Relevance order only
+	DistanceMeters float64  `json:"d,omitempty"`
+	CampaignID     string   `json:"id,omitempty"`
+}
+
+func (c campaignCursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCampaignCursor(s string) (*campaignCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c campaignCursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, err
+	}
+	if c.CampaignID == "" {
+		return nil, fmt.Errorf("cursor without a campaign")
+	}
+	return &c, nil
+}
+
+// after reports whether r comes after the cursor in relevance order: higher
+// scores first, then nearer, then by campaign ID (as ranking.Rank sorts)
+func (c campaignCursor) after(r ranking.Ranked) bool {
+	if r.Score != *c.Score {
+		return r.Score < *c.Score
+	}
+	if r.DistanceMeters != c.DistanceMeters {
+		return r.DistanceMeters > c.DistanceMeters
+	}
+	return r.CampaignID > c.CampaignID
+}
+
+// campaignListItem is one campaign in a campaign list, at the nearest of
+// the stores it runs at. The user and guest lists share this shape.
+type campaignListItem struct {
+	CampaignID       string  `json:"campaign_id"`
+	VendorID         string  `json:"vendor_id"` // Nearest store running the campaign
+	Title            string  `json:"title"`
+	Description      string  `json:"description"`
+	Code             string  `json:"code"`
+	Enabled          bool    `json:"enabled"`
+	GeofenceRadiusKm float64 `json:"geofence_radius_km"`
+	VendorName       string  `json:"vendor_name"` // Store or brand display name, vendor type if unnamed
+	VendorType       string  `json:"vendor_type"`
+	VendorAddress    string  `json:"vendor_address"`
+	VendorLat        float64 `json:"vendor_lat"`
+	VendorLng        float64 `json:"vendor_lng"`
+	DistanceMeters   float64 `json:"distance_meters"`
+	DistanceDisplay  string  `json:"distance_display"` // "350m", "1.2km"
+
+	VariantID   string           `json:"variant_id,omitempty"`  // A/B variant shown, if any
+	Score       *float64         `json:"score,omitempty"`       // Set when sorted by relevance
+	Explanation []ranking.Factor `json:"explanation,omitempty"` // Why it got that score
+}
+
+// formatDistance is distance_display: whole meters below 1km, else km
+func formatDistance(meters float64) string {
+	if meters < 1000 {
+		return fmt.Sprintf("%.0fm", meters)
+	}
+	return fmt.Sprintf("%.1fkm", meters/1000)
+}
+
+// pageItems orders items as page does, adding scores and explanations in
+// relevance order
+func pageItems(items []campaignListItem, page []ranking.Ranked, sortBy string) []campaignListItem {
+	byID := make(map[string]campaignListItem, len(items))
+	for _, c := range items {
+		byID[c.CampaignID] = c
+	}
+
+	paged := make([]campaignListItem, len(page))
+	for i, rc := range page {
+		c := byID[rc.CampaignID]
+		if sortBy == sortByRelevance {
+			score := rc.Score
+			c.Score = &score
+			c.Explanation = rc.Explanation
+		}
+		paged[i] = c
+	}
+	return paged
+}
+
+// campaignListParams are the query parameters shared by campaign lists
+type campaignListParams struct {
+	SortBy            string
+	Limit             int
+	After             *campaignCursor
+	VendorType        string
+	MaxDistanceMeters float64 // 0 means no limit
+	Search            string
+	ExpiringSoon      bool
+}
+
+// parseCampaignListParams reads sort, limit, cursor, vendor_type,
+// max_distance_m, q and expiring_soon
+func parseCampaignListParams(r *http.Request, defaultSort string) (campaignListParams, error) {
+	q := r.URL.Query()
+	p := campaignListParams{Limit: defaultCampaignPageSize}
+
+	sortBy, err := parseSortParam(r, defaultSort)
+	if err != nil {
+		return p, err
+	}
+	p.SortBy = sortBy
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxCampaignPageSize {
+			return p, invalidField("limit", "limit must be between 1 and %d", maxCampaignPageSize)
+		}
+		p.Limit = limit
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		cursor, err := decodeCampaignCursor(v)
+		// A cursor only continues the order it came from
+		if err != nil || (cursor.Score != nil) != (p.SortBy == sortByRelevance) {
+			return p, invalidField("cursor", "invalid cursor")
+		}
+		p.After = cursor
+	}
+
+	p.VendorType = strings.TrimSpace(q.Get("vendor_type"))
+	p.Search = strings.TrimSpace(q.Get("q"))
+
+	if v := q.Get("max_distance_m"); v != "" {
+		d, err := strconv.ParseFloat(v, 64)
+		if err != nil || d <= 0 {
+			return p, invalidField("max_distance_m", "max_distance_m must be a positive number of meters")
+		}
+		p.MaxDistanceMeters = d
+	}
+
+	if v := q.Get("expiring_soon"); v != "" {
+		soon, err := strconv.ParseBool(v)
+		if err != nil {
+			return p, invalidField("expiring_soon", "expiring_soon must be true or false")
+		}
+		p.ExpiringSoon = soon
+	}
+
+	return p, nil
+}
+
+// sqlArgs collects positional query arguments for dynamically built queries
+type sqlArgs []interface{}
+
+// add appends v and returns its placeholder ("$n")
+func (a *sqlArgs) add(v interface{}) string {
+	*a = append(*a, v)
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+// pagedQuery wraps a campaign list query with the filters, order and limit.
+// base must select campaign_id, vendor_id, title, description, vendor_type,
+// end_date and distance_meters columns and use args for its own placeholders.
+func (p campaignListParams) pagedQuery(base string, args *sqlArgs) string {
+	var where []string
+
+	if p.VendorType != "" {
+		where = append(where, "LOWER(vendor_type) = LOWER("+args.add(p.VendorType)+")")
+	}
+	if p.MaxDistanceMeters > 0 {
+		where = append(where, "distance_meters <= "+args.add(p.MaxDistanceMeters))
+	}
+	if p.Search != "" {
+		pattern := args.add("%" + escapeLike(p.Search) + "%")
+		where = append(where, "(title ILIKE "+pattern+" OR description ILIKE "+pattern+")")
+	}
+	if p.ExpiringSoon {
+		// Today in the store's timezone, as campaign dates are evaluated
+		where = append(where, "end_date <= (SELECT (NOW() AT TIME ZONE v.timezone)::date FROM vendors v"+
+			" WHERE v.vendor_id = candidates.vendor_id) + "+args.add(expiringSoonDays)+"::int")
+	}
+
+	limit := rankPoolSize
+	if p.SortBy == sortByDistance {
+		limit = p.Limit + 1 // One extra row tells us whether there's a next page
+		if p.After != nil {
+			where = append(where, "(distance_meters, campaign_id) > ("+
+				args.add(p.After.DistanceMeters)+"::double precision, "+args.add(p.After.CampaignID)+")")
+		}
+	}
+
+	query := "SELECT * FROM (" + base + ") candidates"
+	if len(where) > 0 {
+		query += "\nWHERE " + strings.Join(where, "\n  AND ")
+	}
+	return query + "\nORDER BY distance_meters ASC, campaign_id\nLIMIT " + args.add(limit)
+}
+
+// pageCampaigns picks the page to return from candidates (in distance
+// order, as produced by pagedQuery) and the cursor for the next page, or ""
+// on the last page. Relevance order ranks the candidates first and fills
+// in each item's score and explanation.
+func pageCampaigns(userID string, p campaignListParams, candidates []ranking.Candidate) ([]ranking.Ranked, string, error) {
+	if p.SortBy == sortByDistance {
+		var next string
+		if len(candidates) > p.Limit {
+			candidates = candidates[:p.Limit]
+			last := candidates[len(candidates)-1]
+			next = campaignCursor{DistanceMeters: last.DistanceMeters, CampaignID: last.CampaignID}.encode()
+		}
+
+		page := make([]ranking.Ranked, len(candidates))
+		for i, c := range candidates {
+			page[i] = ranking.Ranked{Candidate: c}
+		}
+		return page, next, nil
+	}
+
+	ranked, err := rankCampaigns(userID, candidates)
+	if err != nil {
+		return nil, "", err
+	}
+
+	start := 0
+	if p.After != nil {
+		for start < len(ranked) && !p.After.after(ranked[start]) {
+			start++
+		}
+	}
+	ranked = ranked[start:]
+
+	var next string
+	if len(ranked) > p.Limit {
+		ranked = ranked[:p.Limit]
+		last := ranked[len(ranked)-1]
+		score := last.Score
+		next = campaignCursor{Score: &score, DistanceMeters: last.DistanceMeters, CampaignID: last.CampaignID}.encode()
+	}
+	return ranked, next, nil
+}
+
+// escapeLike escapes LIKE wildcards so search text matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"streetsavvy-backend/ranking"
+)
+
+func TestCampaignCursorRoundTrip(t *testing.T) {
+	score := 0.5
+	for _, c := range []campaignCursor{
+		{DistanceMeters: 120.5, CampaignID: "C0007"},
+		{Score: &score, DistanceMeters: 0, CampaignID: "C0001"},
+	} {
+		got, err := decodeCampaignCursor(c.encode())
+		if err != nil {
+			t.Fatalf("decoding %+v: %v", c, err)
+		}
+		if !reflect.DeepEqual(*got, c) {
+			t.Errorf("round trip of %+v gave %+v", c, *got)
+		}
+	}
+
+	for _, bad := range []string{"", "not base64!", "bnVsbA", "e30"} { // null, {}
+		if _, err := decodeCampaignCursor(bad); err == nil {
+			t.Errorf("decodeCampaignCursor(%q) accepted", bad)
+		}
+	}
+}
+
+func TestCampaignCursorAfter(t *testing.T) {
+	score := 0.5
+	cursor := campaignCursor{Score: &score, DistanceMeters: 200, CampaignID: "C0005"}
+	ranked := func(score, distance float64, id string) ranking.Ranked {
+		return ranking.Ranked{Candidate: ranking.Candidate{CampaignID: id, DistanceMeters: distance}, Score: score}
+	}
+
+	for _, tc := range []struct {
+		name string
+		r    ranking.Ranked
+		want bool
+	}{
+		{"lower score", ranked(0.4, 10, "C0001"), true},
+		{"higher score", ranked(0.6, 900, "C0009"), false},
+		{"same score, farther", ranked(0.5, 300, "C0001"), true},
+		{"same score, nearer", ranked(0.5, 100, "C0009"), false},
+		{"same score and distance, later ID", ranked(0.5, 200, "C0006"), true},
+		{"same score and distance, earlier ID", ranked(0.5, 200, "C0004"), false},
+		{"the cursor's own campaign", ranked(0.5, 200, "C0005"), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := cursor.after(tc.r); got != tc.want {
+				t.Errorf("after = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
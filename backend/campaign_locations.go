@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"streetsavvy-backend/config"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Multi-location campaigns. A campaign normally runs at its own vendor; a
+// brand can instead pick any of its store locations in campaign_locations.
+// The campaign_sites view (database/migrations/005_campaign_locations.sql)
+// lists the stores each campaign is matched against, and engagements record
+// the store they happened at so analytics roll up per location and per brand.
+
+// campaignLocations is the body of GET/PUT /api/campaigns/{id}/locations
+type campaignLocations struct {
+	CampaignID string   `json:"campaign_id"`
+	BrandID    string   `json:"brand_id,omitempty"`
+	VendorIDs  []string `json:"vendor_ids"` // Stores the campaign runs at
+	Explicit   bool     `json:"explicit"`   // false: only the campaign's own vendor
+}
+
+// getCampaignLocationsHandler lists the stores a campaign runs at
+func getCampaignLocationsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	campaignID := vars["campaign_id"]
+
+	locations, err := loadCampaignLocations(r.Context(), campaignID)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeCampaignNotFound, "Campaign not found")
+		return
+	}
+	if err != nil {
+		errorf(r, "Error loading locations for campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Failed to load campaign locations")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(locations)
+}
+
+// updateCampaignLocationsHandler replaces the stores a campaign runs at. All
+// of them must belong to the brand of the campaign's vendor. An empty list
+// goes back to running at the campaign's own vendor only.
+func updateCampaignLocationsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	campaignID := vars["campaign_id"]
+
+	var req campaignLocations
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorf(r, "Error parsing campaign locations request: %v", err)
+		writeError(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+
+	tx, err := config.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorf(r, "Error starting campaign locations transaction: %v", err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the campaign so concurrent updates can't interleave their rows
+	var brandID sql.NullString
+	err = tx.QueryRow(`
+		SELECT v.brand_id
+		FROM campaigns c
+		JOIN vendors v ON c.vendor_id = v.vendor_id
+		WHERE c.campaign_id = $1
+		FOR UPDATE OF c`, campaignID).Scan(&brandID)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeCampaignNotFound, "Campaign not found")
+		return
+	}
+	if err != nil {
+		errorf(r, "Error locking campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+
+	if len(req.VendorIDs) > 0 {
+		if !brandID.Valid {
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Campaign vendor doesn't belong to a brand")
+			return
+		}
+		if err := validateCampaignLocations(tx, brandID.String, req.VendorIDs); err != nil {
+			if err == errForeignLocation {
+				writeValidationError(w, r, err)
+				return
+			}
+			errorf(r, "Error validating locations for campaign %s: %v", campaignID, err)
+			writeInternalError(w, r, "Database error")
+			return
+		}
+	}
+
+	if _, err = tx.Exec(`DELETE FROM campaign_locations WHERE campaign_id = $1`, campaignID); err != nil {
+		errorf(r, "Error clearing locations for campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Failed to update campaign locations")
+		return
+	}
+	if len(req.VendorIDs) > 0 {
+		_, err = tx.Exec(`
+			INSERT INTO campaign_locations (campaign_id, vendor_id)
+			SELECT $1, unnest($2::text[])
+			ON CONFLICT DO NOTHING`,
+			campaignID, pq.Array(req.VendorIDs))
+		if err != nil {
+			errorf(r, "Error inserting locations for campaign %s: %v", campaignID, err)
+			writeInternalError(w, r, "Failed to update campaign locations")
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		errorf(r, "Error committing locations for campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Failed to update campaign locations")
+		return
+	}
+
+	logf(r, "Campaign %s now runs at %d selected locations", campaignID, len(req.VendorIDs))
+
+	locations, err := loadCampaignLocations(r.Context(), campaignID)
+	if err != nil {
+		errorf(r, "Error reloading locations for campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Failed to load campaign locations")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(locations)
+}
+
+// errForeignLocation rejects stores outside the campaign's brand
+var errForeignLocation = invalidField("vendor_ids", "all locations must belong to the campaign's brand")
+
+// validateCampaignLocations checks every vendor ID is a store of brandID
+func validateCampaignLocations(q queryRower, brandID string, vendorIDs []string) error {
+	var foreign int
+	err := q.QueryRow(`
+		SELECT COUNT(*)
+		FROM unnest($1::text[]) AS ids(vendor_id)
+		LEFT JOIN vendors v ON v.vendor_id = ids.vendor_id AND v.brand_id = $2
+		WHERE v.vendor_id IS NULL`,
+		pq.Array(vendorIDs), brandID).Scan(&foreign)
+	if err != nil {
+		return err
+	}
+	if foreign > 0 {
+		return errForeignLocation
+	}
+	return nil
+}
+
+// loadCampaignLocations reads the stores a campaign runs at. Returns
+// sql.ErrNoRows if the campaign is unknown.
+func loadCampaignLocations(ctx context.Context, campaignID string) (*campaignLocations, error) {
+	locations := &campaignLocations{CampaignID: campaignID, VendorIDs: []string{}}
+
+	var brandID sql.NullString
+	err := config.DB.QueryRowContext(ctx, `
+		SELECT v.brand_id, EXISTS (SELECT 1 FROM campaign_locations cl WHERE cl.campaign_id = c.campaign_id)
+		FROM campaigns c
+		JOIN vendors v ON c.vendor_id = v.vendor_id
+		WHERE c.campaign_id = $1`, campaignID).Scan(&brandID, &locations.Explicit)
+	if err != nil {
+		return nil, err
+	}
+	locations.BrandID = brandID.String
+
+	rows, err := config.DB.QueryContext(ctx, `
+		SELECT vendor_id FROM campaign_sites WHERE campaign_id = $1 ORDER BY vendor_id`, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var vendorID string
+		if err := rows.Scan(&vendorID); err != nil {
+			return nil, err
+		}
+		locations.VendorIDs = append(locations.VendorIDs, vendorID)
+	}
+	return locations, rows.Err()
+}
+
+// brandAnalytics is a brand's engagement totals, per store location and per
+// campaign
+type brandAnalytics struct {
+	BrandID   string                 `json:"brand_id"`
+	Summary   brandSummary           `json:"brand_summary"`
+	Locations []brandLocationMetrics `json:"locations"`
+	Campaigns []brandCampaignMetrics `json:"campaigns"`
+}
+
+type brandSummary struct {
+	TotalLocations        int     `json:"total_locations"`
+	TotalCampaigns        int     `json:"total_campaigns"`
+	TotalClicks           int     `json:"total_clicks"`
+	TotalUses             int     `json:"total_uses"`
+	OverallConversionRate float64 `json:"overall_conversion_rate"`
+}
+
+type brandLocationMetrics struct {
+	VendorID       string  `json:"vendor_id"`
+	DisplayName    string  `json:"display_name"`
+	TotalClicks    int     `json:"total_clicks"`
+	TotalUses      int     `json:"total_uses"`
+	ConversionRate float64 `json:"conversion_rate"`
+}
+
+type brandCampaignMetrics struct {
+	CampaignID     string  `json:"campaign_id"`
+	Title          string  `json:"title"`
+	Code           string  `json:"code"`
+	Enabled        bool    `json:"enabled"`
+	TotalLocations int     `json:"total_locations"`
+	TotalClicks    int     `json:"total_clicks"`
+	TotalUses      int     `json:"total_uses"`
+	ConversionRate float64 `json:"conversion_rate"`
+}
+
+// getBrandAnalyticsHandler rolls engagement stats up across a brand's store
+// locations, with a breakdown per location and per campaign
+func getBrandAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	brandID := vars["brand_id"]
+
+	var exists bool
+	err := config.DB.QueryRowContext(r.Context(), `SELECT EXISTS (SELECT 1 FROM brands WHERE brand_id = $1)`, brandID).Scan(&exists)
+	if err != nil {
+		errorf(r, "Error looking up brand %s: %v", brandID, err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+	if !exists {
+		writeError(w, r, http.StatusNotFound, codeBrandNotFound, "Brand not found")
+		return
+	}
+
+	// Per location: engagements attributed to each store. Rows from before
+	// per-location attribution count towards the campaign's vendor.
+	rows, err := config.DB.QueryContext(r.Context(), `
+		SELECT
+			v.vendor_id,
+			COALESCE(v.display_name, v.address, v.vendor_id),
+			COUNT(e.engagement_type) FILTER (WHERE e.engagement_type = 'clicked') AS total_clicks,
+			COUNT(e.engagement_type) FILTER (WHERE e.engagement_type = 'used') AS total_uses
+		FROM vendors v
+		LEFT JOIN (
+			SELECT COALESCE(e.vendor_id, c.vendor_id) AS vendor_id, e.engagement_type
+			FROM campaign_user_engagements e
+			JOIN campaigns c ON e.campaign_id = c.campaign_id
+		) e ON e.vendor_id = v.vendor_id
+		WHERE v.brand_id = $1
+		GROUP BY v.vendor_id, v.display_name, v.address
+		ORDER BY v.vendor_id`, brandID)
+	if err != nil {
+		errorf(r, "Error executing brand location query: %v", err)
+		writeInternalError(w, r, "Failed to get brand analytics")
+		return
+	}
+	defer rows.Close()
+
+	locations := []brandLocationMetrics{}
+	var brandTotalClicks, brandTotalUses int
+	for rows.Next() {
+		var l brandLocationMetrics
+		if err := rows.Scan(&l.VendorID, &l.DisplayName, &l.TotalClicks, &l.TotalUses); err != nil {
+			errorf(r, "Error scanning location row: %v", err)
+			continue
+		}
+		l.ConversionRate = conversionRate(l.TotalClicks, l.TotalUses)
+		brandTotalClicks += l.TotalClicks
+		brandTotalUses += l.TotalUses
+		locations = append(locations, l)
+	}
+	if err := rows.Err(); err != nil {
+		errorf(r, "Error reading location rows: %v", err)
+		writeInternalError(w, r, "Failed to get brand analytics")
+		return
+	}
+
+	// Per campaign: all of the brand's campaigns across all their locations
+	campaignRows, err := config.DB.QueryContext(r.Context(), `
+		SELECT
+			c.campaign_id,
+			c.title,
+			c.code,
+			c.enabled,
+			(SELECT COUNT(*) FROM campaign_sites cs WHERE cs.campaign_id = c.campaign_id) AS total_locations,
+			COUNT(e.engagement_type) FILTER (WHERE e.engagement_type = 'clicked') AS total_clicks,
+			COUNT(e.engagement_type) FILTER (WHERE e.engagement_type = 'used') AS total_uses
+		FROM campaigns c
+		JOIN vendors v ON c.vendor_id = v.vendor_id
+		LEFT JOIN campaign_user_engagements e ON e.campaign_id = c.campaign_id
+		WHERE v.brand_id = $1
+		GROUP BY c.campaign_id, c.title, c.code, c.enabled
+		ORDER BY c.campaign_id`, brandID)
+	if err != nil {
+		errorf(r, "Error executing brand campaign query: %v", err)
+		writeInternalError(w, r, "Failed to get brand analytics")
+		return
+	}
+	defer campaignRows.Close()
+
+	campaigns := []brandCampaignMetrics{}
+	for campaignRows.Next() {
+		var c brandCampaignMetrics
+		err := campaignRows.Scan(&c.CampaignID, &c.Title, &c.Code, &c.Enabled,
+			&c.TotalLocations, &c.TotalClicks, &c.TotalUses)
+		if err != nil {
+			errorf(r, "Error scanning campaign row: %v", err)
+			continue
+		}
+		c.ConversionRate = conversionRate(c.TotalClicks, c.TotalUses)
+		campaigns = append(campaigns, c)
+	}
+	if err := campaignRows.Err(); err != nil {
+		errorf(r, "Error reading campaign rows: %v", err)
+		writeInternalError(w, r, "Failed to get brand analytics")
+		return
+	}
+
+	response := brandAnalytics{
+		BrandID: brandID,
+		Summary: brandSummary{
+			TotalLocations:        len(locations),
+			TotalCampaigns:        len(campaigns),
+			TotalClicks:           brandTotalClicks,
+			TotalUses:             brandTotalUses,
+			OverallConversionRate: conversionRate(brandTotalClicks, brandTotalUses),
+		},
+		Locations: locations,
+		Campaigns: campaigns,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// conversionRate is uses per click as a percentage rounded down to 1
+// decimal place, as on the vendor dashboard; 0 without clicks
+func conversionRate(clicks, uses int) float64 {
+	if clicks == 0 {
+		return 0
+	}
+	rate := float64(uses) / float64(clicks) * 100
+	return float64(int(rate*10)) / 10
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestConversionRate(t *testing.T) {
+	for _, tc := range []struct {
+		clicks, uses int
+		want         float64
+	}{
+		{0, 0, 0},
+		{0, 3, 0},
+		{4, 1, 25},
+		{3, 1, 33.3},
+		{3, 2, 66.6}, // Rounded down, like the vendor dashboard
+		{7, 7, 100},
+	} {
+		if got := conversionRate(tc.clicks, tc.uses); got != tc.want {
+			t.Errorf("conversionRate(%d, %d) = %v, want %v", tc.clicks, tc.uses, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"streetsavvy-backend/config"
+	"streetsavvy-backend/ranking"
+)
+
+// campaignRanker orders campaign lists when clients ask for ?sort=relevance.
+// Set in main from RANKER / RANK_WEIGHT_* (see config.RankingConfig).
+var campaignRanker ranking.Ranker = ranking.NewScoreRanker(ranking.DefaultWeights())
+
+// Campaign list orderings accepted in ?sort=
+const (
+	sortByDistance  = "distance"
+	sortByRelevance = "relevance"
+)
+
+// parseSortParam reads ?sort=, falling back to the endpoint's default
+func parseSortParam(r *http.Request, defaultSort string) (string, error) {
+	sortBy := r.URL.Query().Get("sort")
+	switch sortBy {
+	case "":
+		return defaultSort, nil
+	case sortByDistance, sortByRelevance:
+		return sortBy, nil
+	}
+	return "", invalidField("sort", "sort must be '%s' or '%s'", sortByDistance, sortByRelevance)
+}
+
+// rankCampaigns orders candidates for a user with the deployment's ranker
+func rankCampaigns(userID string, candidates []ranking.Candidate) ([]ranking.Ranked, error) {
+	user, err := loadRankingUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return campaignRanker.Rank(user, candidates), nil
+}
+
+// loadRankingUser reads the user's segments and engagement history up to now
+func loadRankingUser(userID string) (ranking.User, error) {
+	return ranking.LoadUser(config.DB, userID, time.Now())
+}
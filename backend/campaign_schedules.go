@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"streetsavvy-backend/config"
+	"streetsavvy-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Campaign schedules: recurring dayparts and blackout dates.
+// The rules themselves are evaluated in Postgres by campaign_is_live()
+// (database/migrations/001_campaign_schedules.sql) so every campaign query
+// agrees on what "active" means.
+
+// campaignScheduleStatus is a campaign's schedule and whether it allows the
+// campaign to run right now
+type campaignScheduleStatus struct {
+	Schedule *models.CampaignSchedule `json:"schedule"`
+	LiveNow  bool                     `json:"live_now"`
+}
+
+// getCampaignScheduleHandler returns a campaign's schedule rules, blackout
+// dates and whether it is live right now
+func getCampaignScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	campaignID := vars["campaign_id"]
+
+	schedule, err := loadCampaignSchedule(r.Context(), campaignID)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeCampaignNotFound, "Campaign not found")
+		return
+	}
+	if err != nil {
+		errorf(r, "Error loading schedule for campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Failed to load campaign schedule")
+		return
+	}
+
+	var liveNow bool
+	err = config.DB.QueryRowContext(r.Context(), `SELECT campaign_is_live($1, NOW())`, campaignID).Scan(&liveNow)
+	if err != nil {
+		errorf(r, "Error evaluating schedule for campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Failed to evaluate campaign schedule")
+		return
+	}
+
+	response := campaignScheduleStatus{Schedule: schedule, LiveNow: liveNow}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// updateCampaignScheduleHandler replaces all schedule rules and blackout
+// dates of a campaign in one transaction
+func updateCampaignScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	campaignID := vars["campaign_id"]
+
+	var req models.CampaignSchedule
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorf(r, "Error parsing schedule request: %v", err)
+		writeError(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+
+	if err := validateSchedule(req); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	tx, err := config.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorf(r, "Error starting schedule transaction: %v", err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the campaign so concurrent updates can't interleave their rules
+	var exists string
+	err = tx.QueryRow(`SELECT campaign_id FROM campaigns WHERE campaign_id = $1 FOR UPDATE`, campaignID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeCampaignNotFound, "Campaign not found")
+		return
+	}
+	if err != nil {
+		errorf(r, "Error locking campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+
+	if _, err = tx.Exec(`DELETE FROM campaign_schedules WHERE campaign_id = $1`, campaignID); err != nil {
+		errorf(r, "Error clearing schedule rules for campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Failed to update campaign schedule")
+		return
+	}
+	if _, err = tx.Exec(`DELETE FROM campaign_blackout_dates WHERE campaign_id = $1`, campaignID); err != nil {
+		errorf(r, "Error clearing blackout dates for campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Failed to update campaign schedule")
+		return
+	}
+
+	for _, rule := range req.Rules {
+		days := make([]int64, len(rule.DaysOfWeek))
+		for i, d := range rule.DaysOfWeek {
+			days[i] = int64(d)
+		}
+		_, err = tx.Exec(`
+			INSERT INTO campaign_schedules (campaign_id, days_of_week, start_time, end_time)
+			VALUES ($1, $2, $3, $4)`,
+			campaignID, pq.Array(days), rule.StartTime, rule.EndTime)
+		if err != nil {
+			errorf(r, "Error inserting schedule rule for campaign %s: %v", campaignID, err)
+			writeInternalError(w, r, "Failed to update campaign schedule")
+			return
+		}
+	}
+
+	for _, b := range req.BlackoutDates {
+		_, err = tx.Exec(`
+			INSERT INTO campaign_blackout_dates (campaign_id, blackout_date, reason)
+			VALUES ($1, $2, NULLIF($3, ''))
+			ON CONFLICT (campaign_id, blackout_date) DO UPDATE SET reason = EXCLUDED.reason`,
+			campaignID, b.Date, b.Reason)
+		if err != nil {
+			errorf(r, "Error inserting blackout date for campaign %s: %v", campaignID, err)
+			writeInternalError(w, r, "Failed to update campaign schedule")
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		errorf(r, "Error committing schedule for campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Failed to update campaign schedule")
+		return
+	}
+
+	logf(r, "Updated schedule for campaign %s: %d rules, %d blackout dates",
+		campaignID, len(req.Rules), len(req.BlackoutDates))
+
+	schedule, err := loadCampaignSchedule(r.Context(), campaignID)
+	if err != nil {
+		errorf(r, "Error reloading schedule for campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Failed to load campaign schedule")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// loadCampaignSchedule reads a campaign's rules, blackout dates and its
+// vendor's timezone. Returns sql.ErrNoRows for an unknown campaign.
+func loadCampaignSchedule(ctx context.Context, campaignID string) (*models.CampaignSchedule, error) {
+	schedule := &models.CampaignSchedule{
+		CampaignID:    campaignID,
+		Rules:         []models.ScheduleRule{},
+		BlackoutDates: []models.BlackoutDate{},
+	}
+
+	err := config.DB.QueryRowContext(ctx, `
+		SELECT v.timezone
+		FROM campaigns c
+		JOIN vendors v ON c.vendor_id = v.vendor_id
+		WHERE c.campaign_id = $1`, campaignID).Scan(&schedule.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := config.DB.QueryContext(ctx, `
+		SELECT schedule_id, days_of_week, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')
+		FROM campaign_schedules
+		WHERE campaign_id = $1
+		ORDER BY schedule_id`, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rule models.ScheduleRule
+		var days []int64
+		if err := rows.Scan(&rule.ScheduleID, pq.Array(&days), &rule.StartTime, &rule.EndTime); err != nil {
+			return nil, err
+		}
+		for _, d := range days {
+			rule.DaysOfWeek = append(rule.DaysOfWeek, int(d))
+		}
+		schedule.Rules = append(schedule.Rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	blackoutRows, err := config.DB.QueryContext(ctx, `
+		SELECT to_char(blackout_date, 'YYYY-MM-DD'), COALESCE(reason, '')
+		FROM campaign_blackout_dates
+		WHERE campaign_id = $1
+		ORDER BY blackout_date`, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer blackoutRows.Close()
+
+	for blackoutRows.Next() {
+		var b models.BlackoutDate
+		if err := blackoutRows.Scan(&b.Date, &b.Reason); err != nil {
+			return nil, err
+		}
+		schedule.BlackoutDates = append(schedule.BlackoutDates, b)
+	}
+
+	return schedule, blackoutRows.Err()
+}
+
+// validateSchedule checks days, "HH:MM" windows and "YYYY-MM-DD" blackout
+// dates. The timezone is the vendor's and can't be set here.
+func validateSchedule(s models.CampaignSchedule) error {
+	if s.Timezone != "" {
+		return invalidField("timezone", "timezone comes from the vendor profile; set it with PUT /vendors/{vendor_id}")
+	}
+	for i, rule := range s.Rules {
+		if len(rule.DaysOfWeek) == 0 {
+			return invalidField(fmt.Sprintf("rules[%d].days_of_week", i), "rule %d: days_of_week must not be empty", i)
+		}
+		for _, d := range rule.DaysOfWeek {
+			if d < 0 || d > 6 {
+				return invalidField(fmt.Sprintf("rules[%d].days_of_week", i), "rule %d: days_of_week must be between 0 (Sunday) and 6 (Saturday)", i)
+			}
+		}
+		start, err := time.Parse("15:04", rule.StartTime)
+		if err != nil {
+			return invalidField(fmt.Sprintf("rules[%d].start_time", i), "rule %d: start_time must be HH:MM", i)
+		}
+		end, err := time.Parse("15:04", rule.EndTime)
+		if err != nil {
+			return invalidField(fmt.Sprintf("rules[%d].end_time", i), "rule %d: end_time must be HH:MM", i)
+		}
+		if start.Equal(end) {
+			return invalidField(fmt.Sprintf("rules[%d].end_time", i), "rule %d: start_time and end_time must differ", i)
+		}
+	}
+	for i, b := range s.BlackoutDates {
+		if _, err := time.Parse("2006-01-02", b.Date); err != nil {
+			return invalidField(fmt.Sprintf("blackout_dates[%d].date", i), "blackout date %d: date must be YYYY-MM-DD", i)
+		}
+	}
+	return nil
+}
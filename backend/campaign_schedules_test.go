@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"streetsavvy-backend/models"
+)
+
+func TestValidateSchedule(t *testing.T) {
+	weekdays := func(start, end string) models.ScheduleRule {
+		return models.ScheduleRule{DaysOfWeek: []int{1, 2, 3, 4, 5}, StartTime: start, EndTime: end}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		schedule models.CampaignSchedule
+		field    string // Empty when the schedule is valid
+	}{
+		{"empty", models.CampaignSchedule{}, ""},
+		{"weekday lunch", models.CampaignSchedule{Rules: []models.ScheduleRule{weekdays("11:30", "14:00")}}, ""},
+		{"overnight", models.CampaignSchedule{Rules: []models.ScheduleRule{weekdays("22:00", "02:00")}}, ""},
+		{"whole week", models.CampaignSchedule{Rules: []models.ScheduleRule{
+			{DaysOfWeek: []int{0, 1, 2, 3, 4, 5, 6}, StartTime: "00:00", EndTime: "23:59"}}}, ""},
+		{"blackout", models.CampaignSchedule{BlackoutDates: []models.BlackoutDate{{Date: "2026-12-25"}}}, ""},
+
+		{"no days", models.CampaignSchedule{Rules: []models.ScheduleRule{
+			{StartTime: "09:00", EndTime: "17:00"}}}, "rules[0].days_of_week"},
+		{"day too high", models.CampaignSchedule{Rules: []models.ScheduleRule{
+			weekdays("09:00", "17:00"), {DaysOfWeek: []int{7}, StartTime: "09:00", EndTime: "17:00"}}}, "rules[1].days_of_week"},
+		{"negative day", models.CampaignSchedule{Rules: []models.ScheduleRule{
+			{DaysOfWeek: []int{-1}, StartTime: "09:00", EndTime: "17:00"}}}, "rules[0].days_of_week"},
+		{"bad start", models.CampaignSchedule{Rules: []models.ScheduleRule{weekdays("9am", "17:00")}}, "rules[0].start_time"},
+		{"hour out of range", models.CampaignSchedule{Rules: []models.ScheduleRule{weekdays("24:00", "17:00")}}, "rules[0].start_time"},
+		{"missing end", models.CampaignSchedule{Rules: []models.ScheduleRule{weekdays("09:00", "")}}, "rules[0].end_time"},
+		{"empty window", models.CampaignSchedule{Rules: []models.ScheduleRule{weekdays("09:00", "09:00")}}, "rules[0].end_time"},
+		{"bad blackout", models.CampaignSchedule{BlackoutDates: []models.BlackoutDate{
+			{Date: "2026-12-25"}, {Date: "25/12/2026"}}}, "blackout_dates[1].date"},
+		{"impossible blackout", models.CampaignSchedule{BlackoutDates: []models.BlackoutDate{{Date: "2026-02-30"}}}, "blackout_dates[0].date"},
+		{"timezone", models.CampaignSchedule{Timezone: "America/New_York"}, "timezone"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateSchedule(tc.schedule)
+			if tc.field == "" {
+				if err != nil {
+					t.Fatalf("validateSchedule = %v, want nil", err)
+				}
+				return
+			}
+			fe, ok := err.(fieldError)
+			if !ok {
+				t.Fatalf("validateSchedule = %v, want a field error on %s", err, tc.field)
+			}
+			if fe.Field != tc.field {
+				t.Errorf("field = %s, want %s", fe.Field, tc.field)
+			}
+		})
+	}
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+
+	"streetsavvy-backend/config"
+	"streetsavvy-backend/experiments"
+	"streetsavvy-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Campaign variants: A/B tests of a campaign's title, description and code.
+// Users are bucketed by experiments.Assign the first time a campaign is
+// shown to them and the assignment is stored, so it never changes. One
+// variant per campaign is the control the others are measured against: the
+// first one added, until another is created or updated with is_control.
+
+// getCampaignVariantsHandler lists a campaign's variants
+func getCampaignVariantsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	campaignID := vars["campaign_id"]
+
+	variants, err := loadCampaignVariants(r.Context(), []string{campaignID})
+	if err != nil {
+		errorf(r, "Error loading variants for campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Failed to load campaign variants")
+		return
+	}
+
+	list := variants[campaignID]
+	if list == nil {
+		list = []models.CampaignVariant{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// createCampaignVariantHandler adds a variant to a campaign
+func createCampaignVariantHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	campaignID := vars["campaign_id"]
+
+	var req models.CampaignVariant
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorf(r, "Error parsing variant request: %v", err)
+		writeError(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+	if req.Weight == 0 {
+		req.Weight = 1
+	}
+	if err := validateVariant(req); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	req.CampaignID = campaignID
+	tx, err := config.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorf(r, "Error starting variant transaction: %v", err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the campaign so two first variants can't both become the control
+	var hasControl bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM campaign_variants WHERE campaign_id = c.campaign_id AND is_control)
+		FROM campaigns c
+		WHERE c.campaign_id = $1
+		FOR NO KEY UPDATE`, campaignID).Scan(&hasControl)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeCampaignNotFound, "Campaign not found")
+		return
+	}
+	if err != nil {
+		errorf(r, "Error locking campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+	if !hasControl {
+		req.IsControl = true
+	} else if req.IsControl {
+		if err = clearControlVariant(tx, campaignID); err != nil {
+			errorf(r, "Error clearing control variant of campaign %s: %v", campaignID, err)
+			writeInternalError(w, r, "Failed to create campaign variant")
+			return
+		}
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO campaign_variants (campaign_id, name, title, description, code, weight, is_control)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING variant_id`,
+		campaignID, req.Name, req.Title, req.Description, req.Code, req.Weight, req.IsControl).Scan(&req.VariantID)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		errorf(r, "Error creating variant for campaign %s: %v", campaignID, err)
+		writeInternalError(w, r, "Failed to create campaign variant")
+		return
+	}
+
+	logf(r, "Created variant %s (%s) for campaign %s", req.VariantID, req.Name, campaignID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(req)
+}
+
+// updateCampaignVariantHandler changes a variant's creative or weight, and
+// makes it the control if is_control is set (false leaves the control as
+// is). Users already assigned keep their variant.
+func updateCampaignVariantHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	campaignID := vars["campaign_id"]
+	variantID := vars["variant_id"]
+
+	var req models.CampaignVariant
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorf(r, "Error parsing variant request: %v", err)
+		writeError(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+	if err := validateVariant(req); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	tx, err := config.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorf(r, "Error starting variant transaction: %v", err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+	defer tx.Rollback()
+
+	if req.IsControl {
+		if err = clearControlVariant(tx, campaignID); err != nil {
+			errorf(r, "Error clearing control variant of campaign %s: %v", campaignID, err)
+			writeInternalError(w, r, "Failed to update campaign variant")
+			return
+		}
+	}
+
+	err = tx.QueryRow(`
+		UPDATE campaign_variants
+		SET name = $3, title = $4, description = $5, code = $6, weight = $7, is_control = is_control OR $8
+		WHERE campaign_id = $1 AND variant_id = $2
+		RETURNING is_control`,
+		campaignID, variantID, req.Name, req.Title, req.Description, req.Code, req.Weight, req.IsControl).Scan(&req.IsControl)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeVariantNotFound, "Variant not found")
+		return
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		errorf(r, "Error updating variant %s: %v", variantID, err)
+		writeInternalError(w, r, "Failed to update campaign variant")
+		return
+	}
+
+	req.VariantID = variantID
+	req.CampaignID = campaignID
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(req)
+}
+
+// deleteCampaignVariantHandler removes a variant. Its users are reassigned
+// the next time the campaign is shown to them; past engagements are kept
+// without a variant. Removing the control makes the oldest remaining
+// variant the control.
+func deleteCampaignVariantHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	campaignID := vars["campaign_id"]
+	variantID := vars["variant_id"]
+
+	result, err := config.DB.ExecContext(r.Context(), `
+		DELETE FROM campaign_variants
+		WHERE campaign_id = $1 AND variant_id = $2`, campaignID, variantID)
+	if err != nil {
+		errorf(r, "Error deleting variant %s: %v", variantID, err)
+		writeInternalError(w, r, "Failed to delete campaign variant")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		writeError(w, r, http.StatusNotFound, codeVariantNotFound, "Variant not found")
+		return
+	}
+
+	_, err = config.DB.ExecContext(r.Context(), `
+		UPDATE campaign_variants SET is_control = true
+		WHERE variant_id = (SELECT MIN(variant_id) FROM campaign_variants WHERE campaign_id = $1)
+		  AND NOT EXISTS (SELECT 1 FROM campaign_variants WHERE campaign_id = $1 AND is_control)`, campaignID)
+	if err != nil {
+		errorf(r, "Error choosing a new control for campaign %s: %v", campaignID, err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clearControlVariant unmarks a campaign's control, before another variant
+// takes its place. The campaign stays locked until tx ends, so concurrent
+// changes of the control queue up.
+func clearControlVariant(tx *sql.Tx, campaignID string) error {
+	_, err := tx.Exec(`SELECT 1 FROM campaigns WHERE campaign_id = $1 FOR NO KEY UPDATE`, campaignID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE campaign_variants SET is_control = false
+		WHERE campaign_id = $1 AND is_control`, campaignID)
+	return err
+}
+
+// validateVariant returns the first invalid field, or nil
+func validateVariant(v models.CampaignVariant) error {
+	if v.Name == "" {
+		return invalidField("name", "Variant name is required")
+	}
+	if v.Title == "" {
+		return invalidField("title", "Variant title is required")
+	}
+	if v.Weight <= 0 {
+		return invalidField("weight", "Variant weight must be positive")
+	}
+	return nil
+}
+
+// loadCampaignVariants returns the variants of the given campaigns keyed by
+// campaign ID, each list ordered control first
+func loadCampaignVariants(ctx context.Context, campaignIDs []string) (map[string][]models.CampaignVariant, error) {
+	rows, err := config.DB.QueryContext(ctx, `
+		SELECT variant_id, campaign_id, name, title, description, code, weight, is_control
+		FROM campaign_variants
+		WHERE campaign_id = ANY($1)
+		ORDER BY campaign_id, is_control DESC, variant_id`, pq.Array(campaignIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := make(map[string][]models.CampaignVariant)
+	for rows.Next() {
+		var v models.CampaignVariant
+		if err := rows.Scan(&v.VariantID, &v.CampaignID, &v.Name, &v.Title, &v.Description, &v.Code, &v.Weight, &v.IsControl); err != nil {
+			return nil, err
+		}
+		variants[v.CampaignID] = append(variants[v.CampaignID], v)
+	}
+	return variants, rows.Err()
+}
+
+// resolveVariants returns the variant each campaign should be shown to the
+// user as, keyed by campaign ID. Campaigns without variants are absent.
+// New assignments are stored so the user keeps seeing the same creative.
+func resolveVariants(ctx context.Context, userID string, campaignIDs []string) (map[string]models.CampaignVariant, error) {
+	resolved := make(map[string]models.CampaignVariant)
+	if len(campaignIDs) == 0 {
+		return resolved, nil
+	}
+
+	variants, err := loadCampaignVariants(ctx, campaignIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(variants) == 0 {
+		return resolved, nil
+	}
+
+	// Existing assignments win over hashing
+	rows, err := config.DB.QueryContext(ctx, `
+		SELECT campaign_id, variant_id
+		FROM campaign_variant_assignments
+		WHERE user_id = $1 AND campaign_id = ANY($2)`, userID, pq.Array(campaignIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assigned := make(map[string]string)
+	for rows.Next() {
+		var campaignID, variantID string
+		if err := rows.Scan(&campaignID, &variantID); err != nil {
+			return nil, err
+		}
+		assigned[campaignID] = variantID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for campaignID, list := range variants {
+		if variantID, ok := assigned[campaignID]; ok {
+			for _, v := range list {
+				if v.VariantID == variantID {
+					resolved[campaignID] = v
+				}
+			}
+			continue
+		}
+
+		weights := make([]int, len(list))
+		for i, v := range list {
+			weights[i] = v.Weight
+		}
+		idx := experiments.Assign(userID, campaignID, weights)
+		if idx < 0 {
+			continue
+		}
+		chosen := list[idx]
+
+		// A concurrent request may have assigned first; keep whichever won
+		err := config.DB.QueryRowContext(ctx, `
+			INSERT INTO campaign_variant_assignments (campaign_id, user_id, variant_id)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (campaign_id, user_id) DO UPDATE SET campaign_id = EXCLUDED.campaign_id
+			RETURNING variant_id`, campaignID, userID, chosen.VariantID).Scan(&chosen.VariantID)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range list {
+			if v.VariantID == chosen.VariantID {
+				resolved[campaignID] = v
+			}
+		}
+	}
+
+	return resolved, nil
+}
+
+// applyVariants swaps in the variant creative assigned to userID for each
+// campaign in a list. A variant without a description or code keeps the
+// campaign's.
+func applyVariants(ctx context.Context, userID string, campaigns []campaignListItem) error {
+	ids := make([]string, len(campaigns))
+	for i, c := range campaigns {
+		ids[i] = c.CampaignID
+	}
+
+	variants, err := resolveVariants(ctx, userID, ids)
+	if err != nil {
+		return err
+	}
+
+	for i, c := range campaigns {
+		if v, ok := variants[c.CampaignID]; ok {
+			campaigns[i].Title = v.Title
+			if v.Description != nil {
+				campaigns[i].Description = *v.Description
+			}
+			if v.Code != nil {
+				campaigns[i].Code = *v.Code
+			}
+			campaigns[i].VariantID = v.VariantID
+		}
+	}
+	return nil
+}
+
+// assignedVariantID returns the variant a user was shown for a campaign, or nil
+func assignedVariantID(ctx context.Context, userID, campaignID string) (*string, error) {
+	var variantID string
+	err := config.DB.QueryRowContext(ctx, `
+		SELECT variant_id FROM campaign_variant_assignments
+		WHERE campaign_id = $1 AND user_id = $2`, campaignID, userID).Scan(&variantID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &variantID, nil
+}
+
+// loadVariantMetrics builds per-variant funnels for all campaigns running at
+// a vendor, keyed by campaign ID, control first. Each other variant's
+// conversion is tested against the campaign's control.
+func loadVariantMetrics(ctx context.Context, vendorID string) (map[string][]models.VariantMetrics, error) {
+	rows, err := config.DB.QueryContext(ctx, `
+		SELECT
+			cv.campaign_id,
+			cv.variant_id,
+			cv.name,
+			cv.weight,
+			cv.is_control,
+			(SELECT COUNT(*) FROM campaign_variant_assignments a WHERE a.variant_id = cv.variant_id) AS exposures,
+			COUNT(DISTINCT e.user_id) FILTER (WHERE e.engagement_type = 'clicked') AS clickers,
+			COUNT(DISTINCT e.user_id) FILTER (WHERE e.engagement_type = 'used') AS redeemers
+		FROM campaign_variants cv
+		JOIN campaigns c ON cv.campaign_id = c.campaign_id
+		LEFT JOIN campaign_user_engagements e ON e.variant_id = cv.variant_id
+		WHERE c.campaign_id IN (SELECT campaign_id FROM campaign_sites WHERE vendor_id = $1)
+		GROUP BY cv.campaign_id, cv.variant_id, cv.name, cv.weight, cv.is_control
+		ORDER BY cv.campaign_id, cv.is_control DESC, cv.variant_id`, vendorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metrics := make(map[string][]models.VariantMetrics)
+	for rows.Next() {
+		var campaignID string
+		var m models.VariantMetrics
+		if err := rows.Scan(&campaignID, &m.VariantID, &m.Name, &m.Weight, &m.IsControl, &m.Exposures, &m.Clickers, &m.Redeemers); err != nil {
+			return nil, err
+		}
+		if m.Exposures > 0 {
+			m.ClickRate = roundTo(float64(m.Clickers)/float64(m.Exposures)*100, 1)
+			m.ConversionRate = roundTo(float64(m.Redeemers)/float64(m.Exposures)*100, 1)
+		}
+		metrics[campaignID] = append(metrics[campaignID], m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Compare every variant with the control, if the campaign still has one
+	for _, list := range metrics {
+		control := &list[0]
+		if !control.IsControl {
+			continue
+		}
+		for i := 1; i < len(list); i++ {
+			v := &list[i]
+			test, ok := experiments.TwoProportionZTest(v.Redeemers, v.Exposures, control.Redeemers, control.Exposures)
+			if !ok {
+				continue
+			}
+			lift := roundTo(v.ConversionRate-control.ConversionRate, 1)
+			test.Z = roundTo(test.Z, 3)
+			test.PValue = roundTo(test.PValue, 4)
+			v.LiftVsControl = &lift
+			v.Significance = &test
+		}
+	}
+
+	return metrics, nil
+}
+
+// roundTo rounds x to the given number of decimal places
+func roundTo(x float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(x*scale) / scale
+}
@@ -0,0 +1,110 @@
+// Package client is a Go client for the StreetSavvy API (/api/v1).
+//
+// The types and methods in client_gen.go are generated from the server's
+// OpenAPI document (openapi.json, also served at /api/openapi.json); run
+// go generate in the server package after changing an endpoint. This file
+// is the hand-written transport they share.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client calls the API at BaseURL, such as "http://localhost:8080"
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client // http.DefaultClient if nil
+}
+
+// New returns a Client for the server at baseURL
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// Error is a failed request. Code and Message come from the API's error
+// envelope; a body that isn't one is kept as Message.
+type Error struct {
+	StatusCode int
+	APIError
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("streetsavvy: %d %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("streetsavvy: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// do sends a request and decodes a 2xx response into out: *[]byte takes the
+// raw body and nil discards it. It returns the response headers.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values,
+	header http.Header, body, out interface{}) (http.Header, error) {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.Header, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		var envelope struct {
+			Error *APIError `json:"error"`
+		}
+		if json.Unmarshal(raw, &envelope) == nil && envelope.Error != nil {
+			apiErr.APIError = *envelope.Error
+		} else {
+			apiErr.Message = strings.TrimSpace(string(raw))
+		}
+		return resp.Header, apiErr
+	}
+
+	switch out := out.(type) {
+	case nil:
+	case *[]byte:
+		*out = raw
+	default:
+		if err := json.Unmarshal(raw, out); err != nil {
+			return resp.Header, fmt.Errorf("decoding %s %s response: %w", method, path, err)
+		}
+	}
+	return resp.Header, nil
+}
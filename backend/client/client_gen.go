@@ -0,0 +1,1459 @@
+// Code generated by openapi.GenerateClient; DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type APIError struct {
+	Code      string       `json:"code"`
+	Details   []FieldError `json:"details,omitempty"`
+	Message   string       `json:"message"`
+	RequestID string       `json:"request_id,omitempty"`
+	Status    int          `json:"status"`
+}
+
+type APIErrorEnvelope struct {
+	Error APIError `json:"error"`
+}
+
+type AffinityWeight struct {
+	Key        string    `json:"key"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Share      float64   `json:"share"`
+	Uses       int       `json:"uses"`
+	Weight     float64   `json:"weight"`
+}
+
+type AuditEntry struct {
+	Action     string          `json:"action"`
+	AuditID    int64           `json:"audit_id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Details    json.RawMessage `json:"details"`
+	RemoteAddr string          `json:"remote_addr,omitempty"`
+	UserAgent  string          `json:"user_agent,omitempty"`
+}
+
+type BlackoutDate struct {
+	Date   string `json:"date"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type Brand struct {
+	BrandID      string     `json:"brand_id"`
+	ContactEmail string     `json:"contact_email,omitempty"`
+	ContactPhone string     `json:"contact_phone,omitempty"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+	DisplayName  string     `json:"display_name"`
+	Locations    []Vendor   `json:"locations"`
+	LogoURL      string     `json:"logo_url,omitempty"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+	Website      string     `json:"website,omitempty"`
+}
+
+type BrandAnalytics struct {
+	BrandID      string                 `json:"brand_id"`
+	BrandSummary BrandSummary           `json:"brand_summary"`
+	Campaigns    []BrandCampaignMetrics `json:"campaigns"`
+	Locations    []BrandLocationMetrics `json:"locations"`
+}
+
+type BrandCampaignMetrics struct {
+	CampaignID     string  `json:"campaign_id"`
+	Code           string  `json:"code"`
+	ConversionRate float64 `json:"conversion_rate"`
+	Enabled        bool    `json:"enabled"`
+	Title          string  `json:"title"`
+	TotalClicks    int     `json:"total_clicks"`
+	TotalLocations int     `json:"total_locations"`
+	TotalUses      int     `json:"total_uses"`
+}
+
+type BrandLocationMetrics struct {
+	ConversionRate float64 `json:"conversion_rate"`
+	DisplayName    string  `json:"display_name"`
+	TotalClicks    int     `json:"total_clicks"`
+	TotalUses      int     `json:"total_uses"`
+	VendorID       string  `json:"vendor_id"`
+}
+
+type BrandSummary struct {
+	OverallConversionRate float64 `json:"overall_conversion_rate"`
+	TotalCampaigns        int     `json:"total_campaigns"`
+	TotalClicks           int     `json:"total_clicks"`
+	TotalLocations        int     `json:"total_locations"`
+	TotalUses             int     `json:"total_uses"`
+}
+
+type CampaignBudget struct {
+	CampaignID       string     `json:"campaign_id"`
+	DistinctUsers    int        `json:"distinct_users"`
+	ExhaustedAt      *time.Time `json:"exhausted_at"`
+	ExhaustedReason  *string    `json:"exhausted_reason"`
+	MaxDistinctUsers *int       `json:"max_distinct_users"`
+	MaxUses          *int       `json:"max_uses"`
+	MaxUsesPerDay    *int       `json:"max_uses_per_day"`
+	Uses             int        `json:"uses"`
+	UsesToday        int        `json:"uses_today"`
+}
+
+type CampaignListItem struct {
+	CampaignID       string          `json:"campaign_id"`
+	Code             string          `json:"code"`
+	Description      string          `json:"description"`
+	DistanceDisplay  string          `json:"distance_display"`
+	DistanceMeters   float64         `json:"distance_meters"`
+	Enabled          bool            `json:"enabled"`
+	Explanation      []RankingFactor `json:"explanation,omitempty"`
+	GeofenceRadiusKm float64         `json:"geofence_radius_km"`
+	Score            *float64        `json:"score,omitempty"`
+	Title            string          `json:"title"`
+	VariantID        string          `json:"variant_id,omitempty"`
+	VendorAddress    string          `json:"vendor_address"`
+	VendorID         string          `json:"vendor_id"`
+	VendorLat        float64         `json:"vendor_lat"`
+	VendorLng        float64         `json:"vendor_lng"`
+	VendorName       string          `json:"vendor_name"`
+	VendorType       string          `json:"vendor_type"`
+}
+
+type CampaignLocations struct {
+	BrandID    string   `json:"brand_id,omitempty"`
+	CampaignID string   `json:"campaign_id"`
+	Explicit   bool     `json:"explicit"`
+	VendorIDs  []string `json:"vendor_ids"`
+}
+
+type CampaignSchedule struct {
+	BlackoutDates []BlackoutDate `json:"blackout_dates"`
+	CampaignID    string         `json:"campaign_id"`
+	Rules         []ScheduleRule `json:"rules"`
+	Timezone      string         `json:"timezone"`
+}
+
+type CampaignScheduleStatus struct {
+	LiveNow  bool              `json:"live_now"`
+	Schedule *CampaignSchedule `json:"schedule"`
+}
+
+type CampaignVariant struct {
+	CampaignID  string  `json:"campaign_id"`
+	Code        *string `json:"code"`
+	Description *string `json:"description"`
+	IsControl   bool    `json:"is_control"`
+	Name        string  `json:"name"`
+	Title       string  `json:"title"`
+	VariantID   string  `json:"variant_id"`
+	Weight      int     `json:"weight"`
+}
+
+type DeletedUser struct {
+	Mode   string `json:"mode"`
+	UserID string `json:"user_id"`
+}
+
+type DeviceRequest struct {
+	IMEI string `json:"imei"`
+}
+
+type EngagementLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+type EngagementRequest struct {
+	Action string `json:"action"`
+}
+
+type EngagementResponse struct {
+	Duplicate  bool               `json:"duplicate"`
+	Engagement *EngagementSummary `json:"engagement,omitempty"`
+	Message    string             `json:"message"`
+	Success    bool               `json:"success"`
+}
+
+type EngagementSummary struct {
+	Action     string             `json:"action"`
+	CampaignID string             `json:"campaign_id"`
+	Location   EngagementLocation `json:"location"`
+	Timestamp  time.Time          `json:"timestamp"`
+	UserID     string             `json:"user_id"`
+}
+
+type ErasureRequest struct {
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	RequestID    string     `json:"request_id"`
+	RequestedAt  time.Time  `json:"requested_at"`
+	ScheduledFor time.Time  `json:"scheduled_for"`
+	Status       string     `json:"status"`
+	UserID       string     `json:"user_id"`
+}
+
+type ExperimentsZTest struct {
+	PValue      float64 `json:"p_value"`
+	Significant bool    `json:"significant"`
+	ZScore      float64 `json:"z_score"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type GeocodeAddress struct {
+	City        string `json:"city,omitempty"`
+	Country     string `json:"country,omitempty"`
+	Housenumber string `json:"housenumber,omitempty"`
+	Postcode    string `json:"postcode,omitempty"`
+	State       string `json:"state,omitempty"`
+	Street      string `json:"street,omitempty"`
+}
+
+type GeocodeResult struct {
+	Address        GeocodeAddress `json:"address"`
+	AddressID      int64          `json:"address_id"`
+	DistanceMeters float64        `json:"distance_meters,omitempty"`
+	Formatted      string         `json:"formatted"`
+	Lat            float64        `json:"lat"`
+	Lng            float64        `json:"lng"`
+	Score          float64        `json:"score,omitempty"`
+}
+
+type GeocodeSearchResult struct {
+	Normalized string          `json:"normalized"`
+	Query      string          `json:"query"`
+	Results    []GeocodeResult `json:"results"`
+}
+
+type GuestClickRequest struct {
+	Lat *float64 `json:"lat"`
+	Lng *float64 `json:"lng"`
+}
+
+type GuestSessionResponse struct {
+	ExpiresAt    time.Time `json:"expires_at"`
+	SessionID    string    `json:"session_id"`
+	SessionToken string    `json:"session_token"`
+}
+
+type HealthReport struct {
+	CheckedAt time.Time               `json:"checked_at"`
+	Checks    map[string]HealthResult `json:"checks"`
+	Status    string                  `json:"status"`
+}
+
+type HealthResult struct {
+	Details   map[string]json.RawMessage `json:"details,omitempty"`
+	Error     string                     `json:"error,omitempty"`
+	LatencyMs float64                    `json:"latency_ms"`
+	Status    string                     `json:"status"`
+}
+
+type JobRunnerStats struct {
+	Concurrency    int          `json:"concurrency"`
+	Counters       JobsCounters `json:"counters"`
+	PollIntervalMs int64        `json:"poll_interval_ms"`
+	RetryBaseMs    int64        `json:"retry_base_ms"`
+	RetryMaxMs     int64        `json:"retry_max_ms"`
+	TimeoutMs      int64        `json:"timeout_ms"`
+}
+
+type JobStats struct {
+	Queues []JobsQueueStats `json:"queues"`
+	Runner JobRunnerStats   `json:"runner"`
+}
+
+type JobsCounters struct {
+	Dead      int64 `json:"dead"`
+	Retried   int64 `json:"retried"`
+	Succeeded int64 `json:"succeeded"`
+}
+
+type JobsDeadJob struct {
+	Attempts  int             `json:"attempts"`
+	CreatedAt time.Time       `json:"created_at"`
+	FailedAt  time.Time       `json:"failed_at"`
+	JobID     int64           `json:"job_id"`
+	JobType   string          `json:"job_type"`
+	LastError string          `json:"last_error"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+type JobsQueueStats struct {
+	Dead     int    `json:"dead"`
+	JobType  string `json:"job_type"`
+	Ready    int    `json:"ready"`
+	Retrying int    `json:"retrying"`
+	Running  int    `json:"running"`
+}
+
+type Liveness struct {
+	Service string `json:"service"`
+	Status  string `json:"status"`
+}
+
+type LocationRequest struct {
+	Accuracy *float64 `json:"accuracy"`
+	Lat      *float64 `json:"lat"`
+	Lng      *float64 `json:"lng"`
+}
+
+type LoyaltyPointsEntry struct {
+	CampaignID *string   `json:"campaign_id"`
+	EarnedAt   time.Time `json:"earned_at"`
+	Multiplier float64   `json:"multiplier"`
+	Points     int       `json:"points"`
+	VendorID   *string   `json:"vendor_id"`
+}
+
+type LoyaltyReport struct {
+	Changed    int       `json:"changed"`
+	DurationMs int64     `json:"duration_ms"`
+	StartedAt  time.Time `json:"started_at"`
+	Users      int       `json:"users"`
+}
+
+type LoyaltyTier struct {
+	MinPoints int    `json:"min_points"`
+	Name      string `json:"name"`
+}
+
+type LoyaltyTierChange struct {
+	ChangedAt time.Time `json:"changed_at"`
+	NewTier   string    `json:"new_tier"`
+	OldTier   *string   `json:"old_tier"`
+	Points    int       `json:"points"`
+	Reason    string    `json:"reason"`
+}
+
+type OpeningPeriod struct {
+	Close string `json:"close"`
+	Open  string `json:"open"`
+}
+
+type RankingFactor struct {
+	Contribution float64 `json:"contribution"`
+	Name         string  `json:"name"`
+	Reason       string  `json:"reason,omitempty"`
+	Value        float64 `json:"value"`
+	Weight       float64 `json:"weight"`
+}
+
+type RegisterRequest struct {
+	IMEI   string `json:"imei"`
+	MSISDN string `json:"msisdn"`
+}
+
+type RequeuedJob struct {
+	JobID   int64  `json:"job_id"`
+	Message string `json:"message"`
+}
+
+type RetentionPolicySettings struct {
+	DryRun     bool `json:"dry_run"`
+	HourlyDays int  `json:"hourly_days"`
+	RawDays    int  `json:"raw_days"`
+}
+
+type RetentionReport struct {
+	DryRun             bool      `json:"dry_run"`
+	DurationMs         int64     `json:"duration_ms"`
+	HourlyCutoff       time.Time `json:"hourly_cutoff"`
+	HourlyRowsDeleted  int64     `json:"hourly_rows_deleted"`
+	HourlyRowsWritten  int64     `json:"hourly_rows_written"`
+	PartitionsCreated  int       `json:"partitions_created"`
+	PartitionsDropped  []string  `json:"partitions_dropped"`
+	RawCutoff          time.Time `json:"raw_cutoff"`
+	RawRowsDeleted     int64     `json:"raw_rows_deleted"`
+	RawRowsDownsampled int64     `json:"raw_rows_downsampled"`
+	StartedAt          time.Time `json:"started_at"`
+}
+
+type RetentionStatus struct {
+	Policy RetentionPolicySettings `json:"policy"`
+	Stats  RetentionTotals         `json:"stats"`
+}
+
+type RetentionTotals struct {
+	Failures                int64            `json:"failures"`
+	HourlyRowsDeletedTotal  int64            `json:"hourly_rows_deleted_total"`
+	HourlyRowsWrittenTotal  int64            `json:"hourly_rows_written_total"`
+	LastError               string           `json:"last_error,omitempty"`
+	LastReport              *RetentionReport `json:"last_report,omitempty"`
+	LastRunAt               time.Time        `json:"last_run_at"`
+	PartitionsDroppedTotal  int64            `json:"partitions_dropped_total"`
+	RawRowsDeletedTotal     int64            `json:"raw_rows_deleted_total"`
+	RawRowsDownsampledTotal int64            `json:"raw_rows_downsampled_total"`
+	Runs                    int64            `json:"runs"`
+}
+
+type ScheduleRule struct {
+	DaysOfWeek []int  `json:"days_of_week"`
+	EndTime    string `json:"end_time"`
+	ScheduleID string `json:"schedule_id,omitempty"`
+	StartTime  string `json:"start_time"`
+}
+
+type User struct {
+	CreatedAt              time.Time  `json:"created_at"`
+	DeviceBoundAt          *time.Time `json:"device_bound_at,omitempty"`
+	IMEI                   string     `json:"imei"`
+	LoyaltyTier            string     `json:"loyalty_tier"`
+	MostFrequentVendor     string     `json:"most_frequent_vendor"`
+	MostFrequentVendorType string     `json:"most_frequent_vendor_type"`
+	MSISDN                 string     `json:"msisdn"`
+	MSISDNVerifiedAt       *time.Time `json:"msisdn_verified_at,omitempty"`
+	NotifInapp             bool       `json:"notif_inapp"`
+	NotifSMS               bool       `json:"notif_sms"`
+	NotifWhatsapp          bool       `json:"notif_whatsapp"`
+	Privacy                bool       `json:"privacy"`
+	UpdatedAt              *time.Time `json:"updated_at"`
+	UserID                 string     `json:"user_id"`
+}
+
+type UserAffinities struct {
+	HalfLifeDays float64          `json:"half_life_days"`
+	UserID       string           `json:"user_id"`
+	VendorTypes  []AffinityWeight `json:"vendor_types"`
+	Vendors      []AffinityWeight `json:"vendors"`
+}
+
+type UserLocation struct {
+	AccuracyM  *float64 `json:"accuracy_m"`
+	AgeSeconds int      `json:"age_seconds"`
+	FixTime    string   `json:"fix_time"`
+	Latitude   float64  `json:"latitude"`
+	Longitude  float64  `json:"longitude"`
+	Message    string   `json:"message"`
+	Stale      bool     `json:"stale"`
+	UserID     string   `json:"user_id"`
+}
+
+type UserLoyalty struct {
+	NextTier         string               `json:"next_tier,omitempty"`
+	Points           int                  `json:"points"`
+	PointsToNextTier int                  `json:"points_to_next_tier,omitempty"`
+	RecentPoints     []LoyaltyPointsEntry `json:"recent_points"`
+	Tier             string               `json:"tier"`
+	TierHistory      []LoyaltyTierChange  `json:"tier_history"`
+	Tiers            []LoyaltyTier        `json:"tiers"`
+	UserID           string               `json:"user_id"`
+	WindowDays       int                  `json:"window_days"`
+}
+
+type UserSettingsRequest struct {
+	NotifInapp    *bool `json:"notif_inapp,omitempty"`
+	NotifSMS      *bool `json:"notif_sms,omitempty"`
+	NotifWhatsapp *bool `json:"notif_whatsapp,omitempty"`
+	Privacy       *bool `json:"privacy,omitempty"`
+}
+
+type VariantMetrics struct {
+	ClickRate      float64           `json:"click_rate"`
+	Clickers       int               `json:"clickers"`
+	ConversionRate float64           `json:"conversion_rate"`
+	Exposures      int               `json:"exposures"`
+	IsControl      bool              `json:"is_control"`
+	LiftVsControl  *float64          `json:"lift_vs_control,omitempty"`
+	Name           string            `json:"name"`
+	Redeemers      int               `json:"redeemers"`
+	Significance   *ExperimentsZTest `json:"significance,omitempty"`
+	VariantID      string            `json:"variant_id"`
+	Weight         int               `json:"weight"`
+}
+
+type Vendor struct {
+	Address      string                     `json:"address"`
+	BrandID      *string                    `json:"brand_id"`
+	ContactEmail string                     `json:"contact_email,omitempty"`
+	ContactPhone string                     `json:"contact_phone,omitempty"`
+	CreatedAt    *time.Time                 `json:"created_at,omitempty"`
+	DisplayName  string                     `json:"display_name"`
+	Lat          float64                    `json:"lat"`
+	Lng          float64                    `json:"lng"`
+	OpeningHours map[string][]OpeningPeriod `json:"opening_hours"`
+	Timezone     string                     `json:"timezone"`
+	UpdatedAt    *time.Time                 `json:"updated_at,omitempty"`
+	VendorID     string                     `json:"vendor_id"`
+	VendorType   string                     `json:"vendor_type"`
+}
+
+type VendorAnalytics struct {
+	Campaigns     []VendorCampaignMetrics `json:"campaigns"`
+	VendorID      string                  `json:"vendor_id"`
+	VendorSummary VendorSummary           `json:"vendor_summary"`
+}
+
+type VendorCampaignMetrics struct {
+	CampaignID  string           `json:"campaign_id"`
+	Code        string           `json:"code"`
+	Enabled     bool             `json:"enabled"`
+	Title       string           `json:"title"`
+	TotalClicks int              `json:"total_clicks"`
+	TotalUses   int              `json:"total_uses"`
+	Variants    []VariantMetrics `json:"variants,omitempty"`
+}
+
+type VendorLoyalty struct {
+	Multiplier   float64 `json:"multiplier"`
+	PointsPerUse int     `json:"points_per_use"`
+	VendorID     string  `json:"vendor_id"`
+}
+
+type VendorLoyaltyRequest struct {
+	Multiplier *float64 `json:"multiplier"`
+}
+
+type VendorSummary struct {
+	OverallConversionRate float64 `json:"overall_conversion_rate"`
+	TotalCampaigns        int     `json:"total_campaigns"`
+	TotalClicks           int     `json:"total_clicks"`
+	TotalUniqueUsers      int     `json:"total_unique_users"`
+	TotalUses             int     `json:"total_uses"`
+}
+
+type VerificationChallenge struct {
+	ChallengeID string    `json:"challenge_id"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+type VerifyDeviceRequest struct {
+	ChallengeID string `json:"challenge_id"`
+	Code        string `json:"code"`
+}
+
+type VerifyRegistrationRequest struct {
+	ChallengeID string `json:"challenge_id"`
+	Code        string `json:"code"`
+	GuestToken  string `json:"guest_token,omitempty"`
+}
+
+// GetOpenAPI calls GET /api/openapi.json
+//
+// This document
+func (c *Client) GetOpenAPI(ctx context.Context) (json.RawMessage, error) {
+	var out json.RawMessage
+	_, err := c.do(ctx, "GET", "/api/openapi.json", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetJobStats calls GET /api/v1/admin/jobs
+//
+// Job runner settings and counters, and the queue per job type
+func (c *Client) GetJobStats(ctx context.Context) (*JobStats, error) {
+	var out JobStats
+	_, err := c.do(ctx, "GET", "/api/v1/admin/jobs", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListDeadJobsParams are the query parameters of ListDeadJobs
+type ListDeadJobsParams struct {
+	// Only this job type
+	Type string
+	// Most jobs, 1-500 (default 50)
+	Limit *int
+}
+
+func (p *ListDeadJobsParams) values() url.Values {
+	q := url.Values{}
+	if p == nil {
+		return q
+	}
+	if p.Type != "" {
+		q.Set("type", p.Type)
+	}
+	if p.Limit != nil {
+		q.Set("limit", strconv.Itoa(*p.Limit))
+	}
+	return q
+}
+
+// ListDeadJobs calls GET /api/v1/admin/jobs/dead
+//
+// Jobs that ran out of attempts, newest first
+func (c *Client) ListDeadJobs(ctx context.Context, params *ListDeadJobsParams) ([]JobsDeadJob, error) {
+	var out []JobsDeadJob
+	_, err := c.do(ctx, "GET", "/api/v1/admin/jobs/dead", params.values(), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RetryDeadJob calls POST /api/v1/admin/jobs/dead/{job_id}/retry
+//
+// Put a dead job back on the queue with fresh attempts
+func (c *Client) RetryDeadJob(ctx context.Context, jobID string) (*RequeuedJob, error) {
+	var out RequeuedJob
+	_, err := c.do(ctx, "POST", "/api/v1/admin/jobs/dead/"+url.PathEscape(jobID)+"/retry", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RecalculateLoyalty calls POST /api/v1/admin/loyalty/recalculate
+//
+// Recalculate every user's loyalty tier now
+func (c *Client) RecalculateLoyalty(ctx context.Context) (*LoyaltyReport, error) {
+	var out LoyaltyReport
+	_, err := c.do(ctx, "POST", "/api/v1/admin/loyalty/recalculate", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetRetentionStats calls GET /api/v1/admin/retention
+//
+// Location retention policy and worker counters
+func (c *Client) GetRetentionStats(ctx context.Context) (*RetentionStatus, error) {
+	var out RetentionStatus
+	_, err := c.do(ctx, "GET", "/api/v1/admin/retention", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RunRetentionParams are the query parameters of RunRetention
+type RunRetentionParams struct {
+	// Only report what would change
+	DryRun *bool
+}
+
+func (p *RunRetentionParams) values() url.Values {
+	q := url.Values{}
+	if p == nil {
+		return q
+	}
+	if p.DryRun != nil {
+		q.Set("dry_run", strconv.FormatBool(*p.DryRun))
+	}
+	return q
+}
+
+// RunRetention calls POST /api/v1/admin/retention/run
+//
+// Run location retention now
+func (c *Client) RunRetention(ctx context.Context, params *RunRetentionParams) (*RetentionReport, error) {
+	var out RetentionReport
+	_, err := c.do(ctx, "POST", "/api/v1/admin/retention/run", params.values(), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetBrand calls GET /api/v1/brands/{brand_id}
+//
+// Get a brand profile with its store locations
+func (c *Client) GetBrand(ctx context.Context, brandID string) (*Brand, error) {
+	var out Brand
+	_, err := c.do(ctx, "GET", "/api/v1/brands/"+url.PathEscape(brandID), nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateBrand calls PUT /api/v1/brands/{brand_id}
+//
+// Update a brand's display name, logo and contact details
+func (c *Client) UpdateBrand(ctx context.Context, brandID string, body Brand) (*Brand, error) {
+	var out Brand
+	_, err := c.do(ctx, "PUT", "/api/v1/brands/"+url.PathEscape(brandID), nil, nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetBrandAnalytics calls GET /api/v1/brands/{brand_id}/analytics
+//
+// Clicks, uses and conversion across a brand, per location and per campaign
+func (c *Client) GetBrandAnalytics(ctx context.Context, brandID string) (*BrandAnalytics, error) {
+	var out BrandAnalytics
+	_, err := c.do(ctx, "GET", "/api/v1/brands/"+url.PathEscape(brandID)+"/analytics", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AddBrandLocation calls POST /api/v1/brands/{brand_id}/locations
+//
+// Add a store location to a brand
+func (c *Client) AddBrandLocation(ctx context.Context, brandID string, body Vendor) (*Vendor, error) {
+	var out Vendor
+	_, err := c.do(ctx, "POST", "/api/v1/brands/"+url.PathEscape(brandID)+"/locations", nil, nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetCampaignBudget calls GET /api/v1/campaigns/{campaign_id}/budget
+//
+// Budget limits and current usage
+func (c *Client) GetCampaignBudget(ctx context.Context, campaignID string) (*CampaignBudget, error) {
+	var out CampaignBudget
+	_, err := c.do(ctx, "GET", "/api/v1/campaigns/"+url.PathEscape(campaignID)+"/budget", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateCampaignBudget calls PUT /api/v1/campaigns/{campaign_id}/budget
+//
+// Set max uses, max uses per day and max distinct users
+func (c *Client) UpdateCampaignBudget(ctx context.Context, campaignID string, body CampaignBudget) (*CampaignBudget, error) {
+	var out CampaignBudget
+	_, err := c.do(ctx, "PUT", "/api/v1/campaigns/"+url.PathEscape(campaignID)+"/budget", nil, nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetCampaignLocations calls GET /api/v1/campaigns/{campaign_id}/locations
+//
+// List the store locations a campaign runs at
+func (c *Client) GetCampaignLocations(ctx context.Context, campaignID string) (*CampaignLocations, error) {
+	var out CampaignLocations
+	_, err := c.do(ctx, "GET", "/api/v1/campaigns/"+url.PathEscape(campaignID)+"/locations", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateCampaignLocations calls PUT /api/v1/campaigns/{campaign_id}/locations
+//
+// Run a campaign at several of its brand's locations
+func (c *Client) UpdateCampaignLocations(ctx context.Context, campaignID string, body CampaignLocations) (*CampaignLocations, error) {
+	var out CampaignLocations
+	_, err := c.do(ctx, "PUT", "/api/v1/campaigns/"+url.PathEscape(campaignID)+"/locations", nil, nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetCampaignSchedule calls GET /api/v1/campaigns/{campaign_id}/schedule
+//
+// Dayparts, blackout dates and whether the campaign is live now
+func (c *Client) GetCampaignSchedule(ctx context.Context, campaignID string) (*CampaignScheduleStatus, error) {
+	var out CampaignScheduleStatus
+	_, err := c.do(ctx, "GET", "/api/v1/campaigns/"+url.PathEscape(campaignID)+"/schedule", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateCampaignSchedule calls PUT /api/v1/campaigns/{campaign_id}/schedule
+//
+// Replace a campaign's dayparts and blackout dates; the timezone comes from the vendor profile
+func (c *Client) UpdateCampaignSchedule(ctx context.Context, campaignID string, body CampaignSchedule) (*CampaignSchedule, error) {
+	var out CampaignSchedule
+	_, err := c.do(ctx, "PUT", "/api/v1/campaigns/"+url.PathEscape(campaignID)+"/schedule", nil, nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetCampaignVariants calls GET /api/v1/campaigns/{campaign_id}/variants
+//
+// List A/B test variants
+func (c *Client) GetCampaignVariants(ctx context.Context, campaignID string) ([]CampaignVariant, error) {
+	var out []CampaignVariant
+	_, err := c.do(ctx, "GET", "/api/v1/campaigns/"+url.PathEscape(campaignID)+"/variants", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateCampaignVariant calls POST /api/v1/campaigns/{campaign_id}/variants
+//
+// Add a variant
+func (c *Client) CreateCampaignVariant(ctx context.Context, campaignID string, body CampaignVariant) (*CampaignVariant, error) {
+	var out CampaignVariant
+	_, err := c.do(ctx, "POST", "/api/v1/campaigns/"+url.PathEscape(campaignID)+"/variants", nil, nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteCampaignVariant calls DELETE /api/v1/campaigns/{campaign_id}/variants/{variant_id}
+//
+// Remove a variant
+func (c *Client) DeleteCampaignVariant(ctx context.Context, campaignID string, variantID string) error {
+	_, err := c.do(ctx, "DELETE", "/api/v1/campaigns/"+url.PathEscape(campaignID)+"/variants/"+url.PathEscape(variantID), nil, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateCampaignVariant calls PUT /api/v1/campaigns/{campaign_id}/variants/{variant_id}
+//
+// Update a variant's creative or weight
+func (c *Client) UpdateCampaignVariant(ctx context.Context, campaignID string, variantID string, body CampaignVariant) (*CampaignVariant, error) {
+	var out CampaignVariant
+	_, err := c.do(ctx, "PUT", "/api/v1/campaigns/"+url.PathEscape(campaignID)+"/variants/"+url.PathEscape(variantID), nil, nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ReverseGeocodeParams are the query parameters of ReverseGeocode
+type ReverseGeocodeParams struct {
+	Lat *float64
+	Lng *float64
+}
+
+func (p *ReverseGeocodeParams) values() url.Values {
+	q := url.Values{}
+	if p == nil {
+		return q
+	}
+	if p.Lat != nil {
+		q.Set("lat", strconv.FormatFloat(*p.Lat, 'f', -1, 64))
+	}
+	if p.Lng != nil {
+		q.Set("lng", strconv.FormatFloat(*p.Lng, 'f', -1, 64))
+	}
+	return q
+}
+
+// ReverseGeocode calls GET /api/v1/geocode/reverse
+//
+// Nearest known address to a point
+func (c *Client) ReverseGeocode(ctx context.Context, params *ReverseGeocodeParams) (*GeocodeResult, error) {
+	var out GeocodeResult
+	_, err := c.do(ctx, "GET", "/api/v1/geocode/reverse", params.values(), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GeocodeSearchParams are the query parameters of GeocodeSearch
+type GeocodeSearchParams struct {
+	// Address
+	Q string
+	// Most results, 1-10 (default 5)
+	Limit *int
+}
+
+func (p *GeocodeSearchParams) values() url.Values {
+	q := url.Values{}
+	if p == nil {
+		return q
+	}
+	if p.Q != "" {
+		q.Set("q", p.Q)
+	}
+	if p.Limit != nil {
+		q.Set("limit", strconv.Itoa(*p.Limit))
+	}
+	return q
+}
+
+// GeocodeSearch calls GET /api/v1/geocode/search
+//
+// Look up an address
+func (c *Client) GeocodeSearch(ctx context.Context, params *GeocodeSearchParams) (*GeocodeSearchResult, error) {
+	var out GeocodeSearchResult
+	_, err := c.do(ctx, "GET", "/api/v1/geocode/search", params.values(), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RecordGuestClick calls POST /api/v1/guest/engagements/{campaign_id}
+//
+// Record a guest's click
+func (c *Client) RecordGuestClick(ctx context.Context, campaignID string, guestToken string, body GuestClickRequest) (*EngagementResponse, error) {
+	header := http.Header{}
+	header.Set("X-Guest-Token", guestToken)
+	var out EngagementResponse
+	_, err := c.do(ctx, "POST", "/api/v1/guest/engagements/"+url.PathEscape(campaignID), nil, header, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetGuestNearbyCampaignsParams are the query parameters of GetGuestNearbyCampaigns
+type GetGuestNearbyCampaignsParams struct {
+	// Latitude of the guest
+	Lat *float64
+	// Longitude of the guest
+	Lng *float64
+	// Page size, 1-100 (default 50)
+	Limit *int
+	// X-Next-Cursor of the previous page
+	Cursor string
+	// Only this vendor type
+	VendorType string
+	// Only campaigns this close, in meters
+	MaxDistanceM *float64
+	// Search in title and description
+	Q string
+	// Only campaigns ending within 3 days
+	ExpiringSoon *bool
+}
+
+func (p *GetGuestNearbyCampaignsParams) values() url.Values {
+	q := url.Values{}
+	if p == nil {
+		return q
+	}
+	if p.Lat != nil {
+		q.Set("lat", strconv.FormatFloat(*p.Lat, 'f', -1, 64))
+	}
+	if p.Lng != nil {
+		q.Set("lng", strconv.FormatFloat(*p.Lng, 'f', -1, 64))
+	}
+	if p.Limit != nil {
+		q.Set("limit", strconv.Itoa(*p.Limit))
+	}
+	if p.Cursor != "" {
+		q.Set("cursor", p.Cursor)
+	}
+	if p.VendorType != "" {
+		q.Set("vendor_type", p.VendorType)
+	}
+	if p.MaxDistanceM != nil {
+		q.Set("max_distance_m", strconv.FormatFloat(*p.MaxDistanceM, 'f', -1, 64))
+	}
+	if p.Q != "" {
+		q.Set("q", p.Q)
+	}
+	if p.ExpiringSoon != nil {
+		q.Set("expiring_soon", strconv.FormatBool(*p.ExpiringSoon))
+	}
+	return q
+}
+
+// GetGuestNearbyCampaigns calls GET /api/v1/guest/nearby-campaigns
+//
+// # Campaigns for everyone whose geofence covers the position, nearest first
+//
+// Also returns the X-Next-Cursor response header.
+func (c *Client) GetGuestNearbyCampaigns(ctx context.Context, guestToken string, params *GetGuestNearbyCampaignsParams) ([]CampaignListItem, string, error) {
+	header := http.Header{}
+	header.Set("X-Guest-Token", guestToken)
+	var out []CampaignListItem
+	respHeader, err := c.do(ctx, "GET", "/api/v1/guest/nearby-campaigns", params.values(), header, nil, &out)
+	if err != nil {
+		return nil, "", err
+	}
+	return out, respHeader.Get("X-Next-Cursor"), nil
+}
+
+// CreateGuestSession calls POST /api/v1/guest/sessions
+//
+// Start a guest session
+func (c *Client) CreateGuestSession(ctx context.Context) (*GuestSessionResponse, error) {
+	var out GuestSessionResponse
+	_, err := c.do(ctx, "POST", "/api/v1/guest/sessions", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetHealth calls GET /api/v1/health
+//
+// Same as /health/ready
+func (c *Client) GetHealth(ctx context.Context) (*HealthReport, error) {
+	var out HealthReport
+	_, err := c.do(ctx, "GET", "/api/v1/health", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetLiveness calls GET /api/v1/health/live
+//
+// 200 while the process is serving
+func (c *Client) GetLiveness(ctx context.Context) (*Liveness, error) {
+	var out Liveness
+	_, err := c.do(ctx, "GET", "/api/v1/health/live", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetReadiness calls GET /api/v1/health/ready
+//
+// Dependency checks; 503 when any fails
+func (c *Client) GetReadiness(ctx context.Context) (*HealthReport, error) {
+	var out HealthReport
+	_, err := c.do(ctx, "GET", "/api/v1/health/ready", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RegisterUser calls POST /api/v1/users/register
+//
+// Start registration; sends a verification code to the phone number
+func (c *Client) RegisterUser(ctx context.Context, body RegisterRequest) (*VerificationChallenge, error) {
+	var out VerificationChallenge
+	_, err := c.do(ctx, "POST", "/api/v1/users/register", nil, nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// VerifyRegistration calls POST /api/v1/users/register/verify
+//
+// Finish registration: 201 for a new account, 200 for an existing one on a new device
+func (c *Client) VerifyRegistration(ctx context.Context, body VerifyRegistrationRequest) (*User, error) {
+	var out User
+	_, err := c.do(ctx, "POST", "/api/v1/users/register/verify", nil, nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteUser calls DELETE /api/v1/users/{id}
+//
+// Delete an account, keeping engagements under an anonymous ID
+func (c *Client) DeleteUser(ctx context.Context, id string) (*DeletedUser, error) {
+	var out DeletedUser
+	_, err := c.do(ctx, "DELETE", "/api/v1/users/"+url.PathEscape(id), nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetUser calls GET /api/v1/users/{id}
+//
+// Get a user profile
+func (c *Client) GetUser(ctx context.Context, id string) (*User, error) {
+	var out User
+	_, err := c.do(ctx, "GET", "/api/v1/users/"+url.PathEscape(id), nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateUser calls PUT /api/v1/users/{id}
+//
+// Update notification and privacy settings
+func (c *Client) UpdateUser(ctx context.Context, id string, body UserSettingsRequest) (*User, error) {
+	var out User
+	_, err := c.do(ctx, "PUT", "/api/v1/users/"+url.PathEscape(id), nil, nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetUserAffinities calls GET /api/v1/users/{id}/affinities
+//
+// Strongest stores and store types from the user's redemptions
+func (c *Client) GetUserAffinities(ctx context.Context, id string) (*UserAffinities, error) {
+	var out UserAffinities
+	_, err := c.do(ctx, "GET", "/api/v1/users/"+url.PathEscape(id)+"/affinities", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetPrivacyAudit calls GET /api/v1/users/{id}/audit
+//
+// Privacy audit trail, kept after erasure
+func (c *Client) GetPrivacyAudit(ctx context.Context, id string) ([]AuditEntry, error) {
+	var out []AuditEntry
+	_, err := c.do(ctx, "GET", "/api/v1/users/"+url.PathEscape(id)+"/audit", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RequestDeviceRebind calls POST /api/v1/users/{id}/device
+//
+// Move the account to a new device; sends a code to the account's phone
+func (c *Client) RequestDeviceRebind(ctx context.Context, id string, body DeviceRequest) (*VerificationChallenge, error) {
+	var out VerificationChallenge
+	_, err := c.do(ctx, "POST", "/api/v1/users/"+url.PathEscape(id)+"/device", nil, nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// VerifyDeviceRebind calls POST /api/v1/users/{id}/device/verify
+//
+// Confirm the new device
+func (c *Client) VerifyDeviceRebind(ctx context.Context, id string, body VerifyDeviceRequest) (*User, error) {
+	var out User
+	_, err := c.do(ctx, "POST", "/api/v1/users/"+url.PathEscape(id)+"/device/verify", nil, nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CancelErasure calls DELETE /api/v1/users/{id}/erasure
+//
+// Cancel a pending erasure request
+func (c *Client) CancelErasure(ctx context.Context, id string) (*ErasureRequest, error) {
+	var out ErasureRequest
+	_, err := c.do(ctx, "DELETE", "/api/v1/users/"+url.PathEscape(id)+"/erasure", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetErasure calls GET /api/v1/users/{id}/erasure
+//
+// Status of the latest erasure request
+func (c *Client) GetErasure(ctx context.Context, id string) (*ErasureRequest, error) {
+	var out ErasureRequest
+	_, err := c.do(ctx, "GET", "/api/v1/users/"+url.PathEscape(id)+"/erasure", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RequestErasure calls POST /api/v1/users/{id}/erasure
+//
+// Request erasure after the grace period: 202, or 200 with the request already pending
+func (c *Client) RequestErasure(ctx context.Context, id string) (*ErasureRequest, error) {
+	var out ErasureRequest
+	_, err := c.do(ctx, "POST", "/api/v1/users/"+url.PathEscape(id)+"/erasure", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ExportUserData calls GET /api/v1/users/{id}/export
+//
+// Download a ZIP of everything stored about the user
+func (c *Client) ExportUserData(ctx context.Context, id string) ([]byte, error) {
+	var out []byte
+	_, err := c.do(ctx, "GET", "/api/v1/users/"+url.PathEscape(id)+"/export", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetUserLocation calls GET /api/v1/users/{id}/location
+//
+// The user's newest location fix
+func (c *Client) GetUserLocation(ctx context.Context, id string) (*UserLocation, error) {
+	var out UserLocation
+	_, err := c.do(ctx, "GET", "/api/v1/users/"+url.PathEscape(id)+"/location", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RecordUserLocation calls POST /api/v1/users/{id}/location
+//
+// Record a location fix; it becomes the user's current location
+func (c *Client) RecordUserLocation(ctx context.Context, id string, body LocationRequest) (*UserLocation, error) {
+	var out UserLocation
+	_, err := c.do(ctx, "POST", "/api/v1/users/"+url.PathEscape(id)+"/location", nil, nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetUserLoyalty calls GET /api/v1/users/{id}/loyalty
+//
+// Loyalty tier, points, progress to the next tier and history
+func (c *Client) GetUserLoyalty(ctx context.Context, id string) (*UserLoyalty, error) {
+	var out UserLoyalty
+	_, err := c.do(ctx, "GET", "/api/v1/users/"+url.PathEscape(id)+"/loyalty", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetNearbyCampaignsParams are the query parameters of GetNearbyCampaigns
+type GetNearbyCampaignsParams struct {
+	// distance or relevance
+	Sort string
+	// Page size, 1-100 (default 50)
+	Limit *int
+	// X-Next-Cursor of the previous page
+	Cursor string
+	// Only this vendor type
+	VendorType string
+	// Only campaigns this close, in meters
+	MaxDistanceM *float64
+	// Search in title and description
+	Q string
+	// Only campaigns ending within 3 days
+	ExpiringSoon *bool
+	// Use this position instead of the stored location
+	Lat *float64
+	// Use this position instead of the stored location
+	Lng *float64
+	// Accuracy of lat and lng, in meters
+	Accuracy *float64
+	// Also record lat and lng as a location event
+	Save *bool
+}
+
+func (p *GetNearbyCampaignsParams) values() url.Values {
+	q := url.Values{}
+	if p == nil {
+		return q
+	}
+	if p.Sort != "" {
+		q.Set("sort", p.Sort)
+	}
+	if p.Limit != nil {
+		q.Set("limit", strconv.Itoa(*p.Limit))
+	}
+	if p.Cursor != "" {
+		q.Set("cursor", p.Cursor)
+	}
+	if p.VendorType != "" {
+		q.Set("vendor_type", p.VendorType)
+	}
+	if p.MaxDistanceM != nil {
+		q.Set("max_distance_m", strconv.FormatFloat(*p.MaxDistanceM, 'f', -1, 64))
+	}
+	if p.Q != "" {
+		q.Set("q", p.Q)
+	}
+	if p.ExpiringSoon != nil {
+		q.Set("expiring_soon", strconv.FormatBool(*p.ExpiringSoon))
+	}
+	if p.Lat != nil {
+		q.Set("lat", strconv.FormatFloat(*p.Lat, 'f', -1, 64))
+	}
+	if p.Lng != nil {
+		q.Set("lng", strconv.FormatFloat(*p.Lng, 'f', -1, 64))
+	}
+	if p.Accuracy != nil {
+		q.Set("accuracy", strconv.FormatFloat(*p.Accuracy, 'f', -1, 64))
+	}
+	if p.Save != nil {
+		q.Set("save", strconv.FormatBool(*p.Save))
+	}
+	return q
+}
+
+// GetNearbyCampaigns calls GET /api/v1/users/{id}/nearby-campaigns
+//
+// Campaigns near the user, personalized; best match first by default
+//
+// Also returns the X-Next-Cursor response header.
+func (c *Client) GetNearbyCampaigns(ctx context.Context, id string, params *GetNearbyCampaignsParams) ([]CampaignListItem, string, error) {
+	var out []CampaignListItem
+	respHeader, err := c.do(ctx, "GET", "/api/v1/users/"+url.PathEscape(id)+"/nearby-campaigns", params.values(), nil, nil, &out)
+	if err != nil {
+		return nil, "", err
+	}
+	return out, respHeader.Get("X-Next-Cursor"), nil
+}
+
+// GetDistanceSortedCampaignsParams are the query parameters of GetDistanceSortedCampaigns
+type GetDistanceSortedCampaignsParams struct {
+	// distance or relevance
+	Sort string
+	// Page size, 1-100 (default 50)
+	Limit *int
+	// X-Next-Cursor of the previous page
+	Cursor string
+	// Only this vendor type
+	VendorType string
+	// Only campaigns this close, in meters
+	MaxDistanceM *float64
+	// Search in title and description
+	Q string
+	// Only campaigns ending within 3 days
+	ExpiringSoon *bool
+	// Use this position instead of the stored location
+	Lat *float64
+	// Use this position instead of the stored location
+	Lng *float64
+	// Accuracy of lat and lng, in meters
+	Accuracy *float64
+	// Also record lat and lng as a location event
+	Save *bool
+}
+
+func (p *GetDistanceSortedCampaignsParams) values() url.Values {
+	q := url.Values{}
+	if p == nil {
+		return q
+	}
+	if p.Sort != "" {
+		q.Set("sort", p.Sort)
+	}
+	if p.Limit != nil {
+		q.Set("limit", strconv.Itoa(*p.Limit))
+	}
+	if p.Cursor != "" {
+		q.Set("cursor", p.Cursor)
+	}
+	if p.VendorType != "" {
+		q.Set("vendor_type", p.VendorType)
+	}
+	if p.MaxDistanceM != nil {
+		q.Set("max_distance_m", strconv.FormatFloat(*p.MaxDistanceM, 'f', -1, 64))
+	}
+	if p.Q != "" {
+		q.Set("q", p.Q)
+	}
+	if p.ExpiringSoon != nil {
+		q.Set("expiring_soon", strconv.FormatBool(*p.ExpiringSoon))
+	}
+	if p.Lat != nil {
+		q.Set("lat", strconv.FormatFloat(*p.Lat, 'f', -1, 64))
+	}
+	if p.Lng != nil {
+		q.Set("lng", strconv.FormatFloat(*p.Lng, 'f', -1, 64))
+	}
+	if p.Accuracy != nil {
+		q.Set("accuracy", strconv.FormatFloat(*p.Accuracy, 'f', -1, 64))
+	}
+	if p.Save != nil {
+		q.Set("save", strconv.FormatBool(*p.Save))
+	}
+	return q
+}
+
+// GetDistanceSortedCampaigns calls GET /api/v1/users/{user_id}/campaigns/distance-sorted
+//
+// # Nearest active campaigns for the user
+//
+// Also returns the X-Next-Cursor response header.
+func (c *Client) GetDistanceSortedCampaigns(ctx context.Context, userID string, params *GetDistanceSortedCampaignsParams) ([]CampaignListItem, string, error) {
+	var out []CampaignListItem
+	respHeader, err := c.do(ctx, "GET", "/api/v1/users/"+url.PathEscape(userID)+"/campaigns/distance-sorted", params.values(), nil, nil, &out)
+	if err != nil {
+		return nil, "", err
+	}
+	return out, respHeader.Get("X-Next-Cursor"), nil
+}
+
+// RecordEngagement calls POST /api/v1/users/{user_id}/campaigns/{campaign_id}/engage
+//
+// Record a click or use of a campaign
+func (c *Client) RecordEngagement(ctx context.Context, userID string, campaignID string, body EngagementRequest) (*EngagementResponse, error) {
+	var out EngagementResponse
+	_, err := c.do(ctx, "POST", "/api/v1/users/"+url.PathEscape(userID)+"/campaigns/"+url.PathEscape(campaignID)+"/engage", nil, nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RegisterVendor calls POST /api/v1/vendors/register
+//
+// Register a brand with one or more store locations
+func (c *Client) RegisterVendor(ctx context.Context, body Brand) (*Brand, error) {
+	var out Brand
+	_, err := c.do(ctx, "POST", "/api/v1/vendors/register", nil, nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetVendor calls GET /api/v1/vendors/{vendor_id}
+//
+// Get a store location's profile
+func (c *Client) GetVendor(ctx context.Context, vendorID string) (*Vendor, error) {
+	var out Vendor
+	_, err := c.do(ctx, "GET", "/api/v1/vendors/"+url.PathEscape(vendorID), nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateVendor calls PUT /api/v1/vendors/{vendor_id}
+//
+// Update a store location's profile and coordinates
+func (c *Client) UpdateVendor(ctx context.Context, vendorID string, body Vendor) (*Vendor, error) {
+	var out Vendor
+	_, err := c.do(ctx, "PUT", "/api/v1/vendors/"+url.PathEscape(vendorID), nil, nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetVendorAnalytics calls GET /api/v1/vendors/{vendor_id}/analytics
+//
+// Engagements with the campaigns running at a store
+func (c *Client) GetVendorAnalytics(ctx context.Context, vendorID string) (*VendorAnalytics, error) {
+	var out VendorAnalytics
+	_, err := c.do(ctx, "GET", "/api/v1/vendors/"+url.PathEscape(vendorID)+"/analytics", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateVendorLoyalty calls PUT /api/v1/vendors/{vendor_id}/loyalty
+//
+// Set the loyalty points multiplier for offers used at a store
+func (c *Client) UpdateVendorLoyalty(ctx context.Context, vendorID string, body VendorLoyaltyRequest) (*VendorLoyalty, error) {
+	var out VendorLoyalty
+	_, err := c.do(ctx, "PUT", "/api/v1/vendors/"+url.PathEscape(vendorID)+"/loyalty", nil, nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetMetrics calls GET /metrics
+//
+// Prometheus metrics
+func (c *Client) GetMetrics(ctx context.Context) ([]byte, error) {
+	var out []byte
+	_, err := c.do(ctx, "GET", "/metrics", nil, nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,166 @@
+// Command geoimport loads an address dataset into geocode_addresses for the
+// offline geocoder.
+//
+// The input is a CSV with a header row naming any of the columns id, lat,
+// lon (or lng), housenumber, street, city, postcode, state and country;
+// lat and lon are required. An OSM extract's addr:* points can be exported to
+// this shape with ogr2ogr or osmium. Rows are upserted by (source, id), so an
+// updated extract can be re-imported over the old one.
+//
+//	go run ./cmd/geoimport -file texas-addresses.csv -source osm
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"streetsavvy-backend/config"
+	"streetsavvy-backend/geocode"
+
+	"github.com/joho/godotenv"
+)
+
+const batchSize = 5000
+
+func main() {
+	file := flag.String("file", "", "CSV file to import")
+	source := flag.String("source", "osm", "dataset name stored with each row")
+	flag.Parse()
+
+	if *file == "" {
+		log.Fatal("-file is required")
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using system environment variables")
+	}
+	cfg, err := config.Load(nil)
+	if err != nil {
+		log.Fatal("Invalid configuration:", err)
+	}
+	if err := config.InitDB(cfg.Database); err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatal("Failed to open dataset:", err)
+	}
+	defer f.Close()
+
+	imported, skipped, err := importCSV(f, *source)
+	if err != nil {
+		log.Fatal("Import failed:", err)
+	}
+	log.Printf("Imported %d addresses from %s (%d rows skipped)", imported, *file, skipped)
+}
+
+// importCSV upserts every row with coordinates and at least a street,
+// committing every batchSize rows
+func importCSV(r io.Reader, source string) (imported, skipped int, err error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading header: %w", err)
+	}
+	col := make(map[string]int)
+	for i, name := range header {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := col["lng"]; ok {
+		col["lon"] = col["lng"]
+	}
+	if _, ok := col["lat"]; !ok {
+		return 0, 0, fmt.Errorf("header has no lat column")
+	}
+	if _, ok := col["lon"]; !ok {
+		return 0, 0, fmt.Errorf("header has no lon column")
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := col[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() { tx.Rollback() }()
+
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return imported, skipped, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		lat, errLat := strconv.ParseFloat(field(record, "lat"), 64)
+		lng, errLng := strconv.ParseFloat(field(record, "lon"), 64)
+		a := geocode.Address{
+			HouseNumber: field(record, "housenumber"),
+			Street:      field(record, "street"),
+			City:        field(record, "city"),
+			Postcode:    field(record, "postcode"),
+			State:       field(record, "state"),
+			Country:     field(record, "country"),
+		}
+		if errLat != nil || errLng != nil || a.Street == "" {
+			skipped++
+			continue
+		}
+
+		sourceID := field(record, "id")
+		if sourceID == "" {
+			sourceID = fmt.Sprintf("%.7f,%.7f", lat, lng)
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO geocode_addresses
+				(source, source_id, housenumber, street, city, postcode, state, country, normalized, geom)
+			VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''),
+				$9, ST_SetSRID(ST_MakePoint($10, $11), 4326))
+			ON CONFLICT (source, source_id) DO UPDATE
+			SET housenumber = EXCLUDED.housenumber,
+				street = EXCLUDED.street,
+				city = EXCLUDED.city,
+				postcode = EXCLUDED.postcode,
+				state = EXCLUDED.state,
+				country = EXCLUDED.country,
+				normalized = EXCLUDED.normalized,
+				geom = EXCLUDED.geom`,
+			source, sourceID, a.HouseNumber, a.Street, a.City, a.Postcode, a.State, a.Country,
+			geocode.Normalize(a.String()), lng, lat)
+		if err != nil {
+			return imported, skipped, fmt.Errorf("line %d: %w", line, err)
+		}
+		imported++
+
+		if imported%batchSize == 0 {
+			if err := tx.Commit(); err != nil {
+				return imported, skipped, err
+			}
+			log.Printf("Imported %d addresses", imported)
+			if tx, err = config.DB.Begin(); err != nil {
+				return imported, skipped, err
+			}
+		}
+	}
+
+	return imported, skipped, tx.Commit()
+}
@@ -0,0 +1,233 @@
+// Command rankeval replays historical engagements against campaign rankers.
+//
+// For every engagement it rebuilds the campaigns that were running near the
+// engagement's location that day, ranks them with the user's history up to
+// that moment, and records where the campaign the user actually engaged with
+// landed. The configured ranker (RANKER / RANK_WEIGHT_*) is compared with
+// the plain distance ordering.
+//
+//	go run ./cmd/rankeval -since 2025-08-01 -action used -k 5
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"streetsavvy-backend/config"
+	"streetsavvy-backend/ranking"
+
+	"github.com/joho/godotenv"
+)
+
+// event is one historical engagement to replay
+type event struct {
+	userID     string
+	campaignID string
+	at         time.Time
+	lat, lng   float64
+}
+
+// result accumulates ranking quality for one ranker
+type result struct {
+	name    string
+	ranker  ranking.Ranker
+	events  int
+	missing int // engaged campaign wasn't in the candidate pool
+	hitsAt1 int
+	hitsAtK int
+	rrSum   float64
+	rankSum int
+}
+
+func main() {
+	since := flag.String("since", "", "only replay engagements on or after this date (YYYY-MM-DD)")
+	action := flag.String("action", "used", "engagement type to replay: clicked, used or all")
+	radiusKm := flag.Float64("radius-km", 5, "candidate pool radius around the engagement location")
+	k := flag.Int("k", 5, "cut-off for hit@k")
+	limit := flag.Int("limit", 10000, "maximum number of engagements to replay")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using system environment variables")
+	}
+	cfg, err := config.Load(nil)
+	if err != nil {
+		log.Fatal("Invalid configuration:", err)
+	}
+	if err := config.InitDB(cfg.Database); err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	configured, err := config.NewRanker(cfg.Ranking)
+	if err != nil {
+		log.Fatal("Invalid ranking configuration:", err)
+	}
+
+	sinceTime := time.Time{}
+	if *since != "" {
+		if sinceTime, err = time.Parse("2006-01-02", *since); err != nil {
+			log.Fatal("-since must be YYYY-MM-DD")
+		}
+	}
+
+	events, err := loadEvents(sinceTime, *action, *limit)
+	if err != nil {
+		log.Fatal("Failed to load engagements:", err)
+	}
+	log.Printf("Replaying %d engagements", len(events))
+
+	results := []*result{
+		{name: "configured", ranker: configured},
+		{name: "distance", ranker: ranking.DistanceRanker{}},
+	}
+
+	for _, e := range events {
+		candidates, err := loadCandidates(e, *radiusKm)
+		if err != nil {
+			log.Fatal("Failed to load candidates:", err)
+		}
+		user, err := ranking.LoadUser(config.DB, e.userID, e.at)
+		if err != nil {
+			log.Fatal("Failed to load user history:", err)
+		}
+
+		for _, res := range results {
+			res.events++
+			rank := position(res.ranker.Rank(user, candidates), e.campaignID)
+			if rank == 0 {
+				res.missing++
+				continue
+			}
+			res.rankSum += rank
+			res.rrSum += 1 / float64(rank)
+			if rank == 1 {
+				res.hitsAt1++
+			}
+			if rank <= *k {
+				res.hitsAtK++
+			}
+		}
+	}
+
+	printResults(results, *k)
+}
+
+// loadEvents reads engagements oldest first
+func loadEvents(since time.Time, action string, limit int) ([]event, error) {
+	rows, err := config.DB.Query(`
+		SELECT user_id, campaign_id, engagement_time, used_loc_lat, used_loc_long
+		FROM campaign_user_engagements
+		WHERE engagement_time >= $1
+		  AND ($2 = 'all' OR engagement_type = $2)
+		ORDER BY engagement_time
+		LIMIT $3`, since, action, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []event
+	for rows.Next() {
+		var e event
+		if err := rows.Scan(&e.userID, &e.campaignID, &e.at, &e.lat, &e.lng); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// loadCandidates finds the campaigns that were within their date range on
+// the engagement's day and near where it happened, measured to each
+// campaign's nearest store. Today's enabled flag and budgets don't say what
+// was live back then, so they are ignored.
+func loadCandidates(e event, radiusKm float64) ([]ranking.Candidate, error) {
+	rows, err := config.DB.Query(`
+		SELECT DISTINCT ON (c.campaign_id)
+			c.campaign_id,
+			v.vendor_id,
+			v.vendor_type,
+			COALESCE(s.segment_name, ''),
+			c.start_date,
+			c.end_date,
+			ST_Distance(
+				ST_SetSRID(ST_MakePoint(v.long, v.lat), 4326)::geography,
+				ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography
+			) AS distance_meters
+		FROM campaigns c
+		JOIN campaign_sites cs ON cs.campaign_id = c.campaign_id
+		JOIN vendors v ON cs.vendor_id = v.vendor_id
+		LEFT JOIN segments s ON c.segment_id = s.segment_id
+		WHERE $3::date BETWEEN c.start_date AND c.end_date
+		  AND ST_DWithin(
+			ST_SetSRID(ST_MakePoint(v.long, v.lat), 4326)::geography,
+			ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography,
+			$4 * 1000
+		  )
+		ORDER BY c.campaign_id, distance_meters`, e.lng, e.lat, e.at, radiusKm)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []ranking.Candidate
+	for rows.Next() {
+		var c ranking.Candidate
+		err := rows.Scan(&c.CampaignID, &c.VendorID, &c.VendorType, &c.SegmentName,
+			&c.StartDate, &c.EndDate, &c.DistanceMeters)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// position returns the 1-based rank of campaignID, or 0 if it is absent
+func position(ranked []ranking.Ranked, campaignID string) int {
+	for i, r := range ranked {
+		if r.CampaignID == campaignID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func printResults(results []*result, k int) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "ranker\tevents\tmissing\thit@1\thit@%d\tMRR\tmean rank\n", k)
+	for _, r := range results {
+		ranked := r.events - r.missing
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%.3f\t%s\n",
+			r.name, r.events, r.missing,
+			ratio(r.hitsAt1, ranked), ratio(r.hitsAtK, ranked),
+			safeDiv(r.rrSum, float64(ranked)),
+			meanRank(r.rankSum, ranked))
+	}
+	tw.Flush()
+}
+
+func ratio(n, d int) string {
+	if d == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(n)/float64(d)*100)
+}
+
+func safeDiv(n, d float64) float64 {
+	if d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+func meanRank(sum, n int) string {
+	if n == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", float64(sum)/float64(n))
+}
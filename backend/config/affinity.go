@@ -0,0 +1,32 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+
+	"streetsavvy-backend/affinity"
+)
+
+// affinityPolicy reads how user store affinities fade and how many are kept:
+//
+//	AFFINITY_HALF_LIFE_DAYS  days for a use to count half as much (default 30)
+//	AFFINITY_TOP_K           vendors and vendor types kept per user (default 5)
+func affinityPolicy() (affinity.Policy, error) {
+	p := affinity.DefaultPolicy()
+
+	value := getEnv("AFFINITY_HALF_LIFE_DAYS", formatFloat(p.HalfLifeDays))
+	days, err := strconv.ParseFloat(value, 64)
+	if err != nil || days <= 0 {
+		return p, fmt.Errorf("AFFINITY_HALF_LIFE_DAYS must be a positive number of days, got %q", value)
+	}
+	p.HalfLifeDays = days
+
+	value = getEnv("AFFINITY_TOP_K", strconv.Itoa(p.TopK))
+	k, err := strconv.Atoi(value)
+	if err != nil || k < 1 {
+		return p, fmt.Errorf("AFFINITY_TOP_K must be a positive number, got %q", value)
+	}
+	p.TopK = k
+
+	return p, p.Validate()
+}
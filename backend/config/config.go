@@ -0,0 +1,427 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"streetsavvy-backend/affinity"
+	"streetsavvy-backend/jobs"
+	"streetsavvy-backend/logging"
+	"streetsavvy-backend/loyalty"
+	"streetsavvy-backend/retention"
+	"streetsavvy-backend/tracing"
+)
+
+// Every setting has one name, such as DB_HOST or CAMPAIGN_PAGE_SIZE, that
+// can be given in three places. A --set NAME=VALUE flag wins over the
+// environment (including .env), which wins over the JSON config file named
+// by --config or CONFIG_FILE, which wins over the built-in default.
+
+// Where a setting's value came from
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// secretSettings are redacted by Print
+var secretSettings = map[string]bool{
+	"DB_PASSWORD":     true,
+	"OTP_WEBHOOK_URL": true, // May carry a token
+}
+
+// Config is every setting of a server process, parsed and validated
+type Config struct {
+	Logging   logging.Options
+	Tracing   tracing.Options
+	Database  DatabaseConfig
+	Server    ServerConfig
+	Health    HealthConfig
+	WebSocket WebSocketConfig
+	Campaigns CampaignConfig
+	Ranking   RankingConfig
+	Geocoding GeocodingConfig
+	OTP       OTPConfig
+	Location  LocationConfig
+	Guest     GuestConfig
+	Privacy   PrivacyConfig
+	Jobs      jobs.Options
+	Affinity  affinity.Policy
+	Loyalty   LoyaltyConfig
+
+	// PrintOnly is set by --print-config: print the settings and exit
+	PrintOnly bool
+
+	settings map[string]Setting
+}
+
+// Setting is the value a setting resolved to and where it came from
+type Setting struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// WebSocketConfig is how live campaign updates are pushed
+type WebSocketConfig struct {
+	PushInterval     time.Duration // Time between campaign updates to a connected user
+	HandshakeTimeout time.Duration
+}
+
+// CampaignConfig holds the business rules of campaign lists and engagements
+type CampaignConfig struct {
+	ClickDedupWindow time.Duration // Repeat clicks within this window are ignored
+	DefaultPageSize  int
+	MaxPageSize      int
+	RankPoolSize     int // Nearest candidates considered for relevance order
+}
+
+// LocationConfig is how user locations are trusted and kept
+type LocationConfig struct {
+	MaxAge            time.Duration // Older fixes are refused as stale
+	Retention         retention.Policy
+	RetentionInterval time.Duration
+}
+
+// GuestConfig is how anonymous guest sessions behave
+type GuestConfig struct {
+	SessionTTL time.Duration
+}
+
+// PrivacyConfig is when erasure requests are carried out
+type PrivacyConfig struct {
+	ErasureGracePeriod   time.Duration
+	ErasureCheckInterval time.Duration
+}
+
+// LoyaltyConfig is how points are earned and when tiers are recalculated
+type LoyaltyConfig struct {
+	Policy     loyalty.Policy
+	RecalcHour int // Local hour (0-23) of the nightly recalculation
+}
+
+// sources holds the layers getEnv reads while Load runs
+var sources struct {
+	flags    map[string]string
+	file     map[string]string
+	resolved map[string]Setting
+}
+
+// Load reads the configuration from args (command-line flags, without the
+// program name), the environment and the config file, and validates it.
+// Settings not used by any part of the server are rejected so that typos
+// don't go unnoticed.
+func Load(args []string) (*Config, error) {
+	flags := flag.NewFlagSet("streetsavvy-backend", flag.ContinueOnError)
+	configFile := flags.String("config", "", "JSON config file (default $CONFIG_FILE)")
+	printOnly := flags.Bool("print-config", false, "print the resolved settings and their sources, then exit")
+	listen := flags.String("listen", "", "address to listen on; same as --set LISTEN_ADDR=...")
+	set := settingFlag{}
+	flags.Var(set, "set", "override a setting, e.g. --set DB_HOST=db.internal (repeatable)")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+	if *listen != "" {
+		set["LISTEN_ADDR"] = *listen
+	}
+
+	if *configFile == "" {
+		*configFile = os.Getenv("CONFIG_FILE")
+	}
+	file := map[string]string{}
+	if *configFile != "" {
+		var err error
+		if file, err = readConfigFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	sources.flags = set
+	sources.file = file
+	sources.resolved = map[string]Setting{}
+	defer func() { sources.flags, sources.file, sources.resolved = nil, nil, nil }()
+
+	cfg := &Config{PrintOnly: *printOnly}
+	if err := cfg.read(); err != nil {
+		return nil, err
+	}
+
+	for _, layer := range []struct {
+		name   string
+		values map[string]string
+	}{{"--set", set}, {*configFile, file}} {
+		for key := range layer.values {
+			if _, ok := sources.resolved[key]; !ok {
+				return nil, fmt.Errorf("%s: unknown setting %s", layer.name, key)
+			}
+		}
+	}
+	cfg.settings = sources.resolved
+	return cfg, nil
+}
+
+// read fills in every section, in the order they depend on each other
+func (c *Config) read() error {
+	var err error
+	if c.Logging, err = loggingOptions(); err != nil {
+		return err
+	}
+	if c.Tracing, err = tracingOptions(); err != nil {
+		return err
+	}
+	if c.Database, err = databaseConfig(); err != nil {
+		return err
+	}
+	if c.Server, err = serverConfig(); err != nil {
+		return err
+	}
+	if c.Health, err = healthConfig(); err != nil {
+		return err
+	}
+	if c.WebSocket, err = webSocketConfig(); err != nil {
+		return err
+	}
+	if c.Campaigns, err = campaignConfig(); err != nil {
+		return err
+	}
+	if c.Ranking, err = rankingConfig(); err != nil {
+		return err
+	}
+	if c.Geocoding, err = geocodingConfig(); err != nil {
+		return err
+	}
+	if c.OTP, err = otpConfig(); err != nil {
+		return err
+	}
+	if c.Location.MaxAge, err = maxLocationAge(); err != nil {
+		return err
+	}
+	if c.Location.Retention, c.Location.RetentionInterval, err = retentionPolicy(); err != nil {
+		return err
+	}
+	if c.Guest.SessionTTL, err = guestSessionTTL(); err != nil {
+		return err
+	}
+	if c.Privacy, err = privacyConfig(); err != nil {
+		return err
+	}
+	if c.Jobs, err = jobOptions(); err != nil {
+		return err
+	}
+	// Shutdown waits for running jobs; it can't if they may outlast it
+	if c.Jobs.JobTimeout > c.Server.ShutdownTimeout {
+		return fmt.Errorf("JOBS_TIMEOUT (%s) must not be longer than SHUTDOWN_TIMEOUT (%s)",
+			FormatDuration(c.Jobs.JobTimeout), FormatDuration(c.Server.ShutdownTimeout))
+	}
+	if c.Affinity, err = affinityPolicy(); err != nil {
+		return err
+	}
+	if c.Loyalty, err = loyaltyConfig(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Settings returns every setting by name, as resolved by Load
+func (c *Config) Settings() map[string]Setting {
+	return c.settings
+}
+
+// Print writes every setting, its value and source as JSON, with secrets
+// redacted
+func (c *Config) Print(w io.Writer) error {
+	printed := make(map[string]Setting, len(c.settings))
+	for key, s := range c.settings {
+		if secretSettings[key] && s.Value != "" {
+			s.Value = "REDACTED"
+		}
+		printed[key] = s
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(printed)
+}
+
+// getEnv looks key up in the flags, the environment and the config file,
+// in that order, and records what it resolved to
+func getEnv(key, defaultValue string) string {
+	s := Setting{Value: defaultValue, Source: SourceDefault}
+	if value, ok := sources.flags[key]; ok {
+		s = Setting{Value: value, Source: SourceFlag}
+	} else if value := os.Getenv(key); value != "" {
+		s = Setting{Value: value, Source: SourceEnv}
+	} else if value, ok := sources.file[key]; ok {
+		s = Setting{Value: value, Source: SourceFile}
+	}
+	if sources.resolved != nil {
+		sources.resolved[key] = s
+	}
+	return s.Value
+}
+
+// readConfigFile reads a JSON object of setting names to strings, numbers
+// or booleans
+func readConfigFile(path string) (map[string]string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	settings := make(map[string]string, len(values))
+	for key, value := range values {
+		switch v := value.(type) {
+		case string:
+			settings[key] = v
+		case float64:
+			settings[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			settings[key] = strconv.FormatBool(v)
+		default:
+			return nil, fmt.Errorf("config file %s: %s must be a string, number or boolean", path, key)
+		}
+	}
+	return settings, nil
+}
+
+// settingFlag collects repeated --set NAME=VALUE flags
+type settingFlag map[string]string
+
+func (s settingFlag) String() string {
+	pairs := make([]string, 0, len(s))
+	for key, value := range s {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (s settingFlag) Set(pair string) error {
+	key, value, ok := strings.Cut(pair, "=")
+	if !ok || key == "" {
+		return errors.New("expected NAME=VALUE")
+	}
+	s[key] = value
+	return nil
+}
+
+// webSocketConfig reads:
+//
+//	WS_PUSH_INTERVAL       time between campaign updates to a user (default 30s)
+//	WS_HANDSHAKE_TIMEOUT   time allowed for the upgrade (default 10s)
+func webSocketConfig() (WebSocketConfig, error) {
+	var cfg WebSocketConfig
+	err := durations([]durationSetting{
+		{"WS_PUSH_INTERVAL", "30s", &cfg.PushInterval},
+		{"WS_HANDSHAKE_TIMEOUT", "10s", &cfg.HandshakeTimeout},
+	})
+	return cfg, err
+}
+
+// campaignConfig reads:
+//
+//	CLICK_DEDUP_WINDOW       repeat clicks on a campaign within this are ignored (default 5m)
+//	CAMPAIGN_PAGE_SIZE       campaigns per page without ?limit (default 50)
+//	CAMPAIGN_MAX_PAGE_SIZE   largest ?limit accepted (default 100)
+//	CAMPAIGN_RANK_POOL       nearest campaigns ranked for relevance order (default 500)
+func campaignConfig() (CampaignConfig, error) {
+	var cfg CampaignConfig
+	if err := durations([]durationSetting{
+		{"CLICK_DEDUP_WINDOW", "5m", &cfg.ClickDedupWindow},
+	}); err != nil {
+		return cfg, err
+	}
+
+	ints := []struct {
+		key      string
+		fallback string
+		value    *int
+	}{
+		{"CAMPAIGN_PAGE_SIZE", "50", &cfg.DefaultPageSize},
+		{"CAMPAIGN_MAX_PAGE_SIZE", "100", &cfg.MaxPageSize},
+		{"CAMPAIGN_RANK_POOL", "500", &cfg.RankPoolSize},
+	}
+	for _, i := range ints {
+		value := getEnv(i.key, i.fallback)
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return cfg, fmt.Errorf("%s must be a positive number, got %q", i.key, value)
+		}
+		*i.value = n
+	}
+
+	if cfg.DefaultPageSize > cfg.MaxPageSize {
+		return cfg, fmt.Errorf("CAMPAIGN_PAGE_SIZE must not be larger than CAMPAIGN_MAX_PAGE_SIZE")
+	}
+	if cfg.RankPoolSize < cfg.MaxPageSize {
+		return cfg, fmt.Errorf("CAMPAIGN_RANK_POOL must be at least CAMPAIGN_MAX_PAGE_SIZE")
+	}
+	return cfg, nil
+}
+
+// privacyConfig reads:
+//
+//	ERASURE_GRACE_PERIOD     how long an erasure request can still be cancelled;
+//	                         0 erases on the worker's next pass (default 72h)
+//	ERASURE_CHECK_INTERVAL   how often due erasures are carried out (default 10m)
+func privacyConfig() (PrivacyConfig, error) {
+	var cfg PrivacyConfig
+	var err error
+	if cfg.ErasureGracePeriod, err = erasureGracePeriod(); err != nil {
+		return cfg, err
+	}
+	err = durations([]durationSetting{
+		{"ERASURE_CHECK_INTERVAL", "10m", &cfg.ErasureCheckInterval},
+	})
+	return cfg, err
+}
+
+// durationSetting is a positive duration read by durations
+type durationSetting struct {
+	key      string
+	fallback string
+	value    *time.Duration
+}
+
+func durations(settings []durationSetting) error {
+	for _, d := range settings {
+		value := getEnv(d.key, d.fallback)
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("%s must be a positive duration, got %q", d.key, value)
+		}
+		*d.value = parsed
+	}
+	return nil
+}
+
+// FormatDuration writes d the way it would be configured: 5m rather than
+// 5m0s
+func FormatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
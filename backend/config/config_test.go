@@ -0,0 +1,175 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfigFile writes contents to a config file in a temporary directory
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		file, env  string
+		flag       string
+		want       string
+		wantSource string
+	}{
+		{"default", "", "", "", "localhost", SourceDefault},
+		{"file over default", "file.internal", "", "", "file.internal", SourceFile},
+		{"env over file", "file.internal", "env.internal", "", "env.internal", SourceEnv},
+		{"flag over env", "file.internal", "env.internal", "flag.internal", "flag.internal", SourceFlag},
+		{"flag without env", "file.internal", "", "flag.internal", "flag.internal", SourceFlag},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			t.Setenv("DB_HOST", tc.env)
+
+			var args []string
+			if tc.file != "" {
+				args = append(args, "--config", writeConfigFile(t, `{"DB_HOST": "`+tc.file+`"}`))
+			}
+			if tc.flag != "" {
+				args = append(args, "--set", "DB_HOST="+tc.flag)
+			}
+
+			cfg, err := Load(args)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Database.Host != tc.want {
+				t.Errorf("Database.Host = %q, want %q", cfg.Database.Host, tc.want)
+			}
+			want := Setting{Value: tc.want, Source: tc.wantSource}
+			if got := cfg.Settings()["DB_HOST"]; got != want {
+				t.Errorf("Settings()[DB_HOST] = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		file    string // Config file contents, if any
+		args    []string
+		wantErr string
+	}{
+		{"unknown --set", "", []string{"--set", "DB_HOTS=db.internal"}, "--set: unknown setting DB_HOTS"},
+		{"unknown file key", `{"DB_HOTS": "db.internal"}`, nil, "unknown setting DB_HOTS"},
+		{"--set without value", "", []string{"--set", "DB_HOST"}, "expected NAME=VALUE"},
+		{"bad duration", "", []string{"--set", "SHUTDOWN_TIMEOUT=soon"}, "SHUTDOWN_TIMEOUT must be a positive duration"},
+		{"job outlasts shutdown", "", []string{"--set", "JOBS_TIMEOUT=1m"}, "JOBS_TIMEOUT (1m) must not be longer than SHUTDOWN_TIMEOUT (30s)"},
+		{"stray argument", "", []string{"serve"}, `unexpected argument "serve"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			args := tc.args
+			if tc.file != "" {
+				args = append([]string{"--config", writeConfigFile(t, tc.file)}, args...)
+			}
+
+			_, err := Load(args)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Load error = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadConfigFile(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		contents string
+		want     map[string]string
+		wantErr  string
+	}{
+		{"string", `{"DB_HOST": "db.internal"}`, map[string]string{"DB_HOST": "db.internal"}, ""},
+		{"integer", `{"DB_PORT": 5433}`, map[string]string{"DB_PORT": "5433"}, ""},
+		{"large integer", `{"CAMPAIGN_RANK_POOL": 10000000}`, map[string]string{"CAMPAIGN_RANK_POOL": "10000000"}, ""},
+		{"fraction", `{"TRACING_SAMPLE_RATIO": 0.25}`, map[string]string{"TRACING_SAMPLE_RATIO": "0.25"}, ""},
+		{"boolean", `{"TRACING_OTLP_INSECURE": true}`, map[string]string{"TRACING_OTLP_INSECURE": "true"}, ""},
+		{"empty", `{}`, map[string]string{}, ""},
+
+		{"null", `{"DB_HOST": null}`, nil, "DB_HOST must be a string, number or boolean"},
+		{"array", `{"DB_HOST": ["a", "b"]}`, nil, "DB_HOST must be a string, number or boolean"},
+		{"object", `{"DB": {"HOST": "a"}}`, nil, "DB must be a string, number or boolean"},
+		{"not an object", `["DB_HOST"]`, nil, "config file"},
+		{"malformed", `{"DB_HOST": `, nil, "config file"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := readConfigFile(writeConfigFile(t, tc.contents))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("readConfigFile error = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readConfigFile: %v", err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("readConfigFile = %v, want %v", got, tc.want)
+			}
+			for key, value := range tc.want {
+				if got[key] != value {
+					t.Errorf("%s = %q, want %q", key, got[key], value)
+				}
+			}
+		})
+	}
+
+	if _, err := readConfigFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("readConfigFile of a missing file succeeded")
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("DB_PASSWORD", "")
+	t.Setenv("OTP_WEBHOOK_URL", "")
+
+	cfg, err := Load([]string{"--set", "DB_PASSWORD=hunter2", "--set", "DB_HOST=db.internal"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatalf("Print: %v", err)
+	}
+	if strings.Contains(out.String(), "hunter2") {
+		t.Errorf("Print leaked the password:\n%s", out.String())
+	}
+
+	var printed map[string]Setting
+	if err := json.Unmarshal(out.Bytes(), &printed); err != nil {
+		t.Fatalf("Print wrote invalid JSON: %v", err)
+	}
+	for key, want := range map[string]Setting{
+		"DB_PASSWORD":     {Value: "REDACTED", Source: SourceFlag},
+		"OTP_WEBHOOK_URL": {Value: "", Source: SourceDefault}, // Unset secrets show as unset
+		"DB_HOST":         {Value: "db.internal", Source: SourceFlag},
+	} {
+		if got := printed[key]; got != want {
+			t.Errorf("%s = %+v, want %+v", key, got, want)
+		}
+	}
+
+	// Printing must not redact the loaded settings themselves
+	if got := cfg.Settings()["DB_PASSWORD"].Value; got != "hunter2" {
+		t.Errorf("Settings()[DB_PASSWORD] = %q after Print, want the password", got)
+	}
+}
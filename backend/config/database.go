@@ -4,39 +4,84 @@ import (
     "database/sql"
     "fmt"
     "log"
-    "os"
+    "strconv"
     "time"
 
-    _ "github.com/lib/pq"
+    "streetsavvy-backend/tracing"
+
+    "github.com/lib/pq"
 )
 
 // Global database connection pool
 var DB *sql.DB
 
-// InitDB initializes the global database connection pool
-func InitDB() error {
-    // Get database configuration from environment variables
-    host := getEnv("DB_HOST", "localhost")
-    port := getEnv("DB_PORT", "5432")
-    user := getEnv("DB_USER", "postgres")
-    password := getEnv("DB_PASSWORD", "")
-    dbname := getEnv("DB_NAME", "streetsavvy")
-    sslmode := getEnv("DB_SSLMODE", "disable")
+// DatabaseConfig is how to reach PostgreSQL and size the connection pool
+type DatabaseConfig struct {
+    Host, Port, User, Password, Name, SSLMode string
+    MaxOpenConns    int
+    MaxIdleConns    int
+    ConnMaxLifetime time.Duration
+}
+
+// databaseConfig reads DB_HOST, DB_PORT, DB_USER, DB_PASSWORD, DB_NAME and
+// DB_SSLMODE, and the pool settings:
+//
+//	DB_MAX_OPEN_CONNS      concurrent connections (default 25)
+//	DB_MAX_IDLE_CONNS      connections kept ready (default 5)
+//	DB_CONN_MAX_LIFETIME   connections are refreshed after this (default 5m)
+func databaseConfig() (DatabaseConfig, error) {
+    cfg := DatabaseConfig{
+        Host:     getEnv("DB_HOST", "localhost"),
+        Port:     getEnv("DB_PORT", "5432"),
+        User:     getEnv("DB_USER", "postgres"),
+        Password: getEnv("DB_PASSWORD", ""),
+        Name:     getEnv("DB_NAME", "streetsavvy"),
+        SSLMode:  getEnv("DB_SSLMODE", "disable"),
+    }
+
+    ints := []struct {
+        key      string
+        fallback string
+        value    *int
+    }{
+        {"DB_MAX_OPEN_CONNS", "25", &cfg.MaxOpenConns},
+        {"DB_MAX_IDLE_CONNS", "5", &cfg.MaxIdleConns},
+    }
+    for _, i := range ints {
+        value := getEnv(i.key, i.fallback)
+        n, err := strconv.Atoi(value)
+        if err != nil || n < 1 {
+            return cfg, fmt.Errorf("%s must be a positive number, got %q", i.key, value)
+        }
+        *i.value = n
+    }
+    if cfg.MaxIdleConns > cfg.MaxOpenConns {
+        return cfg, fmt.Errorf("DB_MAX_IDLE_CONNS must not be larger than DB_MAX_OPEN_CONNS")
+    }
+
+    err := durations([]durationSetting{
+        {"DB_CONN_MAX_LIFETIME", "5m", &cfg.ConnMaxLifetime},
+    })
+    return cfg, err
+}
 
+// InitDB initializes the global database connection pool
+func InitDB(cfg DatabaseConfig) error {
     // Build connection string
     connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-        host, port, user, password, dbname, sslmode)
+        cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name, cfg.SSLMode)
 
     // DEBUG: Print connection string (remove password for security)
     debugConnStr := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=%s",
-        host, port, user, dbname, sslmode)
+        cfg.Host, cfg.Port, cfg.User, cfg.Name, cfg.SSLMode)
     log.Printf("Attempting to connect with: %s", debugConnStr)
 
-    // Open database connection pool
-    db, err := sql.Open("postgres", connStr)
+    // Open database connection pool, tracing its queries
+    connector, err := pq.NewConnector(connStr)
     if err != nil {
         return fmt.Errorf("error opening database: %v", err)
     }
+    db := sql.OpenDB(tracing.WrapConnector(connector))
 
     // Test the connection
     log.Printf("Testing database connection...")
@@ -46,21 +91,13 @@ func InitDB() error {
 
     log.Printf("Database connection successful!")
 
-    // Configure connection pool for performance
-    db.SetMaxOpenConns(25)                 // Maximum 25 concurrent connections
-    db.SetMaxIdleConns(5)                  // Keep 5 connections ready
-    db.SetConnMaxLifetime(5 * time.Minute) // Refresh connections every 5 minutes
+    // Configure connection pool (DB_MAX_OPEN_CONNS etc.)
+    db.SetMaxOpenConns(cfg.MaxOpenConns)
+    db.SetMaxIdleConns(cfg.MaxIdleConns)
+    db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
     // Store in global variable
     DB = db
 
     return nil
 }
-
-// Helper function to get environment variables with defaults
-func getEnv(key, defaultValue string) string {
-    if value := os.Getenv(key); value != "" {
-        return value
-    }
-    return defaultValue
-}
\ No newline at end of file
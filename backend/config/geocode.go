@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+
+	"streetsavvy-backend/geocode"
+)
+
+// GeocodingConfig is the geocoder backend and its distance limits
+type GeocodingConfig struct {
+	Geocoder         string
+	ReverseMaxMeters float64
+	ToleranceMeters  float64 // How far a vendor's address may geocode from its coordinates
+}
+
+// geocodingConfig reads GEOCODER, the backend ("postgis", the default, or
+// "none"), GEOCODE_REVERSE_MAX_M, how far reverse lookups search for the
+// nearest address, and GEOCODE_TOLERANCE_M, how far a vendor's address may
+// geocode from the coordinates entered with it
+func geocodingConfig() (GeocodingConfig, error) {
+	cfg := GeocodingConfig{Geocoder: getEnv("GEOCODER", "postgis")}
+	if cfg.Geocoder != "postgis" && cfg.Geocoder != "none" {
+		return cfg, fmt.Errorf("unknown geocoder %q", cfg.Geocoder)
+	}
+
+	var err error
+	if cfg.ReverseMaxMeters, err = positiveEnv("GEOCODE_REVERSE_MAX_M", geocode.DefaultMaxReverseMeters); err != nil {
+		return cfg, err
+	}
+	cfg.ToleranceMeters, err = positiveEnv("GEOCODE_TOLERANCE_M", geocode.DefaultToleranceMeters)
+	return cfg, err
+}
+
+// NewGeocoder builds the geocoder for this deployment; call it after InitDB
+func NewGeocoder(cfg GeocodingConfig) (geocode.Geocoder, error) {
+	switch cfg.Geocoder {
+	case "postgis":
+		g := geocode.NewPostGIS(DB)
+		g.MaxReverseMeters = cfg.ReverseMaxMeters
+		return g, nil
+	case "none":
+		return geocode.Nop{}, nil
+	default:
+		return nil, fmt.Errorf("unknown geocoder %q", cfg.Geocoder)
+	}
+}
+
+func positiveEnv(key string, defaultValue float64) (float64, error) {
+	value := getEnv(key, formatFloat(defaultValue))
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f <= 0 {
+		return 0, fmt.Errorf("%s must be a positive number, got %q", key, value)
+	}
+	return f, nil
+}
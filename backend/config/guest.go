@@ -0,0 +1,17 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// guestSessionTTL reads GUEST_SESSION_TTL (a Go duration, default 720h): how
+// long an anonymous guest session stays valid without being used
+func guestSessionTTL() (time.Duration, error) {
+	value := getEnv("GUEST_SESSION_TTL", "720h")
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("GUEST_SESSION_TTL must be a positive duration such as 720h, got %q", value)
+	}
+	return d, nil
+}
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// HealthConfig is how /api/health/ready judges the instance
+type HealthConfig struct {
+	CheckTimeout      time.Duration // Deadline for all dependency checks together
+	MaxPoolSaturation float64       // Not ready once this fraction of DB_MAX_OPEN_CONNS is in use
+}
+
+// healthConfig reads the readiness check settings:
+//
+//	HEALTH_CHECK_TIMEOUT          deadline for the database checks (default 2s)
+//	HEALTH_MAX_POOL_SATURATION    not ready when in-use connections reach this
+//	                              fraction of the pool, 0 to 1 (default 1)
+func healthConfig() (HealthConfig, error) {
+	var cfg HealthConfig
+	err := durations([]durationSetting{
+		{"HEALTH_CHECK_TIMEOUT", "2s", &cfg.CheckTimeout},
+	})
+	if err != nil {
+		return cfg, err
+	}
+
+	value := getEnv("HEALTH_MAX_POOL_SATURATION", "1")
+	cfg.MaxPoolSaturation, err = strconv.ParseFloat(value, 64)
+	if err != nil || cfg.MaxPoolSaturation <= 0 || cfg.MaxPoolSaturation > 1 {
+		return cfg, fmt.Errorf("HEALTH_MAX_POOL_SATURATION must be a number above 0 and at most 1, got %q", value)
+	}
+	return cfg, nil
+}
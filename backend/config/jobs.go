@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+
+	"streetsavvy-backend/jobs"
+)
+
+// jobOptions reads how the background job runner works through the queue:
+//
+//	JOBS_CONCURRENCY    jobs run at once (default 4)
+//	JOBS_POLL_INTERVAL  how often idle workers check for due jobs (default 1s)
+//	JOBS_RETRY_BASE     delay before the first retry, doubling after (default 10s)
+//	JOBS_RETRY_MAX      longest delay between retries (default 1h)
+//	JOBS_TIMEOUT        time one run may take (default 20s); at most
+//	                    SHUTDOWN_TIMEOUT, so shutdown can wait for it
+func jobOptions() (jobs.Options, error) {
+	o := jobs.DefaultOptions()
+
+	value := getEnv("JOBS_CONCURRENCY", strconv.Itoa(o.Concurrency))
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return o, fmt.Errorf("JOBS_CONCURRENCY must be a positive number, got %q", value)
+	}
+	o.Concurrency = n
+
+	err = durations([]durationSetting{
+		{"JOBS_POLL_INTERVAL", FormatDuration(o.PollInterval), &o.PollInterval},
+		{"JOBS_RETRY_BASE", FormatDuration(o.RetryBase), &o.RetryBase},
+		{"JOBS_RETRY_MAX", FormatDuration(o.RetryMax), &o.RetryMax},
+		{"JOBS_TIMEOUT", FormatDuration(o.JobTimeout), &o.JobTimeout},
+	})
+	if err != nil {
+		return o, err
+	}
+
+	// Leave plenty of room before a slow job is assumed lost
+	if o.LockTimeout < 10*o.JobTimeout {
+		o.LockTimeout = 10 * o.JobTimeout
+	}
+
+	return o, o.Validate()
+}
@@ -0,0 +1,17 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxLocationAge reads LOCATION_MAX_AGE (a Go duration, default 30m): how
+// old a user's latest fix may be before campaign queries refuse it as stale
+func maxLocationAge() (time.Duration, error) {
+	value := getEnv("LOCATION_MAX_AGE", "30m")
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("LOCATION_MAX_AGE must be a positive duration such as 30m, got %q", value)
+	}
+	return d, nil
+}
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+
+	"streetsavvy-backend/logging"
+)
+
+// loggingOptions reads how the server logs:
+//
+//	LOG_LEVEL                 debug, info, warn or error (default info)
+//	LOG_FORMAT                json or text (default json)
+//	LOG_COORDINATE_DECIMALS   decimal places kept of logged coordinates (default 2, about 1km)
+func loggingOptions() (logging.Options, error) {
+	o := logging.DefaultOptions()
+
+	value := getEnv("LOG_LEVEL", "info")
+	level, err := logging.ParseLevel(value)
+	if err != nil {
+		return o, fmt.Errorf("LOG_LEVEL must be debug, info, warn or error, got %q", value)
+	}
+	o.Level = level
+
+	o.Format = getEnv("LOG_FORMAT", o.Format)
+
+	value = getEnv("LOG_COORDINATE_DECIMALS", strconv.Itoa(o.CoordinateDecimals))
+	decimals, err := strconv.Atoi(value)
+	if err != nil {
+		return o, fmt.Errorf("LOG_COORDINATE_DECIMALS must be a number, got %q", value)
+	}
+	o.CoordinateDecimals = decimals
+
+	return o, o.Validate()
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"streetsavvy-backend/loyalty"
+)
+
+// loyaltyConfig reads how loyalty points are earned and the local hour at
+// which every user's tier is recalculated each night:
+//
+//	LOYALTY_POINTS_PER_USE   base points per redemption (default 10)
+//	LOYALTY_WINDOW_DAYS      rolling window points count for (default 90)
+//	LOYALTY_TIERS            name:min_points list (default bronze:0,silver:100,gold:300)
+//	LOYALTY_RECALC_HOUR      hour of day (0-23) of the nightly recalculation (default 3)
+func loyaltyConfig() (LoyaltyConfig, error) {
+	p := loyalty.DefaultPolicy()
+
+	ints := []struct {
+		key   string
+		value *int
+	}{
+		{"LOYALTY_POINTS_PER_USE", &p.PointsPerUse},
+		{"LOYALTY_WINDOW_DAYS", &p.WindowDays},
+	}
+	for _, i := range ints {
+		value := getEnv(i.key, strconv.Itoa(*i.value))
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return LoyaltyConfig{}, fmt.Errorf("%s must be a positive number, got %q", i.key, value)
+		}
+		*i.value = n
+	}
+
+	tiers, err := loyalty.ParseTiers(getEnv("LOYALTY_TIERS", formatTiers(p.Tiers)))
+	if err != nil {
+		return LoyaltyConfig{}, fmt.Errorf("LOYALTY_TIERS: %w", err)
+	}
+	p.Tiers = tiers
+
+	value := getEnv("LOYALTY_RECALC_HOUR", "3")
+	hour, err := strconv.Atoi(value)
+	if err != nil || hour < 0 || hour > 23 {
+		return LoyaltyConfig{}, fmt.Errorf("LOYALTY_RECALC_HOUR must be an hour between 0 and 23, got %q", value)
+	}
+
+	return LoyaltyConfig{Policy: p, RecalcHour: hour}, p.Validate()
+}
+
+// formatTiers writes tiers in the form LOYALTY_TIERS takes
+func formatTiers(tiers []loyalty.Tier) string {
+	parts := make([]string, len(tiers))
+	for i, t := range tiers {
+		parts[i] = fmt.Sprintf("%s:%d", t.Name, t.MinPoints)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"fmt"
+
+	"streetsavvy-backend/otp"
+)
+
+// OTPConfig is how verification codes are delivered
+type OTPConfig struct {
+	Sender     string
+	WebhookURL string
+}
+
+// otpConfig reads OTP_SENDER: "log" (the default; codes only go to the
+// server log) or "webhook", which posts each code to OTP_WEBHOOK_URL
+func otpConfig() (OTPConfig, error) {
+	cfg := OTPConfig{
+		Sender:     getEnv("OTP_SENDER", "log"),
+		WebhookURL: getEnv("OTP_WEBHOOK_URL", ""),
+	}
+	_, err := NewOTPSender(cfg)
+	return cfg, err
+}
+
+// NewOTPSender builds the sender for verification codes
+func NewOTPSender(cfg OTPConfig) (otp.Sender, error) {
+	switch cfg.Sender {
+	case "log":
+		return otp.LogSender{}, nil
+	case "webhook":
+		if cfg.WebhookURL == "" {
+			return nil, fmt.Errorf("OTP_WEBHOOK_URL is required when OTP_SENDER=webhook")
+		}
+		return otp.NewWebhookSender(cfg.WebhookURL), nil
+	default:
+		return nil, fmt.Errorf("unknown OTP sender %q", cfg.Sender)
+	}
+}
@@ -0,0 +1,18 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// erasureGracePeriod reads ERASURE_GRACE_PERIOD (a Go duration, default
+// 72h): how long an erasure request can still be cancelled before the
+// user's data is erased. 0 erases on the worker's next pass.
+func erasureGracePeriod() (time.Duration, error) {
+	value := getEnv("ERASURE_GRACE_PERIOD", "72h")
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("ERASURE_GRACE_PERIOD must be a non-negative duration such as 72h, got %q", value)
+	}
+	return d, nil
+}
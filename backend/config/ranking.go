@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+
+	"streetsavvy-backend/ranking"
+)
+
+// RankingConfig is the campaign ranking strategy and its weights
+type RankingConfig struct {
+	Strategy string
+	Weights  ranking.Weights
+}
+
+// rankingConfig reads RANKER, the strategy ("score" or "distance"), and
+// RANK_WEIGHT_*, the score weights
+func rankingConfig() (RankingConfig, error) {
+	cfg := RankingConfig{
+		Strategy: getEnv("RANKER", "score"),
+		Weights:  ranking.DefaultWeights(),
+	}
+
+	weights := []struct {
+		key    string
+		weight *float64
+	}{
+		{"RANK_WEIGHT_DISTANCE", &cfg.Weights.Distance},
+		{"RANK_WEIGHT_AFFINITY", &cfg.Weights.Affinity},
+		{"RANK_WEIGHT_LOYALTY", &cfg.Weights.Loyalty},
+		{"RANK_WEIGHT_ENGAGEMENT", &cfg.Weights.Engagement},
+		{"RANK_WEIGHT_RECENCY", &cfg.Weights.Recency},
+		{"RANK_WEIGHT_EXPIRY", &cfg.Weights.Expiry},
+	}
+	for _, o := range weights {
+		value := getEnv(o.key, formatFloat(*o.weight))
+		w, err := strconv.ParseFloat(value, 64)
+		if err != nil || w < 0 {
+			return cfg, fmt.Errorf("%s must be a non-negative number, got %q", o.key, value)
+		}
+		*o.weight = w
+	}
+
+	// Catch an unknown strategy at startup
+	_, err := NewRanker(cfg)
+	return cfg, err
+}
+
+// NewRanker builds the campaign ranker for this deployment
+func NewRanker(cfg RankingConfig) (ranking.Ranker, error) {
+	return ranking.New(cfg.Strategy, cfg.Weights)
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"streetsavvy-backend/retention"
+)
+
+// retentionPolicy reads how long location data is kept and how often the
+// retention worker runs:
+//
+//	LOCATION_RAW_RETENTION_DAYS     raw fixes, then hourly centroids (default 30)
+//	LOCATION_HOURLY_RETENTION_DAYS  hourly centroids, then deleted (default 365)
+//	LOCATION_RETENTION_DRY_RUN      only log what would be pruned (default false)
+//	LOCATION_RETENTION_INTERVAL     time between runs (default 1h)
+func retentionPolicy() (retention.Policy, time.Duration, error) {
+	p := retention.DefaultPolicy()
+
+	days := []struct {
+		key   string
+		value *int
+	}{
+		{"LOCATION_RAW_RETENTION_DAYS", &p.RawDays},
+		{"LOCATION_HOURLY_RETENTION_DAYS", &p.HourlyDays},
+	}
+	for _, d := range days {
+		value := getEnv(d.key, strconv.Itoa(*d.value))
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return p, 0, fmt.Errorf("%s must be a positive number of days, got %q", d.key, value)
+		}
+		*d.value = n
+	}
+
+	value := getEnv("LOCATION_RETENTION_DRY_RUN", strconv.FormatBool(p.DryRun))
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return p, 0, fmt.Errorf("LOCATION_RETENTION_DRY_RUN must be true or false, got %q", value)
+	}
+	p.DryRun = dryRun
+
+	value = getEnv("LOCATION_RETENTION_INTERVAL", "1h")
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		return p, 0, fmt.Errorf("LOCATION_RETENTION_INTERVAL must be a positive duration such as 1h, got %q", value)
+	}
+
+	return p, interval, p.Validate()
+}
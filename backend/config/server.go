@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// ServerConfig is how the HTTP server listens and shuts down
+type ServerConfig struct {
+	Addr              string
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration // Drain time for requests and background jobs
+}
+
+// serverConfig reads the listen address and timeouts:
+//
+//	LISTEN_ADDR                full address; overrides HOST and PORT
+//	HOST, PORT                 default 127.0.0.1 and 8080
+//	HTTP_READ_HEADER_TIMEOUT   default 5s
+//	HTTP_READ_TIMEOUT          whole request including body (default 30s)
+//	HTTP_WRITE_TIMEOUT         default 120s, enough for data exports
+//	HTTP_IDLE_TIMEOUT          keep-alive connections (default 120s)
+//	SHUTDOWN_TIMEOUT           drain time after SIGTERM (default 30s)
+//
+// WebSocket connections are not subject to the read and write timeouts.
+func serverConfig() (ServerConfig, error) {
+	cfg := ServerConfig{
+		Addr: getEnv("LISTEN_ADDR", net.JoinHostPort(getEnv("HOST", "127.0.0.1"), getEnv("PORT", "8080"))),
+	}
+	if _, _, err := net.SplitHostPort(cfg.Addr); err != nil {
+		return cfg, fmt.Errorf("LISTEN_ADDR must be host:port, got %q", cfg.Addr)
+	}
+
+	err := durations([]durationSetting{
+		{"HTTP_READ_HEADER_TIMEOUT", "5s", &cfg.ReadHeaderTimeout},
+		{"HTTP_READ_TIMEOUT", "30s", &cfg.ReadTimeout},
+		{"HTTP_WRITE_TIMEOUT", "120s", &cfg.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", "120s", &cfg.IdleTimeout},
+		{"SHUTDOWN_TIMEOUT", "30s", &cfg.ShutdownTimeout},
+	})
+	return cfg, err
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+
+	"streetsavvy-backend/tracing"
+)
+
+// tracingOptions reads where trace spans are exported:
+//
+//	TRACING_EXPORTER        none, otlp, stdout or file (default none)
+//	TRACING_OTLP_ENDPOINT   host:port of an OTLP/HTTP collector (default localhost:4318)
+//	TRACING_OTLP_INSECURE   send to the collector over plain HTTP (default true)
+//	TRACING_FILE            file the file exporter appends JSON spans to (default traces.json)
+//	TRACING_SAMPLE_RATIO    fraction of new traces kept, 0 to 1 (default 1)
+func tracingOptions() (tracing.Options, error) {
+	o := tracing.DefaultOptions()
+
+	o.Exporter = getEnv("TRACING_EXPORTER", o.Exporter)
+	o.OTLPEndpoint = getEnv("TRACING_OTLP_ENDPOINT", o.OTLPEndpoint)
+
+	value := getEnv("TRACING_OTLP_INSECURE", strconv.FormatBool(o.OTLPInsecure))
+	insecure, err := strconv.ParseBool(value)
+	if err != nil {
+		return o, fmt.Errorf("TRACING_OTLP_INSECURE must be true or false, got %q", value)
+	}
+	o.OTLPInsecure = insecure
+
+	o.File = getEnv("TRACING_FILE", o.File)
+
+	value = getEnv("TRACING_SAMPLE_RATIO", formatFloat(o.SampleRatio))
+	ratio, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return o, fmt.Errorf("TRACING_SAMPLE_RATIO must be a number, got %q", value)
+	}
+	o.SampleRatio = ratio
+
+	return o, o.Validate()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"streetsavvy-backend/affinity"
+)
+
+// clickDedupWindow is set in main from CLICK_DEDUP_WINDOW: repeat clicks on
+// a campaign within it are not recorded again
+var clickDedupWindow = 5 * time.Minute
+
+// engagementRecord is one campaign engagement about to be stored
+type engagementRecord struct {
+	UserID     string
+	CampaignID string
+	Action     string  // "clicked" or "used"
+	VariantID  *string // A/B variant the user was shown, if any
+	Lat        float64
+	Lng        float64
+}
+
+// engagementRequest is the body of POST .../campaigns/{campaign_id}/engage
+type engagementRequest struct {
+	Action string `json:"action"` // "clicked" or "used"
+}
+
+// engagementResponse answers an engagement, whether it was recorded or
+// de-duplicated
+type engagementResponse struct {
+	Success    bool               `json:"success"`
+	Message    string             `json:"message"`
+	Duplicate  bool               `json:"duplicate"`
+	Engagement *engagementSummary `json:"engagement,omitempty"` // Newly recorded user engagements only
+}
+
+// engagementSummary echoes a newly recorded engagement
+type engagementSummary struct {
+	UserID     string             `json:"user_id"`
+	CampaignID string             `json:"campaign_id"`
+	Action     string             `json:"action"`
+	Location   engagementLocation `json:"location"`
+	Timestamp  time.Time          `json:"timestamp"`
+}
+
+// engagementLocation is where the user was when they engaged
+type engagementLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// contextQueryRower is satisfied by both *sql.DB and *sql.Tx
+type contextQueryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertEngagement writes one engagement row at the current time. The
+// engagement is attributed to the campaign's store nearest to where it
+// happened, so multi-location campaigns roll up per location. Returns the
+// engagement's ID and that store's vendor ID.
+func insertEngagement(ctx context.Context, db contextQueryRower, e engagementRecord) (int64, string, error) {
+	var engagementID int64
+	var vendorID sql.NullString
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO campaign_user_engagements
+		(user_id, campaign_id, engagement_type, used_loc_lat, used_loc_long, variant_id, vendor_id, engagement_time)
+		VALUES ($1, $2, $3, $4, $5, $6, (
+			SELECT cs.vendor_id
+			FROM campaign_sites cs
+			JOIN vendors v ON cs.vendor_id = v.vendor_id
+			WHERE cs.campaign_id = $2
+			ORDER BY ST_SetSRID(ST_MakePoint(v.long, v.lat), 4326) <-> ST_SetSRID(ST_MakePoint($5, $4), 4326)
+			LIMIT 1
+		), NOW())
+		RETURNING engagement_id, vendor_id`,
+		e.UserID, e.CampaignID, e.Action, e.Lat, e.Lng, e.VariantID).Scan(&engagementID, &vendorID)
+	return engagementID, vendorID.String, err
+}
+
+// insertUsedEngagement writes a "used" engagement and, in the same
+// transaction, counts it towards the user's store affinities and credits
+// its loyalty points
+func insertUsedEngagement(ctx context.Context, tx *sql.Tx, e engagementRecord) error {
+	engagementID, vendorID, err := insertEngagement(ctx, tx, e)
+	if err != nil {
+		return err
+	}
+	if vendorID != "" {
+		if err := affinity.Record(tx, affinityPolicy, e.UserID, vendorID); err != nil {
+			return err
+		}
+	}
+	return creditLoyalty(tx, e.UserID, engagementID)
+}
@@ -0,0 +1,77 @@
+// Package experiments holds the math behind campaign A/B tests: deterministic
+// variant assignment and the significance test used in vendor analytics.
+package experiments
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// SignificanceLevel is the p-value below which a difference is reported as significant
+const SignificanceLevel = 0.05
+
+// Assign picks a variant index for a user given the variants' weights.
+// The same user, campaign and weights always give the same answer; the
+// campaign ID salts the hash so a user isn't in the first bucket everywhere.
+// Returns -1 if there are no positive weights.
+func Assign(userID, campaignID string, weights []int) int {
+	total := 0
+	for _, w := range weights {
+		if w > 0 {
+			total += w
+		}
+	}
+	if total == 0 {
+		return -1
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(campaignID))
+	h.Write([]byte{0})
+	h.Write([]byte(userID))
+	bucket := int(h.Sum64() % uint64(total))
+
+	for i, w := range weights {
+		if w <= 0 {
+			continue
+		}
+		if bucket < w {
+			return i
+		}
+		bucket -= w
+	}
+	return -1
+}
+
+// ZTest is the result of comparing a variant's rate against the control's
+type ZTest struct {
+	Z           float64 `json:"z_score"`
+	PValue      float64 `json:"p_value"`
+	Significant bool    `json:"significant"`
+}
+
+// TwoProportionZTest compares successes/trials of a variant (a) against the
+// control (b) with a pooled two-sided z-test. ok is false when either side
+// has no trials or the pooled rate is 0 or 1, where the test is undefined.
+func TwoProportionZTest(successA, trialsA, successB, trialsB int) (result ZTest, ok bool) {
+	if trialsA <= 0 || trialsB <= 0 {
+		return ZTest{}, false
+	}
+
+	pA := float64(successA) / float64(trialsA)
+	pB := float64(successB) / float64(trialsB)
+	pooled := float64(successA+successB) / float64(trialsA+trialsB)
+	if pooled <= 0 || pooled >= 1 {
+		return ZTest{}, false
+	}
+
+	se := math.Sqrt(pooled * (1 - pooled) * (1/float64(trialsA) + 1/float64(trialsB)))
+	z := (pA - pB) / se
+	p := math.Erfc(math.Abs(z) / math.Sqrt2)
+
+	return ZTest{
+		Z:           z,
+		PValue:      p,
+		Significant: p < SignificanceLevel,
+	}, true
+}
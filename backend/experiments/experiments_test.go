@@ -0,0 +1,120 @@
+package experiments
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestAssign(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		weights []int
+		want    int // -1 for no variant; otherwise only the given index can be picked
+	}{
+		{"no variants", nil, -1},
+		{"all zero", []int{0, 0}, -1},
+		{"negative ignored", []int{-5, 0}, -1},
+		{"single variant", []int{1}, 0},
+		{"only positive weight", []int{0, 3, -2}, 1},
+		{"last positive weight", []int{0, 0, 7}, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for i := 0; i < 50; i++ {
+				if got := Assign(fmt.Sprintf("U%04d", i), "C0001", tc.weights); got != tc.want {
+					t.Fatalf("Assign(U%04d) = %d, want %d", i, got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAssignIsDeterministic(t *testing.T) {
+	weights := []int{50, 50}
+	for i := 0; i < 100; i++ {
+		user := fmt.Sprintf("U%04d", i)
+		if a, b := Assign(user, "C0001", weights), Assign(user, "C0001", weights); a != b {
+			t.Fatalf("Assign(%s) gave %d then %d", user, a, b)
+		}
+	}
+}
+
+func TestAssignFollowsWeights(t *testing.T) {
+	const users = 20000
+	for _, tc := range []struct {
+		weights []int
+	}{
+		{[]int{50, 50}},
+		{[]int{90, 10}},
+		{[]int{1, 2, 1}},
+		{[]int{30, 0, 70}},
+	} {
+		t.Run(fmt.Sprint(tc.weights), func(t *testing.T) {
+			counts := make([]int, len(tc.weights))
+			total := 0
+			for _, w := range tc.weights {
+				total += w
+			}
+			for i := 0; i < users; i++ {
+				counts[Assign(fmt.Sprintf("U%06d", i), "C0042", tc.weights)]++
+			}
+			for i, w := range tc.weights {
+				share := float64(counts[i]) / users
+				if want := float64(w) / float64(total); math.Abs(share-want) > 0.02 {
+					t.Errorf("variant %d got %.3f of users, want %.3f", i, share, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAssignSaltsByCampaign(t *testing.T) {
+	weights := []int{50, 50}
+	differ := 0
+	for i := 0; i < 1000; i++ {
+		user := fmt.Sprintf("U%04d", i)
+		if Assign(user, "C0001", weights) != Assign(user, "C0002", weights) {
+			differ++
+		}
+	}
+	// Independent 50/50 splits disagree for about half the users
+	if differ < 400 || differ > 600 {
+		t.Errorf("%d of 1000 users switched variant between campaigns, want about 500", differ)
+	}
+}
+
+func TestTwoProportionZTest(t *testing.T) {
+	for _, tc := range []struct {
+		name                                 string
+		successA, trialsA, successB, trialsB int
+		ok                                   bool
+		z, p                                 float64
+		significant                          bool
+	}{
+		{"equal rates", 100, 1000, 100, 1000, true, 0, 1, false},
+		{"small lift", 120, 1000, 100, 1000, true, 1.4293, 0.1529, false},
+		{"clear lift", 150, 1000, 100, 1000, true, 3.3806, 0.0007, true},
+		{"clear drop", 100, 1000, 150, 1000, true, -3.3806, 0.0007, true},
+		{"few trials", 5, 10, 3, 10, true, 0.9129, 0.3613, false},
+		{"no variant trials", 0, 0, 10, 100, false, 0, 0, false},
+		{"no control trials", 10, 100, 0, 0, false, 0, 0, false},
+		{"no successes", 0, 100, 0, 100, false, 0, 0, false},
+		{"all successes", 100, 100, 50, 50, false, 0, 0, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := TwoProportionZTest(tc.successA, tc.trialsA, tc.successB, tc.trialsB)
+			if ok != tc.ok {
+				t.Fatalf("ok = %v, want %v", ok, tc.ok)
+			}
+			if !ok {
+				return
+			}
+			if math.Abs(got.Z-tc.z) > 1e-4 || math.Abs(got.PValue-tc.p) > 1e-4 {
+				t.Errorf("z = %.4f p = %.4f, want z = %.4f p = %.4f", got.Z, got.PValue, tc.z, tc.p)
+			}
+			if got.Significant != tc.significant {
+				t.Errorf("significant = %v, want %v", got.Significant, tc.significant)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+// Package geocode turns addresses into coordinates and back without calling
+// out to a hosted service. The Geocoder interface lets deployments plug in
+// another backend; PostGIS is the default, matching against an address
+// dataset imported into the geocode_addresses table (see cmd/geoimport).
+package geocode
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// ErrNotFound is returned when no known address matches
+var ErrNotFound = errors.New("geocode: no matching address")
+
+// DefaultToleranceMeters is how far apart an address and the coordinates
+// entered with it may be before they are considered to disagree
+const DefaultToleranceMeters = 150.0
+
+// Address is a structured postal address
+type Address struct {
+	HouseNumber string `json:"housenumber,omitempty"`
+	Street      string `json:"street,omitempty"`
+	City        string `json:"city,omitempty"`
+	Postcode    string `json:"postcode,omitempty"`
+	State       string `json:"state,omitempty"`
+	Country     string `json:"country,omitempty"`
+}
+
+// String formats the address on one line, e.g. "123 Main St, Plano, TX 75074"
+func (a Address) String() string {
+	var parts []string
+	if street := strings.TrimSpace(a.HouseNumber + " " + a.Street); street != "" {
+		parts = append(parts, street)
+	}
+	if a.City != "" {
+		parts = append(parts, a.City)
+	}
+	if region := strings.TrimSpace(a.State + " " + a.Postcode); region != "" {
+		parts = append(parts, region)
+	}
+	if a.Country != "" {
+		parts = append(parts, a.Country)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Result is one geocoded address
+type Result struct {
+	AddressID int64   `json:"address_id"`
+	Address   Address `json:"address"`
+	Formatted string  `json:"formatted"`
+	Lat       float64 `json:"lat"`
+	Lng       float64 `json:"lng"`
+	// Score is the text similarity of a forward match, 0..1
+	Score float64 `json:"score,omitempty"`
+	// DistanceMeters is how far a reverse match is from the queried point
+	DistanceMeters float64 `json:"distance_meters,omitempty"`
+}
+
+// Geocoder resolves free-text addresses and coordinates
+type Geocoder interface {
+	// Geocode returns up to limit candidates for a free-text address, best
+	// first, or ErrNotFound
+	Geocode(address string, limit int) ([]Result, error)
+	// Reverse returns the known address nearest to a point, or ErrNotFound
+	// if there is none close enough
+	Reverse(lat, lng float64) (*Result, error)
+}
+
+// Nop is a Geocoder that knows no addresses, for deployments without a
+// dataset. Address checks are skipped rather than failed.
+type Nop struct{}
+
+// Geocode implements Geocoder
+func (Nop) Geocode(address string, limit int) ([]Result, error) { return nil, ErrNotFound }
+
+// Reverse implements Geocoder
+func (Nop) Reverse(lat, lng float64) (*Result, error) { return nil, ErrNotFound }
+
+// abbreviations maps address words to the short form used in normalized text
+var abbreviations = map[string]string{
+	"street": "st", "avenue": "ave", "av": "ave", "road": "rd", "drive": "dr",
+	"boulevard": "blvd", "lane": "ln", "court": "ct", "place": "pl",
+	"parkway": "pkwy", "highway": "hwy", "freeway": "fwy", "expressway": "expy",
+	"circle": "cir", "terrace": "ter", "trail": "trl", "square": "sq",
+	"suite": "ste", "apartment": "apt", "building": "bldg", "floor": "fl",
+	"north": "n", "south": "s", "east": "e", "west": "w",
+	"northeast": "ne", "northwest": "nw", "southeast": "se", "southwest": "sw",
+	"mount": "mt", "fort": "ft",
+	"texas": "tx", "oklahoma": "ok", "california": "ca", "new york": "ny",
+	"united states": "us", "usa": "us",
+}
+
+// Normalize reduces a free-text address to a canonical form for matching:
+// lower case, punctuation dropped, common words abbreviated and whitespace
+// collapsed. "123 Main Street, Suite #4" becomes "123 main st ste 4".
+// "St" opening a comma-separated part, or right after its house number, is
+// "saint" ("St. Louis", "500 St Paul St"); anywhere else it's "street".
+func Normalize(address string) string {
+	var out []string
+	parts := strings.FieldsFunc(address, func(r rune) bool { return r == ',' || r == ';' || r == '\n' })
+	for _, part := range parts {
+		out = append(out, normalizePart(part)...)
+	}
+	return strings.Join(out, " ")
+}
+
+// normalizePart normalizes one comma-separated part of an address
+func normalizePart(part string) []string {
+	cleaned := strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+			return unicode.ToLower(r)
+		case r == '\'':
+			return -1 // "O'Connor" -> "oconnor"
+		}
+		return ' '
+	}, part)
+
+	words := strings.Fields(cleaned)
+	out := make([]string, 0, len(words))
+	for i := 0; i < len(words); i++ {
+		// A street needs a name before "St", so a leading one is a saint
+		leading := len(out) == 0 || (len(out) == 1 && isNumber(out[0]))
+		if words[i] == "st" && leading && i+1 < len(words) {
+			out = append(out, "saint")
+			continue
+		}
+		// Two-word names first ("new york", "united states")
+		if i+1 < len(words) {
+			if short, ok := abbreviations[words[i]+" "+words[i+1]]; ok {
+				out = append(out, short)
+				i++
+				continue
+			}
+		}
+		if short, ok := abbreviations[words[i]]; ok {
+			out = append(out, short)
+			continue
+		}
+		out = append(out, words[i])
+	}
+	return out
+}
+
+// isNumber reports whether word is all digits, like a house number
+func isNumber(word string) bool {
+	for _, r := range word {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return word != ""
+}
+
+// DistanceMeters is the great-circle distance between two points
+func DistanceMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	const earthRadiusMeters = 6371008.8
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLng := toRad(lng2 - lng1)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(h)))
+}
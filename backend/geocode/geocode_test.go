@@ -0,0 +1,67 @@
+package geocode
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"123 Main Street, Suite #4", "123 main st ste 4"},
+		{"123 main st ste 4", "123 main st ste 4"},
+		{"  4500  North   Central Expressway ", "4500 n central expy"},
+		{"12 O'Connor Avenue", "12 oconnor ave"},
+		{"Saint Louis Road", "saint louis rd"},
+		{"St. Louis Road", "saint louis rd"},
+		{"500 St Paul St, Dallas", "500 saint paul st dallas"},
+		{"123 Main St, St Louis, MO", "123 main st saint louis mo"},
+		{"123 Main Street, Saint Louis", "123 main st saint louis"},
+		{"Saint Street", "saint st"},
+		{"12 St", "12 st"},
+		{"1 Broadway, New York, NY 10004, United States", "1 broadway ny ny 10004 us"},
+		{"200 E. Houston St., San Antonio, Texas", "200 e houston st san antonio tx"},
+		{"New Braunfels", "new braunfels"}, // "new" alone isn't abbreviated
+		{"Straße 5, München", "straße 5 münchen"},
+		{"", ""},
+		{"---", ""},
+	} {
+		if got := Normalize(tc.in); got != tc.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestAddressString(t *testing.T) {
+	for _, tc := range []struct {
+		a    Address
+		want string
+	}{
+		{Address{HouseNumber: "123", Street: "Main St", City: "Plano", State: "TX", Postcode: "75074"}, "123 Main St, Plano, TX 75074"},
+		{Address{Street: "Main St", City: "Plano", Country: "US"}, "Main St, Plano, US"},
+		{Address{Postcode: "75074"}, "75074"},
+		{Address{}, ""},
+	} {
+		if got := tc.a.String(); got != tc.want {
+			t.Errorf("%+v.String() = %q, want %q", tc.a, got, tc.want)
+		}
+	}
+}
+
+func TestDistanceMeters(t *testing.T) {
+	for _, tc := range []struct {
+		name                   string
+		lat1, lng1, lat2, lng2 float64
+		want, tolerance        float64
+	}{
+		{"same point", 33.0198, -96.6989, 33.0198, -96.6989, 0, 0},
+		{"one degree of latitude", 0, 0, 1, 0, 111195, 1},
+		{"Dallas to Austin", 32.7767, -96.7970, 30.2672, -97.7431, 293100, 500},
+		{"antipodes", 0, 0, 0, 180, math.Pi * 6371008.8, 1},
+	} {
+		if got := DistanceMeters(tc.lat1, tc.lng1, tc.lat2, tc.lng2); math.Abs(got-tc.want) > tc.tolerance {
+			t.Errorf("%s: DistanceMeters = %.0f, want %.0f", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package geocode
+
+import (
+	"database/sql"
+)
+
+// DefaultMaxReverseMeters is how far Reverse looks for the nearest address
+const DefaultMaxReverseMeters = 100.0
+
+// PostGIS geocodes against the geocode_addresses table: trigram similarity
+// on normalized text for forward lookups, nearest neighbour on geom for
+// reverse lookups
+type PostGIS struct {
+	DB               *sql.DB
+	MaxReverseMeters float64
+}
+
+// NewPostGIS returns a Geocoder backed by the imported address dataset
+func NewPostGIS(db *sql.DB) *PostGIS {
+	return &PostGIS{DB: db, MaxReverseMeters: DefaultMaxReverseMeters}
+}
+
+const addressColumns = `
+	address_id, COALESCE(housenumber, ''), COALESCE(street, ''), COALESCE(city, ''),
+	COALESCE(postcode, ''), COALESCE(state, ''), COALESCE(country, ''),
+	ST_Y(geom), ST_X(geom)`
+
+// Geocode implements Geocoder. Candidates must pass pg_trgm's similarity
+// threshold (0.3 by default).
+func (p *PostGIS) Geocode(address string, limit int) ([]Result, error) {
+	normalized := Normalize(address)
+	if normalized == "" {
+		return nil, ErrNotFound
+	}
+
+	rows, err := p.DB.Query(`
+		SELECT `+addressColumns+`, similarity(normalized, $1) AS score
+		FROM geocode_addresses
+		WHERE normalized % $1
+		ORDER BY score DESC, address_id
+		LIMIT $2`, normalized, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []Result
+	for rows.Next() {
+		var r Result
+		if err := scanAddress(rows, &r, &r.Score); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, ErrNotFound
+	}
+	return results, nil
+}
+
+// Reverse implements Geocoder
+func (p *PostGIS) Reverse(lat, lng float64) (*Result, error) {
+	var r Result
+	row := p.DB.QueryRow(`
+		SELECT `+addressColumns+`,
+			ST_Distance(geom::geography, ST_SetSRID(ST_MakePoint($2, $1), 4326)::geography)
+		FROM geocode_addresses
+		ORDER BY geom <-> ST_SetSRID(ST_MakePoint($2, $1), 4326)
+		LIMIT 1`, lat, lng)
+	err := scanAddress(row, &r, &r.DistanceMeters)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.MaxReverseMeters > 0 && r.DistanceMeters > p.MaxReverseMeters {
+		return nil, ErrNotFound
+	}
+	return &r, nil
+}
+
+// scanAddress reads addressColumns plus one trailing metric column
+func scanAddress(row interface{ Scan(...interface{}) error }, r *Result, metric *float64) error {
+	a := &r.Address
+	err := row.Scan(&r.AddressID, &a.HouseNumber, &a.Street, &a.City,
+		&a.Postcode, &a.State, &a.Country, &r.Lat, &r.Lng, metric)
+	if err != nil {
+		return err
+	}
+	r.Formatted = a.String()
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"streetsavvy-backend/config"
+	"streetsavvy-backend/geocode"
+	"streetsavvy-backend/jobs"
+	"streetsavvy-backend/models"
+)
+
+// Offline geocoding: address search, reverse lookups for location events and
+// the address/coordinate agreement check on vendor profiles.
+
+// geocoder and addressToleranceMeters are set in main from GEOCODER and
+// GEOCODE_* (see config.NewGeocoder)
+var (
+	geocoder               geocode.Geocoder = geocode.Nop{}
+	addressToleranceMeters                  = geocode.DefaultToleranceMeters
+)
+
+const maxGeocodeResults = 10
+
+// geocodeSearchResult is an address search: the query as given and as
+// matched, and the best matches first
+type geocodeSearchResult struct {
+	Query      string           `json:"query"`
+	Normalized string           `json:"normalized"`
+	Results    []geocode.Result `json:"results"`
+}
+
+// geocodeSearchHandler resolves a free-text address: GET /api/geocode/search?q=&limit=
+func geocodeSearchHandler(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		writeValidationError(w, r, invalidField("q", "q is required"))
+		return
+	}
+
+	limit := 5
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxGeocodeResults {
+			writeValidationError(w, r, invalidField("limit", "limit must be between 1 and %d", maxGeocodeResults))
+			return
+		}
+		limit = n
+	}
+
+	results, err := geocoder.Geocode(q, limit)
+	if err == geocode.ErrNotFound {
+		results = []geocode.Result{}
+	} else if err != nil {
+		errorf(r, "Error geocoding %q: %v", q, err)
+		writeInternalError(w, r, "Failed to geocode address")
+		return
+	}
+
+	response := geocodeSearchResult{
+		Query:      q,
+		Normalized: geocode.Normalize(q),
+		Results:    results,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// reverseGeocodeHandler finds the nearest known address: GET /api/geocode/reverse?lat=&lng=
+func reverseGeocodeHandler(w http.ResponseWriter, r *http.Request) {
+	lat, errLat := strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
+	lng, errLng := strconv.ParseFloat(r.URL.Query().Get("lng"), 64)
+	if errLat != nil || errLng != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		writeValidationError(w, r, invalidField("lat", "lat and lng must be valid coordinates"))
+		return
+	}
+
+	result, err := geocoder.Reverse(lat, lng)
+	if err == geocode.ErrNotFound {
+		writeError(w, r, http.StatusNotFound, codeAddressNotFound, "No known address nearby")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "reverse geocoding failed", "lat", lat, "lng", lng, "error", err)
+		writeInternalError(w, r, "Failed to reverse geocode location")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// checkVendorAddress verifies a store's address geocodes to within
+// addressToleranceMeters of its coordinates. Addresses the dataset doesn't
+// know can't be checked and are accepted.
+func checkVendorAddress(v models.Vendor) error {
+	if strings.TrimSpace(v.Address) == "" {
+		return nil
+	}
+
+	results, err := geocoder.Geocode(v.Address, 1)
+	if err == geocode.ErrNotFound {
+		log.Printf("Address %q not in geocoding dataset; skipping coordinate check", v.Address)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	best := results[0]
+	distance := geocode.DistanceMeters(v.Lat, v.Lng, best.Lat, best.Lng)
+	if distance > addressToleranceMeters {
+		return addressMismatchError{Distance: distance, Match: best}
+	}
+	return nil
+}
+
+// writeAddressCheckError answers a failed checkVendorAddress: 400 when the
+// address and coordinates disagree, 500 when the lookup itself failed.
+// field is the address's place in the request, such as locations[0].address.
+func writeAddressCheckError(w http.ResponseWriter, r *http.Request, field, prefix string, err error) {
+	if mismatch, ok := err.(addressMismatchError); ok {
+		writeValidationError(w, r, invalidField(field, "%s%s", prefix, mismatch.Error()))
+		return
+	}
+	errorf(r, "Error checking vendor address: %v", err)
+	writeInternalError(w, r, "Failed to verify address")
+}
+
+// addressMismatchError reports an address and coordinates that disagree
+type addressMismatchError struct {
+	Distance float64
+	Match    geocode.Result
+}
+
+func (e addressMismatchError) Error() string {
+	return fmt.Sprintf("address and coordinates are %.0fm apart (tolerance %.0fm); %q is at lat %.6f, lng %.6f",
+		e.Distance, addressToleranceMeters, e.Match.Formatted, e.Match.Lat, e.Match.Lng)
+}
+
+// annotateLocationPayload is the location event to tag with an address
+type annotateLocationPayload struct {
+	LocationID string  `json:"location_id"`
+	Lat        float64 `json:"lat"`
+	Lng        float64 `json:"lng"`
+}
+
+// annotateLocationJob is queued by storeUserLocation for each new fix
+var annotateLocationJob = jobs.Type[annotateLocationPayload]{Name: "geocode.annotate_location", MaxAttempts: 3}
+
+// annotateLocationEvent links a stored location event to its nearest known
+// address. Points with no address nearby are left alone.
+func annotateLocationEvent(ctx context.Context, p annotateLocationPayload) error {
+	result, err := geocoder.Reverse(p.Lat, p.Lng)
+	if err == geocode.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reverse geocoding location %s: %w", p.LocationID, err)
+	}
+
+	_, err = config.DB.ExecContext(ctx, `UPDATE user_location_events SET address_id = $2 WHERE location_id = $1`,
+		p.LocationID, result.AddressID)
+	return err
+}
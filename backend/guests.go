@@ -0,0 +1,346 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"streetsavvy-backend/config"
+
+	"github.com/gorilla/mux"
+)
+
+// Guest browsing: a new install asks for an anonymous session token and can
+// browse campaigns in the "everyone" segment around a position it sends
+// with each request. Nothing about the guest's location is stored. Clicks
+// are kept against the session and move to the account when the guest
+// registers with the token (see verifyRegistrationHandler).
+
+const (
+	guestTokenHeader = "X-Guest-Token"
+	everyoneSegment  = "everyone"
+	guestTokenBytes  = 32
+)
+
+// guestSessionTTL is set in main from GUEST_SESSION_TTL
+var guestSessionTTL = 30 * 24 * time.Hour
+
+// hashGuestToken is what guest_sessions stores in place of the token
+func hashGuestToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// guestSessionResponse is a new guest session
+type guestSessionResponse struct {
+	SessionID    string    `json:"session_id"`
+	SessionToken string    `json:"session_token"` // Only ever returned here
+	ExpiresAt    time.Time `json:"expires_at"`    // Pushed back by each request that uses the token
+}
+
+// guestClickRequest is the body of POST /api/guest/engagements/{campaign_id}
+type guestClickRequest struct {
+	Lat *float64 `json:"lat"`
+	Lng *float64 `json:"lng"`
+}
+
+// createGuestSessionHandler starts a guest session: POST /api/guest/sessions.
+// The token is only returned here; send it as X-Guest-Token afterwards.
+func createGuestSessionHandler(w http.ResponseWriter, r *http.Request) {
+	raw := make([]byte, guestTokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		errorf(r, "Error generating guest token: %v", err)
+		writeInternalError(w, r, "Failed to create guest session")
+		return
+	}
+	token := hex.EncodeToString(raw)
+
+	var sessionID string
+	var expiresAt time.Time
+	err := config.DB.QueryRowContext(r.Context(), `
+		INSERT INTO guest_sessions (token_hash, expires_at)
+		VALUES ($1, NOW() + $2::float8 * INTERVAL '1 second')
+		RETURNING session_id, expires_at`,
+		hashGuestToken(token), guestSessionTTL.Seconds()).Scan(&sessionID, &expiresAt)
+	if err != nil {
+		errorf(r, "Error creating guest session: %v", err)
+		writeInternalError(w, r, "Failed to create guest session")
+		return
+	}
+
+	// Expired sessions go with their unmerged clicks
+	if _, err := config.DB.ExecContext(r.Context(), `DELETE FROM guest_sessions WHERE expires_at < NOW()`); err != nil {
+		errorf(r, "Error removing expired guest sessions: %v", err)
+	}
+
+	logf(r, "Started guest session %s", sessionID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(guestSessionResponse{
+		SessionID:    sessionID,
+		SessionToken: token,
+		ExpiresAt:    expiresAt,
+	})
+}
+
+// guestSession resolves the X-Guest-Token header to a live, unmerged
+// session and extends its expiry. Writes 401 and returns false otherwise.
+func guestSession(w http.ResponseWriter, r *http.Request) (string, bool) {
+	token := r.Header.Get(guestTokenHeader)
+	if token == "" {
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "Missing "+guestTokenHeader+" header")
+		return "", false
+	}
+
+	var sessionID string
+	err := config.DB.QueryRowContext(r.Context(), `
+		UPDATE guest_sessions
+		SET last_seen_at = NOW(), expires_at = NOW() + $2::float8 * INTERVAL '1 second'
+		WHERE token_hash = $1 AND expires_at > NOW() AND merged_at IS NULL
+		RETURNING session_id`,
+		hashGuestToken(token), guestSessionTTL.Seconds()).Scan(&sessionID)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "Invalid or expired guest session")
+		return "", false
+	}
+	if err != nil {
+		errorf(r, "Error looking up guest session: %v", err)
+		writeInternalError(w, r, "Database error")
+		return "", false
+	}
+	return sessionID, true
+}
+
+// getGuestNearbyCampaignsHandler lists "everyone" campaigns whose geofence
+// covers the given position: GET /api/guest/nearby-campaigns?lat=&lng=.
+// Nearest first, with the same paging and filters as the user lists
+// (relevance order needs a profile, so it isn't offered).
+func getGuestNearbyCampaignsHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := guestSession(w, r)
+	if !ok {
+		return
+	}
+
+	params, err := parseCampaignListParams(r, sortByDistance)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	if params.SortBy != sortByDistance {
+		writeValidationError(w, r, invalidField("sort", "Guests can only sort by distance"))
+		return
+	}
+
+	q := r.URL.Query()
+	lat, lng, err := parseCoordinates(q.Get("lat"), q.Get("lng"))
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	query := `
+		SELECT DISTINCT ON (c.campaign_id)
+			c.campaign_id,
+			v.vendor_id,
+			c.title,
+			c.code,
+			c.description,
+			c.enabled,
+			c.geofence_radius_km,
+			v.address,
+			v.vendor_type,
+			COALESCE(v.display_name, b.display_name, v.vendor_type) as vendor_name,
+			v.lat as vendor_lat,
+			v.long as vendor_lng,
+			c.end_date,
+			ST_Distance(
+				ST_SetSRID(ST_MakePoint(v.long, v.lat), 4326)::geography,
+				ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography
+			) as distance_meters
+		FROM campaigns c
+		JOIN campaign_sites cs ON cs.campaign_id = c.campaign_id
+		JOIN vendors v ON cs.vendor_id = v.vendor_id
+		LEFT JOIN brands b ON v.brand_id = b.brand_id
+		JOIN segments s ON c.segment_id = s.segment_id
+		WHERE c.enabled = true
+			AND s.segment_name = $3
+			AND campaign_is_live(c.campaign_id, NOW())
+			AND campaign_open_to_user(c.campaign_id, NULL)
+			AND ST_DWithin(
+				ST_SetSRID(ST_MakePoint(v.long, v.lat), 4326)::geography,
+				ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography,
+				c.geofence_radius_km * 1000
+			)
+		ORDER BY c.campaign_id, distance_meters`
+
+	args := sqlArgs{lng, lat, everyoneSegment}
+	rows, err := config.DB.QueryContext(r.Context(), params.pagedQuery(query, &args), args...)
+	if err != nil {
+		errorf(r, "Error fetching campaigns for guest %s: %v", sessionID, err)
+		writeInternalError(w, r, "Campaign query failed")
+		return
+	}
+	defer rows.Close()
+
+	campaigns := []campaignListItem{}
+	for rows.Next() {
+		var c campaignListItem
+		var endDate time.Time
+		err := rows.Scan(&c.CampaignID, &c.VendorID, &c.Title, &c.Code, &c.Description,
+			&c.Enabled, &c.GeofenceRadiusKm, &c.VendorAddress, &c.VendorType, &c.VendorName,
+			&c.VendorLat, &c.VendorLng, &endDate, &c.DistanceMeters)
+		if err != nil {
+			errorf(r, "Error scanning guest campaign: %v", err)
+			continue
+		}
+		c.DistanceDisplay = formatDistance(c.DistanceMeters)
+		campaigns = append(campaigns, c)
+	}
+	if err := rows.Err(); err != nil {
+		errorf(r, "Error reading campaigns for guest %s: %v", sessionID, err)
+		writeInternalError(w, r, "Campaign query failed")
+		return
+	}
+
+	// pagedQuery fetched one extra row if there's another page
+	if len(campaigns) > params.Limit {
+		campaigns = campaigns[:params.Limit]
+		last := campaigns[len(campaigns)-1]
+		w.Header().Set(nextCursorHeader,
+			campaignCursor{DistanceMeters: last.DistanceMeters, CampaignID: last.CampaignID}.encode())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(campaigns)
+}
+
+// recordGuestClickHandler records a guest opening a campaign: POST
+// /api/guest/engagements/{campaign_id} {"lat", "lng"}. The position only
+// picks which of the campaign's stores the click counts for. Guests can't
+// use offers; that needs an account.
+func recordGuestClickHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := guestSession(w, r)
+	if !ok {
+		return
+	}
+	campaignID := mux.Vars(r)["campaign_id"]
+
+	var req guestClickRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+	if req.Lat == nil || req.Lng == nil {
+		writeValidationError(w, r, invalidField("lat", "lat and lng are required"))
+		return
+	}
+	if err := checkCoordinates(*req.Lat, *req.Lng); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	// Same de-duplication as registered users' clicks
+	var recent int
+	err := config.DB.QueryRowContext(r.Context(), `
+		SELECT COUNT(*) FROM guest_engagements
+		WHERE session_id = $1 AND campaign_id = $2
+		  AND engagement_time > NOW() - $3::float8 * INTERVAL '1 second'`,
+		sessionID, campaignID, clickDedupWindow.Seconds()).Scan(&recent)
+	if err != nil {
+		errorf(r, "Error checking guest clicks: %v", err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+	if recent > 0 {
+		engagementDuplicates.Inc("clicked", audienceGuest)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(engagementResponse{
+			Success:   true,
+			Message:   "Engagement already recorded in the last " + config.FormatDuration(clickDedupWindow),
+			Duplicate: true,
+		})
+		return
+	}
+
+	// Only live "everyone" campaigns are visible to guests
+	result, err := config.DB.ExecContext(r.Context(), `
+		INSERT INTO guest_engagements (session_id, campaign_id, vendor_id)
+		SELECT $1, c.campaign_id, (
+			SELECT cs.vendor_id
+			FROM campaign_sites cs
+			JOIN vendors v ON cs.vendor_id = v.vendor_id
+			WHERE cs.campaign_id = c.campaign_id
+			ORDER BY ST_SetSRID(ST_MakePoint(v.long, v.lat), 4326) <-> ST_SetSRID(ST_MakePoint($3, $4), 4326)
+			LIMIT 1
+		)
+		FROM campaigns c
+		JOIN segments s ON c.segment_id = s.segment_id
+		WHERE c.campaign_id = $2
+		  AND c.enabled = true
+		  AND s.segment_name = $5
+		  AND campaign_is_live(c.campaign_id, NOW())
+		  AND campaign_open_to_user(c.campaign_id, NULL)`,
+		sessionID, campaignID, *req.Lng, *req.Lat, everyoneSegment)
+	if err != nil {
+		errorf(r, "Error recording guest click: %v", err)
+		writeInternalError(w, r, "Failed to record engagement")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		writeError(w, r, http.StatusNotFound, codeCampaignNotFound, "Campaign not found")
+		return
+	}
+
+	engagementsRecorded.Inc("clicked", audienceGuest)
+	logf(r, "Guest %s clicked campaign %s", sessionID, campaignID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(engagementResponse{
+		Success:   true,
+		Message:   "New clicked engagement recorded",
+		Duplicate: false,
+	})
+}
+
+// mergeGuestSession moves a guest session's clicks to userID and closes the
+// session. A missing, expired or already merged token merges nothing.
+// Clicks are placed at the store they were attributed to, since the guest's
+// own position was never kept.
+func mergeGuestSession(tx *sql.Tx, token, userID string) (int64, error) {
+	var sessionID string
+	err := tx.QueryRow(`
+		UPDATE guest_sessions
+		SET merged_user_id = $2, merged_at = NOW()
+		WHERE token_hash = $1 AND expires_at > NOW() AND merged_at IS NULL
+		RETURNING session_id`,
+		hashGuestToken(token), userID).Scan(&sessionID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO campaign_user_engagements
+			(user_id, campaign_id, engagement_type, used_loc_lat, used_loc_long, vendor_id, engagement_time)
+		SELECT $2, ge.campaign_id, 'clicked', v.lat, v.long, ge.vendor_id, ge.engagement_time
+		FROM guest_engagements ge
+		JOIN vendors v ON ge.vendor_id = v.vendor_id
+		WHERE ge.session_id = $1`,
+		sessionID, userID)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM guest_engagements WHERE session_id = $1`, sessionID); err != nil {
+		return 0, err
+	}
+
+	merged, _ := result.RowsAffected()
+	log.Printf("Merged guest session %s into user %s (%d clicks)", sessionID, userID, merged)
+	return merged, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"streetsavvy-backend/config"
+	"streetsavvy-backend/health"
+)
+
+// Health endpoints for the orchestrator. Liveness only says the process is
+// serving, so a database outage doesn't get every instance restarted.
+// Readiness checks the database: it answers pings, has PostGIS, carries the
+// migrations this build needs and has free connections. A not-ready
+// instance answers 503 and is taken out of rotation until it recovers.
+
+// schemaVersion is the newest migration (database/migrations) this build
+// relies on; bump it with each migration
+const schemaVersion = 21
+
+// healthConfig is set in main from HEALTH_CHECK_TIMEOUT and
+// HEALTH_MAX_POOL_SATURATION
+var healthConfig = config.HealthConfig{CheckTimeout: 2 * time.Second, MaxPoolSaturation: 1}
+
+// liveness is the body of a live check
+type liveness struct {
+	Status  string `json:"status"`
+	Service string `json:"service"`
+}
+
+// liveHandler answers as long as the process is serving: GET /api/health/live
+func liveHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(liveness{Status: "alive", Service: "streetsavvy-backend"})
+}
+
+// readyHandler runs the dependency checks and answers 503 unless all pass:
+// GET /api/health/ready (and the older GET /api/health)
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	report := health.Run(r.Context(), healthConfig.CheckTimeout, readinessChecks(config.DB))
+	if !report.Ready() {
+		for name, result := range report.Checks {
+			if result.Status != health.StatusOK {
+				errorf(r, "Readiness check %s failed: %s", name, result.Error)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !report.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// readinessChecks are the dependencies an instance needs to serve traffic
+func readinessChecks(db *sql.DB) []health.Check {
+	// Taken before the other checks borrow connections
+	stats := db.Stats()
+	return []health.Check{
+		{Name: "database", Run: func(ctx context.Context) (map[string]interface{}, error) {
+			return nil, db.PingContext(ctx)
+		}},
+		{Name: "postgis", Run: func(ctx context.Context) (map[string]interface{}, error) {
+			var version string
+			err := db.QueryRowContext(ctx,
+				`SELECT extversion FROM pg_extension WHERE extname = 'postgis'`).Scan(&version)
+			if err == sql.ErrNoRows {
+				return nil, fmt.Errorf("PostGIS extension is not installed")
+			}
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"version": version}, nil
+		}},
+		{Name: "schema", Run: func(ctx context.Context) (map[string]interface{}, error) {
+			return checkSchemaVersion(ctx, db)
+		}},
+		{Name: "pool", Run: func(context.Context) (map[string]interface{}, error) {
+			return checkPoolSaturation(stats, healthConfig.MaxPoolSaturation)
+		}},
+	}
+}
+
+// checkSchemaVersion fails while migrations this build needs are missing,
+// including one skipped below the newest applied. A newer schema passes:
+// during a rolling deploy the old instances keep serving after the new
+// release has migrated.
+func checkSchemaVersion(ctx context.Context, db *sql.DB) (map[string]interface{}, error) {
+	rows, err := db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied []int
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied = append(applied, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	version := 0
+	for _, v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	details := map[string]interface{}{"version": version, "expected": schemaVersion}
+	if missing := missingMigrations(applied, schemaVersion); len(missing) > 0 {
+		details["missing"] = missing
+		return details, fmt.Errorf("schema is missing migrations %v that this build needs: run the pending migrations",
+			missing)
+	}
+	return details, nil
+}
+
+// missingMigrations lists the versions from 1 to want not in applied
+func missingMigrations(applied []int, want int) []int {
+	have := make(map[int]bool, len(applied))
+	for _, v := range applied {
+		have[v] = true
+	}
+	var missing []int
+	for v := 1; v <= want; v++ {
+		if !have[v] {
+			missing = append(missing, v)
+		}
+	}
+	return missing
+}
+
+// checkPoolSaturation fails once the share of connections in use reaches
+// max, so a starved instance stops taking new traffic
+func checkPoolSaturation(stats sql.DBStats, max float64) (map[string]interface{}, error) {
+	var saturation float64
+	if stats.MaxOpenConnections > 0 {
+		saturation = float64(stats.InUse) / float64(stats.MaxOpenConnections)
+	}
+	details := map[string]interface{}{
+		"max_open":   stats.MaxOpenConnections,
+		"open":       stats.OpenConnections,
+		"in_use":     stats.InUse,
+		"idle":       stats.Idle,
+		"wait_count": stats.WaitCount,
+		"saturation": saturation,
+	}
+	if saturation >= max {
+		return details, fmt.Errorf("%d of %d connections in use", stats.InUse, stats.MaxOpenConnections)
+	}
+	return details, nil
+}
@@ -0,0 +1,109 @@
+// Package health runs the dependency checks behind the readiness endpoint.
+// Checks run concurrently under a shared deadline; each reports its status,
+// latency and, when it fails, why. The instance is ready only if every
+// check passes.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Statuses of a check and of a whole report
+const (
+	StatusOK       = "ok"
+	StatusFailed   = "failed"
+	StatusReady    = "ready"
+	StatusNotReady = "not_ready"
+)
+
+// Check is one dependency to verify. Run returns optional details to
+// report (such as a version), or an error if the dependency is unusable.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) (map[string]interface{}, error)
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Status    string                 `json:"status"`
+	LatencyMs float64                `json:"latency_ms"`
+	Error     string                 `json:"error,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// Report is the outcome of every check, keyed by name
+type Report struct {
+	Status    string            `json:"status"`
+	CheckedAt time.Time         `json:"checked_at"`
+	Checks    map[string]Result `json:"checks"`
+}
+
+// Ready reports whether every check passed
+func (r Report) Ready() bool {
+	return r.Status == StatusReady
+}
+
+// Run runs checks concurrently, each given until timeout to finish. A check
+// that doesn't return by then is reported as failed.
+func Run(ctx context.Context, timeout time.Duration, checks []Check) Report {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	report := Report{
+		Status:    StatusReady,
+		CheckedAt: time.Now().UTC(),
+		Checks:    make(map[string]Result, len(checks)),
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c Check) {
+			defer wg.Done()
+			result := run(ctx, c)
+			mu.Lock()
+			report.Checks[c.Name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusNotReady
+			}
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+	return report
+}
+
+// run times one check, giving up when ctx is done even if the check
+// ignores it
+func run(ctx context.Context, c Check) Result {
+	type outcome struct {
+		details map[string]interface{}
+		err     error
+	}
+	done := make(chan outcome, 1)
+	start := time.Now()
+	go func() {
+		details, err := c.Run(ctx)
+		done <- outcome{details, err}
+	}()
+
+	var o outcome
+	select {
+	case o = <-done:
+	case <-ctx.Done():
+		o.err = ctx.Err()
+	}
+
+	result := Result{
+		Status:    StatusOK,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		Details:   o.details,
+	}
+	if o.err != nil {
+		result.Status = StatusFailed
+		result.Error = o.err.Error()
+	}
+	return result
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestMissingMigrations(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		applied []int
+		want    int
+		missing []int
+	}{
+		{"none applied", nil, 3, []int{1, 2, 3}},
+		{"all applied", []int{1, 2, 3}, 3, nil},
+		{"out of order", []int{3, 1, 2}, 3, nil},
+		{"newer schema", []int{1, 2, 3, 4}, 3, nil},
+		{"behind", []int{1, 2}, 3, []int{3}},
+		{"skipped in the middle", []int{1, 3, 4}, 4, []int{2}},
+		{"newer but skipped", []int{1, 3, 4, 5}, 4, []int{2}},
+		{"nothing needed", nil, 0, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := missingMigrations(tc.applied, tc.want); !reflect.DeepEqual(got, tc.missing) {
+				t.Errorf("missingMigrations(%v, %d) = %v, want %v", tc.applied, tc.want, got, tc.missing)
+			}
+		})
+	}
+}
+
+// TestSchemaVersion checks schemaVersion was bumped with the newest
+// migration, and that migration numbers have no gaps
+func TestSchemaVersion(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "database", "migrations", "*.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	number := regexp.MustCompile(`^(\d+)_`)
+	var versions []int
+	for _, f := range files {
+		m := number.FindStringSubmatch(filepath.Base(f))
+		if m == nil {
+			t.Errorf("migration %s doesn't start with its number", f)
+			continue
+		}
+		v, _ := strconv.Atoi(m[1])
+		versions = append(versions, v)
+	}
+	if len(versions) == 0 {
+		t.Fatal("no migrations found")
+	}
+	sort.Ints(versions)
+
+	if missing := missingMigrations(versions, len(versions)); len(missing) > 0 {
+		t.Errorf("migration numbers skip %v", missing)
+	}
+	if newest := versions[len(versions)-1]; newest != schemaVersion {
+		t.Errorf("schemaVersion is %d, but the newest migration is %d", schemaVersion, newest)
+	}
+}
@@ -0,0 +1,206 @@
+// Package jobs runs background work from a Postgres-backed queue. Jobs are
+// rows in the jobs table (database/migrations/014_jobs.sql); workers claim
+// them with SELECT ... FOR UPDATE SKIP LOCKED, so several server processes
+// can share one queue. Failed jobs are retried with exponential backoff and
+// moved to jobs_dead once they run out of attempts.
+//
+// Handlers are typed: declare a Type with the payload it carries, register
+// it on a Runner with Handle and enqueue with Type.Enqueue.
+//
+// A job remembers the trace it was enqueued in, and each run is a span in
+// that trace (see package tracing).
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"streetsavvy-backend/tracing"
+)
+
+// DefaultMaxAttempts is used by Types that don't set MaxAttempts
+const DefaultMaxAttempts = 5
+
+// Execer is satisfied by both *sql.DB and *sql.Tx, so a job can be
+// enqueued in the same transaction as the change that needs it
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Type is a kind of job carrying a payload of type T, encoded as JSON
+type Type[T any] struct {
+	Name        string
+	MaxAttempts int // Runs before the job is dead-lettered; 0 means DefaultMaxAttempts
+}
+
+// Enqueue adds a job to run as soon as a worker is free. The job's run
+// continues ctx's trace.
+func (t Type[T]) Enqueue(ctx context.Context, db Execer, payload T) error {
+	return t.EnqueueAt(ctx, db, payload, time.Time{})
+}
+
+// EnqueueAt adds a job to run no earlier than at (zero means now)
+func (t Type[T]) EnqueueAt(ctx context.Context, db Execer, payload T, at time.Time) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encoding %s payload: %w", t.Name, err)
+	}
+	maxAttempts := t.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	var runAt interface{}
+	if !at.IsZero() {
+		runAt = at
+	}
+	var traceParent interface{}
+	if tp := tracing.Inject(ctx); tp != "" {
+		traceParent = tp
+	}
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO jobs (job_type, payload, max_attempts, run_at, trace_parent)
+		VALUES ($1, $2, $3, COALESCE($4, NOW()), $5)`,
+		t.Name, raw, maxAttempts, runAt, traceParent)
+	return err
+}
+
+// Handle registers fn to run jobs of type t
+func Handle[T any](r *Runner, t Type[T], fn func(ctx context.Context, payload T) error) {
+	r.handlers[t.Name] = func(ctx context.Context, raw json.RawMessage) error {
+		var payload T
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return permanent{fmt.Errorf("decoding payload: %w", err)}
+		}
+		return fn(ctx, payload)
+	}
+}
+
+// Permanent marks an error that retrying won't fix; the job goes straight
+// to the dead-letter table
+func Permanent(err error) error {
+	return permanent{err}
+}
+
+type permanent struct{ error }
+
+func (p permanent) Unwrap() error { return p.error }
+
+// Backoff is the delay before retry number attempt (1 for the first
+// retry): base doubled per attempt, capped at max
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// DeadJob is a job that ran out of attempts
+type DeadJob struct {
+	JobID     int64           `json:"job_id"`
+	Type      string          `json:"job_type"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error"`
+	CreatedAt time.Time       `json:"created_at"`
+	FailedAt  time.Time       `json:"failed_at"`
+}
+
+// QueueStats counts jobs per type
+type QueueStats struct {
+	Type     string `json:"job_type"`
+	Ready    int    `json:"ready"`    // Due and waiting for a worker
+	Running  int    `json:"running"`  // Claimed by a worker
+	Retrying int    `json:"retrying"` // Failed, waiting out their backoff
+	Dead     int    `json:"dead"`
+}
+
+// Stats counts queued, running and dead jobs per type. A claim older than
+// lockTimeout counts as ready again, as it does for workers.
+func Stats(db *sql.DB, lockTimeout time.Duration) ([]QueueStats, error) {
+	rows, err := db.Query(`
+		WITH queued AS (
+			SELECT job_type,
+				COUNT(*) FILTER (WHERE run_at <= NOW() AND (locked_at IS NULL OR locked_at < NOW() - $1::float8 * INTERVAL '1 second')) AS ready,
+				COUNT(*) FILTER (WHERE locked_at >= NOW() - $1::float8 * INTERVAL '1 second') AS running,
+				COUNT(*) FILTER (WHERE run_at > NOW() AND locked_at IS NULL AND attempts > 0) AS retrying
+			FROM jobs
+			GROUP BY job_type
+		), dead AS (
+			SELECT job_type, COUNT(*) AS dead FROM jobs_dead GROUP BY job_type
+		)
+		SELECT job_type, COALESCE(q.ready, 0), COALESCE(q.running, 0), COALESCE(q.retrying, 0), COALESCE(d.dead, 0)
+		FROM queued q
+		FULL JOIN dead d USING (job_type)
+		ORDER BY job_type`, lockTimeout.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []QueueStats{}
+	for rows.Next() {
+		var s QueueStats
+		if err := rows.Scan(&s.Type, &s.Ready, &s.Running, &s.Retrying, &s.Dead); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// ListDead returns dead jobs, newest first, optionally of one type
+func ListDead(db *sql.DB, jobType string, limit int) ([]DeadJob, error) {
+	rows, err := db.Query(`
+		SELECT job_id, job_type, payload, attempts, last_error, created_at, failed_at
+		FROM jobs_dead
+		WHERE $1 = '' OR job_type = $1
+		ORDER BY failed_at DESC
+		LIMIT $2`, jobType, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dead := []DeadJob{}
+	for rows.Next() {
+		var j DeadJob
+		if err := rows.Scan(&j.JobID, &j.Type, &j.Payload, &j.Attempts, &j.LastError, &j.CreatedAt, &j.FailedAt); err != nil {
+			return nil, err
+		}
+		dead = append(dead, j)
+	}
+	return dead, rows.Err()
+}
+
+// Retry puts a dead job back on the queue with a fresh set of attempts.
+// Returns sql.ErrNoRows if there is no such dead job.
+func Retry(db *sql.DB, jobID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		WITH revived AS (
+			DELETE FROM jobs_dead WHERE job_id = $1
+			RETURNING job_id, job_type, payload, max_attempts, last_error, created_at, trace_parent
+		)
+		INSERT INTO jobs (job_id, job_type, payload, max_attempts, last_error, created_at, run_at, trace_parent)
+		SELECT job_id, job_type, payload, max_attempts, last_error, created_at, NOW(), trace_parent
+		FROM revived`, jobID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
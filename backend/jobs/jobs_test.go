@@ -0,0 +1,30 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	const base, max = 30 * time.Second, 10 * time.Minute
+	for _, tc := range []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, base},
+		{1, base},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{6, max}, // 16 minutes, capped
+		{1000, max},
+	} {
+		if got := Backoff(tc.attempt, base, max); got != tc.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tc.attempt, got, tc.want)
+		}
+	}
+
+	if got := Backoff(1, time.Hour, time.Minute); got != time.Minute {
+		t.Errorf("Backoff with base above max = %v, want %v", got, time.Minute)
+	}
+}
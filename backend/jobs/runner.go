@@ -0,0 +1,261 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"streetsavvy-backend/tracing"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Options tune a Runner
+type Options struct {
+	Concurrency  int           // Jobs run at once by this process
+	PollInterval time.Duration // How often idle workers look for due jobs
+	RetryBase    time.Duration // Delay before the first retry
+	RetryMax     time.Duration // Longest delay between retries
+	LockTimeout  time.Duration // A claimed job not finished by then is run again
+	JobTimeout   time.Duration // Context deadline for one run
+}
+
+// DefaultOptions runs 4 jobs at once, retrying after 10s, 20s, 40s ... up to 1h
+func DefaultOptions() Options {
+	return Options{
+		Concurrency:  4,
+		PollInterval: time.Second,
+		RetryBase:    10 * time.Second,
+		RetryMax:     time.Hour,
+		LockTimeout:  10 * time.Minute,
+		JobTimeout:   20 * time.Second,
+	}
+}
+
+// Validate checks the options make sense together
+func (o Options) Validate() error {
+	if o.Concurrency < 1 {
+		return fmt.Errorf("job concurrency must be at least 1")
+	}
+	if o.PollInterval <= 0 || o.RetryBase <= 0 || o.JobTimeout <= 0 {
+		return fmt.Errorf("job poll interval, retry delay and timeout must be positive")
+	}
+	if o.RetryMax < o.RetryBase {
+		return fmt.Errorf("maximum retry delay must not be shorter than the first")
+	}
+	if o.LockTimeout <= o.JobTimeout {
+		return fmt.Errorf("job lock timeout must be longer than the job timeout")
+	}
+	return nil
+}
+
+// Counters are what a Runner has done since it started
+type Counters struct {
+	Succeeded int64 `json:"succeeded"`
+	Retried   int64 `json:"retried"`
+	Dead      int64 `json:"dead"`
+}
+
+// Runner claims due jobs and runs them with the registered handlers
+type Runner struct {
+	db       *sql.DB
+	opts     Options
+	workerID string
+	handlers map[string]func(ctx context.Context, payload json.RawMessage) error
+
+	succeeded, retried, dead atomic.Int64
+}
+
+// NewRunner creates a Runner; register handlers with Handle before Run
+func NewRunner(db *sql.DB, opts Options) *Runner {
+	host, _ := os.Hostname()
+	return &Runner{
+		db:       db,
+		opts:     opts,
+		workerID: fmt.Sprintf("%s:%d", host, os.Getpid()),
+		handlers: make(map[string]func(context.Context, json.RawMessage) error),
+	}
+}
+
+// Options returns the runner's settings
+func (r *Runner) Options() Options {
+	return r.opts
+}
+
+// Counters returns the runner's counters
+func (r *Runner) Counters() Counters {
+	return Counters{
+		Succeeded: r.succeeded.Load(),
+		Retried:   r.retried.Load(),
+		Dead:      r.dead.Load(),
+	}
+}
+
+// Run starts Options.Concurrency workers and blocks until ctx is cancelled
+// and the jobs in progress have finished. Jobs only see ctx's cancellation
+// through their own deadline, so a shutdown lets them complete.
+func (r *Runner) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < r.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// work runs jobs back to back while there are any, then polls
+func (r *Runner) work(ctx context.Context) {
+	ticker := time.NewTicker(r.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			ran, err := r.runOne()
+			if err != nil {
+				log.Printf("Job queue error: %v", err)
+				break
+			}
+			if !ran {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// claimed is a job taken by this worker
+type claimed struct {
+	id          int64
+	jobType     string
+	payload     json.RawMessage
+	attempts    int
+	maxAttempts int
+	traceParent sql.NullString
+}
+
+// runOne claims and runs one due job. Returns false if none was due.
+func (r *Runner) runOne() (bool, error) {
+	job, err := r.claim()
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Each run is a span in the trace that enqueued the job
+	ctx := tracing.Extract(context.Background(), job.traceParent.String)
+	ctx, span := tracing.Tracer().Start(ctx, "job "+job.jobType,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("job.type", job.jobType),
+			attribute.Int64("job.id", job.id),
+			attribute.Int("job.attempt", job.attempts),
+		))
+	defer span.End()
+
+	handler := r.handlers[job.jobType]
+	runCtx, cancel := context.WithTimeout(ctx, r.opts.JobTimeout)
+	err = runHandler(runCtx, handler, job.payload)
+	cancel()
+
+	if err == nil {
+		r.succeeded.Add(1)
+		_, err = r.db.ExecContext(ctx, `DELETE FROM jobs WHERE job_id = $1`, job.id)
+		return true, err
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	return true, r.fail(ctx, job, err)
+}
+
+// claim locks the oldest due job of a type this runner handles. A job whose
+// claim is older than LockTimeout (its worker died) is claimed again.
+func (r *Runner) claim() (*claimed, error) {
+	types := make([]string, 0, len(r.handlers))
+	for t := range r.handlers {
+		types = append(types, t)
+	}
+
+	var job claimed
+	err := r.db.QueryRow(`
+		UPDATE jobs
+		SET locked_at = NOW(), locked_by = $3, attempts = attempts + 1
+		WHERE job_id = (
+			SELECT job_id FROM jobs
+			WHERE job_type = ANY($1)
+			  AND run_at <= NOW()
+			  AND (locked_at IS NULL OR locked_at < NOW() - $2::float8 * INTERVAL '1 second')
+			ORDER BY run_at, job_id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING job_id, job_type, payload, attempts, max_attempts, trace_parent`,
+		pq.Array(types), r.opts.LockTimeout.Seconds(), r.workerID).Scan(
+		&job.id, &job.jobType, &job.payload, &job.attempts, &job.maxAttempts, &job.traceParent)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// runHandler turns a panicking handler into a failed job
+func runHandler(ctx context.Context, handler func(context.Context, json.RawMessage) error, payload json.RawMessage) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return handler(ctx, payload)
+}
+
+// fail schedules a retry, or dead-letters the job once it is out of
+// attempts or the error is permanent
+func (r *Runner) fail(ctx context.Context, job *claimed, jobErr error) error {
+	var perm permanent
+	if job.attempts < job.maxAttempts && !errors.As(jobErr, &perm) {
+		delay := Backoff(job.attempts, r.opts.RetryBase, r.opts.RetryMax)
+		r.retried.Add(1)
+		log.Printf("Job %d (%s) failed, attempt %d of %d, retrying in %s: %v",
+			job.id, job.jobType, job.attempts, job.maxAttempts, delay, jobErr)
+		_, err := r.db.ExecContext(ctx, `
+			UPDATE jobs
+			SET locked_at = NULL, locked_by = NULL, last_error = $2,
+				run_at = NOW() + $3::float8 * INTERVAL '1 second'
+			WHERE job_id = $1`,
+			job.id, jobErr.Error(), delay.Seconds())
+		return err
+	}
+
+	r.dead.Add(1)
+	log.Printf("Job %d (%s) failed permanently after %d attempts: %v",
+		job.id, job.jobType, job.attempts, jobErr)
+	_, err := r.db.ExecContext(ctx, `
+		WITH failed AS (
+			DELETE FROM jobs WHERE job_id = $1
+			RETURNING job_id, job_type, payload, attempts, max_attempts, created_at, trace_parent
+		)
+		INSERT INTO jobs_dead (job_id, job_type, payload, attempts, max_attempts, last_error, created_at, trace_parent)
+		SELECT job_id, job_type, payload, attempts, max_attempts, $2, created_at, trace_parent
+		FROM failed`,
+		job.id, jobErr.Error())
+	return err
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"streetsavvy-backend/config"
+	"streetsavvy-backend/retention"
+)
+
+// Location retention: a background worker applies retentionPolicy to the
+// location trail (see package retention), and admin endpoints show its
+// counters or trigger a run by hand.
+
+// retentionPolicy is set in main from LOCATION_* (see config.LocationConfig)
+var (
+	retentionPolicy = retention.DefaultPolicy()
+	retentionStats  retention.Stats
+)
+
+// runRetentionWorker applies retentionPolicy every interval until ctx is
+// cancelled
+func runRetentionWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		runRetention(retentionPolicy)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runRetention does one pass and records it in retentionStats
+func runRetention(p retention.Policy) (retention.Report, error) {
+	report, err := retention.Run(config.DB, p, time.Now())
+	retentionStats.Record(report, err)
+
+	if err != nil {
+		log.Printf("Location retention failed: %v", err)
+		return report, err
+	}
+
+	verb := "Pruned"
+	if report.DryRun {
+		verb = "Dry run: would prune"
+	}
+	log.Printf("%s location data: %d raw fixes (%d downsampled into %d hourly rows), %d partitions, %d hourly rows past horizon (%dms)",
+		verb, report.RawRowsDeleted, report.RawRowsDownsampled, report.HourlyRowsWritten,
+		len(report.PartitionsDropped), report.HourlyRowsDeleted, report.DurationMs)
+	return report, nil
+}
+
+// retentionStatus is the retention policy and the worker's counters
+type retentionStatus struct {
+	Policy retentionPolicySettings `json:"policy"`
+	Stats  retention.Totals        `json:"stats"`
+}
+
+type retentionPolicySettings struct {
+	RawDays    int  `json:"raw_days"`
+	HourlyDays int  `json:"hourly_days"`
+	DryRun     bool `json:"dry_run"`
+}
+
+// getRetentionStatsHandler returns the policy and the worker's counters:
+// GET /api/admin/retention
+func getRetentionStatsHandler(w http.ResponseWriter, r *http.Request) {
+	response := retentionStatus{
+		Policy: retentionPolicySettings{
+			RawDays:    retentionPolicy.RawDays,
+			HourlyDays: retentionPolicy.HourlyDays,
+			DryRun:     retentionPolicy.DryRun,
+		},
+		Stats: retentionStats.Snapshot(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// runRetentionHandler runs retention now and returns its report:
+// POST /api/admin/retention/run. ?dry_run=true only reports.
+func runRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	p := retentionPolicy
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		dryRun, err := strconv.ParseBool(v)
+		if err != nil {
+			writeValidationError(w, r, invalidField("dry_run", "dry_run must be true or false"))
+			return
+		}
+		p.DryRun = dryRun
+	}
+
+	report, err := runRetention(p)
+	if err != nil {
+		writeInternalError(w, r, "Location retention failed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,98 @@
+// Package logging sets up the server's structured logs. Records are written
+// as JSON (or text for local development) through log/slog; records logged
+// with a request's context carry its request ID (and trace ID when traced), and everything passes
+// through a redaction layer (see redact.go) before it is written, including
+// lines still logged with the standard log package.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Options configure the logger
+type Options struct {
+	Level              slog.Level
+	Format             string // "json" or "text"
+	CoordinateDecimals int    // Decimal places kept of logged coordinates
+}
+
+// DefaultOptions log JSON at info level, with coordinates rounded to 2
+// decimal places (about 1km)
+func DefaultOptions() Options {
+	return Options{Level: slog.LevelInfo, Format: "json", CoordinateDecimals: 2}
+}
+
+// Validate checks the options are usable
+func (o Options) Validate() error {
+	if o.Format != "json" && o.Format != "text" {
+		return fmt.Errorf("log format must be json or text, got %q", o.Format)
+	}
+	if o.CoordinateDecimals < 0 || o.CoordinateDecimals > 6 {
+		return fmt.Errorf("coordinate decimals must be between 0 and 6")
+	}
+	return nil
+}
+
+// ParseLevel reads debug, info, warn or error
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(strings.ToUpper(s)))
+	return level, err
+}
+
+// New returns a logger writing to w. Install it with slog.SetDefault so the
+// standard log package goes through it too.
+func New(w io.Writer, opts Options) *slog.Logger {
+	handlerOpts := &slog.HandlerOptions{Level: opts.Level}
+	var h slog.Handler
+	if opts.Format == "text" {
+		h = slog.NewTextHandler(w, handlerOpts)
+	} else {
+		h = slog.NewJSONHandler(w, handlerOpts)
+	}
+	h = &redactHandler{next: h, decimals: opts.CoordinateDecimals}
+	return slog.New(contextHandler{h})
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns ctx carrying id; records logged with it include
+// request_id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or ""
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds the request ID and trace ID from the record's context
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
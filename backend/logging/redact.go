@@ -0,0 +1,123 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Redaction: logs must not hold a user's precise location or phone
+// identity. Coordinates are rounded to Options.CoordinateDecimals, and
+// phone numbers (MSISDN) and device IDs (IMEI) keep only their last two
+// digits. Attributes are redacted by key; messages and other string values,
+// which include free-text lines from the log package, are scrubbed by
+// pattern.
+
+// Attribute keys whose values are redacted
+var (
+	coordinateKeys = map[string]bool{
+		"lat": true, "lng": true, "long": true, "lon": true,
+		"latitude": true, "longitude": true,
+	}
+	identityKeys = map[string]bool{
+		"msisdn": true, "imei": true, "phone": true,
+	}
+)
+
+var (
+	// A decimal with 4 or more places is taken to be a coordinate
+	coordinatePattern = regexp.MustCompile(`-?\b\d{1,3}\.\d{4,}\b`)
+	// 10 to 15 digits, optionally with a leading +: an MSISDN or IMEI
+	identityPattern = regexp.MustCompile(`\+?\b\d{10,15}\b`)
+)
+
+// RoundCoordinate rounds a latitude or longitude to decimals places
+func RoundCoordinate(f float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(f*scale) / scale
+}
+
+// MaskIdentity hides all but the last two digits of an MSISDN or IMEI
+func MaskIdentity(s string) string {
+	if len(s) <= 2 {
+		return strings.Repeat("*", len(s))
+	}
+	return strings.Repeat("*", len(s)-2) + s[len(s)-2:]
+}
+
+// Scrub rounds coordinates and masks phone numbers and device IDs in
+// free text
+func Scrub(s string, decimals int) string {
+	s = coordinatePattern.ReplaceAllStringFunc(s, func(m string) string {
+		f, err := strconv.ParseFloat(m, 64)
+		if err != nil {
+			return m
+		}
+		return strconv.FormatFloat(RoundCoordinate(f, decimals), 'f', decimals, 64)
+	})
+	return identityPattern.ReplaceAllStringFunc(s, MaskIdentity)
+}
+
+// redactHandler redacts records before passing them on
+type redactHandler struct {
+	next     slog.Handler
+	decimals int
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, Scrub(r.Message, h.decimals), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(h.redact(a))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = h.redact(a)
+	}
+	return &redactHandler{next: h.next.WithAttrs(redacted), decimals: h.decimals}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{next: h.next.WithGroup(name), decimals: h.decimals}
+}
+
+// redact rounds or masks one attribute, recursing into groups
+func (h *redactHandler) redact(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	key := strings.ToLower(a.Key)
+
+	switch v := a.Value; v.Kind() {
+	case slog.KindGroup:
+		attrs := v.Group()
+		redacted := make([]slog.Attr, len(attrs))
+		for i, ga := range attrs {
+			redacted[i] = h.redact(ga)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+	case slog.KindFloat64:
+		if coordinateKeys[key] {
+			return slog.Float64(a.Key, RoundCoordinate(v.Float64(), h.decimals))
+		}
+	case slog.KindString:
+		if identityKeys[key] {
+			return slog.String(a.Key, MaskIdentity(v.String()))
+		}
+		return slog.String(a.Key, Scrub(v.String(), h.decimals))
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return slog.String(a.Key, Scrub(err.Error(), h.decimals))
+		}
+	}
+	return a
+}
@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+func TestScrub(t *testing.T) {
+	for _, tc := range []struct {
+		in       string
+		decimals int
+		want     string
+	}{
+		{"user at 33.019812,-96.698934", 2, "user at 33.02,-96.70"},
+		{"user at 33.019812,-96.698934", 3, "user at 33.020,-96.699"},
+		{"lat=33.0198 lng=-96.6989", 0, "lat=33 lng=-97"},
+		{"msisdn +15551234567 verified", 2, "msisdn **********67 verified"},
+		{"device 490154203237518", 2, "device *************18"},
+		{"number 5551234567", 2, "number ********67"},
+		// Short numbers, versions and amounts are left alone
+		{"order 12345 cost 12.50 on v1.2.3", 2, "order 12345 cost 12.50 on v1.2.3"},
+		{"retry 3 of 5 after 1.5s", 2, "retry 3 of 5 after 1.5s"},
+		{"", 2, ""},
+	} {
+		if got := Scrub(tc.in, tc.decimals); got != tc.want {
+			t.Errorf("Scrub(%q, %d) = %q, want %q", tc.in, tc.decimals, got, tc.want)
+		}
+	}
+}
+
+func TestMaskIdentity(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"+15551234567", "**********67"},
+		{"123", "*23"},
+		{"12", "**"},
+		{"", ""},
+	} {
+		if got := MaskIdentity(tc.in); got != tc.want {
+			t.Errorf("MaskIdentity(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestRedactHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, DefaultOptions()).With("imei", "490154203237518")
+	logger.Info("location from +15551234567",
+		"lat", 33.019812,
+		"lng", -96.698934,
+		"MSISDN", "+15551234567",
+		"note", "near 33.019812,-96.698934",
+		"err", errors.New("no campaign near 33.019812"),
+		slog.Group("fix", "latitude", 33.019812, "accuracy", 12.345678),
+	)
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("log line %q: %v", buf.String(), err)
+	}
+	for key, want := range map[string]interface{}{
+		"msg":    "location from **********67",
+		"imei":   "*************18",
+		"lat":    33.02,
+		"lng":    -96.7,
+		"MSISDN": "**********67",
+		"note":   "near 33.02,-96.70",
+		"err":    "no campaign near 33.02",
+	} {
+		if got[key] != want {
+			t.Errorf("%s = %v, want %v", key, got[key], want)
+		}
+	}
+	fix, _ := got["fix"].(map[string]interface{})
+	if fix["latitude"] != 33.02 || fix["accuracy"] != 12.345678 {
+		t.Errorf("fix = %v, want latitude rounded and accuracy untouched", fix)
+	}
+}
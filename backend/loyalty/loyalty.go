@@ -0,0 +1,112 @@
+// Package loyalty awards points for redeemed offers and turns them into a
+// loyalty tier. Points are kept in a ledger (loyalty_points); a user's tier
+// is the highest one whose threshold their points within the rolling window
+// reach. The tier is stored in users.loyalty_tier, where segment matching
+// reads it as loyalty_tier_<name>.
+package loyalty
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Tier is a named level reached at MinPoints
+type Tier struct {
+	Name      string `json:"name"`
+	MinPoints int    `json:"min_points"`
+}
+
+// Policy is how points are earned and what they are worth
+type Policy struct {
+	PointsPerUse int    // Base points for one "used" engagement
+	WindowDays   int    // Only points earned within this many days count
+	Tiers        []Tier // Ascending by MinPoints; the first must start at 0
+}
+
+// DefaultPolicy is bronze/silver/gold at 0/100/300 points over 90 days,
+// 10 points per use
+func DefaultPolicy() Policy {
+	return Policy{
+		PointsPerUse: 10,
+		WindowDays:   90,
+		Tiers: []Tier{
+			{Name: "bronze", MinPoints: 0},
+			{Name: "silver", MinPoints: 100},
+			{Name: "gold", MinPoints: 300},
+		},
+	}
+}
+
+// ParseTiers reads "name:min_points,..." such as "bronze:0,silver:100,gold:300"
+func ParseTiers(s string) ([]Tier, error) {
+	var tiers []Tier
+	for _, part := range strings.Split(s, ",") {
+		name, min, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return nil, fmt.Errorf("tier %q must be name:min_points", part)
+		}
+		points, err := strconv.Atoi(strings.TrimSpace(min))
+		if err != nil {
+			return nil, fmt.Errorf("tier %q has an invalid point threshold", part)
+		}
+		tiers = append(tiers, Tier{Name: strings.TrimSpace(name), MinPoints: points})
+	}
+	sort.SliceStable(tiers, func(i, j int) bool { return tiers[i].MinPoints < tiers[j].MinPoints })
+	return tiers, nil
+}
+
+// Validate checks the policy can place every user in a tier
+func (p Policy) Validate() error {
+	if p.PointsPerUse < 1 {
+		return fmt.Errorf("points per use must be at least 1")
+	}
+	if p.WindowDays < 1 {
+		return fmt.Errorf("loyalty window must be at least 1 day")
+	}
+	if len(p.Tiers) == 0 {
+		return fmt.Errorf("at least one loyalty tier is required")
+	}
+	if p.Tiers[0].MinPoints != 0 {
+		return fmt.Errorf("the lowest loyalty tier must start at 0 points")
+	}
+	seen := make(map[string]bool, len(p.Tiers))
+	for i, t := range p.Tiers {
+		if t.Name == "" || strings.ContainsAny(t.Name, " \t") {
+			return fmt.Errorf("loyalty tier names must be non-empty and without spaces")
+		}
+		if seen[t.Name] {
+			return fmt.Errorf("loyalty tier %q is listed twice", t.Name)
+		}
+		seen[t.Name] = true
+		if i > 0 && t.MinPoints == p.Tiers[i-1].MinPoints {
+			return fmt.Errorf("loyalty tiers %q and %q have the same threshold", p.Tiers[i-1].Name, t.Name)
+		}
+	}
+	return nil
+}
+
+// TierFor returns the tier points reach and the one after it, or nil at the top
+func (p Policy) TierFor(points int) (Tier, *Tier) {
+	current := 0
+	for i, t := range p.Tiers {
+		if points >= t.MinPoints {
+			current = i
+		}
+	}
+	if current+1 < len(p.Tiers) {
+		next := p.Tiers[current+1]
+		return p.Tiers[current], &next
+	}
+	return p.Tiers[current], nil
+}
+
+// PointsFor is what one use is worth at a vendor with the given multiplier
+func (p Policy) PointsFor(multiplier float64) int {
+	if multiplier <= 0 {
+		return 0
+	}
+	return int(math.Round(float64(p.PointsPerUse) * multiplier))
+}
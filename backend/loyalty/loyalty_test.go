@@ -0,0 +1,105 @@
+package loyalty
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTiers(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    []Tier
+		wantErr bool
+	}{
+		{"bronze:0,silver:100,gold:300", DefaultPolicy().Tiers, false},
+		{" gold : 300 , bronze:0, silver:100 ", DefaultPolicy().Tiers, false}, // Sorted by threshold
+		{"member:0", []Tier{{Name: "member", MinPoints: 0}}, false},
+		{"bronze", nil, true},
+		{"bronze:0,silver", nil, true},
+		{"bronze:zero", nil, true},
+		{"bronze:1.5", nil, true},
+		{"", nil, true},
+	} {
+		got, err := ParseTiers(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseTiers(%q) error = %v, wantErr %v", tc.in, err, tc.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseTiers(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	with := func(change func(*Policy)) Policy {
+		p := DefaultPolicy()
+		change(&p)
+		return p
+	}
+
+	for _, tc := range []struct {
+		name    string
+		policy  Policy
+		wantErr bool
+	}{
+		{"default", DefaultPolicy(), false},
+		{"single tier", with(func(p *Policy) { p.Tiers = []Tier{{Name: "member"}} }), false},
+		{"no points", with(func(p *Policy) { p.PointsPerUse = 0 }), true},
+		{"no window", with(func(p *Policy) { p.WindowDays = 0 }), true},
+		{"no tiers", with(func(p *Policy) { p.Tiers = nil }), true},
+		{"no starting tier", with(func(p *Policy) { p.Tiers = []Tier{{Name: "silver", MinPoints: 100}} }), true},
+		{"unnamed tier", with(func(p *Policy) { p.Tiers[1].Name = "" }), true},
+		{"space in name", with(func(p *Policy) { p.Tiers[1].Name = "sterling silver" }), true},
+		{"duplicate name", with(func(p *Policy) { p.Tiers[2].Name = "silver" }), true},
+		{"same threshold", with(func(p *Policy) { p.Tiers[2].MinPoints = 100 }), true},
+	} {
+		if err := tc.policy.Validate(); (err != nil) != tc.wantErr {
+			t.Errorf("%s: Validate() = %v, wantErr %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestTierFor(t *testing.T) {
+	p := DefaultPolicy()
+	for _, tc := range []struct {
+		points     int
+		tier, next string // next is empty at the top tier
+	}{
+		{0, "bronze", "silver"},
+		{-20, "bronze", "silver"}, // Reversed points never drop below the first tier
+		{99, "bronze", "silver"},
+		{100, "silver", "gold"},
+		{299, "silver", "gold"},
+		{300, "gold", ""},
+		{5000, "gold", ""},
+	} {
+		tier, next := p.TierFor(tc.points)
+		nextName := ""
+		if next != nil {
+			nextName = next.Name
+		}
+		if tier.Name != tc.tier || nextName != tc.next {
+			t.Errorf("TierFor(%d) = %s, %q; want %s, %q", tc.points, tier.Name, nextName, tc.tier, tc.next)
+		}
+	}
+}
+
+func TestPointsFor(t *testing.T) {
+	p := DefaultPolicy()
+	for _, tc := range []struct {
+		multiplier float64
+		want       int
+	}{
+		{1, 10},
+		{1.5, 15},
+		{1.26, 13},
+		{0.04, 0},
+		{0, 0},
+		{-2, 0},
+	} {
+		if got := p.PointsFor(tc.multiplier); got != tc.want {
+			t.Errorf("PointsFor(%v) = %d, want %d", tc.multiplier, got, tc.want)
+		}
+	}
+}
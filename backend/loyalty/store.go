@@ -0,0 +1,181 @@
+package loyalty
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Reasons recorded in loyalty_tier_history
+const (
+	ReasonUse     = "use"     // Incremental update after a redemption
+	ReasonNightly = "nightly" // Scheduled recalculation, e.g. points aging out
+	ReasonManual  = "manual"  // Recalculation triggered by an operator
+)
+
+// Change is the outcome of recalculating one user's tier
+type Change struct {
+	UserID  string `json:"user_id"`
+	OldTier string `json:"old_tier"`
+	NewTier string `json:"new_tier"`
+	Points  int    `json:"points"`
+	Changed bool   `json:"changed"`
+}
+
+// Report is what a full recalculation did
+type Report struct {
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	Users      int       `json:"users"`
+	Changed    int       `json:"changed"`
+}
+
+// Award credits the "used" engagement engagementID to its user, at the
+// multiplier of the store it was used at. A use is credited at most once;
+// Award returns the points awarded, 0 if it already was.
+func Award(tx *sql.Tx, p Policy, engagementID int64) (int, error) {
+	var userID, campaignID, vendorID string
+	var multiplier float64
+	err := tx.QueryRow(`
+		SELECT e.user_id, e.campaign_id, v.vendor_id, v.loyalty_multiplier
+		FROM campaign_user_engagements e
+		JOIN campaigns c ON e.campaign_id = c.campaign_id
+		JOIN vendors v ON v.vendor_id = COALESCE(e.vendor_id, c.vendor_id)
+		WHERE e.engagement_id = $1 AND e.engagement_type = 'used'`,
+		engagementID).Scan(&userID, &campaignID, &vendorID, &multiplier)
+	if err != nil {
+		return 0, err
+	}
+
+	points := p.PointsFor(multiplier)
+	if points == 0 {
+		return 0, nil
+	}
+	res, err := tx.Exec(`
+		INSERT INTO loyalty_points (user_id, campaign_id, vendor_id, multiplier, points, engagement_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (engagement_id) DO NOTHING`,
+		userID, campaignID, vendorID, multiplier, points, engagementID)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return 0, err
+	}
+	return points, nil
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Points is userID's total within the policy window
+func Points(q queryRower, p Policy, userID string) (int, error) {
+	var points int
+	err := q.QueryRow(`
+		SELECT COALESCE(SUM(points), 0)
+		FROM loyalty_points
+		WHERE user_id = $1 AND earned_at >= NOW() - $2::int * INTERVAL '1 day'`,
+		userID, p.WindowDays).Scan(&points)
+	return points, err
+}
+
+// Recalculate sets userID's tier from their points, recording any change
+// in loyalty_tier_history. The users row is locked for the transaction.
+func Recalculate(tx *sql.Tx, p Policy, userID, reason string) (Change, error) {
+	c := Change{UserID: userID}
+
+	var current sql.NullString
+	err := tx.QueryRow(`SELECT loyalty_tier FROM users WHERE user_id = $1 FOR UPDATE`,
+		userID).Scan(&current)
+	if err != nil {
+		return c, err
+	}
+	c.OldTier = current.String
+
+	if c.Points, err = Points(tx, p, userID); err != nil {
+		return c, err
+	}
+	tier, _ := p.TierFor(c.Points)
+	c.NewTier = tier.Name
+	if c.NewTier == c.OldTier {
+		return c, nil
+	}
+
+	c.Changed = true
+	if _, err = tx.Exec(`UPDATE users SET loyalty_tier = $2, updated_at = NOW() WHERE user_id = $1`,
+		userID, c.NewTier); err != nil {
+		return c, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO loyalty_tier_history (user_id, old_tier, new_tier, points, reason)
+		VALUES ($1, $2, $3, $4, $5)`,
+		userID, current, c.NewTier, c.Points, reason)
+	return c, err
+}
+
+// RecalculateAll brings every live user's tier up to date, e.g. as points
+// age out of the window or after the thresholds change. Each change
+// commits on its own.
+func RecalculateAll(db *sql.DB, p Policy, reason string) (Report, error) {
+	r := Report{StartedAt: time.Now()}
+	err := recalculateAll(db, p, reason, &r)
+	r.DurationMs = time.Since(r.StartedAt).Milliseconds()
+	return r, err
+}
+
+func recalculateAll(db *sql.DB, p Policy, reason string, r *Report) error {
+	rows, err := db.Query(`
+		SELECT u.user_id, COALESCE(u.loyalty_tier, ''), COALESCE(SUM(lp.points), 0)
+		FROM users u
+		LEFT JOIN loyalty_points lp
+			ON lp.user_id = u.user_id AND lp.earned_at >= NOW() - $1::int * INTERVAL '1 day'
+		WHERE u.deleted_at IS NULL
+		GROUP BY u.user_id`, p.WindowDays)
+	if err != nil {
+		return err
+	}
+
+	var stale []string
+	for rows.Next() {
+		var userID, tier string
+		var points int
+		if err := rows.Scan(&userID, &tier, &points); err != nil {
+			rows.Close()
+			return err
+		}
+		r.Users++
+		if want, _ := p.TierFor(points); want.Name != tier {
+			stale = append(stale, userID)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, userID := range stale {
+		c, err := recalculateOne(db, p, userID, reason)
+		if err != nil {
+			return err
+		}
+		if c.Changed {
+			r.Changed++
+		}
+	}
+	return nil
+}
+
+func recalculateOne(db *sql.DB, p Policy, userID, reason string) (Change, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Change{}, err
+	}
+	defer tx.Rollback()
+
+	c, err := Recalculate(tx, p, userID, reason)
+	if err != nil {
+		return c, err
+	}
+	return c, tx.Commit()
+}
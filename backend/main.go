@@ -1,21 +1,31 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"fmt"
 	"database/sql"
 
 	"streetsavvy-backend/config"
+	"streetsavvy-backend/logging"
 	"streetsavvy-backend/models"
+	"streetsavvy-backend/ranking"
+	"streetsavvy-backend/tracing"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/trace"
     "sync"
+    "syscall"
     "time"
 )
 
@@ -37,6 +47,9 @@ var upgrader = websocket.Upgrader{
 		return true // Allow all origins for development
 	},
 }
+
+// wsPushInterval is set in main from WS_PUSH_INTERVAL
+var wsPushInterval = 30 * time.Second
 // WSMessage represents a message sent over WebSocket
 type WSMessage struct {
 	Type     string      `json:"type"`
@@ -45,6 +58,20 @@ type WSMessage struct {
 	VendorID string      `json:"vendor_id,omitempty"`
 }
 
+// campaignUpdate is the data of a campaign_update message: the live
+// campaigns around the user, as the campaign lists show them
+type campaignUpdate struct {
+	Campaigns []campaignListItem `json:"campaigns"`
+	Count     int                `json:"count"`
+	Timestamp string             `json:"timestamp"`
+}
+
+// vendorAnalyticsUpdate is the data of an analytics_update message
+type vendorAnalyticsUpdate struct {
+	vendorAnalytics
+	Timestamp string `json:"timestamp"`
+}
+
 
 
 func main() {
@@ -53,38 +80,190 @@ func main() {
 		log.Println("No .env file found, using system environment variables")
 	}
 
+	// Settings from flags, the environment and the config file
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal("Invalid configuration:", err)
+	}
+	if cfg.PrintOnly {
+		cfg.Print(os.Stdout)
+		return
+	}
+
+	// JSON logs with redacted coordinates and phone numbers; the log package
+	// writes through the same handler (see package logging)
+	slog.SetDefault(logging.New(os.Stderr, cfg.Logging))
+
+	// Trace spans for requests, queries, WebSocket sends and jobs (see
+	// package tracing); flushed before exit
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatal("Failed to set up tracing:", err)
+	}
+
 	// Initialize database connection
-	if err := config.InitDB(); err != nil {
+	if err := config.InitDB(cfg.Database); err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	// Create router
+	// Pool and WebSocket gauges for /metrics (see server_metrics.go)
+	registerGaugeMetrics(config.DB)
+
+	// SIGINT/SIGTERM cancel ctx: the server stops accepting connections and
+	// background workers wind down (see server.go)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	var workers backgroundWorkers
+
+	// Live campaign pushes and business rules of campaign lists and engagements
+	upgrader.HandshakeTimeout = cfg.WebSocket.HandshakeTimeout
+	wsPushInterval = cfg.WebSocket.PushInterval
+	clickDedupWindow = cfg.Campaigns.ClickDedupWindow
+	defaultCampaignPageSize = cfg.Campaigns.DefaultPageSize
+	maxCampaignPageSize = cfg.Campaigns.MaxPageSize
+	rankPoolSize = cfg.Campaigns.RankPoolSize
+
+	// Campaign ranking strategy and weights for this deployment
+	if campaignRanker, err = config.NewRanker(cfg.Ranking); err != nil {
+		log.Fatal("Invalid ranking configuration:", err)
+	}
+
+	// Offline geocoder for address search, reverse lookups and vendor address checks
+	if geocoder, err = config.NewGeocoder(cfg.Geocoding); err != nil {
+		log.Fatal("Invalid geocoding configuration:", err)
+	}
+	addressToleranceMeters = cfg.Geocoding.ToleranceMeters
+	guestSessionTTL = cfg.Guest.SessionTTL
+
+	// Campaign queries refuse locations older than this
+	maxLocationAge = cfg.Location.MaxAge
+
+	// Readiness checks (see health.go)
+	healthConfig = cfg.Health
+
+	// Delivery of registration and device verification codes
+	if otpSender, err = config.NewOTPSender(cfg.OTP); err != nil {
+		log.Fatal("Invalid OTP configuration:", err)
+	}
+
+	// Right-to-erasure requests are carried out after their grace period
+	erasureGracePeriod = cfg.Privacy.ErasureGracePeriod
+	workers.start(func() { runErasureWorker(ctx, cfg.Privacy.ErasureCheckInterval) })
+
+	// Downsample and prune the location trail
+	retentionPolicy = cfg.Location.Retention
+	workers.start(func() { runRetentionWorker(ctx, cfg.Location.RetentionInterval) })
+
+	// Background jobs (see package jobs and background_jobs.go)
+	jobRunner = newJobRunner(cfg.Jobs)
+	workers.start(func() { jobRunner.Run(ctx) })
+
+	affinityPolicy = cfg.Affinity
+
+	loyaltyPolicy, loyaltyRecalcHour = cfg.Loyalty.Policy, cfg.Loyalty.RecalcHour
+	workers.start(func() { runLoyaltyWorker(ctx, loyaltyRecalcHour) })
+
+	r := newRouter()
+
+	// Serve until SIGINT/SIGTERM, then drain. Every request is logged with
+	// its request ID (see request_logging.go).
+	finished, err := serve(ctx, cfg.Server, requestLogging(r), &workers)
+	if err != nil {
+		log.Fatal("Server failed:", err)
+	}
+	// Workers still running may be mid-query; exiting ends them instead
+	if finished {
+		config.DB.Close()
+	}
+	flushCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	if err := shutdownTracing(flushCtx); err != nil {
+		log.Printf("Error flushing trace spans: %v", err)
+	}
+	cancel()
+	log.Println("StreetSavvy Backend stopped")
+}
+
+// newRouter routes every endpoint the server answers
+func newRouter() *mux.Router {
 	r := mux.NewRouter()
 
-	// CORS middleware for development
+	// Route templates for metrics, then CORS middleware for development
+	r.Use(recordRoute)
 	r.Use(corsMiddleware)
 
-	// API handlers
-	r.HandleFunc("/api/users/{id}", getUserHandler).Methods("GET")
-	r.HandleFunc("/api/users/{id}/nearby-campaigns", getUserNearbyPromsHandler).Methods("GET")
-	r.HandleFunc("/api/users/{id}/location", getUserLocationHandler).Methods("GET")  // 🎯 ADDED: Missing endpoint
-	r.HandleFunc("/api/health", healthCheck).Methods("GET")
-	r.HandleFunc("/api/users/{user_id}/campaigns/{campaign_id}/engage", recordEngagementHandler).Methods("POST")
-	r.HandleFunc("/api/vendors/{vendor_id}/analytics", getVendorAnalyticsHandler).Methods("GET")
-	r.HandleFunc("/api/users/{user_id}/campaigns/distance-sorted", getAllActiveCampaignsWithDistanceHandler).Methods("GET")
+	// The OpenAPI document describes all versions, so it sits outside them
+	// (see api_spec.go)
+	r.HandleFunc("/api/openapi.json", openAPIHandler).Methods("GET")
+
+	// API handlers under /api/v1, and the legacy unversioned /api (see
+	// api_version.go)
+	mountAPI(r, registerAPIRoutes)
+	r.Handle("/metrics", metricsRegistry.Handler()).Methods("GET")
 
 	// WebSocket handlers
 	r.HandleFunc("/ws/user/{user_id}", handleUserWebSocket)
 	r.HandleFunc("/ws/vendor/{vendor_id}", handleVendorWebSocket)
+	return r
+}
 
-	// Get port from environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
-	log.Printf("StreetSavvy Backend starting on port %s", port)
-	log.Fatal(http.ListenAndServe("127.0.0.1:8080", r))
+// registerAPIRoutes adds the API's routes, relative to its /api/v<n> or
+// /api prefix. Each one is documented in apiEndpoints (api_spec.go).
+func registerAPIRoutes(api *mux.Router) {
+	api.HandleFunc("/users/register", registerUserHandler).Methods("POST")
+	api.HandleFunc("/users/register/verify", verifyRegistrationHandler).Methods("POST")
+	api.HandleFunc("/users/{id}", getUserHandler).Methods("GET")
+	api.HandleFunc("/users/{id}", updateUserHandler).Methods("PUT")
+	api.HandleFunc("/users/{id}", deleteUserHandler).Methods("DELETE")
+	api.HandleFunc("/users/{id}/device", requestDeviceRebindHandler).Methods("POST")
+	api.HandleFunc("/users/{id}/device/verify", verifyDeviceRebindHandler).Methods("POST")
+	api.HandleFunc("/users/{id}/export", exportUserDataHandler).Methods("GET")
+	api.HandleFunc("/users/{id}/erasure", requestErasureHandler).Methods("POST")
+	api.HandleFunc("/users/{id}/erasure", getErasureHandler).Methods("GET")
+	api.HandleFunc("/users/{id}/erasure", cancelErasureHandler).Methods("DELETE")
+	api.HandleFunc("/users/{id}/audit", getPrivacyAuditHandler).Methods("GET")
+	api.HandleFunc("/guest/sessions", createGuestSessionHandler).Methods("POST")
+	api.HandleFunc("/guest/nearby-campaigns", getGuestNearbyCampaignsHandler).Methods("GET")
+	api.HandleFunc("/guest/engagements/{campaign_id}", recordGuestClickHandler).Methods("POST")
+	api.HandleFunc("/users/{id}/loyalty", getUserLoyaltyHandler).Methods("GET")
+	api.HandleFunc("/users/{id}/affinities", getUserAffinitiesHandler).Methods("GET")
+	api.HandleFunc("/users/{id}/nearby-campaigns", getUserNearbyPromsHandler).Methods("GET")
+	api.HandleFunc("/users/{id}/location", getUserLocationHandler).Methods("GET")  // 🎯 ADDED: Missing endpoint
+	api.HandleFunc("/users/{id}/location", recordUserLocationHandler).Methods("POST")
+	api.HandleFunc("/health", readyHandler).Methods("GET")
+	api.HandleFunc("/health/live", liveHandler).Methods("GET")
+	api.HandleFunc("/health/ready", readyHandler).Methods("GET")
+	api.HandleFunc("/users/{user_id}/campaigns/{campaign_id}/engage", recordEngagementHandler).Methods("POST")
+	api.HandleFunc("/vendors/{vendor_id}/analytics", getVendorAnalyticsHandler).Methods("GET")
+	api.HandleFunc("/vendors/register", registerVendorHandler).Methods("POST")
+	api.HandleFunc("/vendors/{vendor_id}", getVendorHandler).Methods("GET")
+	api.HandleFunc("/vendors/{vendor_id}", updateVendorHandler).Methods("PUT")
+	api.HandleFunc("/vendors/{vendor_id}/loyalty", updateVendorLoyaltyHandler).Methods("PUT")
+	api.HandleFunc("/brands/{brand_id}", getBrandHandler).Methods("GET")
+	api.HandleFunc("/brands/{brand_id}", updateBrandHandler).Methods("PUT")
+	api.HandleFunc("/brands/{brand_id}/locations", addBrandLocationHandler).Methods("POST")
+	api.HandleFunc("/brands/{brand_id}/analytics", getBrandAnalyticsHandler).Methods("GET")
+	api.HandleFunc("/geocode/search", geocodeSearchHandler).Methods("GET")
+	api.HandleFunc("/geocode/reverse", reverseGeocodeHandler).Methods("GET")
+	api.HandleFunc("/admin/retention", getRetentionStatsHandler).Methods("GET")
+	api.HandleFunc("/admin/retention/run", runRetentionHandler).Methods("POST")
+	api.HandleFunc("/admin/loyalty/recalculate", recalculateLoyaltyHandler).Methods("POST")
+	api.HandleFunc("/admin/jobs", getJobStatsHandler).Methods("GET")
+	api.HandleFunc("/admin/jobs/dead", listDeadJobsHandler).Methods("GET")
+	api.HandleFunc("/admin/jobs/dead/{job_id}/retry", retryDeadJobHandler).Methods("POST")
+	api.HandleFunc("/users/{user_id}/campaigns/distance-sorted", getAllActiveCampaignsWithDistanceHandler).Methods("GET")
+	api.HandleFunc("/campaigns/{campaign_id}/schedule", getCampaignScheduleHandler).Methods("GET")
+	api.HandleFunc("/campaigns/{campaign_id}/schedule", updateCampaignScheduleHandler).Methods("PUT")
+	api.HandleFunc("/campaigns/{campaign_id}/budget", getCampaignBudgetHandler).Methods("GET")
+	api.HandleFunc("/campaigns/{campaign_id}/budget", updateCampaignBudgetHandler).Methods("PUT")
+	api.HandleFunc("/campaigns/{campaign_id}/variants", getCampaignVariantsHandler).Methods("GET")
+	api.HandleFunc("/campaigns/{campaign_id}/variants", createCampaignVariantHandler).Methods("POST")
+	api.HandleFunc("/campaigns/{campaign_id}/variants/{variant_id}", updateCampaignVariantHandler).Methods("PUT")
+	api.HandleFunc("/campaigns/{campaign_id}/variants/{variant_id}", deleteCampaignVariantHandler).Methods("DELETE")
+	api.HandleFunc("/campaigns/{campaign_id}/locations", getCampaignLocationsHandler).Methods("GET")
+	api.HandleFunc("/campaigns/{campaign_id}/locations", updateCampaignLocationsHandler).Methods("PUT")
 }
 
 // CORS middleware for development
@@ -93,15 +272,12 @@ func corsMiddleware(next http.Handler) http.Handler {
 		// Set CORS headers for ALL requests (including OPTIONS)
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Accept")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Accept, X-Guest-Token, "+requestIDHeader+", traceparent, tracestate")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		
-		// Log ALL requests for debugging
-		log.Printf("%s %s from %s", r.Method, r.URL.Path, r.Header.Get("Origin"))
+		w.Header().Set("Access-Control-Expose-Headers", nextCursorHeader+", "+requestIDHeader+", "+apiVersionHeader+", Deprecation, Link")
 		
 		// Handle preflight requests GLOBALLY
 		if r.Method == "OPTIONS" {
-			log.Printf("Handling preflight request for %s", r.URL.Path)
 			w.WriteHeader(http.StatusOK)
 			return
 		}
@@ -112,32 +288,16 @@ func corsMiddleware(next http.Handler) http.Handler {
 
 // Temporary test handlers (will be moved to handlers/ later)
 
-func healthCheck(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"status": "healthy", "service": "streetsavvy-backend"}`))
-}
-
 func getUserHandler(w http.ResponseWriter, r *http.Request) {
 	// extract user id from url 
 	vars := mux.Vars(r)
 	userID := vars["id"]	
 
-	// create sql query to get data; $1 is placeholder
-	query := "SELECT user_id, loyalty_tier, most_frequent_vendor, most_frequent_vendor_type, notif_sms, notif_whatsapp, notif_inapp, privacy FROM users WHERE user_id = $1"
-
-	// run query, make struct from results
-	var user models.User
-
-	// connect to db
-	err := config.DB.QueryRow(query, userID).Scan(  // ← Using config.DB global
-        &user.UserID, 
-        &user.LoyaltyTier, 
-        &user.MostFrequentVendor, 
-        &user.MostFrequentVendorType)
-    
+	// read the live account (deleted accounts are not found)
+	user, err := loadUser(r.Context(), userID)
     if err != nil {
-        log.Printf("Error querying user %s: %v", userID, err)
-        http.Error(w, "User not found", http.StatusNotFound)
+        errorf(r, "Error querying user %s: %v", userID, err)
+        writeError(w, r, http.StatusNotFound, codeUserNotFound, "User not found")
         return
     }
     
@@ -152,14 +312,13 @@ func getActiveCampaignsHandler(w http.ResponseWriter, r *http.Request) {
     query := `SELECT campaign_id, vendor_id, title, code, description, geofence_radius_km, enabled
               FROM campaigns 
               WHERE enabled = true 
-              AND start_date <= CURRENT_DATE 
-              AND end_date >= CURRENT_DATE`
+              AND campaign_is_live(campaign_id, NOW())`
     
     // Execute query - returns multiple rows
-    rows, err := config.DB.Query(query)
+    rows, err := config.DB.QueryContext(r.Context(), query)
     if err != nil {
-        log.Printf("Error querying campaigns: %v", err)
-        http.Error(w, "Failed to fetch campaigns", http.StatusInternalServerError)
+        errorf(r, "Error querying campaigns: %v", err)
+        writeInternalError(w, r, "Failed to fetch campaigns")
         return
     }
     defer rows.Close()  // Always close rows when done
@@ -182,7 +341,7 @@ func getActiveCampaignsHandler(w http.ResponseWriter, r *http.Request) {
             &campaign.Enabled)
         
         if err != nil {
-            log.Printf("Error scanning campaign row: %v", err)
+            errorf(r, "Error scanning campaign row: %v", err)
             continue  // Skip this row, continue with next
         }
         
@@ -192,8 +351,8 @@ func getActiveCampaignsHandler(w http.ResponseWriter, r *http.Request) {
     
     // Check for any iteration errors
     if err = rows.Err(); err != nil {
-        log.Printf("Error iterating campaigns: %v", err)
-        http.Error(w, "Error processing campaigns", http.StatusInternalServerError)
+        errorf(r, "Error iterating campaigns: %v", err)
+        writeInternalError(w, r, "Error processing campaigns")
         return
     }
     
@@ -206,100 +365,146 @@ func getUserNearbyPromsHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract user ID from URL path
 	vars := mux.Vars(r)
 	userID := vars["id"]
-	log.Printf("Getting campaigns for user %s", userID)
+	logf(r, "Getting campaigns for user %s", userID)
 
-	// Step 1: Get user's latest location
-	userLat, userLng, err := getUserCurrentLocation(userID)
+	// Nearby campaigns are personalized by default; ?sort=distance opts out.
+	// Also reads paging (limit, cursor) and filters (vendor_type,
+	// max_distance_m, q, expiring_soon).
+	params, err := parseCampaignListParams(r, sortByRelevance)
 	if err != nil {
-		log.Printf("%v", err)
-		http.Error(w, "User location not found", http.StatusNotFound)
+		writeValidationError(w, r, err)
 		return
 	}
 
+	// Step 1: Get user's location: ?lat=&lng= from the app, otherwise the
+	// latest stored fix (409 if it's too old to trust)
+	loc, err := requestLocation(r, userID)
+	if err != nil {
+		writeLocationError(w, r, userID, err)
+		return
+	}
+	userLat, userLng := loc.Lat, loc.Lng
+
 	// Step 2: Get campaigns with vendor address + segmentation + runtime + geofence logic
 	// FIXED: Correct parameter order - userID first, then coordinates
+	// A campaign running at several stores is matched against each of them;
+	// DISTINCT ON keeps the nearest store inside the geofence.
 	campaignQuery := `
-		SELECT 
+		SELECT DISTINCT ON (c.campaign_id)
 			c.campaign_id, 
-			c.vendor_id, 
+			v.vendor_id, 
 			c.title, 
 			c.code,
 			c.description, 
+			c.enabled,
 			c.geofence_radius_km,
 			v.address,           
 			v.vendor_type,      
+			COALESCE(v.display_name, b.display_name, v.vendor_type) as vendor_name,
 			v.lat as vendor_lat, 
-			v.long as vendor_lng
+			v.long as vendor_lng,
+			s.segment_name,
+			c.start_date,
+			c.end_date,
+			ST_Distance(
+				ST_SetSRID(ST_MakePoint(v.long, v.lat), 4326)::geography,
+				ST_SetSRID(ST_MakePoint($2, $3), 4326)::geography
+			) as distance_meters
 		FROM campaigns c
-		JOIN vendors v ON c.vendor_id = v.vendor_id
+		JOIN campaign_sites cs ON cs.campaign_id = c.campaign_id
+		JOIN vendors v ON cs.vendor_id = v.vendor_id
+		LEFT JOIN brands b ON v.brand_id = b.brand_id
 		JOIN segments s ON c.segment_id = s.segment_id
 		JOIN users u ON u.user_id = $1
 		WHERE c.enabled = true
-			AND c.start_date <= CURRENT_DATE
-			AND c.end_date >= CURRENT_DATE
-			AND (
-				CURRENT_DATE > c.start_date OR
-				(CURRENT_DATE = c.start_date AND CURRENT_TIME >= c.run_time::time)
-			)
+			-- Dates, dayparts and blackouts in the vendor's timezone
+			AND campaign_is_live(c.campaign_id, NOW())
+			AND campaign_open_to_user(c.campaign_id, $1)
 			AND ST_DWithin(
 				ST_Transform(ST_SetSRID(ST_MakePoint(v.long, v.lat), 4326), 3857),
 				ST_Transform(ST_SetSRID(ST_MakePoint($2, $3), 4326), 3857),
 				c.geofence_radius_km * 1000
 			)
 			AND (
-				s.segment_name = CONCAT('loyalty_tier_', u.loyalty_tier)
+				s.segment_name = 'everyone'
+				OR s.segment_name = CONCAT('loyalty_tier_', u.loyalty_tier)
 				OR s.segment_name = CONCAT('most_frequent_vendor_type_', u.most_frequent_vendor_type)
 				OR s.segment_name = CONCAT('most_frequent_vendor_', u.most_frequent_vendor)
-			)`
+			)
+		ORDER BY c.campaign_id, distance_meters`
 
 	// FIXED: Execute with correct parameter order - userID, lng, lat
-	rows, err := config.DB.Query(campaignQuery, userID, userLng, userLat)
+	args := sqlArgs{userID, userLng, userLat}
+	rows, err := config.DB.QueryContext(r.Context(), params.pagedQuery(campaignQuery, &args), args...)
 	if err != nil {
-		log.Printf("Error executing campaign query for user %s: %v", userID, err)
-		http.Error(w, "Campaign query failed", http.StatusInternalServerError)
+		errorf(r, "Error executing campaign query for user %s: %v", userID, err)
+		writeInternalError(w, r, "Campaign query failed")
 		return
 	}
 	defer rows.Close()
 
-	// Custom struct for response with vendor information
-	type CampaignWithVendor struct {
-		CampaignID       string  `json:"campaign_id"`
-		VendorID         string  `json:"vendor_id"`
-		Title            string  `json:"title"`
-		Code             string  `json:"code"`
-		Description      string  `json:"description"`
-		GeofenceRadiusKm float64 `json:"geofence_radius_km"`
-		VendorAddress    string  `json:"vendor_address"`    // Real address from database
-		VendorType       string  `json:"vendor_type"`       // Vendor category
-		VendorLat        float64 `json:"vendor_lat"`        // For map markers
-		VendorLng        float64 `json:"vendor_lng"`        // For map markers
-	}
-
 	// Collect matching campaigns with vendor info
-	var campaigns []CampaignWithVendor
+	var campaigns []campaignListItem
+	var candidates []ranking.Candidate
 	for rows.Next() {
-		var c CampaignWithVendor
+		var c campaignListItem
+		var segmentName string
+		var startDate, endDate time.Time
 		err := rows.Scan(
 			&c.CampaignID, 
 			&c.VendorID, 
 			&c.Title,
 			&c.Code, 
 			&c.Description, 
+			&c.Enabled,
 			&c.GeofenceRadiusKm,
 			&c.VendorAddress,    // Real vendor address
 			&c.VendorType,       // Real vendor type
+			&c.VendorName,
 			&c.VendorLat,        // Real vendor coordinates
 			&c.VendorLng,
+			&segmentName,
+			&startDate,
+			&endDate,
+			&c.DistanceMeters,
 		)
 		if err != nil {
-			log.Printf("Error scanning campaign: %v", err)
+			errorf(r, "Error scanning campaign: %v", err)
 			continue
 		}
-		log.Printf("User %s matches campaign: %s at %s", userID, c.CampaignID, c.VendorAddress)
+		c.DistanceDisplay = formatDistance(c.DistanceMeters)
+		logf(r, "User %s matches campaign: %s at %s", userID, c.CampaignID, c.VendorAddress)
 		campaigns = append(campaigns, c)
+		candidates = append(candidates, ranking.Candidate{
+			CampaignID:     c.CampaignID,
+			VendorID:       c.VendorID,
+			VendorType:     c.VendorType,
+			SegmentName:    segmentName,
+			DistanceMeters: c.DistanceMeters,
+			StartDate:      startDate,
+			EndDate:        endDate,
+		})
 	}
 
-	log.Printf("Found %d matching campaigns for user %s", len(campaigns), userID)
+	// Pick this page, ranked best match first unless sorted by distance
+	page, nextCursor, err := pageCampaigns(userID, params, candidates)
+	if err != nil {
+		errorf(r, "Error ranking campaigns for user %s: %v", userID, err)
+		writeInternalError(w, r, "Campaign ranking failed")
+		return
+	}
+	campaigns = pageItems(campaigns, page, params.SortBy)
+
+	// Show each campaign on the page as the A/B variant assigned to this user
+	if err := applyVariants(r.Context(), userID, campaigns); err != nil {
+		errorf(r, "Error resolving campaign variants for user %s: %v", userID, err)
+	}
+
+	if nextCursor != "" {
+		w.Header().Set(nextCursorHeader, nextCursor)
+	}
+
+	logf(r, "Found %d matching campaigns for user %s", len(campaigns), userID)
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(campaigns)
@@ -312,211 +517,162 @@ func recordEngagementHandler(w http.ResponseWriter, r *http.Request) {
 	userID := vars["user_id"]
 	campaignID := vars["campaign_id"]
 	
-	log.Printf("Recording engagement: user=%s, campaign=%s", userID, campaignID)
+	logf(r, "Recording engagement: user=%s, campaign=%s", userID, campaignID)
 	
-	// PART 2: Parse request body (keeping struct for clarity)
-	type EngagementRequest struct {
-		Action string `json:"action"` // "clicked" or "used"
-	}
-	
-	var req EngagementRequest
+	// PART 2: Parse request body
+	var req engagementRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		log.Printf("Error parsing request: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		errorf(r, "Error parsing request: %v", err)
+		writeError(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
 		return
 	}
 	
 	// PART 3: Validate action
 	if req.Action != "clicked" && req.Action != "used" {
-		log.Printf("Invalid action: %s", req.Action)
-		http.Error(w, "Action must be 'clicked' or 'used'", http.StatusBadRequest)
+		logf(r, "Invalid action: %s", req.Action)
+		writeValidationError(w, r, invalidField("action", "Action must be 'clicked' or 'used'"))
 		return
 	}
 	
-	// PART 4: Get user's real location from database
-	var userLat, userLng float64
-	locationQuery := `
-		SELECT lat, long FROM user_location_events
-		WHERE user_id = $1
-		ORDER BY event_time DESC
-		LIMIT 1`
-	
-	err = config.DB.QueryRow(locationQuery, userID).Scan(&userLat, &userLng)
+	// PART 4: Get user's current location (409 if it's too old to trust)
+	loc, err := freshLocation(r.Context(), userID)
 	if err != nil {
-		log.Printf("User %s location not found: %v", userID, err)
-		http.Error(w, "User location not found", http.StatusNotFound)
+		writeLocationError(w, r, userID, err)
 		return
 	}
-	log.Printf("User %s location: lat=%f, lng=%f", userID, userLat, userLng)
+	userLat, userLng := loc.Lat, loc.Lng
+	slog.DebugContext(r.Context(), "user location", "user_id", userID, "lat", userLat, "lng", userLng)
 	
-	// PART 5: Check for duplicate engagement (updated for new schema)
-var duplicateCheck int
-var checkQuery string
-var timeWindow string
-
+	// PART 5: Check for duplicate clicks. A second use the same day is
+	// caught by recordUsedEngagement, under the campaign's lock.
 if req.Action == "clicked" {
-    // Check for clicks in last 5 minutes
-    timeWindow = "5 minutes"
-    checkQuery = `
+    var duplicateCheck int
+    err = config.DB.QueryRowContext(r.Context(), `
         SELECT COUNT(*) FROM campaign_user_engagements 
         WHERE user_id = $1 AND campaign_id = $2 
         AND engagement_type = 'clicked'
-        AND engagement_time > NOW() - INTERVAL '5 minutes'`
-} else {
-    // Check for usage today
-    timeWindow = "today"
-    checkQuery = `
-        SELECT COUNT(*) FROM campaign_user_engagements 
-        WHERE user_id = $1 AND campaign_id = $2 
-        AND engagement_type = 'used'
-        AND DATE(engagement_time) = CURRENT_DATE`
+        AND engagement_time > NOW() - $3::float8 * INTERVAL '1 second'`,
+        userID, campaignID, clickDedupWindow.Seconds()).Scan(&duplicateCheck)
+    if err != nil {
+        errorf(r, "Error checking duplicates: %v", err)
+        writeInternalError(w, r, "Database error")
+        return
+    }
+    if duplicateCheck > 0 {
+        writeDuplicateEngagement(w, r, req.Action, "in the last "+config.FormatDuration(clickDedupWindow))
+        return
+    }
 }
 
-err = config.DB.QueryRow(checkQuery, userID, campaignID).Scan(&duplicateCheck)
+// PART 6: Insert new engagement record, attributed to the A/B variant the user saw
+variantID, err := assignedVariantID(r.Context(), userID, campaignID)
 if err != nil {
-    log.Printf("Error checking duplicates: %v", err)
-    http.Error(w, "Database error", http.StatusInternalServerError)
+    errorf(r, "Error looking up variant for user %s, campaign %s: %v", userID, campaignID, err)
+    writeInternalError(w, r, "Database error")
     return
 }
 
-if duplicateCheck > 0 {
-    log.Printf(" Duplicate %s engagement ignored (already %s %s)", 
-        req.Action, req.Action, timeWindow)
-    
-    response := map[string]interface{}{
-        "success": true,
-        "message": fmt.Sprintf("Engagement already recorded %s", timeWindow),
-        "duplicate": true,
-    }
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(response)
-    return
+engagement := engagementRecord{
+    UserID:     userID,
+    CampaignID: campaignID,
+    Action:     req.Action,
+    VariantID:  variantID,
+    Lat:        userLat,
+    Lng:        userLng,
 }
 
-// PART 6: Insert new engagement record (SIMPLIFIED QUERY)
-insertQuery := `
-    INSERT INTO campaign_user_engagements 
-    (user_id, campaign_id, engagement_type, used_loc_lat, used_loc_long, engagement_time)
-    VALUES ($1, $2, $3, $4, $5, NOW())`
-
-_, err = config.DB.Exec(insertQuery, userID, campaignID, req.Action, userLat, userLng)
+// "used" is checked against the campaign budget
+if req.Action == "used" {
+    err = recordUsedEngagement(r.Context(), engagement)
+} else {
+    _, _, err = insertEngagement(r.Context(), config.DB, engagement)
+}
+if err == errAlreadyUsed {
+    writeDuplicateEngagement(w, r, req.Action, "today")
+    return
+}
+if err == sql.ErrNoRows {
+    writeError(w, r, http.StatusNotFound, codeCampaignNotFound, "Campaign not found")
+    return
+}
+if err == errBudgetExhausted {
+    logf(r, "Campaign %s budget exhausted, rejecting use by %s", campaignID, userID)
+    writeError(w, r, http.StatusConflict, codeBudgetExhausted, "Campaign budget exhausted")
+    return
+}
 if err != nil {
-    log.Printf("Error inserting engagement: %v", err)
-    http.Error(w, "Failed to record engagement", http.StatusInternalServerError)
+    errorf(r, "Error inserting engagement: %v", err)
+    writeInternalError(w, r, "Failed to record engagement")
     return
 }
 
-log.Printf("Inserted new %s engagement: user=%s, campaign=%s", 
+engagementsRecorded.Inc(req.Action, audienceRegistered)
+logf(r, "Inserted new %s engagement: user=%s, campaign=%s", 
     req.Action, userID, campaignID)
-	
-	// PART 7: Update user preferences based on engagement frequency (OPTIONAL)
-	/*
-	ANALYTICS FEATURE: Update user's most_frequent_vendor and most_frequent_vendor_type
-	based on their engagement patterns
-	*/
-	if req.Action == "used" {
-		// Only update preferences on actual usage, not just clicks
-		go updateUserPreferences(userID) // Run in background to avoid slowing response
-	}
-	
-	// PART 8: Return success response
-	response := map[string]interface{}{
-		"success": true,
-		"message": fmt.Sprintf("New %s engagement recorded", req.Action),
-		"engagement": map[string]interface{}{
-			"user_id":       userID,
-			"campaign_id":   campaignID,
-			"action":        req.Action,
-			"location": map[string]float64{
-				"latitude":  userLat,
-				"longitude": userLng,
-			},
-			"timestamp": "NOW()", // Will be set by database
+
+// Live update for the vendor's dashboard; finish it even if the app hangs up
+broadcastEngagementToVendor(context.WithoutCancel(r.Context()), userID, campaignID, req.Action)
+	
+	// Store affinities (most_frequent_vendor and most_frequent_vendor_type),
+	// loyalty points and tier were updated with the "used" row, so the next
+	// campaign query already matches the new segments
+	
+	// PART 7: Return success response
+	response := engagementResponse{
+		Success: true,
+		Message: fmt.Sprintf("New %s engagement recorded", req.Action),
+		Engagement: &engagementSummary{
+			UserID:     userID,
+			CampaignID: campaignID,
+			Action:     req.Action,
+			Location:   engagementLocation{Latitude: userLat, Longitude: userLng},
+			Timestamp:  time.Now().UTC().Truncate(time.Second),
 		},
-		"duplicate": false,
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-// PART 9: Background function to update user preferences
-/*
-ANALYTICS LOGIC: Update user's most frequent vendor/type based on usage patterns
-This runs asynchronously so it doesn't slow down the engagement recording
-*/
-func updateUserPreferences(userID string) {
-	log.Printf("Updating preferences for user %s", userID)
-	
-	// Find most frequently used vendor (FIXED: use engagement_type instead of used column)
-	var mostFrequentVendor string
-	vendorQuery := `
-		SELECT v.vendor_id 
-		FROM campaign_user_engagements cue
-		JOIN campaigns c ON cue.campaign_id = c.campaign_id
-		JOIN vendors v ON c.vendor_id = v.vendor_id
-		WHERE cue.user_id = $1 AND cue.engagement_type = 'used'
-		GROUP BY v.vendor_id
-		ORDER BY COUNT(*) DESC
-		LIMIT 1`
-	
-	err := config.DB.QueryRow(vendorQuery, userID).Scan(&mostFrequentVendor)
-	if err != nil && err != sql.ErrNoRows {
-		log.Printf(" Error finding most frequent vendor: %v", err)
-		return
-	}
-	
-	// Find most frequently used vendor type (FIXED: use engagement_type instead of used column)
-	var mostFrequentVendorType string
-	typeQuery := `
-		SELECT v.vendor_type
-		FROM campaign_user_engagements cue
-		JOIN campaigns c ON cue.campaign_id = c.campaign_id
-		JOIN vendors v ON c.vendor_id = v.vendor_id
-		WHERE cue.user_id = $1 AND cue.engagement_type = 'used'
-		GROUP BY v.vendor_type
-		ORDER BY COUNT(*) DESC
-		LIMIT 1`
-	
-	err = config.DB.QueryRow(typeQuery, userID).Scan(&mostFrequentVendorType)
-	if err != nil && err != sql.ErrNoRows {
-		log.Printf("Error finding most frequent vendor type: %v", err)
-		return
-	}
-	
-	// Update user preferences if we found data
-	if mostFrequentVendor != "" || mostFrequentVendorType != "" {
-		updateQuery := `
-			UPDATE users 
-			SET most_frequent_vendor = COALESCE($2, most_frequent_vendor),
-				most_frequent_vendor_type = COALESCE($3, most_frequent_vendor_type)
-			WHERE user_id = $1`
-		
-		// Handle NULL values properly
-		var vendorParam, typeParam interface{}
-		if mostFrequentVendor != "" {
-			vendorParam = mostFrequentVendor
-		} else {
-			vendorParam = nil
-		}
-		if mostFrequentVendorType != "" {
-			typeParam = mostFrequentVendorType
-		} else {
-			typeParam = nil
-		}
-		
-		_, err = config.DB.Exec(updateQuery, userID, vendorParam, typeParam)
-		
-		if err != nil {
-			log.Printf("Error updating user preferences: %v", err)
-		} else {
-			log.Printf("Updated preferences for %s: vendor=%s, type=%s", 
-				userID, mostFrequentVendor, mostFrequentVendorType)
-		}
-	} else {
-		log.Printf("No usage data yet for user %s - preferences unchanged", userID)
-	}
+// writeDuplicateEngagement answers an engagement already recorded within
+// timeWindow ("today", "in the last 30s")
+func writeDuplicateEngagement(w http.ResponseWriter, r *http.Request, action, timeWindow string) {
+	engagementDuplicates.Inc(action, audienceRegistered)
+	logf(r, " Duplicate %s engagement ignored (already %s %s)", action, action, timeWindow)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(engagementResponse{
+		Success:   true,
+		Message:   fmt.Sprintf("Engagement already recorded %s", timeWindow),
+		Duplicate: true,
+	})
+}
+
+// vendorAnalytics is a vendor's dashboard: overall metrics for the summary
+// and one entry per campaign card
+type vendorAnalytics struct {
+	VendorID  string                  `json:"vendor_id"`
+	Summary   vendorSummary           `json:"vendor_summary"`
+	Campaigns []vendorCampaignMetrics `json:"campaigns"`
+}
+
+type vendorSummary struct {
+	TotalCampaigns        int     `json:"total_campaigns"`
+	OverallConversionRate float64 `json:"overall_conversion_rate"` // Percentage
+	TotalUniqueUsers      int     `json:"total_unique_users"`      // Simplified for now
+	TotalClicks           int     `json:"total_clicks"`
+	TotalUses             int     `json:"total_uses"`
+}
+
+type vendorCampaignMetrics struct {
+	CampaignID  string                  `json:"campaign_id"`
+	Title       string                  `json:"title"`
+	Code        string                  `json:"code"`
+	Enabled     bool                    `json:"enabled"`
+	TotalClicks int                     `json:"total_clicks"`
+	TotalUses   int                     `json:"total_uses"`
+	Variants    []models.VariantMetrics `json:"variants,omitempty"` // A/B test funnel, if any
 }
 
 // get engagement stats for a vendor's campaigns 
@@ -525,9 +681,28 @@ func getVendorAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	vendorID := vars["vendor_id"]
 	
-	log.Printf("Getting analytics for vendor %s", vendorID)
+	logf(r, "Getting analytics for vendor %s", vendorID)
+	
+	// PART 2: Per-campaign clicks and uses, A/B funnels and vendor totals
+	response, err := loadVendorAnalytics(r.Context(), vendorID)
+	if err != nil {
+		errorf(r, "Error loading analytics for vendor %s: %v", vendorID, err)
+		writeInternalError(w, r, "Failed to get campaign analytics")
+		return
+	}
+	
+	logf(r, "Vendor %s analytics: %d campaigns, %.1f%% conversion", 
+		vendorID, len(response.Campaigns), response.Summary.OverallConversionRate)
 	
-	// PART 2: Get individual campaign statistics (clicks and uses per campaign)
+	// PART 3: Return clean analytics
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// loadVendorAnalytics builds a vendor's dashboard. The analytics endpoint
+// and the vendor WebSocket both send it.
+func loadVendorAnalytics(ctx context.Context, vendorID string) (vendorAnalytics, error) {
+	// Individual campaign statistics (clicks and uses per campaign)
 	campaignQuery := `
 		SELECT 
 			c.campaign_id,
@@ -543,52 +718,42 @@ func getVendorAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
 		-- LEFT JOIN: Keep all campaigns, even with 0 clicks
 		LEFT JOIN (
 			SELECT 
-				campaign_id, 
+				e.campaign_id, 
 				COUNT(*) as total_clicks
-			FROM campaign_user_engagements 
-			WHERE engagement_type = 'clicked'
-			GROUP BY campaign_id
+			FROM campaign_user_engagements e
+			JOIN campaigns ec ON e.campaign_id = ec.campaign_id
+			WHERE e.engagement_type = 'clicked'
+			  -- Only engagements at this store (older rows: the campaign's vendor)
+			  AND COALESCE(e.vendor_id, ec.vendor_id) = $1
+			GROUP BY e.campaign_id
 		) clicks ON c.campaign_id = clicks.campaign_id
 		
 		-- LEFT JOIN: Keep all campaigns, even with 0 uses
 		LEFT JOIN (
 			SELECT 
-				campaign_id, 
+				e.campaign_id, 
 				COUNT(*) as total_uses
-			FROM campaign_user_engagements 
-			WHERE engagement_type = 'used'
-			GROUP BY campaign_id
+			FROM campaign_user_engagements e
+			JOIN campaigns ec ON e.campaign_id = ec.campaign_id
+			WHERE e.engagement_type = 'used'
+			  AND COALESCE(e.vendor_id, ec.vendor_id) = $1
+			GROUP BY e.campaign_id
 		) uses ON c.campaign_id = uses.campaign_id
 		
-		-- Only campaigns for this vendor
-		WHERE c.vendor_id = $1
+		-- Campaigns running at this vendor, including brand-wide ones
+		WHERE c.campaign_id IN (SELECT campaign_id FROM campaign_sites WHERE vendor_id = $1)
 		ORDER BY c.campaign_id`
 	
-	// PART 3: Execute campaign analytics query
-	rows, err := config.DB.Query(campaignQuery, vendorID)
+	rows, err := config.DB.QueryContext(ctx, campaignQuery, vendorID)
 	if err != nil {
-		log.Printf("Error executing campaign query: %v", err)
-		http.Error(w, "Failed to get campaign analytics", http.StatusInternalServerError)
-		return
+		return vendorAnalytics{}, err
 	}
 	defer rows.Close()
 	
-	// PART 4: Collect campaign data (simplified structure)
-	type CampaignMetrics struct {
-		CampaignID  string `json:"campaign_id"`
-		Title       string `json:"title"`
-		Code        string `json:"code"`
-		Enabled     bool   `json:"enabled"`
-		TotalClicks int    `json:"total_clicks"`
-		TotalUses   int    `json:"total_uses"`
-	}
-	
-	var campaigns []CampaignMetrics
-	var vendorTotalClicks, vendorTotalUses int
-	
-	// PART 5: Process each campaign
+	var campaigns []vendorCampaignMetrics
+	var summary vendorSummary
 	for rows.Next() {
-		var cm CampaignMetrics
+		var cm vendorCampaignMetrics
 		err := rows.Scan(
 			&cm.CampaignID,
 			&cm.Title,
@@ -598,71 +763,39 @@ func getVendorAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
 			&cm.TotalUses,
 		)
 		if err != nil {
-			log.Printf("Error scanning campaign: %v", err)
-			continue
+			return vendorAnalytics{}, err
 		}
 		
 		// Add to vendor totals
-		vendorTotalClicks += cm.TotalClicks
-		vendorTotalUses += cm.TotalUses
-		
+		summary.TotalClicks += cm.TotalClicks
+		summary.TotalUses += cm.TotalUses
 		campaigns = append(campaigns, cm)
-		
-		log.Printf("Campaign %s: %d clicks, %d uses", 
-			cm.CampaignID, cm.TotalClicks, cm.TotalUses)
 	}
-	
-	if err = rows.Err(); err != nil {
-		log.Printf("Error iterating campaigns: %v", err)
-		http.Error(w, "Error processing campaigns", http.StatusInternalServerError)
-		return
+	if err := rows.Err(); err != nil {
+		return vendorAnalytics{}, err
 	}
 	
-	// PART 6: Calculate overall conversion rate for vendor
-	var overallConversionRate float64
-	if vendorTotalClicks > 0 {
-		overallConversionRate = float64(vendorTotalUses) / float64(vendorTotalClicks) * 100
-		// Round to 1 decimal place
-		overallConversionRate = float64(int(overallConversionRate*10)) / 10
+	// Attach A/B variant funnels to campaigns that run experiments
+	variantMetrics, err := loadVariantMetrics(ctx, vendorID)
+	if err != nil {
+		return vendorAnalytics{}, err
 	}
-	
-	// PART 7: Build clean response structure
-	response := map[string]interface{}{
-		"vendor_id": vendorID,
-		// VENDOR OVERALL METRICS (for dashboard summary)
-		"vendor_summary": map[string]interface{}{
-			"total_campaigns":        len(campaigns),
-			"overall_conversion_rate": overallConversionRate, // Percentage
-			"total_unique_users":     0, // Simplified for now
-		},
-		// INDIVIDUAL CAMPAIGN METRICS (for campaign cards) 
-		"campaigns": campaigns, // Each has: campaign_id, title, code, enabled, total_clicks, total_uses
+	for i := range campaigns {
+		campaigns[i].Variants = variantMetrics[campaigns[i].CampaignID]
 	}
 	
-	log.Printf("Vendor %s analytics: %d campaigns, %.1f%% conversion", 
-		vendorID, len(campaigns), overallConversionRate)
-	
-	// PART 8: Return clean analytics
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
-
-// helper function for handlers to get curr location of a user 
-func getUserCurrentLocation(userID string) (float64, float64, error) {
-	var userLat, userLng float64
-	locationQuery := `
-		SELECT lat, long FROM user_location_events
-		WHERE user_id = $1
-		ORDER BY event_time DESC
-		LIMIT 1`
-	
-	err := config.DB.QueryRow(locationQuery, userID).Scan(&userLat, &userLng)
-	if err != nil {
-		return 0, 0, fmt.Errorf("user %s location not found: %v", userID, err)
+	// Overall conversion rate for the vendor, rounded down to 1 decimal place
+	summary.TotalCampaigns = len(campaigns)
+	if summary.TotalClicks > 0 {
+		rate := float64(summary.TotalUses) / float64(summary.TotalClicks) * 100
+		summary.OverallConversionRate = float64(int(rate*10)) / 10
 	}
 	
-	log.Printf("User %s is at location: lat=%f, lng=%f", userID, userLat, userLng)
-	return userLat, userLng, nil
+	return vendorAnalytics{
+		VendorID:  vendorID,
+		Summary:   summary,
+		Campaigns: campaigns,
+	}, nil
 }
 
 // getUserLocationHandler retrieves the current location of a user
@@ -670,19 +803,27 @@ func getUserLocationHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["id"]
 	
-	// Use consolidated location function
-	userLat, userLng, err := getUserCurrentLocation(userID)
+	// Newest fix from the current-location cache, stale or not
+	loc, err := loadCurrentLocation(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeLocationNotFound, "User location not found")
+		return
+	}
 	if err != nil {
-		log.Printf("%v", err)
-		http.Error(w, "User location not found", http.StatusNotFound)
+		errorf(r, "Error loading location for user %s: %v", userID, err)
+		writeInternalError(w, r, "Database error")
 		return
 	}
 	
-	response := map[string]interface{}{
-		"user_id":   userID,
-		"latitude":  userLat,
-		"longitude": userLng,
-		"message":   "User location retrieved successfully",
+	response := userLocation{
+		UserID:     userID,
+		Latitude:   loc.Lat,
+		Longitude:  loc.Lng,
+		AccuracyM:  loc.AccuracyM,
+		FixTime:    loc.FixTime.Format("2006-01-02T15:04:05"),
+		AgeSeconds: int(loc.Age.Seconds()),
+		Stale:      loc.Age > maxLocationAge,
+		Message:    "User location retrieved successfully",
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
@@ -696,112 +837,139 @@ func getAllActiveCampaignsWithDistanceHandler(w http.ResponseWriter, r *http.Req
 	userID := vars["user_id"]
 	
 	if userID == "" {
-		http.Error(w, "Missing user_id parameter", http.StatusBadRequest)
+		writeValidationError(w, r, invalidField("user_id", "Missing user_id parameter"))
 		return
 	}
 	
-	log.Printf("📱 Getting distance-sorted campaigns for user %s", userID)
+	logf(r, "📱 Getting distance-sorted campaigns for user %s", userID)
+
+	// ?sort=relevance re-orders the nearest campaigns with the personalized ranker.
+	// Also reads paging (limit, cursor) and filters (vendor_type,
+	// max_distance_m, q, expiring_soon).
+	params, err := parseCampaignListParams(r, sortByDistance)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
 
-	// PART 2: Get user's current location from database
-	userLat, userLng, err := getUserCurrentLocation(userID)
+	// PART 2: Get user's location: ?lat=&lng= from the app, otherwise the
+	// latest stored fix (409 if it's too old to trust)
+	loc, err := requestLocation(r, userID)
 	if err != nil {
-		log.Printf("Error getting user location for %s: %v", userID, err)
-		http.Error(w, "User location not found", http.StatusNotFound)
+		writeLocationError(w, r, userID, err)
 		return
 	}
+	userLat, userLng := loc.Lat, loc.Lng
 	
-	log.Printf("User %s location: lat=%.6f, lng=%.6f", userID, userLat, userLng)
+	slog.DebugContext(r.Context(), "user location", "user_id", userID, "lat", userLat, "lng", userLng)
 
-	// PART 3: Get ALL active campaigns with distance calculation (FIXED: Use correct vendor columns)
+	// PART 3: Get ALL active campaigns with distance calculation, measured to
+	// the nearest store each campaign runs at
 	query := `
-		SELECT 
+		SELECT DISTINCT ON (c.campaign_id)
 			c.campaign_id,
 			c.title,
 			c.description,
 			c.code,
 			c.enabled,
+			c.geofence_radius_km,
 			v.vendor_type,
+			COALESCE(v.display_name, b.display_name, v.vendor_type) as vendor_name,
 			v.address,
 			v.lat as vendor_lat,
 			v.long as vendor_lng,
+			v.vendor_id,
+			COALESCE(s.segment_name, '') as segment_name,
+			c.start_date,
+			c.end_date,
 			-- Calculate real-world distance in meters using PostGIS
 			ST_Distance(
 				ST_GeogFromText('POINT(' || $1 || ' ' || $2 || ')'),  -- User's position (lng, lat)
 				ST_GeogFromText('POINT(' || v.long || ' ' || v.lat || ')')  -- Vendor position (lng, lat)
 			) as distance_meters
 		FROM campaigns c
-		JOIN vendors v ON c.vendor_id = v.vendor_id
+		JOIN campaign_sites cs ON cs.campaign_id = c.campaign_id
+		JOIN vendors v ON cs.vendor_id = v.vendor_id
+		LEFT JOIN brands b ON v.brand_id = b.brand_id
+		LEFT JOIN segments s ON c.segment_id = s.segment_id
 		WHERE c.enabled = true 
-		  AND c.start_date <= CURRENT_DATE
-		  AND c.end_date >= CURRENT_DATE
-		  AND (
-			CURRENT_DATE > c.start_date OR
-			(CURRENT_DATE = c.start_date AND CURRENT_TIME >= c.run_time::time)
-		  )
-		ORDER BY distance_meters ASC
-		LIMIT 50`
-
-	// PART 4: Execute distance query with user's coordinates
-	rows, err := config.DB.Query(query, userLng, userLat)  // Note: lng first, then lat for PostGIS
+		  -- Dates, dayparts and blackouts in the vendor's timezone
+		  AND campaign_is_live(c.campaign_id, NOW())
+		  -- Campaigns at their distinct-user cap only for users who redeemed
+		  AND campaign_open_to_user(c.campaign_id, $3)
+		ORDER BY c.campaign_id, distance_meters`
+
+	// PART 4: Execute distance query with user's coordinates, filtered and paged
+	args := sqlArgs{userLng, userLat, userID} // Note: lng first, then lat for PostGIS
+	rows, err := config.DB.QueryContext(r.Context(), params.pagedQuery(query, &args), args...)
 	if err != nil {
-		log.Printf("Error fetching campaigns with distance: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		errorf(r, "Error fetching campaigns with distance: %v", err)
+		writeInternalError(w, r, "Internal server error")
 		return
 	}
 	defer rows.Close()
 
 	// PART 5: Process results and format distances for display
-	var campaigns []map[string]interface{}
+	var campaigns []campaignListItem
+	var candidates []ranking.Candidate
 	for rows.Next() {
-		var campaignID, title, description, code, vendorType, address string
-		var enabled bool
-		var vendorLat, vendorLng, distanceMeters float64
+		var c campaignListItem
+		var segmentName string
+		var startDate, endDate time.Time
 
 		err := rows.Scan(
-			&campaignID, &title, &description, &code, &enabled,
-			&vendorType, &address, &vendorLat, &vendorLng, &distanceMeters,
+			&c.CampaignID, &c.Title, &c.Description, &c.Code, &c.Enabled, &c.GeofenceRadiusKm,
+			&c.VendorType, &c.VendorName, &c.VendorAddress, &c.VendorLat, &c.VendorLng,
+			&c.VendorID, &segmentName, &startDate, &endDate, &c.DistanceMeters,
 		)
 		if err != nil {
-			log.Printf("Error scanning campaign row: %v", err)
+			errorf(r, "Error scanning campaign row: %v", err)
 			continue
 		}
 
-		// Format distance for human-readable display
-		var distanceDisplay string
-		if distanceMeters < 1000 {
-			distanceDisplay = fmt.Sprintf("%.0fm", distanceMeters)
-		} else {
-			distanceDisplay = fmt.Sprintf("%.1fkm", distanceMeters/1000)
-		}
-
-		// Build campaign object with Flutter-compatible field names (FIXED: Use vendor_type instead of vendor_name)
-		campaign := map[string]interface{}{
-			"campaign_id":       campaignID,
-			"title":            title,
-			"description":      description,
-			"code":             code,
-			"enabled":          enabled,
-			"vendor_name":      vendorType,           // Use vendor_type as display name
-			"vendor_address":   address,              // Flutter expects this field name
-			"vendor_lat":       vendorLat,
-			"vendor_lng":       vendorLng,
-			"distance_meters":  distanceMeters,       // Raw distance for calculations
-			"distance_display": distanceDisplay,      // Formatted for UI display
-		}
+		// Formatted for UI display; distance_meters is the raw value
+		c.DistanceDisplay = formatDistance(c.DistanceMeters)
 
-		campaigns = append(campaigns, campaign)
+		campaigns = append(campaigns, c)
+		candidates = append(candidates, ranking.Candidate{
+			CampaignID:     c.CampaignID,
+			VendorID:       c.VendorID,
+			VendorType:     c.VendorType,
+			SegmentName:    segmentName,
+			DistanceMeters: c.DistanceMeters,
+			StartDate:      startDate,
+			EndDate:        endDate,
+		})
 		
 		// Debug: Log first few campaigns
 		if len(campaigns) <= 5 {
-			log.Printf("Campaign %d: %s (%s) at %s - %.0fm away", 
-				len(campaigns), title, vendorType, address, distanceMeters)
+			logf(r, "Campaign %d: %s (%s) at %s - %.0fm away", 
+				len(campaigns), c.Title, c.VendorType, c.VendorAddress, c.DistanceMeters)
 		}
 	}
 
+	// Pick this page; relevance order adds each item's score and explanation
+	page, nextCursor, err := pageCampaigns(userID, params, candidates)
+	if err != nil {
+		errorf(r, "Error ranking campaigns for user %s: %v", userID, err)
+		writeInternalError(w, r, "Campaign ranking failed")
+		return
+	}
+	campaigns = pageItems(campaigns, page, params.SortBy)
+
+	// Show each campaign on the page as the A/B variant assigned to this user
+	if err := applyVariants(r.Context(), userID, campaigns); err != nil {
+		errorf(r, "Error resolving campaign variants for user %s: %v", userID, err)
+	}
+
+	if nextCursor != "" {
+		w.Header().Set(nextCursorHeader, nextCursor)
+	}
+
 	// PART 6: Return distance-sorted campaigns
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(campaigns)
-	log.Printf("Returned %d campaigns ordered by distance for user %s", len(campaigns), userID)
+	logf(r, "Returned %d campaigns ordered by %s for user %s", len(campaigns), params.SortBy, userID)
 }
 
 
@@ -809,12 +977,12 @@ func handleUserWebSocket(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["user_id"]
 	
-	log.Printf("New user WebSocket connection: %s", userID)
+	logf(r, "New user WebSocket connection: %s", userID)
 	
 	// Upgrade HTTP connection to WebSocket
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade failed for user %s: %v", userID, err)
+		errorf(r, "WebSocket upgrade failed for user %s: %v", userID, err)
 		return
 	}
 	defer conn.Close()
@@ -832,18 +1000,19 @@ func handleUserWebSocket(w http.ResponseWriter, r *http.Request) {
 			"user_id": userID,
 		},
 	}
-	conn.WriteJSON(welcomeMsg)
+	writeWS(r.Context(), conn, wsClientUser, welcomeMsg)
 	
 	// Listen for incoming messages
 	for {
 		var msg WSMessage
 		err := conn.ReadJSON(&msg)
 		if err != nil {
-			log.Printf("User %s disconnected: %v", userID, err)
+			logf(r, "User %s disconnected: %v", userID, err)
 			break
 		}
 		
-		log.Printf("Received message from user %s: %s", userID, msg.Type)
+		logf(r, "Received message from user %s: %s", userID, msg.Type)
+		handleUserMessage(userID, msg)
 	}
 	
 	// Clean up connection
@@ -851,19 +1020,19 @@ func handleUserWebSocket(w http.ResponseWriter, r *http.Request) {
 	delete(connManager.userConnections, userID)
 	connManager.mutex.Unlock()
 	
-	log.Printf("User %s WebSocket connection closed", userID)
+	logf(r, "User %s WebSocket connection closed", userID)
 }
 
 func handleVendorWebSocket(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	vendorID := vars["vendor_id"]
 	
-	log.Printf("New vendor WebSocket connection: %s", vendorID)
+	logf(r, "New vendor WebSocket connection: %s", vendorID)
 	
 	// Upgrade HTTP connection to WebSocket
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade failed for vendor %s: %v", vendorID, err)
+		errorf(r, "WebSocket upgrade failed for vendor %s: %v", vendorID, err)
 		return
 	}
 	defer conn.Close()
@@ -881,18 +1050,18 @@ func handleVendorWebSocket(w http.ResponseWriter, r *http.Request) {
 			"vendor_id": vendorID,
 		},
 	}
-	conn.WriteJSON(welcomeMsg)
+	writeWS(r.Context(), conn, wsClientVendor, welcomeMsg)
 	
 	// Listen for incoming messages
 	for {
 		var msg WSMessage
 		err := conn.ReadJSON(&msg)
 		if err != nil {
-			log.Printf("Vendor %s disconnected: %v", vendorID, err)
+			logf(r, "Vendor %s disconnected: %v", vendorID, err)
 			break
 		}
 		
-		log.Printf("Received message from vendor %s: %s", vendorID, msg.Type)
+		logf(r, "Received message from vendor %s: %s", vendorID, msg.Type)
 	}
 	
 	// Clean up connection
@@ -900,11 +1069,11 @@ func handleVendorWebSocket(w http.ResponseWriter, r *http.Request) {
 	delete(connManager.vendorConnections, vendorID)
 	connManager.mutex.Unlock()
 	
-	log.Printf("Vendor %s WebSocket connection closed", vendorID)
+	logf(r, "Vendor %s WebSocket connection closed", vendorID)
 }
 
 // Broadcast engagement update to relevant vendor
-func broadcastEngagementUpdate(vendorID string, engagementData map[string]interface{}) {
+func broadcastEngagementUpdate(ctx context.Context, vendorID string, engagementData map[string]interface{}) {
 	connManager.mutex.RLock()
 	conn, exists := connManager.vendorConnections[vendorID]
 	connManager.mutex.RUnlock()
@@ -916,7 +1085,7 @@ func broadcastEngagementUpdate(vendorID string, engagementData map[string]interf
 			Data:     engagementData,
 		}
 		
-		if err := conn.WriteJSON(msg); err != nil {
+		if err := writeWS(ctx, conn, wsClientVendor, msg); err != nil {
 			log.Printf("Error broadcasting engagement update to vendor %s: %v", vendorID, err)
 		} else {
 			log.Printf("Broadcast engagement update to vendor %s", vendorID)
@@ -925,11 +1094,11 @@ func broadcastEngagementUpdate(vendorID string, engagementData map[string]interf
 }
 
 // Get vendor ID for a campaign and broadcast engagement
-func broadcastEngagementToVendor(userID, campaignID, action string) {
+func broadcastEngagementToVendor(ctx context.Context, userID, campaignID, action string) {
 	// Get vendor ID for this campaign
 	var vendorID string
 	vendorQuery := `SELECT vendor_id FROM campaigns WHERE campaign_id = $1`
-	err := config.DB.QueryRow(vendorQuery, campaignID).Scan(&vendorID)
+	err := config.DB.QueryRowContext(ctx, vendorQuery, campaignID).Scan(&vendorID)
 	if err != nil {
 		log.Printf("Error getting vendor for campaign %s: %v", campaignID, err)
 		return
@@ -944,21 +1113,25 @@ func broadcastEngagementToVendor(userID, campaignID, action string) {
 	}
 	
 	// Broadcast to vendor
-	broadcastEngagementUpdate(vendorID, engagementData)
+	broadcastEngagementUpdate(ctx, vendorID, engagementData)
 }
 
 // Track user location and send campaign notifications
 func trackUserLocation(userID string, conn *websocket.Conn) {
-	ticker := time.NewTicker(30 * time.Second) // Check every 30 seconds
+	ticker := time.NewTicker(wsPushInterval)
 	defer ticker.Stop()
 	
 	for {
 		select {
 		case <-ticker.C:
+			// Each push is its own trace
+			ctx, span := tracing.Tracer().Start(context.Background(), "WS push campaigns")
+			
 			// Get user's current campaigns
-			campaigns, err := getUserCampaignsFromDB(userID)
+			campaigns, err := getUserCampaignsFromDB(ctx, userID)
 			if err != nil {
 				log.Printf("Error getting campaigns for user %s: %v", userID, err)
+				span.End()
 				continue
 			}
 			
@@ -967,26 +1140,28 @@ func trackUserLocation(userID string, conn *websocket.Conn) {
 				msg := WSMessage{
 					Type:   "campaign_update",
 					UserID: userID,
-					Data: map[string]interface{}{
-						"campaigns": campaigns,
-						"count":     len(campaigns),
-						"timestamp": time.Now().Format(time.RFC3339),
+					Data: campaignUpdate{
+						Campaigns: campaigns,
+						Count:     len(campaigns),
+						Timestamp: time.Now().Format(time.RFC3339),
 					},
 				}
 				
-				if err := conn.WriteJSON(msg); err != nil {
+				if err := writeWS(ctx, conn, wsClientUser, msg); err != nil {
 					log.Printf("Error sending campaign update to user %s: %v", userID, err)
+					span.End()
 					return
 				}
 			}
+			span.End()
 		}
 	}
 }
 
 // Send initial analytics to vendor
-func sendInitialAnalytics(vendorID string, conn *websocket.Conn) {
+func sendInitialAnalytics(ctx context.Context, vendorID string, conn *websocket.Conn) {
 	// Get vendor analytics from database
-	analytics, err := getVendorAnalyticsFromDB(vendorID)
+	analytics, err := loadVendorAnalytics(ctx, vendorID)
 	if err != nil {
 		log.Printf("Error getting analytics for vendor %s: %v", vendorID, err)
 		return
@@ -995,27 +1170,48 @@ func sendInitialAnalytics(vendorID string, conn *websocket.Conn) {
 	msg := WSMessage{
 		Type:     "analytics_update",
 		VendorID: vendorID,
-		Data:     analytics,
+		Data: vendorAnalyticsUpdate{
+			vendorAnalytics: analytics,
+			Timestamp:       time.Now().Format(time.RFC3339),
+		},
 	}
 	
-	if err := conn.WriteJSON(msg); err != nil {
+	if err := writeWS(ctx, conn, wsClientVendor, msg); err != nil {
 		log.Printf("Error sending initial analytics to vendor %s: %v", vendorID, err)
 	}
 }
 
 // Handle incoming messages from users
 func handleUserMessage(userID string, msg WSMessage) {
+	ctx, span := tracing.Tracer().Start(context.Background(), "WS receive "+msg.Type,
+		trace.WithSpanKind(trace.SpanKindConsumer))
+	defer span.End()
+	
 	switch msg.Type {
 	case "location_update":
 		// Handle location updates from mobile app
 		if locationData, ok := msg.Data.(map[string]interface{}); ok {
-			lat, _ := locationData["latitude"].(float64)
-			lng, _ := locationData["longitude"].(float64)
+			lat, hasLat := locationData["latitude"].(float64)
+			lng, hasLng := locationData["longitude"].(float64)
+			if !hasLat || !hasLng {
+				slog.Warn("location update without latitude and longitude", "user_id", userID)
+				return
+			}
+			if err := checkCoordinates(lat, lng); err != nil {
+				slog.Warn("invalid location update", "user_id", userID, "error", err)
+				return
+			}
+			
+			// GPS accuracy radius in meters, if the app reports it
+			var accuracy *float64
+			if a, ok := locationData["accuracy"].(float64); ok && checkAccuracy(a) == nil {
+				accuracy = &a
+			}
 			
 			// Store location in database
-			storeUserLocation(userID, lat, lng)
+			storeUserLocation(ctx, userID, lat, lng, accuracy)
 			
-			log.Printf("Location update from user %s: lat=%f, lng=%f", userID, lat, lng)
+			slog.Debug("location update", "user_id", userID, "lat", lat, "lng", lng)
 		}
 	case "engagement":
 		// Handle engagement events via WebSocket
@@ -1026,14 +1222,14 @@ func handleUserMessage(userID string, msg WSMessage) {
 			log.Printf("WebSocket engagement from user %s: %s on %s", userID, action, campaignID)
 			
 			// Broadcast to vendor immediately
-			broadcastEngagementToVendor(userID, campaignID, action)
+			broadcastEngagementToVendor(ctx, userID, campaignID, action)
 		}
 	case "ping":
 		// Respond to ping to keep connection alive
 		pongMsg := WSMessage{Type: "pong", Data: "alive"}
 		connManager.mutex.RLock()
 		if conn, exists := connManager.userConnections[userID]; exists {
-			conn.WriteJSON(pongMsg)
+			writeWS(ctx, conn, wsClientUser, pongMsg)
 		}
 		connManager.mutex.RUnlock()
 	}
@@ -1041,169 +1237,139 @@ func handleUserMessage(userID string, msg WSMessage) {
 
 // Handle incoming messages from vendors
 func handleVendorMessage(vendorID string, msg WSMessage) {
+	ctx, span := tracing.Tracer().Start(context.Background(), "WS receive "+msg.Type,
+		trace.WithSpanKind(trace.SpanKindConsumer))
+	defer span.End()
+	
 	switch msg.Type {
 	case "request_analytics":
-		// Send fresh analytics data
-		go sendInitialAnalytics(vendorID, connManager.vendorConnections[vendorID])
+		// Send fresh analytics data, within this message's span
+		connManager.mutex.RLock()
+		conn, exists := connManager.vendorConnections[vendorID]
+		connManager.mutex.RUnlock()
+		if exists {
+			sendInitialAnalytics(ctx, vendorID, conn)
+		}
 	case "ping":
 		// Respond to ping to keep connection alive
 		pongMsg := WSMessage{Type: "pong", Data: "alive"}
 		connManager.mutex.RLock()
 		if conn, exists := connManager.vendorConnections[vendorID]; exists {
-			conn.WriteJSON(pongMsg)
+			writeWS(ctx, conn, wsClientVendor, pongMsg)
 		}
 		connManager.mutex.RUnlock()
 	}
 }
 
-// Helper function to get user campaigns from database
-func getUserCampaignsFromDB(userID string) ([]map[string]interface{}, error) {
-	// Get user location
-	userLat, userLng, err := getUserCurrentLocation(userID)
+// Helper function to get user campaigns from database, for WebSocket pushes
+func getUserCampaignsFromDB(ctx context.Context, userID string) ([]campaignListItem, error) {
+	// Get user location; no pushes while it's stale
+	loc, err := freshLocation(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
+	userLat, userLng := loc.Lat, loc.Lng
 	
-	// Same query as getUserNearbyPromsHandler but return as map
+	// Same matching as getUserNearbyPromsHandler, every live campaign at its
+	// nearest store
 	campaignQuery := `
-		SELECT 
+		SELECT DISTINCT ON (c.campaign_id)
 			c.campaign_id, 
+			v.vendor_id, 
 			c.title, 
 			c.code,
 			c.description, 
+			c.enabled,
+			c.geofence_radius_km,
 			v.address,           
-			v.vendor_type      
+			v.vendor_type,      
+			COALESCE(v.display_name, b.display_name, v.vendor_type) as vendor_name,
+			v.lat as vendor_lat, 
+			v.long as vendor_lng,
+			ST_Distance(
+				ST_SetSRID(ST_MakePoint(v.long, v.lat), 4326)::geography,
+				ST_SetSRID(ST_MakePoint($2, $3), 4326)::geography
+			) as distance_meters
 		FROM campaigns c
-		JOIN vendors v ON c.vendor_id = v.vendor_id
+		JOIN campaign_sites cs ON cs.campaign_id = c.campaign_id
+		JOIN vendors v ON cs.vendor_id = v.vendor_id
+		LEFT JOIN brands b ON v.brand_id = b.brand_id
 		JOIN segments s ON c.segment_id = s.segment_id
 		JOIN users u ON u.user_id = $1
 		WHERE c.enabled = true
-			AND c.start_date <= CURRENT_DATE
-			AND c.end_date >= CURRENT_DATE
+			AND campaign_is_live(c.campaign_id, NOW())
+			AND campaign_open_to_user(c.campaign_id, $1)
 			AND ST_DWithin(
 				ST_Transform(ST_SetSRID(ST_MakePoint(v.long, v.lat), 4326), 3857),
 				ST_Transform(ST_SetSRID(ST_MakePoint($2, $3), 4326), 3857),
 				c.geofence_radius_km * 1000
 			)
 			AND (
-				s.segment_name = CONCAT('loyalty_tier_', u.loyalty_tier)
+				s.segment_name = 'everyone'
+				OR s.segment_name = CONCAT('loyalty_tier_', u.loyalty_tier)
 				OR s.segment_name = CONCAT('most_frequent_vendor_type_', u.most_frequent_vendor_type)
 				OR s.segment_name = CONCAT('most_frequent_vendor_', u.most_frequent_vendor)
-			)`
-	
-	rows, err := config.DB.Query(campaignQuery, userID, userLng, userLat)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	
-	var campaigns []map[string]interface{}
-	for rows.Next() {
-		var campaignID, title, code, description, address, vendorType string
-		err := rows.Scan(&campaignID, &title, &code, &description, &address, &vendorType)
-		if err != nil {
-			continue
-		}
-		
-		campaigns = append(campaigns, map[string]interface{}{
-			"campaign_id":    campaignID,
-			"title":         title,
-			"code":          code,
-			"description":   description,
-			"vendor_address": address,
-			"vendor_type":   vendorType,
-		})
-	}
-	
-	return campaigns, nil
-}
-
-// Helper function to get vendor analytics from database
-func getVendorAnalyticsFromDB(vendorID string) (map[string]interface{}, error) {
-	// Reuse existing analytics query logic
-	campaignQuery := `
-		SELECT 
-			c.campaign_id,
-			c.title,
-			c.code,
-			c.enabled,
-			COALESCE(clicks.total_clicks, 0) as total_clicks,
-			COALESCE(uses.total_uses, 0) as total_uses
-		FROM campaigns c
-		LEFT JOIN (
-			SELECT campaign_id, COUNT(*) as total_clicks
-			FROM campaign_user_engagements 
-			WHERE engagement_type = 'clicked'
-			GROUP BY campaign_id
-		) clicks ON c.campaign_id = clicks.campaign_id
-		LEFT JOIN (
-			SELECT campaign_id, COUNT(*) as total_uses
-			FROM campaign_user_engagements 
-			WHERE engagement_type = 'used'
-			GROUP BY campaign_id
-		) uses ON c.campaign_id = uses.campaign_id
-		WHERE c.vendor_id = $1
-		ORDER BY c.campaign_id`
+			)
+		ORDER BY c.campaign_id, distance_meters`
 	
-	rows, err := config.DB.Query(campaignQuery, vendorID)
+	rows, err := config.DB.QueryContext(ctx, campaignQuery, userID, userLng, userLat)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	
-	var campaigns []map[string]interface{}
-	var totalClicks, totalUses int
-	
+	var campaigns []campaignListItem
 	for rows.Next() {
-		var campaignID, title, code string
-		var enabled bool
-		var clicks, uses int
-		
-		err := rows.Scan(&campaignID, &title, &code, &enabled, &clicks, &uses)
+		var c campaignListItem
+		err := rows.Scan(
+			&c.CampaignID,
+			&c.VendorID,
+			&c.Title,
+			&c.Code,
+			&c.Description,
+			&c.Enabled,
+			&c.GeofenceRadiusKm,
+			&c.VendorAddress,
+			&c.VendorType,
+			&c.VendorName,
+			&c.VendorLat,
+			&c.VendorLng,
+			&c.DistanceMeters,
+		)
 		if err != nil {
 			continue
 		}
-		
-		totalClicks += clicks
-		totalUses += uses
-		
-		campaigns = append(campaigns, map[string]interface{}{
-			"campaign_id":   campaignID,
-			"title":        title,
-			"code":         code,
-			"enabled":      enabled,
-			"total_clicks": clicks,
-			"total_uses":   uses,
-		})
+		c.DistanceDisplay = formatDistance(c.DistanceMeters)
+		campaigns = append(campaigns, c)
 	}
 	
-	// Calculate conversion rate
-	conversionRate := 0.0
-	if totalClicks > 0 {
-		conversionRate = float64(totalUses) / float64(totalClicks) * 100
+	if err := applyVariants(ctx, userID, campaigns); err != nil {
+		log.Printf("Error resolving campaign variants for user %s: %v", userID, err)
 	}
 	
-	return map[string]interface{}{
-		"vendor_id": vendorID,
-		"vendor_summary": map[string]interface{}{
-			"total_campaigns":        len(campaigns),
-			"overall_conversion_rate": conversionRate,
-			"total_clicks":           totalClicks,
-			"total_uses":             totalUses,
-		},
-		"campaigns": campaigns,
-		"timestamp": time.Now().Format(time.RFC3339),
-	}, nil
+	return campaigns, nil
 }
 
-// Store user location in database
-func storeUserLocation(userID string, lat, lng float64) {
+// Store user location in database. The trg_track_current_location trigger
+// also makes it the user's current location.
+func storeUserLocation(ctx context.Context, userID string, lat, lng float64, accuracy *float64) error {
 	insertQuery := `
-		INSERT INTO user_location_events (user_id, lat, long, event_time)
-		VALUES ($1, $2, $3, NOW())`
+		INSERT INTO user_location_events (user_id, lat, long, accuracy_m, event_time)
+		VALUES ($1, $2, $3, $4, NOW())
+		RETURNING location_id`
 	
-	_, err := config.DB.Exec(insertQuery, userID, lat, lng)
+	var locationID string
+	err := config.DB.QueryRowContext(ctx, insertQuery, userID, lat, lng, accuracy).Scan(&locationID)
 	if err != nil {
 		log.Printf("Error storing location for user %s: %v", userID, err)
+		return err
+	}
+	
+	// Tag the event with its nearest known address in the background, in
+	// the same trace
+	payload := annotateLocationPayload{LocationID: locationID, Lat: lat, Lng: lng}
+	if err := annotateLocationJob.Enqueue(ctx, config.DB, payload); err != nil {
+		log.Printf("Error queueing address lookup for location %s: %v", locationID, err)
 	}
+	return nil
 }
\ No newline at end of file
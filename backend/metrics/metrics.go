@@ -0,0 +1,302 @@
+// Package metrics keeps counters, gauges and histograms and writes them in
+// the Prometheus text exposition format (version 0.0.4). It covers what the
+// server needs without pulling in the Prometheus client library: labelled
+// counters and histograms updated in place, and gauges and counters read
+// from a function at scrape time.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are latency histogram bounds in seconds, 5ms to 10s
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// collector is one metric family
+type collector interface {
+	write(w io.Writer) error
+}
+
+// Registry is a set of metrics to expose together
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+	names      map[string]bool
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// Write writes every metric in registration order
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	for _, c := range collectors {
+		if err := c.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves the registry for Prometheus to scrape
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// desc is the name, help and label names shared by a family's series
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d desc) header(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.kind)
+	return err
+}
+
+// series formats name{labels} for label values in the order of d.labels,
+// plus extra pairs (such as le for histogram buckets)
+func (d desc) series(name string, values []string, extra ...string) string {
+	if len(d.labels) == 0 && len(extra) == 0 {
+		return name
+	}
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	sep := ""
+	for i, label := range d.labels {
+		fmt.Fprintf(&b, `%s%s="%s"`, sep, label, escapeLabel(values[i]))
+		sep = ","
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		fmt.Fprintf(&b, `%s%s="%s"`, sep, extra[i], escapeLabel(extra[i+1]))
+		sep = ","
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// CounterVec is a counter per combination of label values
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labels []string
+	value  float64
+}
+
+// NewCounterVec registers a counter; name should end in _total
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		desc:   desc{name: name, help: help, kind: "counter", labels: labels},
+		values: map[string]*counterSeries{},
+	}
+	r.register(name, c)
+	return c
+}
+
+// Inc adds 1 to the series with these label values
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v (which must not be negative) to the series with these label
+// values
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.values[key]
+	if !ok {
+		s = &counterSeries{labels: append([]string(nil), labelValues...)}
+		c.values[key] = s
+	}
+	s.value += v
+}
+
+func (c *CounterVec) write(w io.Writer) error {
+	c.mu.Lock()
+	keys := sortedKeys(c.values)
+	lines := make([]string, len(keys))
+	for i, k := range keys {
+		s := c.values[k]
+		lines[i] = c.series(c.name, s.labels) + " " + formatValue(s.value)
+	}
+	c.mu.Unlock()
+
+	if err := c.header(w); err != nil {
+		return err
+	}
+	return writeLines(w, lines)
+}
+
+// HistogramVec is a histogram per combination of label values
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labels []string
+	counts []uint64 // Per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec registers a histogram with the given upper bounds
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	h := &HistogramVec{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: sorted,
+		values:  map[string]*histogramSeries{},
+	}
+	r.register(name, h)
+	return h
+}
+
+// Observe records v in the series with these label values
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.values[key]
+	if !ok {
+		s = &histogramSeries{
+			labels: append([]string(nil), labelValues...),
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.values[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *HistogramVec) write(w io.Writer) error {
+	h.mu.Lock()
+	var lines []string
+	for _, k := range sortedKeys(h.values) {
+		s := h.values[k]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			lines = append(lines, h.series(h.name+"_bucket", s.labels, "le", formatValue(bound))+" "+strconv.FormatUint(cumulative, 10))
+		}
+		lines = append(lines,
+			h.series(h.name+"_bucket", s.labels, "le", "+Inf")+" "+strconv.FormatUint(s.count, 10),
+			h.series(h.name+"_sum", s.labels)+" "+formatValue(s.sum),
+			h.series(h.name+"_count", s.labels)+" "+strconv.FormatUint(s.count, 10))
+	}
+	h.mu.Unlock()
+
+	if err := h.header(w); err != nil {
+		return err
+	}
+	return writeLines(w, lines)
+}
+
+// funcMetric reads its value when scraped
+type funcMetric struct {
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is fn's result at scrape time
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{desc: desc{name: name, help: help, kind: "gauge"}, fn: fn})
+}
+
+// NewCounterFunc registers a counter kept elsewhere, such as a count in
+// sql.DBStats; fn must never decrease
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{desc: desc{name: name, help: help, kind: "counter"}, fn: fn})
+}
+
+func (f *funcMetric) write(w io.Writer) error {
+	if err := f.header(w); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s %s\n", f.name, formatValue(f.fn()))
+	return err
+}
+
+func writeLines(w io.Writer, lines []string) error {
+	for _, line := range lines {
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func exposition(t *testing.T, r *Registry) string {
+	t.Helper()
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestCounterVec(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("requests_total", "Requests served", "method", "status")
+	c.Inc("GET", "200")
+	c.Inc("GET", "200")
+	c.Add(0.5, "POST", "500")
+	c.Inc("DELETE", "404")
+
+	// Series are sorted by label values
+	want := `# HELP requests_total Requests served
+# TYPE requests_total counter
+requests_total{method="DELETE",status="404"} 1
+requests_total{method="GET",status="200"} 2
+requests_total{method="POST",status="500"} 0.5
+`
+	if got := exposition(t, r); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCounterVecWithoutLabels(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("runs_total", "Runs")
+	r.NewCounterVec("idle_total", "Never incremented")
+	c.Inc()
+
+	want := `# HELP runs_total Runs
+# TYPE runs_total counter
+runs_total 1
+# HELP idle_total Never incremented
+# TYPE idle_total counter
+`
+	if got := exposition(t, r); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	r := NewRegistry()
+	// Bounds are sorted on registration
+	h := r.NewHistogramVec("duration_seconds", "Request duration", []float64{1, 0.1, 0.5}, "route")
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.5, 0.7, 2} {
+		h.Observe(v, "/users/{id}")
+	}
+	h.Observe(0.2, "/health")
+
+	// Buckets are cumulative and inclusive of their bound; +Inf equals _count
+	want := `# HELP duration_seconds Request duration
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="/health",le="0.1"} 0
+duration_seconds_bucket{route="/health",le="0.5"} 1
+duration_seconds_bucket{route="/health",le="1"} 1
+duration_seconds_bucket{route="/health",le="+Inf"} 1
+duration_seconds_sum{route="/health"} 0.2
+duration_seconds_count{route="/health"} 1
+duration_seconds_bucket{route="/users/{id}",le="0.1"} 2
+duration_seconds_bucket{route="/users/{id}",le="0.5"} 4
+duration_seconds_bucket{route="/users/{id}",le="1"} 5
+duration_seconds_bucket{route="/users/{id}",le="+Inf"} 6
+duration_seconds_sum{route="/users/{id}"} 3.65
+duration_seconds_count{route="/users/{id}"} 6
+`
+	if got := exposition(t, r); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFuncMetrics(t *testing.T) {
+	r := NewRegistry()
+	open := 3.0
+	r.NewGaugeFunc("connections", "Open connections", func() float64 { return open })
+	r.NewCounterFunc("waits_total", "Waits for a connection", func() float64 { return 7 })
+
+	open = 4 // Read at scrape time
+	want := `# HELP connections Open connections
+# TYPE connections gauge
+connections 4
+# HELP waits_total Waits for a connection
+# TYPE waits_total counter
+waits_total 7
+`
+	if got := exposition(t, r); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("errors_total", "Errors by message\nwith a back\\slash", "message")
+	c.Inc("say \"hi\"\nback\\slash")
+
+	want := `# HELP errors_total Errors by message\nwith a back\\slash
+# TYPE errors_total counter
+errors_total{message="say \"hi\"\nback\\slash"} 1
+`
+	if got := exposition(t, r); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	for _, tc := range []struct {
+		v    float64
+		want string
+	}{
+		{0, "0"},
+		{42, "42"},
+		{0.25, "0.25"},
+		{1e21, "1e+21"},
+		{-3.5, "-3.5"},
+		{math.Inf(1), "+Inf"},
+		{math.Inf(-1), "-Inf"},
+		{math.NaN(), "NaN"},
+	} {
+		if got := formatValue(tc.v); got != tc.want {
+			t.Errorf("formatValue(%v) = %q, want %q", tc.v, got, tc.want)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("runs_total", "Runs").Inc()
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.HasSuffix(w.Body.String(), "runs_total 1\n") {
+		t.Errorf("body = %q", w.Body.String())
+	}
+}
+
+func TestRegistrationPanics(t *testing.T) {
+	mustPanic := func(name string, f func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%s didn't panic", name)
+			}
+		}()
+		f()
+	}
+
+	r := NewRegistry()
+	c := r.NewCounterVec("runs_total", "Runs", "job")
+	mustPanic("duplicate name", func() { r.NewGaugeFunc("runs_total", "Again", func() float64 { return 0 }) })
+	mustPanic("missing label value", func() { c.Inc() })
+	mustPanic("extra label value", func() { c.Inc("a", "b") })
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// CampaignBudget caps how many redemptions a campaign can receive.
+// Nil limits are unlimited.
+type CampaignBudget struct {
+	CampaignID       string `json:"campaign_id" db:"campaign_id"`
+	MaxUses          *int   `json:"max_uses" db:"max_uses"`
+	MaxUsesPerDay    *int   `json:"max_uses_per_day" db:"max_uses_per_day"`
+	MaxDistinctUsers *int   `json:"max_distinct_users" db:"max_distinct_users"`
+
+	// Current consumption, filled in on reads
+	Uses          int `json:"uses"`
+	UsesToday     int `json:"uses_today"`
+	DistinctUsers int `json:"distinct_users"`
+
+	ExhaustedAt     *time.Time `json:"exhausted_at" db:"exhausted_at"`
+	ExhaustedReason *string    `json:"exhausted_reason" db:"exhausted_reason"`
+}
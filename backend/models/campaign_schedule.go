@@ -0,0 +1,25 @@
+package models
+
+// ScheduleRule is a recurring daypart during which a campaign may run.
+// Days use Postgres DOW numbering (0 = Sunday); times are "HH:MM" wall-clock
+// values in the vendor's timezone. EndTime before StartTime runs overnight.
+type ScheduleRule struct {
+	ScheduleID string `json:"schedule_id,omitempty" db:"schedule_id"`
+	DaysOfWeek []int  `json:"days_of_week" db:"days_of_week"`
+	StartTime  string `json:"start_time" db:"start_time"`
+	EndTime    string `json:"end_time" db:"end_time"`
+}
+
+// BlackoutDate is a local date ("YYYY-MM-DD") on which a campaign never runs.
+type BlackoutDate struct {
+	Date   string `json:"date" db:"blackout_date"`
+	Reason string `json:"reason,omitempty" db:"reason"`
+}
+
+// CampaignSchedule groups every rule that decides when a campaign is live.
+type CampaignSchedule struct {
+	CampaignID    string         `json:"campaign_id"`
+	Timezone      string         `json:"timezone"` // The vendor's; read-only
+	Rules         []ScheduleRule `json:"rules"`
+	BlackoutDates []BlackoutDate `json:"blackout_dates"`
+}
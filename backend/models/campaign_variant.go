@@ -0,0 +1,36 @@
+package models
+
+import "streetsavvy-backend/experiments"
+
+// CampaignVariant is an alternative creative for a campaign in an A/B test.
+// A nil Description or Code shows the campaign's own.
+type CampaignVariant struct {
+	VariantID   string  `json:"variant_id" db:"variant_id"`
+	CampaignID  string  `json:"campaign_id" db:"campaign_id"`
+	Name        string  `json:"name" db:"name"`
+	Title       string  `json:"title" db:"title"`
+	Description *string `json:"description" db:"description"`
+	Code        *string `json:"code" db:"code"`
+	Weight      int     `json:"weight" db:"weight"`
+	IsControl   bool    `json:"is_control" db:"is_control"` // What the other variants are measured against
+}
+
+// VariantMetrics is a variant's funnel: users exposed, users who clicked and
+// users who redeemed, with the conversion compared against the control
+type VariantMetrics struct {
+	VariantID string `json:"variant_id"`
+	Name      string `json:"name"`
+	Weight    int    `json:"weight"`
+	IsControl bool   `json:"is_control"`
+
+	Exposures int `json:"exposures"`
+	Clickers  int `json:"clickers"`
+	Redeemers int `json:"redeemers"`
+
+	ClickRate      float64 `json:"click_rate"`      // Percentage of exposed users who clicked
+	ConversionRate float64 `json:"conversion_rate"` // Percentage of exposed users who redeemed
+
+	// Against the control; nil for the control or when the test is undefined
+	LiftVsControl *float64           `json:"lift_vs_control,omitempty"` // Percentage points
+	Significance  *experiments.ZTest `json:"significance,omitempty"`
+}
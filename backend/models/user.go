@@ -7,6 +7,8 @@ type User struct {
     IMEI                  string `json:"imei" db:"imei"`
     CreatedAt             time.Time `json:"created_at" db:"created_at"`
     UpdatedAt             *time.Time `json:"updated_at" db:"updated_at"`
+    MSISDNVerifiedAt      *time.Time `json:"msisdn_verified_at,omitempty" db:"msisdn_verified_at"`
+    DeviceBoundAt         *time.Time `json:"device_bound_at,omitempty" db:"device_bound_at"`
     LoyaltyTier           string `json:"loyalty_tier" db:"loyalty_tier"`
     MostFrequentVendor    string `json:"most_frequent_vendor" db:"most_frequent_vendor"`
     MostFrequentVendorType string `json:"most_frequent_vendor_type" db:"most_frequent_vendor_type"`
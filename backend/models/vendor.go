@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// OpeningPeriod is one "HH:MM"-"HH:MM" span a store is open, local time
+type OpeningPeriod struct {
+	Open  string `json:"open"`
+	Close string `json:"close"`
+}
+
+// OpeningHours maps "mon".."sun" to the day's open periods; missing days are closed
+type OpeningHours map[string][]OpeningPeriod
+
+// Vendor is one store location of a brand
+type Vendor struct {
+	VendorID     string       `json:"vendor_id" db:"vendor_id"`
+	BrandID      *string      `json:"brand_id" db:"brand_id"`
+	DisplayName  string       `json:"display_name" db:"display_name"`
+	VendorType   string       `json:"vendor_type" db:"vendor_type"`
+	Address      string       `json:"address" db:"address"`
+	Lat          float64      `json:"lat" db:"lat"`
+	Lng          float64      `json:"lng" db:"long"`
+	Timezone     string       `json:"timezone" db:"timezone"`
+	OpeningHours OpeningHours `json:"opening_hours" db:"opening_hours"`
+	ContactPhone string       `json:"contact_phone,omitempty" db:"contact_phone"`
+	ContactEmail string       `json:"contact_email,omitempty" db:"contact_email"`
+	CreatedAt    *time.Time   `json:"created_at,omitempty" db:"created_at"`
+	UpdatedAt    *time.Time   `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+// Brand is the business behind one or more store locations
+type Brand struct {
+	BrandID      string     `json:"brand_id" db:"brand_id"`
+	DisplayName  string     `json:"display_name" db:"display_name"`
+	LogoURL      string     `json:"logo_url,omitempty" db:"logo_url"`
+	ContactEmail string     `json:"contact_email,omitempty" db:"contact_email"`
+	ContactPhone string     `json:"contact_phone,omitempty" db:"contact_phone"`
+	Website      string     `json:"website,omitempty" db:"website"`
+	CreatedAt    *time.Time `json:"created_at,omitempty" db:"created_at"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty" db:"updated_at"`
+	Locations    []Vendor   `json:"locations"`
+}
@@ -0,0 +1,407 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The generated client is one file in a package that also provides, by
+// hand, the Client type and its transport:
+//
+//	func (c *Client) do(ctx context.Context, method, path string, query url.Values,
+//		header http.Header, body, out interface{}) (http.Header, error)
+//
+// do sends body as JSON and decodes a 2xx response into out (*[]byte takes
+// the raw body, nil discards it), returning the response headers. Every
+// schema becomes a type and every operation a method, except WebSocket
+// upgrades. Query parameters are passed in a per-operation Params struct;
+// header and path parameters are arguments. Documented response headers
+// are returned after the body.
+
+// GenerateClient writes the Go source of the client for doc
+func GenerateClient(doc *Document, pkg string) ([]byte, error) {
+	c := &clientWriter{imports: map[string]bool{"context": true}}
+
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c.printf("\ntype %s ", GoName(name))
+		c.typeDecl(doc.Components.Schemas[name])
+		c.printf("\n")
+	}
+
+	for _, op := range doc.Operations() {
+		method, path, _ := strings.Cut(op, " ")
+		if err := c.operation(method, path, doc.Paths[path][strings.ToLower(method)]); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by openapi.GenerateClient; DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkg)
+	imports := make([]string, 0, len(c.imports))
+	for imp := range c.imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	for _, imp := range imports {
+		fmt.Fprintf(&out, "\t%q\n", imp)
+	}
+	out.WriteString(")\n")
+	out.Write(c.buf.Bytes())
+	return format.Source(out.Bytes())
+}
+
+type clientWriter struct {
+	buf     bytes.Buffer
+	imports map[string]bool
+}
+
+func (c *clientWriter) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&c.buf, format, args...)
+}
+
+// typeDecl writes the Go type of a named schema
+func (c *clientWriter) typeDecl(s *Schema) {
+	if s.Type == "object" && s.Properties != nil {
+		c.printf("%s", c.structType(s))
+		return
+	}
+	c.printf("%s", c.goType(s))
+}
+
+func (c *clientWriter) structType(s *Schema) string {
+	required := map[string]bool{}
+	for _, name := range s.Required {
+		required[name] = true
+	}
+	props := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		props = append(props, name)
+	}
+	sort.Strings(props)
+
+	var b strings.Builder
+	b.WriteString("struct {\n")
+	for _, name := range props {
+		tag := name
+		if !required[name] {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(&b, "%s %s `json:%q`\n", GoName(name), c.goType(s.Properties[name]), tag)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// goType is the Go type a schema decodes into; nullable scalars and
+// references are pointers
+func (c *clientWriter) goType(s *Schema) string {
+	if len(s.AllOf) == 1 {
+		return "*" + c.goType(s.AllOf[0])
+	}
+	if s.Ref != "" {
+		return GoName(strings.TrimPrefix(s.Ref, "#/components/schemas/"))
+	}
+
+	var t string
+	switch s.Type {
+	case "boolean":
+		t = "bool"
+	case "integer":
+		t = "int"
+		if s.Format == "int64" {
+			t = "int64"
+		}
+	case "number":
+		t = "float64"
+	case "string":
+		switch s.Format {
+		case "date-time":
+			c.imports["time"] = true
+			t = "time.Time"
+		case "byte":
+			return "[]byte"
+		default:
+			t = "string"
+		}
+	case "array":
+		return "[]" + c.goType(s.Items)
+	case "object":
+		if s.Properties != nil {
+			return c.structType(s)
+		}
+		if s.AdditionalProperties != nil {
+			return "map[string]" + c.goType(s.AdditionalProperties)
+		}
+		c.imports["encoding/json"] = true
+		return "json.RawMessage"
+	default:
+		c.imports["encoding/json"] = true
+		return "json.RawMessage"
+	}
+	if s.Nullable {
+		return "*" + t
+	}
+	return t
+}
+
+func (c *clientWriter) operation(method, path string, op *Operation) error {
+	success, resp, ok := successResponse(op)
+	if !ok {
+		return fmt.Errorf("no success response")
+	}
+	if success == http.StatusSwitchingProtocols {
+		return nil // WebSocket upgrade
+	}
+	name := GoName(op.OperationID)
+
+	var args, pathExpr []string
+	var queries, headers []Parameter
+	args = append(args, "ctx context.Context")
+	for _, p := range op.Parameters {
+		switch p.In {
+		case "path":
+			args = append(args, argName(p.Name)+" string")
+		case "header":
+			args = append(args, argName(p.Name)+" string")
+			headers = append(headers, p)
+		case "query":
+			queries = append(queries, p)
+		}
+	}
+	literal := ""
+	for _, part := range strings.Split(path, "/")[1:] {
+		if !strings.HasPrefix(part, "{") {
+			literal += "/" + part
+			continue
+		}
+		c.imports["net/url"] = true
+		pathExpr = append(pathExpr, strconv.Quote(literal+"/"), "url.PathEscape("+argName(strings.Trim(part, "{}"))+")")
+		literal = ""
+	}
+	if literal != "" {
+		pathExpr = append(pathExpr, strconv.Quote(literal))
+	}
+
+	if len(queries) > 0 {
+		args = append(args, "params *"+name+"Params")
+		c.paramsType(name, queries)
+	}
+	if op.RequestBody != nil {
+		args = append(args, "body "+c.goType(op.RequestBody.Content[JSON].Schema))
+	}
+
+	// Results: the body, then the documented response headers
+	var out, zero string
+	for contentType, media := range resp.Content {
+		if contentType != JSON {
+			out, zero = "[]byte", "nil"
+			break
+		}
+		out = c.goType(media.Schema)
+		zero = "nil"
+		if media.Schema.Ref != "" {
+			out = "*" + out
+		} else if !strings.HasPrefix(out, "[]") && !strings.HasPrefix(out, "map[") && out != "json.RawMessage" {
+			return fmt.Errorf("unsupported response type %s", out)
+		}
+	}
+	headerNames := make([]string, 0, len(resp.Headers))
+	for h := range resp.Headers {
+		headerNames = append(headerNames, h)
+	}
+	sort.Strings(headerNames)
+
+	var results, zeros []string
+	if out != "" {
+		results = append(results, out)
+		zeros = append(zeros, zero)
+	}
+	for range headerNames {
+		results = append(results, "string")
+		zeros = append(zeros, `""`)
+	}
+	results = append(results, "error")
+	zeros = append(zeros, "err")
+
+	c.printf("\n// %s calls %s %s", name, method, path)
+	if op.Summary != "" {
+		c.printf("\n//\n// %s", op.Summary)
+	}
+	if len(headerNames) > 0 {
+		c.printf("\n//\n// Also returns the %s response header.", strings.Join(headerNames, " and "))
+	}
+	c.printf("\nfunc (c *Client) %s(%s) (%s) {\n", name, strings.Join(args, ", "), strings.Join(results, ", "))
+
+	query, header, body, target := "nil", "nil", "nil", "nil"
+	if len(queries) > 0 {
+		query = "params.values()"
+	}
+	if len(headers) > 0 {
+		c.imports["net/http"] = true
+		c.printf("header := http.Header{}\n")
+		for _, h := range headers {
+			c.printf("header.Set(%q, %s)\n", h.Name, argName(h.Name))
+		}
+		header = "header"
+	}
+	if op.RequestBody != nil {
+		body = "body"
+	}
+	if out != "" {
+		c.printf("var out %s\n", strings.TrimPrefix(out, "*"))
+		target = "&out"
+	}
+	respHeader := "_"
+	if len(headerNames) > 0 {
+		respHeader = "respHeader"
+	}
+	c.printf("%s, err := c.do(ctx, %q, %s, %s, %s, %s, %s)\n",
+		respHeader, method, strings.Join(pathExpr, "+"), query, header, body, target)
+	c.printf("if err != nil {\nreturn %s\n}\n", strings.Join(zeros, ", "))
+
+	var returns []string
+	if out != "" {
+		if strings.HasPrefix(out, "*") {
+			returns = append(returns, "&out")
+		} else {
+			returns = append(returns, "out")
+		}
+	}
+	for _, h := range headerNames {
+		returns = append(returns, fmt.Sprintf("respHeader.Get(%q)", h))
+	}
+	returns = append(returns, "nil")
+	c.printf("return %s\n}\n", strings.Join(returns, ", "))
+	return nil
+}
+
+// paramsType writes the query parameters of an operation as a struct;
+// unset (empty or nil) fields are left out of the query
+func (c *clientWriter) paramsType(name string, params []Parameter) {
+	c.imports["net/url"] = true
+	c.printf("\n// %sParams are the query parameters of %s\ntype %sParams struct {\n", name, name, name)
+	for _, p := range params {
+		if p.Description != "" {
+			c.printf("// %s\n", p.Description)
+		}
+		c.printf("%s %s\n", GoName(p.Name), paramType(p.Schema))
+	}
+	c.printf("}\n\nfunc (p *%sParams) values() url.Values {\nq := url.Values{}\nif p == nil {\nreturn q\n}\n", name)
+	for _, p := range params {
+		field := "p." + GoName(p.Name)
+		switch p.Schema.Type {
+		case "integer":
+			c.imports["strconv"] = true
+			c.printf("if %s != nil {\nq.Set(%q, strconv.Itoa(*%s))\n}\n", field, p.Name, field)
+		case "number":
+			c.imports["strconv"] = true
+			c.printf("if %s != nil {\nq.Set(%q, strconv.FormatFloat(*%s, 'f', -1, 64))\n}\n", field, p.Name, field)
+		case "boolean":
+			c.imports["strconv"] = true
+			c.printf("if %s != nil {\nq.Set(%q, strconv.FormatBool(*%s))\n}\n", field, p.Name, field)
+		default:
+			c.printf("if %s != \"\" {\nq.Set(%q, %s)\n}\n", field, p.Name, field)
+		}
+	}
+	c.printf("return q\n}\n")
+}
+
+func paramType(s *Schema) string {
+	switch s.Type {
+	case "integer":
+		return "*int"
+	case "number":
+		return "*float64"
+	case "boolean":
+		return "*bool"
+	}
+	return "string"
+}
+
+// successResponse is the lowest 1xx or 2xx response of op
+func successResponse(op *Operation) (int, Response, bool) {
+	best := 0
+	for code := range op.Responses {
+		n, err := strconv.Atoi(code)
+		if err == nil && n < 300 && (best == 0 || n < best) {
+			best = n
+		}
+	}
+	if best == 0 {
+		return 0, Response{}, false
+	}
+	return best, op.Responses[strconv.Itoa(best)], true
+}
+
+// initialisms are written in capitals in Go names
+var initialisms = map[string]bool{
+	"api": true, "id": true, "ids": true, "imei": true, "json": true, "http": true,
+	"msisdn": true, "sms": true, "url": true, "uuid": true, "utc": true,
+}
+
+// GoName turns a JSON, parameter or type name into an exported Go name:
+// "user_id" becomes UserID, "X-Guest-Token" XGuestToken and apiError APIError
+func GoName(s string) string {
+	var b strings.Builder
+	for _, word := range words(s) {
+		lower := strings.ToLower(word)
+		if initialisms[lower] {
+			if lower == "ids" {
+				b.WriteString("IDs")
+			} else {
+				b.WriteString(strings.ToUpper(word))
+			}
+			continue
+		}
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
+
+// argName is the unexported form of GoName, for arguments. Header names
+// drop their X- prefix: "X-Guest-Token" becomes guestToken.
+func argName(s string) string {
+	ws := words(strings.TrimPrefix(s, "X-"))
+	if len(ws) == 0 {
+		return ""
+	}
+	return strings.ToLower(ws[0]) + GoName(strings.Join(ws[1:], "_"))
+}
+
+// words splits s on punctuation and lower-to-upper case changes
+func words(s string) []string {
+	var out []string
+	start := -1
+	runes := []rune(s)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if start >= 0 {
+				out = append(out, string(runes[start:i]))
+				start = -1
+			}
+			continue
+		}
+		if start >= 0 && unicode.IsUpper(r) && unicode.IsLower(runes[i-1]) {
+			out = append(out, string(runes[start:i]))
+			start = i
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		out = append(out, string(runes[start:]))
+	}
+	return out
+}
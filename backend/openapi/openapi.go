@@ -0,0 +1,320 @@
+// Package openapi describes an HTTP API as an OpenAPI 3.0 document built
+// from its Go types, and generates a Go client from that document.
+//
+// Endpoints are declared with the request and response bodies as values of
+// the Go types the handlers decode and encode; their JSON schemas are
+// derived by reflection, following encoding/json's rules. Named struct
+// types become components/schemas and are referenced by name.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version is the OpenAPI version of the documents Build produces
+const Version = "3.0.3"
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Tags       []Tag               `json:"tags,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// Info is the document's title, version and description
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Tag groups operations
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps lower-case HTTP methods to the operations on one path
+type PathItem map[string]*Operation
+
+// Operation is one method on one path
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+// Parameter is a path, query or header parameter
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is an operation's JSON request body
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response is one status of an operation, or a reference to a shared one
+type Response struct {
+	Ref         string               `json:"$ref,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// Header is a response header
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// MediaType is the schema of a body in one content type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the subset of JSON Schema that Go types map to. The empty
+// schema accepts any value.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"` // Only to make a reference nullable
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Components holds the named schemas and the shared error response
+type Components struct {
+	Schemas   map[string]*Schema  `json:"schemas"`
+	Responses map[string]Response `json:"responses,omitempty"`
+}
+
+// ErrorResponse is the name of the shared response every operation
+// answers failures with
+const ErrorResponse = "Error"
+
+// Content types
+const (
+	JSON = "application/json"
+	Text = "text/plain"
+	ZIP  = "application/zip"
+)
+
+// Endpoint declares one route for Build
+type Endpoint struct {
+	ID      string // operationId; the client method is named after it
+	Method  string
+	Path    string // With {name} path parameters
+	Tag     string
+	Summary string
+	Params  []Parameter // Query and header parameters; path parameters come from Path
+
+	// Request body, as a value of the type the handler decodes; nil for none
+	Body interface{}
+
+	Status    int   // Success status
+	AltStatus []int // Other statuses answered with the same body
+	WebSocket bool  // Upgraded to a WebSocket; no client method
+
+	// Response body, as a value of the type the handler encodes; nil for
+	// none. Bodies in other content types are documented as strings.
+	Response    interface{}
+	ContentType string            // Of Response; JSON if empty
+	Headers     map[string]string // Response headers, by name, with their descriptions
+}
+
+// Options are the document-wide parts of Build's output
+type Options struct {
+	Info Info
+	Tags []Tag
+
+	// Error is the body failed requests are answered with, as a value of
+	// its type; nil leaves failures undocumented
+	Error interface{}
+
+	// Unprefixed are the import paths of the packages whose types keep
+	// their own names as schema names. Types from other packages are
+	// prefixed with the package name, so jobs.Stats is JobsStats.
+	Unprefixed []string
+}
+
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// Build documents endpoints. It fails on duplicate routes or operation IDs
+// and on Go types that have no JSON schema.
+func Build(opts Options, endpoints []Endpoint) (*Document, error) {
+	g := newGenerator(opts.Unprefixed)
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    opts.Info,
+		Tags:    opts.Tags,
+		Paths:   map[string]PathItem{},
+	}
+
+	if opts.Error != nil {
+		schema, err := g.schemaOf(opts.Error)
+		if err != nil {
+			return nil, fmt.Errorf("error body: %w", err)
+		}
+		doc.Components.Responses = map[string]Response{
+			ErrorResponse: {
+				Description: "Error",
+				Content:     map[string]MediaType{JSON: {Schema: schema}},
+			},
+		}
+	}
+
+	ids := map[string]bool{}
+	for _, e := range endpoints {
+		if ids[e.ID] {
+			return nil, fmt.Errorf("duplicate operation ID %s", e.ID)
+		}
+		ids[e.ID] = true
+
+		op, err := g.operation(e, opts.Error != nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", e.Method, e.Path, err)
+		}
+		item := doc.Paths[e.Path]
+		if item == nil {
+			item = PathItem{}
+			doc.Paths[e.Path] = item
+		}
+		method := strings.ToLower(e.Method)
+		if item[method] != nil {
+			return nil, fmt.Errorf("duplicate route %s %s", e.Method, e.Path)
+		}
+		item[method] = op
+	}
+
+	doc.Components.Schemas = g.schemas
+	return doc, nil
+}
+
+func (g *generator) operation(e Endpoint, withErrors bool) (*Operation, error) {
+	op := &Operation{
+		OperationID: e.ID,
+		Summary:     e.Summary,
+		Responses:   map[string]Response{},
+	}
+	if e.Tag != "" {
+		op.Tags = []string{e.Tag}
+	}
+
+	for _, m := range pathParam.FindAllStringSubmatch(e.Path, -1) {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name: m[1], In: "path", Required: true, Schema: &Schema{Type: "string"},
+		})
+	}
+	op.Parameters = append(op.Parameters, e.Params...)
+
+	if e.Body != nil {
+		schema, err := g.schemaOf(e.Body)
+		if err != nil {
+			return nil, fmt.Errorf("request body: %w", err)
+		}
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{JSON: {Schema: schema}},
+		}
+	}
+
+	status := e.Status
+	if e.WebSocket {
+		status = http.StatusSwitchingProtocols
+	}
+	if status == 0 {
+		return nil, fmt.Errorf("no success status")
+	}
+	resp := Response{Description: http.StatusText(status)}
+	if e.Response != nil {
+		contentType := e.ContentType
+		if contentType == "" {
+			contentType = JSON
+		}
+		schema := &Schema{Type: "string"}
+		if contentType == JSON {
+			var err error
+			if schema, err = g.schemaOf(e.Response); err != nil {
+				return nil, fmt.Errorf("response body: %w", err)
+			}
+		} else if !strings.HasPrefix(contentType, "text/") {
+			schema.Format = "binary"
+		}
+		resp.Content = map[string]MediaType{contentType: {Schema: schema}}
+	}
+	if len(e.Headers) > 0 {
+		resp.Headers = map[string]Header{}
+		for name, description := range e.Headers {
+			resp.Headers[name] = Header{Description: description, Schema: &Schema{Type: "string"}}
+		}
+	}
+	op.Responses[strconv.Itoa(status)] = resp
+	for _, s := range e.AltStatus {
+		alt := resp
+		alt.Description = http.StatusText(s)
+		op.Responses[strconv.Itoa(s)] = alt
+	}
+
+	if withErrors && !e.WebSocket {
+		op.Responses["default"] = Response{Ref: "#/components/responses/" + ErrorResponse}
+	}
+	return op, nil
+}
+
+// Query declares a query parameter of a JSON Schema type ("string",
+// "integer", "number" or "boolean")
+func Query(name, typ, description string) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: &Schema{Type: typ}}
+}
+
+// RequiredQuery declares a query parameter that must be present
+func RequiredQuery(name, typ, description string) Parameter {
+	p := Query(name, typ, description)
+	p.Required = true
+	return p
+}
+
+// RequestHeader declares a string request header
+func RequestHeader(name, description string, required bool) Parameter {
+	return Parameter{Name: name, In: "header", Description: description, Required: required,
+		Schema: &Schema{Type: "string"}}
+}
+
+// Operations lists the document's operations by method and path, sorted
+// by path, then method, as "GET /users/{id}"
+func (d *Document) Operations() []string {
+	var ops []string
+	for path, item := range d.Paths {
+		for method := range item {
+			ops = append(ops, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		pi, pj := ops[i][strings.Index(ops[i], " ")+1:], ops[j][strings.Index(ops[j], " ")+1:]
+		if pi != pj {
+			return pi < pj
+		}
+		return ops[i] < ops[j]
+	})
+	return ops
+}
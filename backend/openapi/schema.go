@@ -0,0 +1,198 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	marshalerType  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textType       = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// generator collects the named schemas of the types it has seen
+type generator struct {
+	schemas    map[string]*Schema
+	types      map[string]reflect.Type
+	unprefixed map[string]bool // Package paths
+}
+
+func newGenerator(unprefixed []string) *generator {
+	g := &generator{schemas: map[string]*Schema{}, types: map[string]reflect.Type{}, unprefixed: map[string]bool{}}
+	for _, pkg := range unprefixed {
+		g.unprefixed[pkg] = true
+	}
+	return g
+}
+
+func (g *generator) schemaOf(v interface{}) (*Schema, error) {
+	return g.schema(reflect.TypeOf(v))
+}
+
+// schema maps t the way encoding/json encodes it
+func (g *generator) schema(t reflect.Type) (*Schema, error) {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}, nil
+	case rawMessageType:
+		return &Schema{}, nil
+	}
+	if t.Kind() != reflect.Ptr && (t.Implements(marshalerType) || t.Implements(textType)) {
+		return nil, fmt.Errorf("%s marshals itself; its schema is unknown", t)
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		elem, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return nullable(elem), nil
+	case reflect.Interface:
+		return &Schema{}, nil
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer"}, nil
+	case reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}, nil
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return &Schema{Type: "string", Format: "byte"}, nil
+		}
+		items, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("%s: only string map keys are supported", t)
+		}
+		values, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "object", AdditionalProperties: values}, nil
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		return g.ref(t)
+	}
+	return nil, fmt.Errorf("%s has no JSON schema", t)
+}
+
+// ref registers a named struct type under its schema name and refers to it
+func (g *generator) ref(t reflect.Type) (*Schema, error) {
+	name := g.schemaName(t)
+	ref := &Schema{Ref: "#/components/schemas/" + name}
+	if seen, ok := g.types[name]; ok {
+		if seen != t {
+			return nil, fmt.Errorf("schema %s is both %s and %s", name, seen, t)
+		}
+		return ref, nil
+	}
+
+	// Registered before its fields so recursive types terminate
+	g.types[name] = t
+	obj, err := g.object(t)
+	if err != nil {
+		return nil, err
+	}
+	g.schemas[name] = obj
+	return ref, nil
+}
+
+// object lists a struct's JSON properties. Fields without omitempty are
+// always encoded, so they are required (and nullable if they are pointers).
+func (g *generator) object(t reflect.Type) (*Schema, error) {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	if err := g.fields(t, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (g *generator) fields(t reflect.Type, s *Schema) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		// Untagged embedded structs are flattened into their parent
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if err := g.fields(ft, s); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop, err := g.schema(f.Type)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", t, f.Name, err)
+		}
+		if strings.Contains(","+opts+",", ",string,") {
+			prop = &Schema{Type: "string", Nullable: prop.Nullable}
+		}
+		s.Properties[name] = prop
+		if !strings.Contains(","+opts+",", ",omitempty,") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return nil
+}
+
+// nullable allows null in place of s. A reference can't carry nullable
+// itself in OpenAPI 3.0, so it is wrapped in allOf.
+func nullable(s *Schema) *Schema {
+	if s.Ref != "" {
+		return &Schema{AllOf: []*Schema{s}, Nullable: true}
+	}
+	if s.Type == "" {
+		return s // Already accepts null
+	}
+	n := *s
+	n.Nullable = true
+	return &n
+}
+
+// schemaName names a struct type's schema: its Go name, exported, prefixed
+// with its package name unless the package is unprefixed (Report in
+// package health is HealthReport)
+func (g *generator) schemaName(t reflect.Type) string {
+	name := GoName(t.Name())
+	if g.unprefixed[t.PkgPath()] {
+		return name
+	}
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	return GoName(pkg + "_" + name)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"streetsavvy-backend/openapi"
+
+	"github.com/gorilla/mux"
+)
+
+// Run with -update (or go generate) to rewrite the checked-in spec and client
+var update = flag.Bool("update", false, "rewrite client/openapi.json and client/client_gen.go")
+
+var (
+	specFile   = filepath.Join("client", "openapi.json")
+	clientFile = filepath.Join("client", "client_gen.go")
+)
+
+// TestOpenAPIRoutes checks that the spec documents exactly the routes
+// newRouter serves, and that the legacy /api routes mirror /api/v1
+func TestOpenAPIRoutes(t *testing.T) {
+	doc, err := buildOpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := map[string]bool{}
+	legacy := map[string]bool{}
+	err = newRouter().Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if route.GetHandler() == nil {
+			return nil // A subrouter's prefix
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{"GET"} // WebSocket upgrades match any method
+		}
+
+		isLegacy := strings.HasPrefix(path, "/api/") && !strings.HasPrefix(path, apiPrefix+"/") &&
+			path != "/api/openapi.json"
+		for _, m := range methods {
+			if isLegacy {
+				legacy[m+" "+apiPrefix+strings.TrimPrefix(path, "/api")] = true
+			} else {
+				routes[m+" "+path] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	documented := map[string]bool{}
+	for _, op := range doc.Operations() {
+		documented[op] = true
+	}
+	for _, op := range sortedKeys(routes) {
+		if !documented[op] {
+			t.Errorf("%s is routed but not in apiEndpoints or rootEndpoints", op)
+		}
+	}
+	for _, op := range sortedKeys(documented) {
+		if !routes[op] {
+			t.Errorf("%s is documented but not routed", op)
+		}
+	}
+
+	for _, op := range sortedKeys(legacy) {
+		if !routes[op] {
+			t.Errorf("legacy route %s has no /api/v1 equivalent", op)
+		}
+	}
+	for _, op := range sortedKeys(routes) {
+		if strings.Contains(op, " "+apiPrefix+"/") && !legacy[op] {
+			t.Errorf("%s has no legacy /api equivalent", op)
+		}
+	}
+}
+
+// TestOpenAPIGenerated checks that the checked-in spec and generated client
+// match the endpoint table
+func TestOpenAPIGenerated(t *testing.T) {
+	doc, err := buildOpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec = append(spec, '\n')
+	client, err := openapi.GenerateClient(doc, "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []struct {
+		path string
+		want []byte
+	}{
+		{specFile, spec},
+		{clientFile, client},
+	} {
+		if *update {
+			if err := os.WriteFile(f.path, f.want, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		got, err := os.ReadFile(f.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, f.want) {
+			t.Errorf("%s is out of date; run go generate in backend", f.path)
+		}
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,89 @@
+// Package otp generates one-time verification codes and delivers them to a
+// phone number. The Sender interface lets deployments plug in their SMS
+// gateway; LogSender stands in for it during local development.
+package otp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+const (
+	CodeLength  = 6
+	CodeTTL     = 5 * time.Minute
+	MaxAttempts = 5 // Wrong guesses before a challenge is void
+)
+
+// Sender delivers a code to a phone number in E.164 form
+type Sender interface {
+	Send(msisdn, code string) error
+}
+
+// NewCode returns a random numeric code of CodeLength digits
+func NewCode() (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(CodeLength), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", CodeLength, n), nil
+}
+
+// Hash is what gets stored for a code. The salt (the challenge ID) keeps
+// equal codes of different challenges from hashing alike.
+func Hash(salt, code string) string {
+	sum := sha256.Sum256([]byte(salt + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// Matches compares a submitted code against a stored hash in constant time
+func Matches(hash, salt, code string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(Hash(salt, code))) == 1
+}
+
+// LogSender writes codes to the server log instead of sending them. For
+// local development only.
+type LogSender struct{}
+
+// Send implements Sender
+func (LogSender) Send(msisdn, code string) error {
+	log.Printf("OTP for %s: %s (not sent, OTP_SENDER=log)", msisdn, code)
+	return nil
+}
+
+// WebhookSender POSTs {"msisdn": ..., "code": ...} to an SMS gateway
+type WebhookSender struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhookSender returns a Sender for the gateway at url
+func NewWebhookSender(url string) *WebhookSender {
+	return &WebhookSender{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Send implements Sender
+func (s *WebhookSender) Send(msisdn, code string) error {
+	body, err := json.Marshal(map[string]string{"msisdn": msisdn, "code": code})
+	if err != nil {
+		return err
+	}
+	resp, err := s.Client.Post(s.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("otp webhook returned %s", resp.Status)
+	}
+	return nil
+}
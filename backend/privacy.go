@@ -0,0 +1,594 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"streetsavvy-backend/config"
+	"streetsavvy-backend/models"
+	"streetsavvy-backend/tracing"
+
+	"github.com/gorilla/mux"
+)
+
+// Data subject rights: a ZIP export of everything held about a user, and
+// erasure requests that wait out a grace period before the erasure worker
+// removes the user's data. Vendor-facing counts survive erasure because the
+// user's engagements move to a fresh anonymous ID that nothing links back
+// to. Every step is written to privacy_audit_log.
+
+// erasureGracePeriod is set in main from ERASURE_GRACE_PERIOD
+var erasureGracePeriod = 72 * time.Hour
+
+// Audit log actions
+const (
+	auditExport           = "export"
+	auditAccountDeleted   = "account_deleted"
+	auditErasureRequested = "erasure_requested"
+	auditErasureCancelled = "erasure_cancelled"
+	auditErasureCompleted = "erasure_completed"
+	auditErasureFailed    = "erasure_failed"
+)
+
+// erasureRequest is one row of erasure_requests
+type erasureRequest struct {
+	RequestID    string     `json:"request_id"`
+	UserID       string     `json:"user_id"`
+	Status       string     `json:"status"`
+	RequestedAt  time.Time  `json:"requested_at"`
+	ScheduledFor time.Time  `json:"scheduled_for"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+}
+
+// exportUserDataHandler streams a ZIP of the user's profile, location
+// history, engagements and variant assignments: GET /api/users/{id}/export
+func exportUserDataHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["id"]
+
+	user, err := loadUser(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeUserNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		errorf(r, "Error loading user %s for export: %v", userID, err)
+		writeInternalError(w, r, "Failed to export user data")
+		return
+	}
+
+	// Audit first: an export that can't be recorded doesn't happen
+	if err := recordAudit(config.DB, userID, auditExport, r, nil); err != nil {
+		errorf(r, "Error auditing export for user %s: %v", userID, err)
+		writeInternalError(w, r, "Failed to export user data")
+		return
+	}
+
+	filename := fmt.Sprintf("streetsavvy-%s-%s.zip", userID, time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	// Headers go out with the first byte, so from here on failures can only
+	// be logged; the client gets a truncated archive that won't open.
+	zw := zip.NewWriter(w)
+	if err := writeUserExport(r.Context(), zw, user); err != nil {
+		errorf(r, "Error writing export for user %s: %v", userID, err)
+		return
+	}
+	if err := zw.Close(); err != nil {
+		errorf(r, "Error finishing export for user %s: %v", userID, err)
+		return
+	}
+	logf(r, "Exported data for user %s", userID)
+}
+
+// writeUserExport adds the export's files to the archive
+func writeUserExport(ctx context.Context, zw *zip.Writer, user *models.User) error {
+	f, err := zw.Create("README.txt")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(f, `StreetSavvy data export for user %s, created %s
+
+profile.json             your account and notification settings
+locations.csv            every location update we stored, with the nearest known address
+locations_hourly.csv     older location history, averaged per hour
+engagements.csv          campaigns you clicked or used, where and when
+variant_assignments.csv  which version of a campaign you were shown
+loyalty_points.csv       loyalty points earned for each offer you used
+loyalty_tier_history.csv when your loyalty tier changed and why
+affinities.csv           stores and store types we think you prefer, from the offers you used
+`, user.UserID, time.Now().UTC().Format(time.RFC3339))
+
+	f, err = zw.Create("profile.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(user); err != nil {
+		return err
+	}
+
+	exports := []struct {
+		name   string
+		header []string
+		query  string
+	}{
+		{
+			"locations.csv",
+			[]string{"location_id", "event_time", "lat", "lng", "idle_time", "address"},
+			`SELECT l.location_id, l.event_time, l.lat, l.long, l.idle_time,
+				NULLIF(CONCAT_WS(', ', NULLIF(CONCAT_WS(' ', a.housenumber, a.street), ''), a.city, a.postcode), '')
+			FROM user_location_events l
+			LEFT JOIN geocode_addresses a ON l.address_id = a.address_id
+			WHERE l.user_id = $1
+			ORDER BY l.event_time`,
+		},
+		{
+			"locations_hourly.csv",
+			[]string{"hour", "lat", "lng", "fixes"},
+			`SELECT hour, lat, long, fixes
+			FROM user_location_hourly
+			WHERE user_id = $1
+			ORDER BY hour`,
+		},
+		{
+			"engagements.csv",
+			[]string{"campaign_id", "campaign_title", "engagement_type", "engagement_time", "lat", "lng", "vendor_id", "variant_id"},
+			`SELECT e.campaign_id, c.title, e.engagement_type, e.engagement_time,
+				e.used_loc_lat, e.used_loc_long, COALESCE(e.vendor_id, c.vendor_id), e.variant_id
+			FROM campaign_user_engagements e
+			JOIN campaigns c ON e.campaign_id = c.campaign_id
+			WHERE e.user_id = $1
+			ORDER BY e.engagement_time`,
+		},
+		{
+			"variant_assignments.csv",
+			[]string{"campaign_id", "variant_id", "assigned_at"},
+			`SELECT campaign_id, variant_id, assigned_at
+			FROM campaign_variant_assignments
+			WHERE user_id = $1
+			ORDER BY assigned_at`,
+		},
+		{
+			"loyalty_points.csv",
+			[]string{"campaign_id", "vendor_id", "multiplier", "points", "earned_at"},
+			`SELECT campaign_id, vendor_id, multiplier, points, earned_at
+			FROM loyalty_points
+			WHERE user_id = $1
+			ORDER BY earned_at`,
+		},
+		{
+			"loyalty_tier_history.csv",
+			[]string{"old_tier", "new_tier", "points", "reason", "changed_at"},
+			`SELECT old_tier, new_tier, points, reason, changed_at
+			FROM loyalty_tier_history
+			WHERE user_id = $1
+			ORDER BY changed_at`,
+		},
+		{
+			"affinities.csv",
+			[]string{"kind", "key", "score", "uses", "last_used_at", "updated_at"},
+			`SELECT kind, key, score, uses, last_used_at, updated_at
+			FROM user_affinities
+			WHERE user_id = $1
+			ORDER BY kind, score DESC`,
+		},
+	}
+
+	for _, e := range exports {
+		f, err := zw.Create(e.name)
+		if err != nil {
+			return err
+		}
+		if err := writeQueryCSV(ctx, f, e.header, e.query, user.UserID); err != nil {
+			return fmt.Errorf("%s: %w", e.name, err)
+		}
+	}
+	return nil
+}
+
+// writeQueryCSV writes a header row and one row per result of query
+func writeQueryCSV(ctx context.Context, out interface{ Write([]byte) (int, error) }, header []string, query string, args ...interface{}) error {
+	rows, err := config.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cw := csv.NewWriter(out)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(header))
+	pointers := make([]interface{}, len(header))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	record := make([]string, len(header))
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		for i, v := range values {
+			record[i] = csvValue(v)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvValue formats a scanned column for CSV
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case []byte:
+		return string(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// requestErasureHandler schedules erasure of a user's data after the grace
+// period: POST /api/users/{id}/erasure. Asking again returns the open request.
+func requestErasureHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["id"]
+
+	if _, err := loadUser(r.Context(), userID); err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeUserNotFound, "User not found")
+		return
+	} else if err != nil {
+		errorf(r, "Error loading user %s: %v", userID, err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+
+	tx, err := config.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorf(r, "Error starting erasure transaction: %v", err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+	defer tx.Rollback()
+
+	var requestID string
+	err = tx.QueryRow(`
+		INSERT INTO erasure_requests (user_id, scheduled_for)
+		VALUES ($1, NOW() + $2::float8 * INTERVAL '1 second')
+		ON CONFLICT (user_id) WHERE status = 'pending' DO NOTHING
+		RETURNING request_id`,
+		userID, erasureGracePeriod.Seconds()).Scan(&requestID)
+	status := http.StatusAccepted
+	if err == sql.ErrNoRows {
+		// Already pending; nothing new to record
+		status = http.StatusOK
+	} else if err != nil {
+		errorf(r, "Error creating erasure request for user %s: %v", userID, err)
+		writeInternalError(w, r, "Failed to request erasure")
+		return
+	} else {
+		details := map[string]interface{}{"request_id": requestID}
+		if err := recordAudit(tx, userID, auditErasureRequested, r, details); err != nil {
+			errorf(r, "Error auditing erasure request for user %s: %v", userID, err)
+			writeInternalError(w, r, "Failed to request erasure")
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		errorf(r, "Error committing erasure request for user %s: %v", userID, err)
+		writeInternalError(w, r, "Failed to request erasure")
+		return
+	}
+
+	writeErasureRequest(w, r, userID, status)
+}
+
+// getErasureHandler returns the user's latest erasure request: GET /api/users/{id}/erasure
+func getErasureHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	writeErasureRequest(w, r, vars["id"], http.StatusOK)
+}
+
+// cancelErasureHandler withdraws a pending request during the grace period:
+// DELETE /api/users/{id}/erasure
+func cancelErasureHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["id"]
+
+	tx, err := config.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorf(r, "Error starting erasure transaction: %v", err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+	defer tx.Rollback()
+
+	var requestID string
+	err = tx.QueryRow(`
+		UPDATE erasure_requests SET status = 'cancelled'
+		WHERE user_id = $1 AND status = 'pending'
+		RETURNING request_id`, userID).Scan(&requestID)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeErasureNotFound, "No pending erasure request")
+		return
+	}
+	if err != nil {
+		errorf(r, "Error cancelling erasure for user %s: %v", userID, err)
+		writeInternalError(w, r, "Failed to cancel erasure")
+		return
+	}
+
+	details := map[string]interface{}{"request_id": requestID}
+	if err := recordAudit(tx, userID, auditErasureCancelled, r, details); err != nil {
+		errorf(r, "Error auditing erasure cancellation for user %s: %v", userID, err)
+		writeInternalError(w, r, "Failed to cancel erasure")
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		errorf(r, "Error committing erasure cancellation for user %s: %v", userID, err)
+		writeInternalError(w, r, "Failed to cancel erasure")
+		return
+	}
+
+	writeErasureRequest(w, r, userID, http.StatusOK)
+}
+
+// auditEntry is one privacy_audit_log row
+type auditEntry struct {
+	AuditID    int64           `json:"audit_id"`
+	Action     string          `json:"action"`
+	RemoteAddr string          `json:"remote_addr,omitempty"`
+	UserAgent  string          `json:"user_agent,omitempty"`
+	Details    json.RawMessage `json:"details"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// getPrivacyAuditHandler lists the audit trail for a user, including after
+// erasure: GET /api/users/{id}/audit
+func getPrivacyAuditHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["id"]
+
+	rows, err := config.DB.QueryContext(r.Context(), `
+		SELECT audit_id, action, COALESCE(remote_addr, ''), COALESCE(user_agent, ''),
+			COALESCE(details, '{}'::jsonb), created_at
+		FROM privacy_audit_log
+		WHERE user_id = $1
+		ORDER BY created_at, audit_id`, userID)
+	if err != nil {
+		errorf(r, "Error querying audit log for user %s: %v", userID, err)
+		writeInternalError(w, r, "Failed to load audit log")
+		return
+	}
+	defer rows.Close()
+
+	entries := []auditEntry{}
+	for rows.Next() {
+		var e auditEntry
+		var details []byte
+		if err := rows.Scan(&e.AuditID, &e.Action, &e.RemoteAddr, &e.UserAgent, &details, &e.CreatedAt); err != nil {
+			errorf(r, "Error scanning audit entry: %v", err)
+			continue
+		}
+		e.Details = details
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		errorf(r, "Error reading audit log for user %s: %v", userID, err)
+		writeInternalError(w, r, "Failed to load audit log")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// writeErasureRequest responds with the user's latest erasure request
+func writeErasureRequest(w http.ResponseWriter, r *http.Request, userID string, status int) {
+	var req erasureRequest
+	err := config.DB.QueryRowContext(r.Context(), `
+		SELECT request_id, user_id, status, requested_at, scheduled_for, completed_at
+		FROM erasure_requests
+		WHERE user_id = $1
+		ORDER BY requested_at DESC
+		LIMIT 1`, userID).Scan(
+		&req.RequestID, &req.UserID, &req.Status, &req.RequestedAt, &req.ScheduledFor, &req.CompletedAt)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeErasureNotFound, "No erasure request")
+		return
+	}
+	if err != nil {
+		errorf(r, "Error loading erasure request for user %s: %v", userID, err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(req)
+}
+
+// recordAudit appends to privacy_audit_log. r is nil for actions the
+// server takes on its own, which are recorded as coming from "server".
+func recordAudit(db execer, userID, action string, r *http.Request, details map[string]interface{}) error {
+	var detailsJSON []byte
+	if details != nil {
+		var err error
+		if detailsJSON, err = json.Marshal(details); err != nil {
+			return err
+		}
+	}
+
+	remoteAddr, userAgent := "server", ""
+	if r != nil {
+		remoteAddr, userAgent = r.RemoteAddr, r.UserAgent()
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO privacy_audit_log (user_id, action, remote_addr, user_agent, details)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5::jsonb)`,
+		userID, action, remoteAddr, userAgent, nullableJSON(detailsJSON))
+	return err
+}
+
+// nullableJSON turns empty JSON into SQL NULL
+func nullableJSON(b []byte) interface{} {
+	if len(b) == 0 {
+		return nil
+	}
+	return string(b)
+}
+
+// runErasureWorker carries out due erasure requests every interval until
+// ctx is cancelled. An erasure in progress is finished first.
+func runErasureWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			done, err := processNextErasure()
+			if err != nil {
+				log.Printf("Erasure worker error: %v", err)
+				break
+			}
+			if !done {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processNextErasure erases the user of one due request. Returns false when
+// nothing is due.
+func processNextErasure() (bool, error) {
+	// Not tied to the worker's context: a shutdown lets the erasure finish
+	ctx, span := tracing.Tracer().Start(context.Background(), "erasure")
+	defer span.End()
+
+	tx, err := config.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// SKIP LOCKED lets several server instances share the queue
+	var requestID, userID string
+	err = tx.QueryRow(`
+		SELECT request_id, user_id
+		FROM erasure_requests
+		WHERE status = 'pending' AND scheduled_for <= NOW()
+		ORDER BY scheduled_for
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED`).Scan(&requestID, &userID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	details := map[string]interface{}{"request_id": requestID}
+	if err := eraseUser(tx, userID); err != nil {
+		// Record the failure outside the rolled-back transaction and retry next pass
+		details["error"] = err.Error()
+		if auditErr := recordAudit(config.DB, userID, auditErasureFailed, nil, details); auditErr != nil {
+			log.Printf("Error auditing failed erasure for user %s: %v", userID, auditErr)
+		}
+		return false, fmt.Errorf("erasing user %s: %w", userID, err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE erasure_requests SET status = 'completed', completed_at = NOW()
+		WHERE request_id = $1`, requestID)
+	if err != nil {
+		return false, err
+	}
+	if err := recordAudit(tx, userID, auditErasureCompleted, nil, details); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	log.Printf("Erased data of user %s (request %s)", userID, requestID)
+	return true, nil
+}
+
+// eraseUser irreversibly removes a user. Engagements and variant
+// assignments are moved to a new anonymous users row, with no record of the
+// old ID, so vendor click/use counts and distinct-user counts stay the same;
+// their coordinates are coarsened to ~1km and times to the hour. Everything
+// else is deleted.
+func eraseUser(tx *sql.Tx, userID string) error {
+	var msisdn sql.NullString
+	err := tx.QueryRow(`SELECT msisdn FROM users WHERE user_id = $1 FOR UPDATE`, userID).Scan(&msisdn)
+	if err == sql.ErrNoRows {
+		return nil // Already gone
+	}
+	if err != nil {
+		return err
+	}
+
+	var anonymousID string
+	err = tx.QueryRow(`
+		INSERT INTO users (created_at, deleted_at) VALUES (NULL, NOW())
+		RETURNING user_id`).Scan(&anonymousID)
+	if err != nil {
+		return err
+	}
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`UPDATE campaign_user_engagements
+			SET user_id = $2,
+				used_loc_lat = ROUND(used_loc_lat::numeric, 2),
+				used_loc_long = ROUND(used_loc_long::numeric, 2),
+				engagement_time = DATE_TRUNC('hour', engagement_time)
+			WHERE user_id = $1`, []interface{}{userID, anonymousID}},
+		{`UPDATE campaign_variant_assignments SET user_id = $2 WHERE user_id = $1`, []interface{}{userID, anonymousID}},
+		{`DELETE FROM user_location_events WHERE user_id = $1`, []interface{}{userID}},
+		{`DELETE FROM user_location_hourly WHERE user_id = $1`, []interface{}{userID}},
+		{`DELETE FROM otp_challenges WHERE user_id = $1 OR msisdn = $2`, []interface{}{userID, msisdn.String}},
+		{`DELETE FROM users WHERE user_id = $1`, []interface{}{userID}},
+	}
+	for _, s := range statements {
+		if _, err := tx.Exec(s.query, s.args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
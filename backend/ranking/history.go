@@ -0,0 +1,58 @@
+package ranking
+
+import (
+	"database/sql"
+	"time"
+)
+
+// LoadUser reads a user's segments and per-vendor engagement history as of
+// asOf, so live requests and offline replays build the same context.
+// Segments come from the users row as it is now; only engagements are
+// cut off at asOf.
+func LoadUser(db *sql.DB, userID string, asOf time.Time) (User, error) {
+	user := User{
+		UserID:  userID,
+		Vendors: make(map[string]VendorHistory),
+		Now:     asOf,
+	}
+
+	var tier, vendor, vendorType sql.NullString
+	err := db.QueryRow(`
+		SELECT loyalty_tier, most_frequent_vendor, most_frequent_vendor_type
+		FROM users
+		WHERE user_id = $1`, userID).Scan(&tier, &vendor, &vendorType)
+	if err != nil && err != sql.ErrNoRows {
+		return user, err
+	}
+	user.LoyaltyTier = tier.String
+	user.MostFrequentVendor = vendor.String
+	user.MostFrequentVendorType = vendorType.String
+
+	// Keyed by the store engaged with, like candidates' VendorID; rows from
+	// before engagements recorded their store fall back to the campaign's
+	rows, err := db.Query(`
+		SELECT
+			COALESCE(e.vendor_id, c.vendor_id),
+			COUNT(*) FILTER (WHERE e.engagement_type = 'clicked'),
+			COUNT(*) FILTER (WHERE e.engagement_type = 'used'),
+			MAX(e.engagement_time)
+		FROM campaign_user_engagements e
+		JOIN campaigns c ON e.campaign_id = c.campaign_id
+		WHERE e.user_id = $1 AND e.engagement_time < $2
+		GROUP BY COALESCE(e.vendor_id, c.vendor_id)`, userID, asOf)
+	if err != nil {
+		return user, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var vendorID string
+		var h VendorHistory
+		if err := rows.Scan(&vendorID, &h.Clicks, &h.Uses, &h.LastEngagedAt); err != nil {
+			return user, err
+		}
+		user.Vendors[vendorID] = h
+	}
+
+	return user, rows.Err()
+}
@@ -0,0 +1,256 @@
+// Package ranking orders candidate campaigns for a user. The Ranker
+// interface lets deployments swap the scoring strategy; ScoreRanker is the
+// default weighted blend of distance, affinity, engagement and timing.
+package ranking
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Candidate is a campaign that could be shown to the user
+type Candidate struct {
+	CampaignID     string    `json:"campaign_id"`
+	VendorID       string    `json:"vendor_id"`
+	VendorType     string    `json:"vendor_type"`
+	SegmentName    string    `json:"segment_name"` // e.g. "loyalty_tier_gold"
+	DistanceMeters float64   `json:"distance_meters"`
+	StartDate      time.Time `json:"start_date"`
+	EndDate        time.Time `json:"end_date"`
+}
+
+// VendorHistory is what the user has done with one vendor's campaigns so far
+type VendorHistory struct {
+	Clicks        int
+	Uses          int
+	LastEngagedAt time.Time
+}
+
+// User is the personalization context for a ranking request
+type User struct {
+	UserID                 string
+	LoyaltyTier            string
+	MostFrequentVendor     string
+	MostFrequentVendorType string
+	Vendors                map[string]VendorHistory // keyed by vendor ID
+	Now                    time.Time
+}
+
+// Factor is one term of a score, kept so clients can show why an item ranked where it did
+type Factor struct {
+	Name         string  `json:"name"`
+	Value        float64 `json:"value"` // Normalized 0..1
+	Weight       float64 `json:"weight"`
+	Contribution float64 `json:"contribution"` // Value * Weight
+	Reason       string  `json:"reason,omitempty"`
+}
+
+// Ranked is a candidate with its score and explanation
+type Ranked struct {
+	Candidate
+	Score       float64  `json:"score"`
+	Explanation []Factor `json:"explanation"`
+}
+
+// Ranker orders candidates for a user, best first
+type Ranker interface {
+	Rank(user User, candidates []Candidate) []Ranked
+}
+
+// Weights scale each factor of ScoreRanker. Zero disables a factor.
+type Weights struct {
+	Distance   float64
+	Affinity   float64
+	Loyalty    float64
+	Engagement float64
+	Recency    float64
+	Expiry     float64
+}
+
+// DefaultWeights favours proximity, then the user's habits
+func DefaultWeights() Weights {
+	return Weights{
+		Distance:   0.40,
+		Affinity:   0.20,
+		Loyalty:    0.10,
+		Engagement: 0.15,
+		Recency:    0.05,
+		Expiry:     0.10,
+	}
+}
+
+// Tuning constants for turning raw signals into 0..1 values
+const (
+	distanceHalfScoreMeters = 500.0 // Distance at which the distance value is 0.5
+	engagementSaturation    = 3.0   // Weighted engagements for ~63% of the engagement value
+	clickWeight             = 0.25  // A click counts as a quarter of a use
+	recencyDecayDays        = 14.0  // e-folding time of the recency value
+	expiryUrgencyDays       = 3.0   // e-folding time of the expiry value
+)
+
+// ScoreRanker scores each candidate as a weighted sum of normalized factors
+type ScoreRanker struct {
+	Weights Weights
+}
+
+// NewScoreRanker returns the default ranker with the given weights
+func NewScoreRanker(w Weights) *ScoreRanker {
+	return &ScoreRanker{Weights: w}
+}
+
+// Rank implements Ranker. Ties are broken by distance, then campaign ID,
+// so the order is deterministic.
+func (s *ScoreRanker) Rank(user User, candidates []Candidate) []Ranked {
+	ranked := make([]Ranked, len(candidates))
+	for i, c := range candidates {
+		factors := s.factors(user, c)
+		score := 0.0
+		for _, f := range factors {
+			score += f.Contribution
+		}
+		ranked[i] = Ranked{Candidate: c, Score: round(score), Explanation: factors}
+	}
+
+	sortRanked(ranked)
+	return ranked
+}
+
+func (s *ScoreRanker) factors(user User, c Candidate) []Factor {
+	w := s.Weights
+	now := user.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	var factors []Factor
+	add := func(name string, value, weight float64, reason string) {
+		if weight == 0 {
+			return
+		}
+		factors = append(factors, Factor{
+			Name:         name,
+			Value:        round(value),
+			Weight:       weight,
+			Contribution: round(value * weight),
+			Reason:       reason,
+		})
+	}
+
+	// Distance: 1 at the door, 0.5 at distanceHalfScoreMeters
+	add("distance",
+		1/(1+c.DistanceMeters/distanceHalfScoreMeters),
+		w.Distance,
+		fmt.Sprintf("%.0fm away", c.DistanceMeters))
+
+	// Segment affinity: the user's favourite vendor, or at least vendor type
+	switch {
+	case c.VendorID != "" && c.VendorID == user.MostFrequentVendor:
+		add("affinity", 1, w.Affinity, "your most visited vendor")
+	case c.VendorType != "" && strings.EqualFold(c.VendorType, user.MostFrequentVendorType):
+		add("affinity", 0.6, w.Affinity, "a "+c.VendorType+" like you usually visit")
+	default:
+		add("affinity", 0, w.Affinity, "")
+	}
+
+	// Loyalty: campaign targets the user's tier
+	if user.LoyaltyTier != "" && c.SegmentName == "loyalty_tier_"+user.LoyaltyTier {
+		add("loyalty", 1, w.Loyalty, user.LoyaltyTier+" member offer")
+	} else {
+		add("loyalty", 0, w.Loyalty, "")
+	}
+
+	// Past engagement and its recency with this vendor
+	history := user.Vendors[c.VendorID]
+	weighted := float64(history.Uses) + clickWeight*float64(history.Clicks)
+	add("engagement",
+		1-math.Exp(-weighted/engagementSaturation),
+		w.Engagement,
+		engagementReason(history))
+
+	recency := 0.0
+	if !history.LastEngagedAt.IsZero() {
+		days := now.Sub(history.LastEngagedAt).Hours() / 24
+		recency = math.Exp(-math.Max(days, 0) / recencyDecayDays)
+	}
+	add("recency", recency, w.Recency, "")
+
+	// Expiry: campaigns about to end are more urgent
+	expiry := 0.0
+	reason := ""
+	if !c.EndDate.IsZero() {
+		// end_date is inclusive, so the campaign runs until the end of that day
+		daysLeft := c.EndDate.AddDate(0, 0, 1).Sub(now).Hours() / 24
+		expiry = math.Exp(-math.Max(daysLeft, 0) / expiryUrgencyDays)
+		if daysLeft < 1 {
+			reason = "ends today"
+		} else if daysLeft < expiryUrgencyDays {
+			reason = fmt.Sprintf("ends in %.0f days", math.Ceil(daysLeft))
+		}
+	}
+	add("expiry", expiry, w.Expiry, reason)
+
+	return factors
+}
+
+func engagementReason(h VendorHistory) string {
+	if h.Uses == 0 && h.Clicks == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d uses, %d clicks here before", h.Uses, h.Clicks)
+}
+
+// New returns the ranker registered under name: "score" (the default) or
+// "distance"
+func New(name string, w Weights) (Ranker, error) {
+	switch name {
+	case "", "score":
+		return NewScoreRanker(w), nil
+	case "distance":
+		return DistanceRanker{}, nil
+	}
+	return nil, fmt.Errorf("unknown ranker %q", name)
+}
+
+// DistanceRanker is the baseline ordering: nearest first
+type DistanceRanker struct{}
+
+// Rank implements Ranker. The score is the negated distance in meters.
+func (DistanceRanker) Rank(user User, candidates []Candidate) []Ranked {
+	ranked := make([]Ranked, len(candidates))
+	for i, c := range candidates {
+		ranked[i] = Ranked{
+			Candidate: c,
+			Score:     -c.DistanceMeters,
+			Explanation: []Factor{{
+				Name:         "distance",
+				Value:        c.DistanceMeters,
+				Weight:       -1,
+				Contribution: -c.DistanceMeters,
+				Reason:       fmt.Sprintf("%.0fm away", c.DistanceMeters),
+			}},
+		}
+	}
+
+	sortRanked(ranked)
+	return ranked
+}
+
+// sortRanked orders by score descending, then distance, then campaign ID
+func sortRanked(ranked []Ranked) {
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		if ranked[i].DistanceMeters != ranked[j].DistanceMeters {
+			return ranked[i].DistanceMeters < ranked[j].DistanceMeters
+		}
+		return ranked[i].CampaignID < ranked[j].CampaignID
+	})
+}
+
+func round(x float64) float64 {
+	return math.Round(x*10000) / 10000
+}
@@ -0,0 +1,132 @@
+package ranking
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 5, 10, 12, 0, 0, 0, time.UTC)
+
+func factor(t *testing.T, r Ranked, name string) Factor {
+	t.Helper()
+	for _, f := range r.Explanation {
+		if f.Name == name {
+			return f
+		}
+	}
+	t.Fatalf("%s has no %s factor: %+v", r.CampaignID, name, r.Explanation)
+	return Factor{}
+}
+
+func TestScoreRankerFactors(t *testing.T) {
+	user := User{
+		LoyaltyTier:            "gold",
+		MostFrequentVendor:     "V1",
+		MostFrequentVendorType: "Cafe",
+		Vendors: map[string]VendorHistory{
+			"V1": {Uses: 3, LastEngagedAt: now.AddDate(0, 0, -14)},
+		},
+		Now: now,
+	}
+
+	for _, tc := range []struct {
+		name   string
+		c      Candidate
+		factor string
+		value  float64
+		reason string
+	}{
+		{"at the door", Candidate{DistanceMeters: 0}, "distance", 1, "0m away"},
+		{"half score distance", Candidate{DistanceMeters: 500}, "distance", 0.5, "500m away"},
+		{"favourite vendor", Candidate{VendorID: "V1"}, "affinity", 1, "your most visited vendor"},
+		{"favourite type", Candidate{VendorID: "V2", VendorType: "cafe"}, "affinity", 0.6, "a cafe like you usually visit"},
+		{"no affinity", Candidate{VendorID: "V2", VendorType: "bakery"}, "affinity", 0, ""},
+		{"tier offer", Candidate{SegmentName: "loyalty_tier_gold"}, "loyalty", 1, "gold member offer"},
+		{"other tier", Candidate{SegmentName: "loyalty_tier_silver"}, "loyalty", 0, ""},
+		{"engaged vendor", Candidate{VendorID: "V1"}, "engagement", round(1 - math.Exp(-1)), "3 uses, 0 clicks here before"},
+		{"new vendor", Candidate{VendorID: "V2"}, "engagement", 0, ""},
+		{"recent engagement", Candidate{VendorID: "V1"}, "recency", round(math.Exp(-1)), ""},
+		{"no engagement", Candidate{VendorID: "V2"}, "recency", 0, ""},
+		{"ends today", Candidate{EndDate: time.Date(2026, 5, 10, 0, 0, 0, 0, time.UTC)}, "expiry", round(math.Exp(-0.5 / 3)), "ends today"},
+		{"ends in two days", Candidate{EndDate: time.Date(2026, 5, 11, 0, 0, 0, 0, time.UTC)}, "expiry", round(math.Exp(-1.5 / 3)), "ends in 2 days"},
+		{"ended", Candidate{EndDate: time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)}, "expiry", 1, "ends today"},
+		{"open ended", Candidate{}, "expiry", 0, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ranked := NewScoreRanker(DefaultWeights()).Rank(user, []Candidate{tc.c})
+			f := factor(t, ranked[0], tc.factor)
+			if f.Value != tc.value || f.Reason != tc.reason {
+				t.Errorf("%s = %v %q, want %v %q", tc.factor, f.Value, f.Reason, tc.value, tc.reason)
+			}
+			if math.Abs(f.Contribution-f.Value*f.Weight) > 0.0001 {
+				t.Errorf("contribution %v != value %v * weight %v", f.Contribution, f.Value, f.Weight)
+			}
+		})
+	}
+}
+
+func TestScoreRankerSkipsZeroWeights(t *testing.T) {
+	ranked := NewScoreRanker(Weights{Distance: 1}).Rank(User{Now: now}, []Candidate{{DistanceMeters: 500}})
+	if len(ranked[0].Explanation) != 1 || ranked[0].Score != 0.5 {
+		t.Errorf("got score %v with %+v, want 0.5 from distance only", ranked[0].Score, ranked[0].Explanation)
+	}
+}
+
+func TestRankOrder(t *testing.T) {
+	candidates := []Candidate{
+		{CampaignID: "C4", DistanceMeters: 100},
+		{CampaignID: "C3", DistanceMeters: 50},
+		{CampaignID: "C2", DistanceMeters: 50},
+		{CampaignID: "C1", DistanceMeters: 900},
+	}
+	for _, tc := range []struct {
+		name   string
+		ranker Ranker
+		want   []string
+	}{
+		// Equal distances tie on score and fall back to campaign ID
+		{"score", NewScoreRanker(Weights{Distance: 1}), []string{"C2", "C3", "C4", "C1"}},
+		{"distance", DistanceRanker{}, []string{"C2", "C3", "C4", "C1"}},
+		// Every score is zero, so distance decides
+		{"no weights", NewScoreRanker(Weights{}), []string{"C2", "C3", "C4", "C1"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ranked := tc.ranker.Rank(User{Now: now}, candidates)
+			for i, id := range tc.want {
+				if ranked[i].CampaignID != id {
+					t.Fatalf("position %d = %s, want %s", i, ranked[i].CampaignID, id)
+				}
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		want    Ranker
+		wantErr bool
+	}{
+		{"", &ScoreRanker{}, false},
+		{"score", &ScoreRanker{}, false},
+		{"distance", DistanceRanker{}, false},
+		{"random", nil, true},
+	} {
+		r, err := New(tc.name, Weights{})
+		if (err != nil) != tc.wantErr {
+			t.Errorf("New(%q) error = %v", tc.name, err)
+			continue
+		}
+		switch tc.want.(type) {
+		case *ScoreRanker:
+			if _, ok := r.(*ScoreRanker); !ok {
+				t.Errorf("New(%q) = %T, want *ScoreRanker", tc.name, r)
+			}
+		case DistanceRanker:
+			if _, ok := r.(DistanceRanker); !ok {
+				t.Errorf("New(%q) = %T, want DistanceRanker", tc.name, r)
+			}
+		}
+	}
+}
@@ -0,0 +1,332 @@
+// Package retention prunes the user location trail. Raw fixes are kept for
+// Policy.RawDays, then folded into hourly centroids in user_location_hourly;
+// centroids are kept until Policy.HourlyDays. user_location_events is
+// partitioned by month (database/migrations/009_location_retention.sql), so
+// months that fall entirely out of the raw window are dropped rather than
+// deleted row by row.
+package retention
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Policy is how long location data is kept
+type Policy struct {
+	RawDays     int  // Raw fixes older than this are downsampled
+	HourlyDays  int  // Hourly centroids (and any raw fixes) older than this are deleted
+	DryRun      bool // Report what would happen without changing anything
+	MonthsAhead int  // Future monthly partitions to keep created
+}
+
+// DefaultPolicy keeps a month of raw fixes and a year of hourly centroids
+func DefaultPolicy() Policy {
+	return Policy{RawDays: 30, HourlyDays: 365, MonthsAhead: 3}
+}
+
+// Validate checks the windows make sense together
+func (p Policy) Validate() error {
+	if p.RawDays < 1 {
+		return fmt.Errorf("raw retention must be at least 1 day")
+	}
+	if p.HourlyDays < p.RawDays {
+		return fmt.Errorf("hourly retention (%d days) must not be shorter than raw retention (%d days)", p.HourlyDays, p.RawDays)
+	}
+	return nil
+}
+
+// Report is what one run did, or would do in a dry run
+type Report struct {
+	DryRun             bool      `json:"dry_run"`
+	StartedAt          time.Time `json:"started_at"`
+	DurationMs         int64     `json:"duration_ms"`
+	RawCutoff          time.Time `json:"raw_cutoff"`
+	HourlyCutoff       time.Time `json:"hourly_cutoff"`
+	PartitionsCreated  int       `json:"partitions_created"`
+	PartitionsDropped  []string  `json:"partitions_dropped"`
+	RawRowsDownsampled int64     `json:"raw_rows_downsampled"` // Folded into centroids
+	RawRowsDeleted     int64     `json:"raw_rows_deleted"`     // Including those folded into centroids
+	HourlyRowsWritten  int64     `json:"hourly_rows_written"`
+	HourlyRowsDeleted  int64     `json:"hourly_rows_deleted"`
+}
+
+// partitionName matches the monthly partitions created by ensure_location_partitions
+var partitionName = regexp.MustCompile(`^user_location_events_p(\d{6})$`)
+
+// Run applies the policy as of now. Each step commits on its own, so an
+// interrupted run leaves consistent data and the next run picks up the rest.
+func Run(db *sql.DB, p Policy, now time.Time) (Report, error) {
+	r := Report{
+		DryRun:            p.DryRun,
+		StartedAt:         now,
+		RawCutoff:         now.AddDate(0, 0, -p.RawDays).Truncate(time.Hour),
+		HourlyCutoff:      now.AddDate(0, 0, -p.HourlyDays).Truncate(time.Hour),
+		PartitionsDropped: []string{},
+	}
+	if err := p.Validate(); err != nil {
+		return r, err
+	}
+
+	start := time.Now()
+	err := run(db, p, now, &r)
+	r.DurationMs = time.Since(start).Milliseconds()
+	return r, err
+}
+
+func run(db *sql.DB, p Policy, now time.Time, r *Report) error {
+	if !p.DryRun && p.MonthsAhead > 0 {
+		err := db.QueryRow(`SELECT ensure_location_partitions($1::date, $2)`,
+			now.Format("2006-01-02"), p.MonthsAhead).Scan(&r.PartitionsCreated)
+		if err != nil {
+			return fmt.Errorf("creating partitions: %w", err)
+		}
+	}
+
+	partitions, err := expiredPartitions(db, r.RawCutoff)
+	if err != nil {
+		return fmt.Errorf("listing partitions: %w", err)
+	}
+	for _, name := range partitions {
+		if err := prunePartition(db, p.DryRun, name, r.HourlyCutoff, r); err != nil {
+			return fmt.Errorf("pruning %s: %w", name, err)
+		}
+	}
+
+	// Whatever is left below the raw cutoff sits in partitions still in use
+	if err := pruneRows(db, p.DryRun, r.RawCutoff, r.HourlyCutoff, partitions, r); err != nil {
+		return fmt.Errorf("pruning raw fixes: %w", err)
+	}
+
+	if err := pruneHourly(db, p.DryRun, r.HourlyCutoff, r); err != nil {
+		return fmt.Errorf("pruning hourly centroids: %w", err)
+	}
+	return nil
+}
+
+// expiredPartitions lists monthly partitions that end on or before cutoff,
+// oldest first
+func expiredPartitions(db *sql.DB, cutoff time.Time) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'user_location_events'::regclass`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expired []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if partitionExpired(name, cutoff) {
+			expired = append(expired, name)
+		}
+	}
+	sort.Strings(expired)
+	return expired, rows.Err()
+}
+
+// partitionExpired reports whether name is a monthly partition whose month
+// ends on or before cutoff
+func partitionExpired(name string, cutoff time.Time) bool {
+	m := partitionName.FindStringSubmatch(name)
+	if m == nil {
+		return false // The default partition is pruned row by row
+	}
+	start, err := time.Parse("200601", m[1])
+	if err != nil {
+		return false
+	}
+	return !start.AddDate(0, 1, 0).After(cutoff)
+}
+
+// prunePartition folds a whole expired month into centroids and drops it.
+// name comes from pg_class and matched partitionName, so it is safe to
+// splice into SQL.
+func prunePartition(db *sql.DB, dryRun bool, name string, hourlyCutoff time.Time, r *Report) error {
+	var rows, buckets int64
+	err := db.QueryRow(`
+		SELECT COUNT(*),
+			COUNT(DISTINCT (user_id, date_trunc('hour', event_time))) FILTER (WHERE event_time >= $1 AND user_id IS NOT NULL)
+		FROM `+name, hourlyCutoff).Scan(&rows, &buckets)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		r.RawRowsDeleted += rows
+		r.HourlyRowsWritten += buckets
+		r.PartitionsDropped = append(r.PartitionsDropped, name)
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	written, downsampled, err := downsample(tx, `FROM `+name+` WHERE event_time >= $1`, hourlyCutoff)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DROP TABLE ` + name); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	r.HourlyRowsWritten += written
+	r.RawRowsDownsampled += downsampled
+	r.RawRowsDeleted += rows
+	r.PartitionsDropped = append(r.PartitionsDropped, name)
+	return nil
+}
+
+// pruneRows downsamples and deletes raw fixes older than rawCutoff that live
+// in partitions still in use. A dry run leaves out the expired partitions,
+// which prunePartition has already counted.
+func pruneRows(db *sql.DB, dryRun bool, rawCutoff, hourlyCutoff time.Time, expired []string, r *Report) error {
+	if dryRun {
+		var rows, buckets int64
+		err := db.QueryRow(`
+			SELECT COUNT(*),
+				COUNT(DISTINCT (user_id, date_trunc('hour', event_time))) FILTER (WHERE event_time >= $2 AND user_id IS NOT NULL)
+			FROM user_location_events
+			WHERE event_time < $1
+			  AND tableoid::regclass::text <> ALL($3)`,
+			rawCutoff, hourlyCutoff, pq.Array(expired)).Scan(&rows, &buckets)
+		if err != nil {
+			return err
+		}
+		r.RawRowsDeleted += rows
+		r.HourlyRowsWritten += buckets
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	written, downsampled, err := downsample(tx,
+		`FROM user_location_events WHERE event_time >= $1 AND event_time < $2`, hourlyCutoff, rawCutoff)
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec(`DELETE FROM user_location_events WHERE event_time < $1`, rawCutoff)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	deleted, _ := result.RowsAffected()
+	r.HourlyRowsWritten += written
+	r.RawRowsDownsampled += downsampled
+	r.RawRowsDeleted += deleted
+	return nil
+}
+
+// pruneHourly deletes centroids past the horizon
+func pruneHourly(db *sql.DB, dryRun bool, hourlyCutoff time.Time, r *Report) error {
+	if dryRun {
+		return db.QueryRow(`SELECT COUNT(*) FROM user_location_hourly WHERE hour < $1`,
+			hourlyCutoff).Scan(&r.HourlyRowsDeleted)
+	}
+
+	result, err := db.Exec(`DELETE FROM user_location_hourly WHERE hour < $1`, hourlyCutoff)
+	if err != nil {
+		return err
+	}
+	r.HourlyRowsDeleted, _ = result.RowsAffected()
+	return nil
+}
+
+// downsample merges the fixes selected by source ("FROM ... WHERE ...") into
+// hourly centroids. A bucket that already exists is merged weighted by its
+// number of fixes. Returns the buckets written and fixes folded in.
+func downsample(tx *sql.Tx, source string, args ...interface{}) (written, fixes int64, err error) {
+	err = tx.QueryRow(`
+		WITH buckets AS (
+			SELECT user_id, date_trunc('hour', event_time) AS hour, AVG(lat) AS lat, AVG(long) AS long, COUNT(*) AS fixes
+			`+source+` AND user_id IS NOT NULL
+			GROUP BY user_id, date_trunc('hour', event_time)
+		), merged AS (
+			INSERT INTO user_location_hourly AS h (user_id, hour, lat, long, fixes)
+			SELECT user_id, hour, lat, long, fixes FROM buckets
+			ON CONFLICT (user_id, hour) DO UPDATE
+			SET lat = (h.lat * h.fixes + EXCLUDED.lat * EXCLUDED.fixes) / (h.fixes + EXCLUDED.fixes),
+				long = (h.long * h.fixes + EXCLUDED.long * EXCLUDED.fixes) / (h.fixes + EXCLUDED.fixes),
+				fixes = h.fixes + EXCLUDED.fixes
+			RETURNING 1
+		)
+		SELECT (SELECT COUNT(*) FROM merged), (SELECT COALESCE(SUM(fixes), 0) FROM buckets)`,
+		args...).Scan(&written, &fixes)
+	return written, fixes, err
+}
+
+// Totals are the counters kept by Stats
+type Totals struct {
+	Runs               int64     `json:"runs"`
+	Failures           int64     `json:"failures"`
+	LastRunAt          time.Time `json:"last_run_at"`
+	LastError          string    `json:"last_error,omitempty"`
+	LastReport         *Report   `json:"last_report,omitempty"`
+	RawRowsDeleted     int64     `json:"raw_rows_deleted_total"`
+	RawRowsDownsampled int64     `json:"raw_rows_downsampled_total"`
+	HourlyRowsWritten  int64     `json:"hourly_rows_written_total"`
+	HourlyRowsDeleted  int64     `json:"hourly_rows_deleted_total"`
+	PartitionsDropped  int64     `json:"partitions_dropped_total"`
+}
+
+// Stats accumulates results across runs for monitoring. Safe for
+// concurrent use.
+type Stats struct {
+	mu     sync.Mutex
+	totals Totals
+}
+
+// Record adds a run's outcome. Dry runs don't count towards the row totals.
+func (s *Stats) Record(r Report, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := &s.totals
+	t.Runs++
+	t.LastRunAt = r.StartedAt
+	t.LastReport = &r
+	t.LastError = ""
+	if err != nil {
+		t.Failures++
+		t.LastError = err.Error()
+	}
+	if r.DryRun {
+		return
+	}
+	t.RawRowsDeleted += r.RawRowsDeleted
+	t.RawRowsDownsampled += r.RawRowsDownsampled
+	t.HourlyRowsWritten += r.HourlyRowsWritten
+	t.HourlyRowsDeleted += r.HourlyRowsDeleted
+	t.PartitionsDropped += int64(len(r.PartitionsDropped))
+}
+
+// Snapshot returns the current totals
+func (s *Stats) Snapshot() Totals {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.totals
+}
@@ -0,0 +1,59 @@
+package retention
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy Policy
+		valid  bool
+	}{
+		{"default", DefaultPolicy(), true},
+		{"one day each", Policy{RawDays: 1, HourlyDays: 1}, true},
+		{"no partitions ahead", Policy{RawDays: 30, HourlyDays: 365, MonthsAhead: 0}, true},
+		{"zero raw days", Policy{RawDays: 0, HourlyDays: 365}, false},
+		{"negative raw days", Policy{RawDays: -1, HourlyDays: 365}, false},
+		{"hourly shorter than raw", Policy{RawDays: 30, HourlyDays: 29}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.policy.Validate(); (err == nil) != tc.valid {
+				t.Errorf("Validate() = %v, want valid %v", err, tc.valid)
+			}
+		})
+	}
+}
+
+func TestPartitionExpired(t *testing.T) {
+	// March 2026 ends at the start of April
+	endOfMarch := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		partition string
+		cutoff    time.Time
+		want      bool
+	}{
+		{"month ends at the cutoff", "user_location_events_p202603", endOfMarch, true},
+		{"month ends a second after the cutoff", "user_location_events_p202603", endOfMarch.Add(-time.Second), false},
+		{"month ended before the cutoff", "user_location_events_p202602", endOfMarch, true},
+		{"cutoff inside the month", "user_location_events_p202604", endOfMarch.AddDate(0, 0, 15), false},
+		{"same instant in another zone", "user_location_events_p202603", endOfMarch.In(chicago), true},
+		{"end of year", "user_location_events_p202512", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"default partition", "user_location_events_default", endOfMarch, false},
+		{"not a month", "user_location_events_p202613", time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), false},
+		{"other table", "user_location_hourly_p202601", endOfMarch, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := partitionExpired(tc.partition, tc.cutoff); got != tc.want {
+				t.Errorf("partitionExpired(%s, %s) = %v, want %v", tc.partition, tc.cutoff, got, tc.want)
+			}
+		})
+	}
+}
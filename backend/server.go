@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"streetsavvy-backend/config"
+
+	"github.com/gorilla/websocket"
+)
+
+// Server lifecycle: main serves until SIGINT or SIGTERM cancels its
+// context, then stops accepting connections, sends WebSocket clients a
+// close frame, and gives in-flight requests and background workers up to
+// ServerConfig.ShutdownTimeout to finish.
+
+// wsCloseTimeout bounds writing the close frame to one WebSocket client
+const wsCloseTimeout = time.Second
+
+// backgroundWorkers tracks the goroutines that should finish before exit
+type backgroundWorkers struct {
+	wg sync.WaitGroup
+}
+
+// start runs fn in a goroutine that shutdown waits for. fn must return once
+// the context it was given is cancelled.
+func (b *backgroundWorkers) start(fn func()) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		fn()
+	}()
+}
+
+// wait blocks until every worker has returned or ctx is done. Returns false
+// on timeout.
+func (b *backgroundWorkers) wait(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// serve runs the HTTP server until ctx is cancelled, then shuts it and the
+// workers down. Reports whether every worker finished in time; returns an
+// error only if the server could not start.
+func serve(ctx context.Context, cfg config.ServerConfig, handler http.Handler, workers *backgroundWorkers) (bool, error) {
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	// Shutdown doesn't track hijacked (WebSocket) connections; close them here
+	srv.RegisterOnShutdown(func() {
+		connManager.closeAll("server shutting down")
+	})
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+	log.Printf("StreetSavvy Backend listening on %s", cfg.Addr)
+
+	select {
+	case err := <-serveErr:
+		return false, err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down: draining requests and background work (up to %s)", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server did not drain in time: %v", err)
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("HTTP server error: %v", err)
+	}
+
+	if !workers.wait(shutdownCtx) {
+		log.Printf("Gave up waiting for background work after %s", cfg.ShutdownTimeout)
+		return false, nil
+	}
+	log.Printf("Background work finished")
+	return true, nil
+}
+
+// closeAll sends every connected user and vendor a "going away" close frame
+// and closes the connection, which ends their read loops
+func (m *ConnectionManager) closeAll(reason string) {
+	m.mutex.RLock()
+	conns := make([]*websocket.Conn, 0, len(m.userConnections)+len(m.vendorConnections))
+	for _, conn := range m.userConnections {
+		conns = append(conns, conn)
+	}
+	for _, conn := range m.vendorConnections {
+		conns = append(conns, conn)
+	}
+	m.mutex.RUnlock()
+
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, reason)
+	for _, conn := range conns {
+		err := conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsCloseTimeout))
+		if err != nil && err != websocket.ErrCloseSent {
+			log.Printf("Error sending close frame to %s: %v", conn.RemoteAddr(), err)
+		}
+		conn.Close()
+	}
+	log.Printf("Closed %d WebSocket connections", len(conns))
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"streetsavvy-backend/metrics"
+	"streetsavvy-backend/tracing"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Metrics served at GET /metrics in the Prometheus text format (see package
+// metrics). Counters are updated where the events happen; pool and
+// connection gauges are read at scrape time.
+
+var (
+	metricsRegistry = metrics.NewRegistry()
+
+	httpRequests = metricsRegistry.NewCounterVec("streetsavvy_http_requests_total",
+		"HTTP requests handled, by route template, method and status code.",
+		"route", "method", "status")
+	httpDuration = metricsRegistry.NewHistogramVec("streetsavvy_http_request_duration_seconds",
+		"Time to handle an HTTP request, by route template and method. WebSocket sessions are not included.",
+		metrics.DefaultBuckets, "route", "method")
+	wsMessages = metricsRegistry.NewCounterVec("streetsavvy_websocket_messages_total",
+		"WebSocket messages written to clients, by client kind (user or vendor) and result (sent or failed).",
+		"client", "result")
+	engagementsRecorded = metricsRegistry.NewCounterVec("streetsavvy_engagements_recorded_total",
+		"Campaign engagements stored, by type (clicked or used) and audience (registered or guest).",
+		"type", "audience")
+	engagementDuplicates = metricsRegistry.NewCounterVec("streetsavvy_engagement_duplicates_total",
+		"Engagements rejected as repeats within the de-duplication window, by type and audience.",
+		"type", "audience")
+)
+
+// WebSocket client kinds
+const (
+	wsClientUser   = "user"
+	wsClientVendor = "vendor"
+)
+
+// Engagement audiences
+const (
+	audienceRegistered = "registered"
+	audienceGuest      = "guest"
+)
+
+// registerGaugeMetrics adds the gauges read at scrape time: db's pool
+// statistics and the open WebSocket connections
+func registerGaugeMetrics(db *sql.DB) {
+	gauges := []struct {
+		name, help string
+		fn         func(sql.DBStats) float64
+	}{
+		{"streetsavvy_db_max_open_connections", "Maximum open database connections (DB_MAX_OPEN_CONNS).",
+			func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }},
+		{"streetsavvy_db_open_connections", "Open database connections, in use or idle.",
+			func(s sql.DBStats) float64 { return float64(s.OpenConnections) }},
+		{"streetsavvy_db_in_use_connections", "Database connections in use.",
+			func(s sql.DBStats) float64 { return float64(s.InUse) }},
+		{"streetsavvy_db_idle_connections", "Idle database connections.",
+			func(s sql.DBStats) float64 { return float64(s.Idle) }},
+	}
+	for _, g := range gauges {
+		fn := g.fn
+		metricsRegistry.NewGaugeFunc(g.name, g.help, func() float64 { return fn(db.Stats()) })
+	}
+
+	counters := []struct {
+		name, help string
+		fn         func(sql.DBStats) float64
+	}{
+		{"streetsavvy_db_wait_count_total", "Times a query waited for a free database connection.",
+			func(s sql.DBStats) float64 { return float64(s.WaitCount) }},
+		{"streetsavvy_db_wait_duration_seconds_total", "Total time queries waited for a free database connection.",
+			func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }},
+		{"streetsavvy_db_max_idle_closed_total", "Connections closed because the idle pool was full.",
+			func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }},
+		{"streetsavvy_db_max_idle_time_closed_total", "Connections closed for being idle too long.",
+			func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) }},
+		{"streetsavvy_db_max_lifetime_closed_total", "Connections closed at DB_CONN_MAX_LIFETIME.",
+			func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }},
+	}
+	for _, c := range counters {
+		fn := c.fn
+		metricsRegistry.NewCounterFunc(c.name, c.help, func() float64 { return fn(db.Stats()) })
+	}
+
+	metricsRegistry.NewGaugeFunc("streetsavvy_websocket_user_connections",
+		"Users connected over WebSocket.", func() float64 {
+			connManager.mutex.RLock()
+			defer connManager.mutex.RUnlock()
+			return float64(len(connManager.userConnections))
+		})
+	metricsRegistry.NewGaugeFunc("streetsavvy_websocket_vendor_connections",
+		"Vendors connected over WebSocket.", func() float64 {
+			connManager.mutex.RLock()
+			defer connManager.mutex.RUnlock()
+			return float64(len(connManager.vendorConnections))
+		})
+}
+
+// observeRequest counts one handled request
+func observeRequest(route, method string, status int, elapsed time.Duration) {
+	httpRequests.Inc(route, method, strconv.Itoa(status))
+	// A WebSocket request lasts as long as the session
+	if status != http.StatusSwitchingProtocols {
+		httpDuration.Observe(elapsed.Seconds(), route, method)
+	}
+}
+
+// writeWS sends msg to a WebSocket client as a span of ctx's trace, and
+// counts the result
+func writeWS(ctx context.Context, conn *websocket.Conn, client string, msg WSMessage) error {
+	_, span := tracing.Tracer().Start(ctx, "WS send "+msg.Type,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("websocket.client", client),
+			attribute.String("websocket.message_type", msg.Type),
+		))
+	defer span.End()
+
+	err := conn.WriteJSON(msg)
+	result := "sent"
+	if err != nil {
+		result = "failed"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	wsMessages.Inc(client, result)
+	return err
+}
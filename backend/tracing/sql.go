@@ -0,0 +1,202 @@
+package tracing
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SQL spans: WrapConnector traces the queries of a database/sql pool. Each
+// query made with a traced context (QueryContext, ExecContext, BeginTx and
+// so on) gets a span named after the statement, such as "SELECT campaigns"
+// or "INSERT campaign_user_engagements"; parameters are never recorded.
+// Queries inside a transaction belong to the transaction's span even when
+// made without a context. Queries with no trace to join are not traced, so
+// code that doesn't pass a context doesn't start a trace per query.
+
+// WrapConnector traces the connections c opens
+func WrapConnector(c driver.Connector) driver.Connector {
+	return &connector{Connector: c}
+}
+
+type connector struct {
+	driver.Connector
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{Conn: conn}, nil
+}
+
+// tracedConn wraps a driver connection. The interfaces it implements are
+// those lib/pq's connections do.
+type tracedConn struct {
+	driver.Conn
+	tx context.Context // The open transaction's span, if any
+}
+
+// start begins a span for query if ctx, or else the open transaction, is
+// traced
+func (c *tracedConn) start(ctx context.Context, query string) (context.Context, trace.Span, bool) {
+	parent := ctx
+	if !trace.SpanContextFromContext(parent).IsValid() {
+		if c.tx == nil {
+			return ctx, nil, false
+		}
+		parent = c.tx
+	}
+	op, table := QueryName(query)
+	name := op
+	if table != "" {
+		name += " " + table
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation", op),
+	}
+	if table != "" {
+		attrs = append(attrs, attribute.String("db.sql.table", table))
+	}
+	ctx, span := Tracer().Start(parent, name,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return ctx, span, true
+}
+
+func end(span trace.Span, err error) {
+	if err != nil && err != driver.ErrSkip {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span, traced := c.start(ctx, query)
+	result, err := execer.ExecContext(ctx, query, args)
+	if traced {
+		end(span, err)
+	}
+	return result, err
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span, traced := c.start(ctx, query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if traced {
+		end(span, err)
+	}
+	return rows, err
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+// BeginTx starts a "transaction" span that the transaction's queries
+// belong to, ending at commit or rollback
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	beginner, ok := c.Conn.(driver.ConnBeginTx)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	var span trace.Span
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		ctx, span = Tracer().Start(ctx, "transaction",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("db.system", "postgresql")))
+	}
+	tx, err := beginner.BeginTx(ctx, opts)
+	if err != nil {
+		if span != nil {
+			end(span, err)
+		}
+		return nil, err
+	}
+	if span == nil {
+		return tx, nil
+	}
+	c.tx = ctx
+	return &tracedTx{Tx: tx, conn: c, span: span}, nil
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	c.tx = nil
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+type tracedTx struct {
+	driver.Tx
+	conn *tracedConn
+	span trace.Span
+}
+
+func (t *tracedTx) Commit() error {
+	err := t.Tx.Commit()
+	t.conn.tx = nil
+	t.span.SetAttributes(attribute.String("db.transaction.outcome", "commit"))
+	end(t.span, err)
+	return err
+}
+
+func (t *tracedTx) Rollback() error {
+	err := t.Tx.Rollback()
+	t.conn.tx = nil
+	t.span.SetAttributes(attribute.String("db.transaction.outcome", "rollback"))
+	end(t.span, err)
+	return err
+}
+
+var (
+	leadingComments = regexp.MustCompile(`^(\s|--[^\n]*\n|/\*.*?\*/)+`)
+	tableAfter      = regexp.MustCompile(`(?i)\b(?:FROM|INTO|UPDATE)\s+([A-Za-z_][A-Za-z0-9_.]*)`)
+)
+
+// QueryName names a statement by its operation and first table, such as
+// SELECT and campaigns. Table is "" when there is none (SELECT NOW()).
+func QueryName(query string) (op, table string) {
+	query = leadingComments.ReplaceAllString(query, "")
+	if fields := strings.Fields(query); len(fields) > 0 {
+		op = strings.ToUpper(fields[0])
+	}
+	if m := tableAfter.FindStringSubmatch(query); m != nil {
+		table = m[1]
+	}
+	return op, table
+}
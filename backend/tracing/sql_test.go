@@ -0,0 +1,27 @@
+package tracing
+
+import "testing"
+
+func TestQueryName(t *testing.T) {
+	for _, tc := range []struct {
+		query, op, table string
+	}{
+		{"SELECT * FROM campaigns WHERE campaign_id = $1", "SELECT", "campaigns"},
+		{"\n\t\tselect c.title\n\t\tfrom campaigns c join vendors v on true", "SELECT", "campaigns"},
+		{"INSERT INTO campaign_user_engagements (user_id) VALUES ($1)", "INSERT", "campaign_user_engagements"},
+		{"UPDATE users SET loyalty_tier = $1", "UPDATE", "users"},
+		{"DELETE FROM jobs WHERE job_id = $1", "DELETE", "jobs"},
+		{"INSERT INTO public.schema_migrations VALUES (1)", "INSERT", "public.schema_migrations"},
+		{"WITH moved AS (DELETE FROM user_location_events RETURNING *) SELECT 1", "WITH", "user_location_events"},
+		{"-- newest fix\nSELECT lat FROM user_location_events", "SELECT", "user_location_events"},
+		{"/* retention */ DELETE FROM jobs", "DELETE", "jobs"},
+		{"SELECT NOW()", "SELECT", ""},
+		{"BEGIN", "BEGIN", ""},
+		{"", "", ""},
+	} {
+		op, table := QueryName(tc.query)
+		if op != tc.op || table != tc.table {
+			t.Errorf("QueryName(%q) = %q, %q; want %q, %q", tc.query, op, table, tc.op, tc.table)
+		}
+	}
+}
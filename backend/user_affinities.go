@@ -0,0 +1,56 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"streetsavvy-backend/affinity"
+	"streetsavvy-backend/config"
+
+	"github.com/gorilla/mux"
+)
+
+// affinityPolicy is set in main from AFFINITY_* (see config/affinity.go).
+// Scores are updated with each "used" engagement (insertUsedEngagement).
+var affinityPolicy = affinity.DefaultPolicy()
+
+// userAffinities is a user's strongest vendors and vendor types
+type userAffinities struct {
+	UserID       string            `json:"user_id"`
+	HalfLifeDays float64           `json:"half_life_days"`
+	Vendors      []affinity.Weight `json:"vendors"`
+	VendorTypes  []affinity.Weight `json:"vendor_types"`
+}
+
+// getUserAffinitiesHandler returns a user's strongest vendors and vendor
+// types with their decayed weights: GET /api/users/{id}/affinities
+func getUserAffinitiesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+
+	if _, err := loadUser(r.Context(), userID); err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeUserNotFound, "User not found")
+		return
+	} else if err != nil {
+		errorf(r, "Error loading user %s: %v", userID, err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+
+	affinities, err := affinity.Load(config.DB, affinityPolicy, userID)
+	if err != nil {
+		errorf(r, "Error loading affinities for %s: %v", userID, err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+
+	response := userAffinities{
+		UserID:       userID,
+		HalfLifeDays: affinityPolicy.HalfLifeDays,
+		Vendors:      affinities.Vendors,
+		VendorTypes:  affinities.VendorTypes,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
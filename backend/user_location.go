@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"streetsavvy-backend/config"
+
+	"github.com/gorilla/mux"
+)
+
+// Latest location per user. user_current_location is kept up to date by a
+// trigger on user_location_events (database/migrations/010_current_location.sql),
+// so reading it is a primary key lookup however long the trail grows.
+
+// maxLocationAge is set in main from LOCATION_MAX_AGE
+var maxLocationAge = 30 * time.Minute
+
+// currentLocation is a user's newest fix
+type currentLocation struct {
+	LocationID string
+	Lat        float64
+	Lng        float64
+	AccuracyM  *float64 // Reported GPS accuracy, if the app sent it
+	FixTime    time.Time
+	Age        time.Duration
+}
+
+// userLocation answers GET and POST /api/users/{id}/location
+type userLocation struct {
+	UserID     string   `json:"user_id"`
+	Latitude   float64  `json:"latitude"`
+	Longitude  float64  `json:"longitude"`
+	AccuracyM  *float64 `json:"accuracy_m"`
+	FixTime    string   `json:"fix_time"` // Local time, without a zone
+	AgeSeconds int      `json:"age_seconds"`
+	Stale      bool     `json:"stale"` // Older than maxLocationAge
+	Message    string   `json:"message"`
+}
+
+// locationRequest is a fix sent to POST /api/users/{id}/location
+type locationRequest struct {
+	Lat      *float64 `json:"lat"`
+	Lng      *float64 `json:"lng"`
+	Accuracy *float64 `json:"accuracy"` // Meters, optional
+}
+
+// staleLocationError reports a latest fix older than maxLocationAge
+type staleLocationError struct {
+	Age time.Duration
+}
+
+func (e staleLocationError) Error() string {
+	return fmt.Sprintf("stale location: last fix is %s old (max %s)",
+		e.Age.Round(time.Second), maxLocationAge)
+}
+
+// loadCurrentLocation reads a user's newest fix. Returns sql.ErrNoRows if
+// the user has never reported one.
+func loadCurrentLocation(ctx context.Context, userID string) (*currentLocation, error) {
+	var loc currentLocation
+	var ageSeconds float64
+	// fix_time is a local TIMESTAMP, so the age is worked out by the database
+	err := config.DB.QueryRowContext(ctx, `
+		SELECT location_id, lat, long, accuracy_m, fix_time,
+			GREATEST(EXTRACT(EPOCH FROM (LOCALTIMESTAMP - fix_time)), 0)
+		FROM user_current_location
+		WHERE user_id = $1`, userID).Scan(
+		&loc.LocationID, &loc.Lat, &loc.Lng, &loc.AccuracyM, &loc.FixTime, &ageSeconds)
+	if err != nil {
+		return nil, err
+	}
+	loc.Age = time.Duration(ageSeconds * float64(time.Second))
+	return &loc, nil
+}
+
+// freshLocation is loadCurrentLocation that also rejects fixes older than
+// maxLocationAge with staleLocationError
+func freshLocation(ctx context.Context, userID string) (*currentLocation, error) {
+	loc, err := loadCurrentLocation(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if loc.Age > maxLocationAge {
+		return nil, staleLocationError{Age: loc.Age}
+	}
+	return loc, nil
+}
+
+// requestLocation is the location a campaign query runs against. The app
+// can send its position with the request (?lat=&lng=, optionally
+// &accuracy= in meters), saving a round trip and working for users without
+// any stored fix; &save=true also records it as a location event, as
+// POST /api/users/{id}/location does. Without lat and lng it falls back to
+// freshLocation.
+func requestLocation(r *http.Request, userID string) (*currentLocation, error) {
+	q := r.URL.Query()
+	save := false
+	if v := q.Get("save"); v != "" {
+		var err error
+		if save, err = strconv.ParseBool(v); err != nil {
+			return nil, invalidField("save", "save must be true or false")
+		}
+	}
+
+	latParam, lngParam := q.Get("lat"), q.Get("lng")
+	if latParam == "" && lngParam == "" {
+		if save {
+			return nil, invalidField("save", "save needs lat and lng")
+		}
+		return freshLocation(r.Context(), userID)
+	}
+
+	lat, lng, err := parseCoordinates(latParam, lngParam)
+	if err != nil {
+		return nil, err
+	}
+	loc := &currentLocation{Lat: lat, Lng: lng, FixTime: time.Now()}
+
+	if v := q.Get("accuracy"); v != "" {
+		accuracy, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, invalidField("accuracy", "accuracy must be a non-negative number of meters")
+		}
+		if err := checkAccuracy(accuracy); err != nil {
+			return nil, err
+		}
+		loc.AccuracyM = &accuracy
+	}
+
+	if save {
+		if err := storeUserLocation(r.Context(), userID, lat, lng, loc.AccuracyM); err != nil {
+			return nil, err
+		}
+	}
+	return loc, nil
+}
+
+// recordUserLocationHandler stores a fix reported by the app: POST
+// /api/users/{id}/location {"lat", "lng", "accuracy"}. It becomes the
+// user's current location, as a location_update over the WebSocket does.
+func recordUserLocationHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+
+	var req locationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+	if req.Lat == nil || req.Lng == nil {
+		writeValidationError(w, r, invalidField("lat", "lat and lng are required"))
+		return
+	}
+	if err := checkCoordinates(*req.Lat, *req.Lng); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	if req.Accuracy != nil {
+		if err := checkAccuracy(*req.Accuracy); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+	}
+
+	if _, err := loadUser(r.Context(), userID); err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeUserNotFound, "User not found")
+		return
+	} else if err != nil {
+		errorf(r, "Error loading user %s: %v", userID, err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+
+	if err := storeUserLocation(r.Context(), userID, *req.Lat, *req.Lng, req.Accuracy); err != nil {
+		writeInternalError(w, r, "Failed to store location")
+		return
+	}
+	loc, err := loadCurrentLocation(r.Context(), userID)
+	if err != nil {
+		errorf(r, "Error loading location for user %s: %v", userID, err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(userLocation{
+		UserID:     userID,
+		Latitude:   loc.Lat,
+		Longitude:  loc.Lng,
+		AccuracyM:  loc.AccuracyM,
+		FixTime:    loc.FixTime.Format("2006-01-02T15:04:05"),
+		AgeSeconds: int(loc.Age.Seconds()),
+		Stale:      loc.Age > maxLocationAge,
+		Message:    "User location recorded",
+	})
+}
+
+// parseCoordinates reads a lat/lng pair sent by the app
+func parseCoordinates(latParam, lngParam string) (lat, lng float64, err error) {
+	lat, err = strconv.ParseFloat(latParam, 64)
+	if err != nil {
+		return 0, 0, invalidField("lat", "lat must be a latitude between -90 and 90")
+	}
+	lng, err = strconv.ParseFloat(lngParam, 64)
+	if err != nil {
+		return 0, 0, invalidField("lng", "lng must be a longitude between -180 and 180")
+	}
+	return lat, lng, checkCoordinates(lat, lng)
+}
+
+// checkCoordinates reports a lat/lng pair that isn't a position on Earth.
+// NaN passes every comparison, so it is checked for explicitly.
+func checkCoordinates(lat, lng float64) error {
+	if !isFinite(lat) || lat < -90 || lat > 90 {
+		return invalidField("lat", "lat must be a latitude between -90 and 90")
+	}
+	if !isFinite(lng) || lng < -180 || lng > 180 {
+		return invalidField("lng", "lng must be a longitude between -180 and 180")
+	}
+	return nil
+}
+
+// checkAccuracy reports a GPS accuracy radius that isn't a non-negative
+// number of meters
+func checkAccuracy(accuracy float64) error {
+	if !isFinite(accuracy) || accuracy < 0 {
+		return invalidField("accuracy", "accuracy must be a non-negative number of meters")
+	}
+	return nil
+}
+
+func isFinite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+// writeLocationError answers a failed freshLocation or requestLocation: 400
+// for bad parameters, 404 without any fix, 409 when the latest one is stale
+func writeLocationError(w http.ResponseWriter, r *http.Request, userID string, err error) {
+	if paramErr, ok := err.(fieldError); ok {
+		writeValidationError(w, r, paramErr)
+		return
+	}
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeLocationNotFound, "User location not found")
+		return
+	}
+	if stale, ok := err.(staleLocationError); ok {
+		writeError(w, r, http.StatusConflict, codeStaleLocation, stale.Error())
+		return
+	}
+	errorf(r, "Error loading location for user %s: %v", userID, err)
+	writeInternalError(w, r, "Database error")
+}
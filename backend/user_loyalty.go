@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"streetsavvy-backend/config"
+	"streetsavvy-backend/loyalty"
+
+	"github.com/gorilla/mux"
+)
+
+// Loyalty tiers: each redemption earns points (see package loyalty) and
+// moves the user's tier straight away; a nightly pass catches points aging
+// out of the window. users.loyalty_tier feeds the loyalty_tier_* segments,
+// so a new tier changes which campaigns the user is shown on the next query.
+
+const maxLoyaltyMultiplier = 10.0
+
+// loyaltyPolicy and loyaltyRecalcHour are set in main from LOYALTY_*
+// (see config.LoyaltyConfig)
+var (
+	loyaltyPolicy     = loyalty.DefaultPolicy()
+	loyaltyRecalcHour = 3
+)
+
+// runLoyaltyWorker recalculates every user's tier once a night at hour
+// (server local time) until ctx is cancelled
+func runLoyaltyWorker(ctx context.Context, hour int) {
+	for {
+		now := time.Now()
+		next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		runLoyaltyRecalculation(loyalty.ReasonNightly)
+	}
+}
+
+// runLoyaltyRecalculation brings every user's tier up to date
+func runLoyaltyRecalculation(reason string) (loyalty.Report, error) {
+	report, err := loyalty.RecalculateAll(config.DB, loyaltyPolicy, reason)
+	if err != nil {
+		log.Printf("Loyalty recalculation failed after %d tier changes: %v", report.Changed, err)
+		return report, err
+	}
+	log.Printf("Recalculated loyalty tiers: %d users, %d changed (%dms)",
+		report.Users, report.Changed, report.DurationMs)
+	return report, nil
+}
+
+// creditLoyalty awards the points for a redemption and updates the user's
+// tier. It runs in the redemption's transaction, so a use that is stored
+// is always credited.
+func creditLoyalty(tx *sql.Tx, userID string, engagementID int64) error {
+	points, err := loyalty.Award(tx, loyaltyPolicy, engagementID)
+	if err != nil {
+		return err
+	}
+	change, err := loyalty.Recalculate(tx, loyaltyPolicy, userID, loyalty.ReasonUse)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("User %s earned %d loyalty points (%d in window)", userID, points, change.Points)
+	if change.Changed {
+		log.Printf("User %s moved from loyalty tier %q to %q", userID, change.OldTier, change.NewTier)
+	}
+	return nil
+}
+
+// userLoyalty is a user's tier, points, progress to the next tier, recent
+// points and tier history
+type userLoyalty struct {
+	UserID           string               `json:"user_id"`
+	Tier             string               `json:"tier"`
+	Points           int                  `json:"points"` // Earned within the window
+	WindowDays       int                  `json:"window_days"`
+	Tiers            []loyalty.Tier       `json:"tiers"`
+	RecentPoints     []loyaltyPointsEntry `json:"recent_points"`
+	TierHistory      []loyaltyTierChange  `json:"tier_history"`
+	NextTier         string               `json:"next_tier,omitempty"` // Unset at the top tier
+	PointsToNextTier int                  `json:"points_to_next_tier,omitempty"`
+}
+
+type loyaltyPointsEntry struct {
+	CampaignID *string   `json:"campaign_id"`
+	VendorID   *string   `json:"vendor_id"`
+	Multiplier float64   `json:"multiplier"`
+	Points     int       `json:"points"`
+	EarnedAt   time.Time `json:"earned_at"`
+}
+
+type loyaltyTierChange struct {
+	OldTier   *string   `json:"old_tier"`
+	NewTier   string    `json:"new_tier"`
+	Points    int       `json:"points"`
+	Reason    string    `json:"reason"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// vendorLoyaltyRequest is the body of PUT /api/vendors/{vendor_id}/loyalty
+type vendorLoyaltyRequest struct {
+	Multiplier *float64 `json:"multiplier"`
+}
+
+// vendorLoyalty is a store's points multiplier and what a redemption there
+// earns
+type vendorLoyalty struct {
+	VendorID     string  `json:"vendor_id"`
+	Multiplier   float64 `json:"multiplier"`
+	PointsPerUse int     `json:"points_per_use"`
+}
+
+// getUserLoyaltyHandler returns a user's tier, points, progress to the
+// next tier, recent points and tier history: GET /api/users/{id}/loyalty
+func getUserLoyaltyHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+
+	user, err := loadUser(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeUserNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		errorf(r, "Error loading user %s: %v", userID, err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+
+	points, err := loyalty.Points(config.DB, loyaltyPolicy, userID)
+	if err != nil {
+		errorf(r, "Error loading loyalty points for %s: %v", userID, err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+	_, next := loyaltyPolicy.TierFor(points)
+
+	recent := []loyaltyPointsEntry{}
+	rows, err := config.DB.QueryContext(r.Context(), `
+		SELECT campaign_id, vendor_id, multiplier, points, earned_at
+		FROM loyalty_points
+		WHERE user_id = $1
+		ORDER BY earned_at DESC
+		LIMIT 20`, userID)
+	if err != nil {
+		errorf(r, "Error loading loyalty points for %s: %v", userID, err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e loyaltyPointsEntry
+		if err := rows.Scan(&e.CampaignID, &e.VendorID, &e.Multiplier, &e.Points, &e.EarnedAt); err != nil {
+			errorf(r, "Error scanning loyalty points: %v", err)
+			continue
+		}
+		recent = append(recent, e)
+	}
+
+	history := []loyaltyTierChange{}
+	historyRows, err := config.DB.QueryContext(r.Context(), `
+		SELECT old_tier, new_tier, points, reason, changed_at
+		FROM loyalty_tier_history
+		WHERE user_id = $1
+		ORDER BY changed_at DESC`, userID)
+	if err != nil {
+		errorf(r, "Error loading loyalty history for %s: %v", userID, err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+	defer historyRows.Close()
+	for historyRows.Next() {
+		var c loyaltyTierChange
+		if err := historyRows.Scan(&c.OldTier, &c.NewTier, &c.Points, &c.Reason, &c.ChangedAt); err != nil {
+			errorf(r, "Error scanning loyalty history: %v", err)
+			continue
+		}
+		history = append(history, c)
+	}
+
+	response := userLoyalty{
+		UserID:       userID,
+		Tier:         user.LoyaltyTier,
+		Points:       points,
+		WindowDays:   loyaltyPolicy.WindowDays,
+		Tiers:        loyaltyPolicy.Tiers,
+		RecentPoints: recent,
+		TierHistory:  history,
+	}
+	if next != nil {
+		response.NextTier = next.Name
+		response.PointsToNextTier = next.MinPoints - points
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// updateVendorLoyaltyHandler sets the points multiplier for redemptions at a
+// store: PUT /api/vendors/{vendor_id}/loyalty {"multiplier"}. 0 turns
+// points off there; points already earned keep their multiplier.
+func updateVendorLoyaltyHandler(w http.ResponseWriter, r *http.Request) {
+	vendorID := mux.Vars(r)["vendor_id"]
+
+	var req vendorLoyaltyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+	if req.Multiplier == nil || *req.Multiplier < 0 || *req.Multiplier > maxLoyaltyMultiplier {
+		writeValidationError(w, r, invalidField("multiplier", "multiplier must be between 0 and 10"))
+		return
+	}
+
+	result, err := config.DB.ExecContext(r.Context(), `UPDATE vendors SET loyalty_multiplier = $2 WHERE vendor_id = $1`,
+		vendorID, *req.Multiplier)
+	if err != nil {
+		errorf(r, "Error updating loyalty multiplier for vendor %s: %v", vendorID, err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		writeError(w, r, http.StatusNotFound, codeVendorNotFound, "Vendor not found")
+		return
+	}
+
+	logf(r, "Vendor %s loyalty multiplier set to %.2f", vendorID, *req.Multiplier)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vendorLoyalty{
+		VendorID:     vendorID,
+		Multiplier:   *req.Multiplier,
+		PointsPerUse: loyaltyPolicy.PointsFor(*req.Multiplier),
+	})
+}
+
+// recalculateLoyaltyHandler runs the nightly recalculation now, e.g. after
+// changing LOYALTY_TIERS: POST /api/admin/loyalty/recalculate
+func recalculateLoyaltyHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := runLoyaltyRecalculation(loyalty.ReasonManual)
+	if err != nil {
+		writeInternalError(w, r, "Loyalty recalculation failed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
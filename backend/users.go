@@ -0,0 +1,620 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"streetsavvy-backend/config"
+	"streetsavvy-backend/models"
+	"streetsavvy-backend/otp"
+
+	"github.com/gorilla/mux"
+)
+
+// User accounts: registration by phone number (MSISDN) verified with a
+// one-time code, binding the account to one device (IMEI), profile updates
+// and deletion. Codes go out through otpSender (see config.NewOTPSender).
+
+// otpSender is set in main from OTP_SENDER
+var otpSender otp.Sender = otp.LogSender{}
+
+const (
+	msisdnDefaultCallingCode = "1" // Prepended to numbers entered without "+"
+	otpRateWindow            = 15 * time.Minute
+	otpRateLimit             = 5 // Codes per phone number per otpRateWindow
+)
+
+var (
+	errChallengeInvalid = errors.New("invalid or already used verification code")
+	errChallengeExpired = errors.New("verification code expired, request a new one")
+	errWrongCode        = errors.New("incorrect verification code")
+	errTooManyCodes     = errors.New("too many verification codes requested, try again later")
+)
+
+// otpChallenge is a pending verification read back for checking
+type otpChallenge struct {
+	ChallengeID string
+	MSISDN      string
+	UserID      sql.NullString
+	IMEI        string
+}
+
+// registerRequest is the body of POST /api/users/register
+type registerRequest struct {
+	MSISDN string `json:"msisdn"`
+	IMEI   string `json:"imei"`
+}
+
+// verifyRegistrationRequest is the body of POST /api/users/register/verify
+type verifyRegistrationRequest struct {
+	ChallengeID string `json:"challenge_id"`
+	Code        string `json:"code"`
+	GuestToken  string `json:"guest_token,omitempty"` // Guest session to merge into the account
+}
+
+// userSettingsRequest is the body of PUT /api/users/{id}; omitted fields
+// keep their current value
+type userSettingsRequest struct {
+	NotifSMS      *bool `json:"notif_sms,omitempty"`
+	NotifWhatsapp *bool `json:"notif_whatsapp,omitempty"`
+	NotifInapp    *bool `json:"notif_inapp,omitempty"`
+	Privacy       *bool `json:"privacy,omitempty"`
+}
+
+// deviceRequest is the body of POST /api/users/{id}/device
+type deviceRequest struct {
+	IMEI string `json:"imei"`
+}
+
+// verifyDeviceRequest is the body of POST /api/users/{id}/device/verify
+type verifyDeviceRequest struct {
+	ChallengeID string `json:"challenge_id"`
+	Code        string `json:"code"`
+}
+
+// verificationChallenge is a started challenge: the code sent by SMS goes
+// back with its ID before it expires
+type verificationChallenge struct {
+	ChallengeID string    `json:"challenge_id"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// deletedUser answers an account deletion
+type deletedUser struct {
+	UserID string `json:"user_id"`
+	Mode   string `json:"mode"` // "anonymized": engagements are kept without the user's ID
+}
+
+// registerUserHandler starts registration: POST /api/users/register
+// {"msisdn", "imei"}. A code is sent to the phone number and must be passed
+// to /api/users/register/verify. Registering a number that already has an
+// account signs in to it on the new device.
+func registerUserHandler(w http.ResponseWriter, r *http.Request) {
+	var req registerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorf(r, "Error parsing registration request: %v", err)
+		writeError(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+
+	msisdn, err := normalizeMSISDN(req.MSISDN)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	if !validIMEI(req.IMEI) {
+		writeValidationError(w, r, invalidField("imei", "imei must be 15 digits with a valid check digit"))
+		return
+	}
+
+	challengeID, expiresAt, err := startChallenge(r.Context(), "register", msisdn, nil, req.IMEI)
+	if err != nil {
+		writeChallengeStartError(w, r, msisdn, err)
+		return
+	}
+
+	writeChallenge(w, challengeID, expiresAt)
+}
+
+// verifyRegistrationHandler completes registration: POST
+// /api/users/register/verify {"challenge_id", "code"}. Returns the new
+// account (201) or the existing one now bound to this device (200). An
+// optional "guest_token" moves that guest session's clicks to the account.
+func verifyRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	var req verifyRegistrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorf(r, "Error parsing verification request: %v", err)
+		writeError(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+
+	tx, err := config.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorf(r, "Error starting verification transaction: %v", err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+	defer tx.Rollback()
+
+	challenge, err := verifyChallenge(tx, req.ChallengeID, "register", req.Code)
+	if err != nil {
+		writeChallengeError(w, r, tx, err)
+		return
+	}
+
+	status := http.StatusOK
+	var userID string
+	err = tx.QueryRow(`
+		SELECT user_id FROM users WHERE msisdn = $1 AND deleted_at IS NULL FOR UPDATE`,
+		challenge.MSISDN).Scan(&userID)
+	switch {
+	case err == sql.ErrNoRows:
+		err = tx.QueryRow(`
+			INSERT INTO users
+				(msisdn, imei, msisdn_verified_at, device_bound_at, loyalty_tier,
+				 notif_sms, notif_whatsapp, notif_inapp, privacy)
+			VALUES ($1, $2, NOW(), NOW(), 'bronze', false, false, true, true)
+			RETURNING user_id`,
+			challenge.MSISDN, challenge.IMEI).Scan(&userID)
+		status = http.StatusCreated
+	case err == nil:
+		_, err = tx.Exec(`
+			UPDATE users
+			SET imei = $2, device_bound_at = NOW(), msisdn_verified_at = NOW(), updated_at = NOW()
+			WHERE user_id = $1`,
+			userID, challenge.IMEI)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "registration failed", "msisdn", challenge.MSISDN, "error", err)
+		writeInternalError(w, r, "Failed to register user")
+		return
+	}
+
+	if req.GuestToken != "" {
+		if _, err = mergeGuestSession(tx, req.GuestToken, userID); err != nil {
+			errorf(r, "Error merging guest session into %s: %v", userID, err)
+			writeInternalError(w, r, "Failed to register user")
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "committing registration failed", "msisdn", challenge.MSISDN, "error", err)
+		writeInternalError(w, r, "Failed to register user")
+		return
+	}
+
+	if status == http.StatusCreated {
+		logf(r, "Registered user %s", userID)
+	} else {
+		logf(r, "User %s signed in on a new device", userID)
+	}
+	writeUser(w, r, userID, status)
+}
+
+// updateUserHandler changes notification and privacy settings: PUT
+// /api/users/{id}. Omitted fields keep their current value.
+func updateUserHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["id"]
+
+	var req userSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorf(r, "Error parsing user update: %v", err)
+		writeError(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+
+	result, err := config.DB.ExecContext(r.Context(), `
+		UPDATE users
+		SET notif_sms = COALESCE($2, notif_sms),
+			notif_whatsapp = COALESCE($3, notif_whatsapp),
+			notif_inapp = COALESCE($4, notif_inapp),
+			privacy = COALESCE($5, privacy),
+			updated_at = NOW()
+		WHERE user_id = $1 AND deleted_at IS NULL`,
+		userID, req.NotifSMS, req.NotifWhatsapp, req.NotifInapp, req.Privacy)
+	if err != nil {
+		errorf(r, "Error updating user %s: %v", userID, err)
+		writeInternalError(w, r, "Failed to update user")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		writeError(w, r, http.StatusNotFound, codeUserNotFound, "User not found")
+		return
+	}
+
+	writeUser(w, r, userID, http.StatusOK)
+}
+
+// requestDeviceRebindHandler starts moving an account to a new device: POST
+// /api/users/{id}/device {"imei"}. A code goes to the account's phone number.
+func requestDeviceRebindHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["id"]
+
+	var req deviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorf(r, "Error parsing device request: %v", err)
+		writeError(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+	if !validIMEI(req.IMEI) {
+		writeValidationError(w, r, invalidField("imei", "imei must be 15 digits with a valid check digit"))
+		return
+	}
+
+	user, err := loadUser(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeUserNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		errorf(r, "Error loading user %s: %v", userID, err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+	if user.MSISDN == "" {
+		writeError(w, r, http.StatusConflict, codeNoPhoneNumber, "User has no phone number to verify with")
+		return
+	}
+	if user.IMEI == req.IMEI {
+		writeError(w, r, http.StatusConflict, codeDeviceAlreadyBound, "Device is already bound to this user")
+		return
+	}
+
+	challengeID, expiresAt, err := startChallenge(r.Context(), "rebind", user.MSISDN, &userID, req.IMEI)
+	if err != nil {
+		writeChallengeStartError(w, r, user.MSISDN, err)
+		return
+	}
+
+	writeChallenge(w, challengeID, expiresAt)
+}
+
+// verifyDeviceRebindHandler binds the account to the new device: POST
+// /api/users/{id}/device/verify {"challenge_id", "code"}
+func verifyDeviceRebindHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["id"]
+
+	var req verifyDeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorf(r, "Error parsing device verification: %v", err)
+		writeError(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+
+	tx, err := config.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorf(r, "Error starting device transaction: %v", err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+	defer tx.Rollback()
+
+	challenge, err := verifyChallenge(tx, req.ChallengeID, "rebind", req.Code)
+	if err == nil && challenge.UserID.String != userID {
+		err = errChallengeInvalid
+	}
+	if err != nil {
+		writeChallengeError(w, r, tx, err)
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users
+		SET imei = $2, device_bound_at = NOW(), updated_at = NOW()
+		WHERE user_id = $1 AND deleted_at IS NULL`,
+		userID, challenge.IMEI)
+	if err != nil {
+		errorf(r, "Error rebinding device for user %s: %v", userID, err)
+		writeInternalError(w, r, "Failed to bind device")
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		errorf(r, "Error committing device rebind for user %s: %v", userID, err)
+		writeInternalError(w, r, "Failed to bind device")
+		return
+	}
+
+	logf(r, "User %s moved to a new device", userID)
+	writeUser(w, r, userID, http.StatusOK)
+}
+
+// deleteUserHandler deletes an account: DELETE /api/users/{id}. It is
+// erased at once, as a due erasure request would be (see eraseUser):
+// engagements stay, under a new anonymous ID, so vendor analytics and
+// campaign budgets keep their counts; everything else is deleted.
+func deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["id"]
+
+	err := deleteUser(userID, r)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeUserNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		errorf(r, "Error deleting user %s: %v", userID, err)
+		writeInternalError(w, r, "Failed to delete user")
+		return
+	}
+
+	logf(r, "Deleted user %s", userID)
+
+	response := deletedUser{UserID: userID, Mode: "anonymized"}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// deleteUser erases a live account in one transaction and records it in
+// the privacy audit log. Returns sql.ErrNoRows if there is no live account.
+func deleteUser(userID string, r *http.Request) error {
+	tx, err := config.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow(`
+		SELECT true FROM users WHERE user_id = $1 AND deleted_at IS NULL FOR UPDATE`,
+		userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if err := eraseUser(tx, userID); err != nil {
+		return err
+	}
+
+	// Nothing is left for a pending erasure request to do
+	_, err = tx.Exec(`
+		UPDATE erasure_requests SET status = 'completed', completed_at = NOW()
+		WHERE user_id = $1 AND status = 'pending'`, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := recordAudit(tx, userID, auditAccountDeleted, r, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// loadUser reads a live account. Returns sql.ErrNoRows if unknown or deleted.
+func loadUser(ctx context.Context, userID string) (*models.User, error) {
+	var u models.User
+	err := config.DB.QueryRowContext(ctx, `
+		SELECT user_id, COALESCE(msisdn, ''), COALESCE(imei, ''), created_at, updated_at,
+			msisdn_verified_at, device_bound_at,
+			COALESCE(loyalty_tier, ''), COALESCE(most_frequent_vendor, ''),
+			COALESCE(most_frequent_vendor_type, ''),
+			COALESCE(notif_sms, false), COALESCE(notif_whatsapp, false),
+			COALESCE(notif_inapp, false), COALESCE(privacy, true)
+		FROM users
+		WHERE user_id = $1 AND deleted_at IS NULL`, userID).Scan(
+		&u.UserID, &u.MSISDN, &u.IMEI, &u.CreatedAt, &u.UpdatedAt,
+		&u.MSISDNVerifiedAt, &u.DeviceBoundAt,
+		&u.LoyaltyTier, &u.MostFrequentVendor, &u.MostFrequentVendorType,
+		&u.NotifSMS, &u.NotifWhatsapp, &u.NotifInapp, &u.Privacy)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// writeUser responds with the user's current profile
+func writeUser(w http.ResponseWriter, r *http.Request, userID string, status int) {
+	user, err := loadUser(r.Context(), userID)
+	if err != nil {
+		errorf(r, "Error loading user %s: %v", userID, err)
+		writeInternalError(w, r, "Failed to load user")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(user)
+}
+
+// startChallenge stores a new code for msisdn and sends it
+func startChallenge(ctx context.Context, purpose, msisdn string, userID *string, imei string) (string, time.Time, error) {
+	code, err := otp.NewCode()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	tx, err := config.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	// Counted under the number's lock, so concurrent requests can't all
+	// slip under the limit
+	if err = lockMSISDN(tx, msisdn); err != nil {
+		return "", time.Time{}, err
+	}
+	var recent int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM otp_challenges
+		WHERE msisdn = $1 AND created_at > NOW() - $2::float8 * INTERVAL '1 second'`,
+		msisdn, otpRateWindow.Seconds()).Scan(&recent)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if recent >= otpRateLimit {
+		return "", time.Time{}, errTooManyCodes
+	}
+
+	// The hash is salted with the challenge ID, which the insert assigns
+	var challengeID string
+	var expiresAt time.Time
+	err = tx.QueryRow(`
+		INSERT INTO otp_challenges (purpose, msisdn, user_id, imei, code_hash, expires_at)
+		VALUES ($1, $2, $3, $4, '', NOW() + $5::float8 * INTERVAL '1 second')
+		RETURNING challenge_id, expires_at`,
+		purpose, msisdn, userID, imei, otp.CodeTTL.Seconds()).Scan(&challengeID, &expiresAt)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	_, err = tx.Exec(`UPDATE otp_challenges SET code_hash = $2 WHERE challenge_id = $1`,
+		challengeID, otp.Hash(challengeID, code))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		return "", time.Time{}, err
+	}
+
+	if err = otpSender.Send(msisdn, code); err != nil {
+		return "", time.Time{}, fmt.Errorf("sending code: %w", err)
+	}
+	return challengeID, expiresAt, nil
+}
+
+// verifyChallenge checks a submitted code and marks the challenge used. On
+// errWrongCode the attempt has been counted in tx, so the caller must
+// commit it (writeChallengeError does).
+func verifyChallenge(tx *sql.Tx, challengeID, purpose, code string) (*otpChallenge, error) {
+	var c otpChallenge
+	var hash string
+	var attempts int
+	var expired, verified bool
+	err := tx.QueryRow(`
+		SELECT challenge_id, msisdn, user_id, imei, code_hash, attempts,
+			expires_at < NOW(), verified_at IS NOT NULL
+		FROM otp_challenges
+		WHERE challenge_id = $1 AND purpose = $2
+		FOR UPDATE`, challengeID, purpose).Scan(
+		&c.ChallengeID, &c.MSISDN, &c.UserID, &c.IMEI, &hash, &attempts, &expired, &verified)
+	if err == sql.ErrNoRows || verified || attempts >= otp.MaxAttempts {
+		return nil, errChallengeInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expired {
+		return nil, errChallengeExpired
+	}
+	// Verifications of other challenges for the number wait until tx ends,
+	// so two of them can't both create its account
+	if err := lockMSISDN(tx, c.MSISDN); err != nil {
+		return nil, err
+	}
+
+	if !otp.Matches(hash, challengeID, strings.TrimSpace(code)) {
+		if _, err := tx.Exec(`UPDATE otp_challenges SET attempts = attempts + 1 WHERE challenge_id = $1`, challengeID); err != nil {
+			return nil, err
+		}
+		return nil, errWrongCode
+	}
+
+	if _, err := tx.Exec(`UPDATE otp_challenges SET verified_at = NOW() WHERE challenge_id = $1`, challengeID); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// lockMSISDN serializes issuing and verifying codes for msisdn until tx ends
+func lockMSISDN(tx *sql.Tx, msisdn string) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('otp:' || $1))`, msisdn)
+	return err
+}
+
+// writeChallenge answers a started challenge with 202 and its ID
+func writeChallenge(w http.ResponseWriter, challengeID string, expiresAt time.Time) {
+	response := verificationChallenge{
+		ChallengeID: challengeID,
+		ExpiresAt:   expiresAt.Truncate(time.Second),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeChallengeStartError answers a failed startChallenge
+func writeChallengeStartError(w http.ResponseWriter, r *http.Request, msisdn string, err error) {
+	if err == errTooManyCodes {
+		writeError(w, r, http.StatusTooManyRequests, codeRateLimited, err.Error())
+		return
+	}
+	slog.ErrorContext(r.Context(), "sending verification code failed", "msisdn", msisdn, "error", err)
+	writeError(w, r, http.StatusBadGateway, codeUpstreamFailed, "Failed to send verification code")
+}
+
+// writeChallengeError answers a failed verifyChallenge
+func writeChallengeError(w http.ResponseWriter, r *http.Request, tx *sql.Tx, err error) {
+	switch err {
+	case errWrongCode:
+		if err := tx.Commit(); err != nil {
+			log.Printf("Error recording verification attempt: %v", err)
+		}
+		writeError(w, r, http.StatusBadRequest, codeVerificationFail, err.Error())
+	case errChallengeInvalid, errChallengeExpired:
+		writeError(w, r, http.StatusBadRequest, codeVerificationFail, err.Error())
+	default:
+		errorf(r, "Error verifying code: %v", err)
+		writeInternalError(w, r, "Database error")
+	}
+}
+
+// normalizeMSISDN reduces a phone number to E.164 ("+15551234567")
+func normalizeMSISDN(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	international := strings.HasPrefix(s, "+")
+
+	digits := strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9':
+			return r
+		case r == ' ', r == '-', r == '(', r == ')', r == '.', r == '+':
+			return -1
+		}
+		return 'x'
+	}, s)
+	if strings.Contains(digits, "x") {
+		return "", invalidField("msisdn", "msisdn may only contain digits, spaces, dashes and parentheses")
+	}
+	if !international {
+		digits = msisdnDefaultCallingCode + digits
+	}
+	if len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return "", invalidField("msisdn", "msisdn must be a valid phone number, e.g. +15551234567")
+	}
+	return "+" + digits, nil
+}
+
+// validIMEI checks for 15 digits with a correct Luhn check digit
+func validIMEI(imei string) bool {
+	if len(imei) != 15 {
+		return false
+	}
+	sum := 0
+	for i, r := range imei {
+		if r < '0' || r > '9' {
+			return false
+		}
+		d := int(r - '0')
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+func TestNormalizeMSISDN(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string // want is empty when the number is rejected
+	}{
+		{"+15551234567", "+15551234567"},
+		{"  +1 (555) 123-4567 ", "+15551234567"},
+		{"+44 20 7946 0958", "+442079460958"},
+		{"555.123.4567", "+15551234567"}, // No "+" takes the default calling code
+		{"+4915123456789", "+4915123456789"},
+		{"+123456789012345", "+123456789012345"},
+
+		{"", ""},
+		{"+1234567", ""},          // Too short
+		{"+1234567890123456", ""}, // Too long
+		{"+0555123456", ""},       // Calling codes don't start with 0
+		{"555-CALL-NOW", ""},
+		{"+1 555 123 4567 ext 2", ""},
+	} {
+		t.Run(tc.in, func(t *testing.T) {
+			got, err := normalizeMSISDN(tc.in)
+			if tc.want == "" {
+				if _, ok := err.(fieldError); !ok {
+					t.Fatalf("normalizeMSISDN(%q) = %q, %v; want a field error", tc.in, got, err)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Errorf("normalizeMSISDN(%q) = %q, %v; want %q", tc.in, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidIMEI(t *testing.T) {
+	for _, tc := range []struct {
+		imei string
+		want bool
+	}{
+		{"490154203237518", true},
+		{"356938035643809", true},
+		{"000000000000000", true},
+		{"490154203237517", false}, // Wrong check digit
+		{"49015420323751", false},  // Too short
+		{"4901542032375180", false},
+		{"49015420323751a", false},
+		{"", false},
+	} {
+		if got := validIMEI(tc.imei); got != tc.want {
+			t.Errorf("validIMEI(%q) = %v, want %v", tc.imei, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+	_ "time/tzdata" // Validate IANA timezones even on hosts without zoneinfo
+
+	"streetsavvy-backend/config"
+	"streetsavvy-backend/geocode"
+	"streetsavvy-backend/models"
+
+	"github.com/gorilla/mux"
+)
+
+// Vendor onboarding and profiles. A vendor registers a brand together with
+// its store locations; each location is a vendors row, so campaigns and
+// geofences keep working per store. The vendors_sync_geom trigger
+// (database/migrations/004_vendor_profiles.sql) keeps geom in step with
+// lat/long on every write, and checkVendorAddress rejects addresses that
+// geocode too far from the coordinates entered with them.
+
+// Days accepted as keys of opening_hours
+var openingHoursDays = map[string]bool{
+	"mon": true, "tue": true, "wed": true, "thu": true, "fri": true, "sat": true, "sun": true,
+}
+
+// vendorColumns is the column list read by scanVendor
+const vendorColumns = `
+	vendor_id, brand_id, COALESCE(display_name, ''), vendor_type, COALESCE(address, ''),
+	lat, long, timezone, opening_hours,
+	COALESCE(contact_phone, ''), COALESCE(contact_email, ''), created_at, updated_at`
+
+// registerVendorHandler creates a brand and its store locations in one transaction
+func registerVendorHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.Brand
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorf(r, "Error parsing vendor registration: %v", err)
+		writeError(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+
+	if err := validateBrand(req); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	if len(req.Locations) == 0 {
+		writeValidationError(w, r, invalidField("locations", "At least one store location is required"))
+		return
+	}
+	for i, loc := range req.Locations {
+		if err := validateVendorLocation(loc); err != nil {
+			writeValidationError(w, r, inList(err, "locations", "location", i))
+			return
+		}
+		if err := checkVendorAddress(loc); err != nil {
+			writeAddressCheckError(w, r, fmt.Sprintf("locations[%d].address", i), fmt.Sprintf("location %d: ", i), err)
+			return
+		}
+	}
+
+	tx, err := config.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorf(r, "Error starting registration transaction: %v", err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+	defer tx.Rollback()
+
+	var brandID string
+	err = tx.QueryRow(`
+		INSERT INTO brands (display_name, logo_url, contact_email, contact_phone, website)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''))
+		RETURNING brand_id`,
+		req.DisplayName, req.LogoURL, req.ContactEmail, req.ContactPhone, req.Website).Scan(&brandID)
+	if err != nil {
+		errorf(r, "Error creating brand: %v", err)
+		writeInternalError(w, r, "Failed to register vendor")
+		return
+	}
+
+	for _, loc := range req.Locations {
+		if _, err := insertVendorLocation(tx, brandID, loc); err != nil {
+			errorf(r, "Error creating location for brand %s: %v", brandID, err)
+			writeInternalError(w, r, "Failed to register vendor")
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		errorf(r, "Error committing registration of brand %s: %v", brandID, err)
+		writeInternalError(w, r, "Failed to register vendor")
+		return
+	}
+
+	logf(r, "Registered brand %s with %d locations", brandID, len(req.Locations))
+
+	brand, err := loadBrand(r.Context(), brandID)
+	if err != nil {
+		errorf(r, "Error loading brand %s: %v", brandID, err)
+		writeInternalError(w, r, "Failed to load vendor profile")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(brand)
+}
+
+// getBrandHandler returns a brand profile with all its store locations
+func getBrandHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	brandID := vars["brand_id"]
+
+	brand, err := loadBrand(r.Context(), brandID)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeBrandNotFound, "Brand not found")
+		return
+	}
+	if err != nil {
+		errorf(r, "Error loading brand %s: %v", brandID, err)
+		writeInternalError(w, r, "Failed to load vendor profile")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(brand)
+}
+
+// updateBrandHandler replaces a brand's name, logo and contact details
+func updateBrandHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	brandID := vars["brand_id"]
+
+	var req models.Brand
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorf(r, "Error parsing brand update: %v", err)
+		writeError(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+	if err := validateBrand(req); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	result, err := config.DB.ExecContext(r.Context(), `
+		UPDATE brands
+		SET display_name = $2,
+			logo_url = NULLIF($3, ''),
+			contact_email = NULLIF($4, ''),
+			contact_phone = NULLIF($5, ''),
+			website = NULLIF($6, ''),
+			updated_at = NOW()
+		WHERE brand_id = $1`,
+		brandID, req.DisplayName, req.LogoURL, req.ContactEmail, req.ContactPhone, req.Website)
+	if err != nil {
+		errorf(r, "Error updating brand %s: %v", brandID, err)
+		writeInternalError(w, r, "Failed to update vendor profile")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		writeError(w, r, http.StatusNotFound, codeBrandNotFound, "Brand not found")
+		return
+	}
+
+	brand, err := loadBrand(r.Context(), brandID)
+	if err != nil {
+		errorf(r, "Error loading brand %s: %v", brandID, err)
+		writeInternalError(w, r, "Failed to load vendor profile")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(brand)
+}
+
+// addBrandLocationHandler opens a new store location for an existing brand
+func addBrandLocationHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	brandID := vars["brand_id"]
+
+	var req models.Vendor
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorf(r, "Error parsing location request: %v", err)
+		writeError(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+	if err := validateVendorLocation(req); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	if err := checkVendorAddress(req); err != nil {
+		writeAddressCheckError(w, r, "address", "", err)
+		return
+	}
+
+	var exists bool
+	err := config.DB.QueryRowContext(r.Context(), `SELECT EXISTS (SELECT 1 FROM brands WHERE brand_id = $1)`, brandID).Scan(&exists)
+	if err != nil {
+		errorf(r, "Error looking up brand %s: %v", brandID, err)
+		writeInternalError(w, r, "Database error")
+		return
+	}
+	if !exists {
+		writeError(w, r, http.StatusNotFound, codeBrandNotFound, "Brand not found")
+		return
+	}
+
+	vendorID, err := insertVendorLocation(config.DB, brandID, req)
+	if err != nil {
+		errorf(r, "Error creating location for brand %s: %v", brandID, err)
+		writeInternalError(w, r, "Failed to create store location")
+		return
+	}
+
+	logf(r, "Added location %s to brand %s", vendorID, brandID)
+
+	vendor, err := loadVendor(r.Context(), vendorID)
+	if err != nil {
+		errorf(r, "Error loading vendor %s: %v", vendorID, err)
+		writeInternalError(w, r, "Failed to load vendor profile")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(vendor)
+}
+
+// getVendorHandler returns one store location's profile
+func getVendorHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	vendorID := vars["vendor_id"]
+
+	vendor, err := loadVendor(r.Context(), vendorID)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeVendorNotFound, "Vendor not found")
+		return
+	}
+	if err != nil {
+		errorf(r, "Error loading vendor %s: %v", vendorID, err)
+		writeInternalError(w, r, "Failed to load vendor profile")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vendor)
+}
+
+// updateVendorHandler replaces a store location's profile and coordinates
+func updateVendorHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	vendorID := vars["vendor_id"]
+
+	var req models.Vendor
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorf(r, "Error parsing vendor update: %v", err)
+		writeError(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+	if err := validateVendorLocation(req); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	if err := checkVendorAddress(req); err != nil {
+		writeAddressCheckError(w, r, "address", "", err)
+		return
+	}
+
+	hours, err := json.Marshal(req.OpeningHours)
+	if err != nil {
+		writeValidationError(w, r, invalidField("opening_hours", "Invalid opening_hours"))
+		return
+	}
+
+	// geom follows lat/long through the vendors_sync_geom trigger
+	result, err := config.DB.ExecContext(r.Context(), `
+		UPDATE vendors
+		SET display_name = NULLIF($2, ''),
+			vendor_type = $3,
+			address = $4,
+			lat = $5,
+			long = $6,
+			timezone = $7,
+			opening_hours = $8::jsonb,
+			contact_phone = NULLIF($9, ''),
+			contact_email = NULLIF($10, ''),
+			address_normalized = NULLIF($11, ''),
+			updated_at = NOW()
+		WHERE vendor_id = $1`,
+		vendorID, req.DisplayName, req.VendorType, req.Address, req.Lat, req.Lng,
+		req.Timezone, string(hours), req.ContactPhone, req.ContactEmail,
+		geocode.Normalize(req.Address))
+	if err != nil {
+		errorf(r, "Error updating vendor %s: %v", vendorID, err)
+		writeInternalError(w, r, "Failed to update vendor profile")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		writeError(w, r, http.StatusNotFound, codeVendorNotFound, "Vendor not found")
+		return
+	}
+
+	vendor, err := loadVendor(r.Context(), vendorID)
+	if err != nil {
+		errorf(r, "Error loading vendor %s: %v", vendorID, err)
+		writeInternalError(w, r, "Failed to load vendor profile")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vendor)
+}
+
+// insertVendorLocation creates a store location under a brand and returns its vendor_id
+func insertVendorLocation(q queryRower, brandID string, v models.Vendor) (string, error) {
+	hours, err := json.Marshal(v.OpeningHours)
+	if err != nil {
+		return "", err
+	}
+
+	// geom is filled in by the vendors_sync_geom trigger
+	var vendorID string
+	err = q.QueryRow(`
+		INSERT INTO vendors
+			(brand_id, display_name, vendor_type, address, lat, long, timezone,
+			 opening_hours, contact_phone, contact_email, address_normalized)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, $8::jsonb, NULLIF($9, ''), NULLIF($10, ''), NULLIF($11, ''))
+		RETURNING vendor_id`,
+		brandID, v.DisplayName, v.VendorType, v.Address, v.Lat, v.Lng, v.Timezone,
+		string(hours), v.ContactPhone, v.ContactEmail, geocode.Normalize(v.Address)).Scan(&vendorID)
+	return vendorID, err
+}
+
+// loadVendor reads one store location. Returns sql.ErrNoRows if unknown.
+func loadVendor(ctx context.Context, vendorID string) (*models.Vendor, error) {
+	row := config.DB.QueryRowContext(ctx, `SELECT `+vendorColumns+` FROM vendors WHERE vendor_id = $1`, vendorID)
+	return scanVendor(row)
+}
+
+// loadBrand reads a brand and its store locations. Returns sql.ErrNoRows if unknown.
+func loadBrand(ctx context.Context, brandID string) (*models.Brand, error) {
+	brand := &models.Brand{BrandID: brandID, Locations: []models.Vendor{}}
+
+	err := config.DB.QueryRowContext(ctx, `
+		SELECT display_name, COALESCE(logo_url, ''), COALESCE(contact_email, ''),
+			COALESCE(contact_phone, ''), COALESCE(website, ''), created_at, updated_at
+		FROM brands
+		WHERE brand_id = $1`, brandID).Scan(
+		&brand.DisplayName, &brand.LogoURL, &brand.ContactEmail,
+		&brand.ContactPhone, &brand.Website, &brand.CreatedAt, &brand.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := config.DB.QueryContext(ctx, `SELECT `+vendorColumns+` FROM vendors WHERE brand_id = $1 ORDER BY vendor_id`, brandID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		vendor, err := scanVendor(rows)
+		if err != nil {
+			return nil, err
+		}
+		brand.Locations = append(brand.Locations, *vendor)
+	}
+
+	return brand, rows.Err()
+}
+
+// scanVendor reads a row selected with vendorColumns
+func scanVendor(row interface{ Scan(...interface{}) error }) (*models.Vendor, error) {
+	var v models.Vendor
+	var hours []byte
+	err := row.Scan(
+		&v.VendorID, &v.BrandID, &v.DisplayName, &v.VendorType, &v.Address,
+		&v.Lat, &v.Lng, &v.Timezone, &hours,
+		&v.ContactPhone, &v.ContactEmail, &v.CreatedAt, &v.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if len(hours) > 0 {
+		if err := json.Unmarshal(hours, &v.OpeningHours); err != nil {
+			return nil, err
+		}
+	}
+	return &v, nil
+}
+
+// validateBrand checks the brand-level profile fields
+func validateBrand(b models.Brand) error {
+	if strings.TrimSpace(b.DisplayName) == "" {
+		return invalidField("display_name", "display_name is required")
+	}
+	if b.LogoURL != "" {
+		u, err := url.Parse(b.LogoURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return invalidField("logo_url", "logo_url must be an http(s) URL")
+		}
+	}
+	if b.Website != "" {
+		u, err := url.Parse(b.Website)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return invalidField("website", "website must be an http(s) URL")
+		}
+	}
+	if b.ContactEmail != "" {
+		if _, err := mail.ParseAddress(b.ContactEmail); err != nil {
+			return invalidField("contact_email", "contact_email is not a valid email address")
+		}
+	}
+	return nil
+}
+
+// validateVendorLocation checks a store location's fields
+func validateVendorLocation(v models.Vendor) error {
+	if strings.TrimSpace(v.VendorType) == "" {
+		return invalidField("vendor_type", "vendor_type is required")
+	}
+	if v.Lat < -90 || v.Lat > 90 {
+		return invalidField("lat", "lat must be between -90 and 90")
+	}
+	if v.Lng < -180 || v.Lng > 180 {
+		return invalidField("lng", "lng must be between -180 and 180")
+	}
+	if v.Lat == 0 && v.Lng == 0 {
+		return invalidField("lat", "lat and lng are required")
+	}
+	if v.Timezone == "" {
+		return invalidField("timezone", "timezone is required")
+	}
+	if _, err := time.LoadLocation(v.Timezone); err != nil {
+		return invalidField("timezone", "timezone must be an IANA name such as America/Chicago")
+	}
+	if v.ContactEmail != "" {
+		if _, err := mail.ParseAddress(v.ContactEmail); err != nil {
+			return invalidField("contact_email", "contact_email is not a valid email address")
+		}
+	}
+	for day, periods := range v.OpeningHours {
+		if !openingHoursDays[day] {
+			return invalidField("opening_hours."+day, "opening_hours: unknown day %q, use mon..sun", day)
+		}
+		for _, p := range periods {
+			if _, err := time.Parse("15:04", p.Open); err != nil {
+				return invalidField("opening_hours."+day, "opening_hours: %s open must be HH:MM", day)
+			}
+			if _, err := time.Parse("15:04", p.Close); err != nil {
+				return invalidField("opening_hours."+day, "opening_hours: %s close must be HH:MM", day)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+-- 001: Recurring campaign schedules evaluated in the vendor's timezone
+--
+-- Run after the base schema in README.md. Every migration records itself in
+-- schema_migrations so the backend can tell which version it is talking to.
+
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INT PRIMARY KEY,
+    description TEXT NOT NULL,
+    applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Vendors get an IANA timezone; start_date, end_date, run_time and every
+-- schedule rule are wall-clock values in this zone. Existing vendors are in
+-- the Dallas area, so they default to Central time.
+ALTER TABLE vendors ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'America/Chicago';
+
+-- Recurring dayparts. A campaign with no rows runs all day between its dates.
+-- days_of_week uses Postgres DOW numbering (0 = Sunday ... 6 = Saturday).
+-- A window whose end_time is before its start_time runs overnight, and the
+-- part after midnight belongs to the day the window started on.
+CREATE SEQUENCE IF NOT EXISTS schedule_id_seq START 1;
+
+CREATE TABLE IF NOT EXISTS campaign_schedules (
+    schedule_id TEXT PRIMARY KEY DEFAULT ('R' || LPAD(nextval('schedule_id_seq')::text, 4, '0')),
+    campaign_id TEXT NOT NULL REFERENCES campaigns(campaign_id) ON DELETE CASCADE,
+    days_of_week INT[] NOT NULL,
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    CHECK (days_of_week <@ ARRAY[0, 1, 2, 3, 4, 5, 6]),
+    CHECK (start_time <> end_time)
+);
+
+CREATE INDEX IF NOT EXISTS idx_campaign_schedules_campaign ON campaign_schedules (campaign_id);
+
+-- Local dates on which a campaign never runs, whatever its schedule says.
+CREATE TABLE IF NOT EXISTS campaign_blackout_dates (
+    campaign_id TEXT NOT NULL REFERENCES campaigns(campaign_id) ON DELETE CASCADE,
+    blackout_date DATE NOT NULL,
+    reason TEXT,
+    PRIMARY KEY (campaign_id, blackout_date)
+);
+
+-- campaign_is_live reports whether a campaign may be shown at p_at. It is the
+-- single definition of "active" used by every campaign query in the backend.
+CREATE OR REPLACE FUNCTION campaign_is_live(p_campaign_id TEXT, p_at TIMESTAMPTZ DEFAULT NOW())
+RETURNS BOOLEAN AS $$
+    SELECT EXISTS (
+        SELECT 1
+        FROM campaigns c
+        JOIN vendors v ON v.vendor_id = c.vendor_id
+        CROSS JOIN LATERAL (
+            SELECT
+                (p_at AT TIME ZONE v.timezone)::date AS local_date,
+                (p_at AT TIME ZONE v.timezone)::time AS local_time,
+                EXTRACT(DOW FROM p_at AT TIME ZONE v.timezone)::int AS local_dow
+        ) l
+        WHERE c.campaign_id = p_campaign_id
+          AND c.enabled = true
+          AND l.local_date BETWEEN c.start_date AND c.end_date
+          AND (l.local_date > c.start_date OR l.local_time >= c.run_time::time)
+          AND NOT EXISTS (
+              SELECT 1 FROM campaign_blackout_dates b
+              WHERE b.campaign_id = c.campaign_id
+                AND b.blackout_date = l.local_date
+          )
+          AND (
+              NOT EXISTS (
+                  SELECT 1 FROM campaign_schedules s
+                  WHERE s.campaign_id = c.campaign_id
+              )
+              OR EXISTS (
+                  SELECT 1 FROM campaign_schedules s
+                  WHERE s.campaign_id = c.campaign_id
+                    AND (
+                        -- Same-day window
+                        (s.start_time < s.end_time
+                            AND l.local_dow = ANY(s.days_of_week)
+                            AND l.local_time >= s.start_time
+                            AND l.local_time < s.end_time)
+                        -- Overnight window, evening part
+                        OR (s.start_time > s.end_time
+                            AND l.local_dow = ANY(s.days_of_week)
+                            AND l.local_time >= s.start_time)
+                        -- Overnight window, after midnight on the following day
+                        OR (s.start_time > s.end_time
+                            AND ((l.local_dow + 6) % 7) = ANY(s.days_of_week)
+                            AND l.local_time < s.end_time)
+                    )
+              )
+          )
+    );
+$$ LANGUAGE sql STABLE;
+
+INSERT INTO schema_migrations (version, description)
+VALUES (1, 'campaign schedules')
+ON CONFLICT (version) DO NOTHING;
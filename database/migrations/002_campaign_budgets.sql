@@ -0,0 +1,23 @@
+-- 002: Per-campaign budgets with automatic pausing
+
+-- NULL limits are unlimited. exhausted_at/exhausted_reason are set when the
+-- backend auto-pauses the campaign (enabled = false) because a lifetime
+-- limit was reached. Daily limits pause the campaign for the rest of the
+-- vendor-local day by adding a campaign_blackout_dates row instead.
+CREATE TABLE IF NOT EXISTS campaign_budgets (
+    campaign_id TEXT PRIMARY KEY REFERENCES campaigns(campaign_id) ON DELETE CASCADE,
+    max_uses INT CHECK (max_uses > 0),
+    max_uses_per_day INT CHECK (max_uses_per_day > 0),
+    max_distinct_users INT CHECK (max_distinct_users > 0),
+    exhausted_at TIMESTAMP,
+    exhausted_reason TEXT,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Budget checks count a campaign's uses on every redemption
+CREATE INDEX IF NOT EXISTS idx_engagements_campaign_type_time
+    ON campaign_user_engagements (campaign_id, engagement_type, engagement_time);
+
+INSERT INTO schema_migrations (version, description)
+VALUES (2, 'campaign budgets')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,42 @@
+-- 003: A/B testing of campaign creatives
+
+CREATE SEQUENCE IF NOT EXISTS variant_id_seq START 1;
+
+-- Alternative title/description/code for a campaign. Users are split across
+-- a campaign's variants in proportion to weight. The variant with the
+-- lowest variant_id is the control the others are compared against.
+CREATE TABLE IF NOT EXISTS campaign_variants (
+    variant_id TEXT PRIMARY KEY DEFAULT ('A' || LPAD(nextval('variant_id_seq')::text, 4, '0')),
+    campaign_id TEXT NOT NULL REFERENCES campaigns(campaign_id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    title TEXT NOT NULL,
+    description TEXT,
+    code TEXT,
+    weight INT NOT NULL DEFAULT 1 CHECK (weight > 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_campaign_variants_campaign ON campaign_variants (campaign_id);
+
+-- A user's variant is chosen once by hashing their user_id and then pinned
+-- here, so changing weights later does not move existing users.
+-- Rows double as the exposure count for funnel metrics.
+CREATE TABLE IF NOT EXISTS campaign_variant_assignments (
+    campaign_id TEXT NOT NULL REFERENCES campaigns(campaign_id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(user_id),
+    variant_id TEXT NOT NULL REFERENCES campaign_variants(variant_id) ON DELETE CASCADE,
+    assigned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (campaign_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_variant_assignments_variant ON campaign_variant_assignments (variant_id);
+
+-- Engagements remember which creative the user saw
+ALTER TABLE campaign_user_engagements
+    ADD COLUMN IF NOT EXISTS variant_id TEXT REFERENCES campaign_variants(variant_id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_engagements_variant ON campaign_user_engagements (variant_id);
+
+INSERT INTO schema_migrations (version, description)
+VALUES (3, 'campaign variants')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,57 @@
+-- 004: Vendor profiles, brands and store locations
+
+-- A brand is the business a vendor registers as. Each vendors row is one of
+-- its store locations with its own coordinates, hours and timezone.
+-- Vendors created before brands existed have no brand_id.
+CREATE SEQUENCE IF NOT EXISTS brand_id_seq START 1;
+
+CREATE TABLE IF NOT EXISTS brands (
+    brand_id TEXT PRIMARY KEY DEFAULT ('B' || LPAD(nextval('brand_id_seq')::text, 4, '0')),
+    display_name TEXT NOT NULL,
+    logo_url TEXT,
+    contact_email TEXT,
+    contact_phone TEXT,
+    website TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP
+);
+
+ALTER TABLE vendors ADD COLUMN IF NOT EXISTS brand_id TEXT REFERENCES brands(brand_id);
+ALTER TABLE vendors ADD COLUMN IF NOT EXISTS display_name TEXT;
+-- {"mon": [{"open": "07:00", "close": "22:00"}], ...}; missing days are closed
+ALTER TABLE vendors ADD COLUMN IF NOT EXISTS opening_hours JSONB;
+ALTER TABLE vendors ADD COLUMN IF NOT EXISTS contact_phone TEXT;
+ALTER TABLE vendors ADD COLUMN IF NOT EXISTS contact_email TEXT;
+ALTER TABLE vendors ADD COLUMN IF NOT EXISTS created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE vendors ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_vendors_brand ON vendors (brand_id);
+
+-- geom always mirrors lat/long, whoever writes the row
+CREATE OR REPLACE FUNCTION vendors_sync_geom() RETURNS trigger AS $$
+BEGIN
+    NEW.geom := ST_SetSRID(ST_MakePoint(NEW.long, NEW.lat), 4326);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_vendors_sync_geom ON vendors;
+CREATE TRIGGER trg_vendors_sync_geom
+    BEFORE INSERT OR UPDATE OF lat, long, geom ON vendors
+    FOR EACH ROW EXECUTE FUNCTION vendors_sync_geom();
+
+-- Fix rows entered by hand before the trigger existed
+UPDATE vendors
+SET geom = ST_SetSRID(ST_MakePoint(long, lat), 4326)
+WHERE geom IS NULL OR NOT ST_Equals(geom, ST_SetSRID(ST_MakePoint(long, lat), 4326));
+
+-- IDs entered by hand (such as the README's seed vendors) don't advance
+-- vendor_id_seq; move it past them, or adding a store location collides with one
+SELECT setval('vendor_id_seq', MAX(substring(vendor_id FROM 2)::int))
+FROM vendors
+WHERE vendor_id ~ '^V[0-9]+$'
+HAVING MAX(substring(vendor_id FROM 2)::int) >= (SELECT last_value FROM vendor_id_seq);
+
+INSERT INTO schema_migrations (version, description)
+VALUES (4, 'vendor profiles')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,34 @@
+-- 005: Campaigns running at several store locations of a brand
+
+-- Store locations a campaign runs at. A campaign without rows here runs only
+-- at its own vendor_id, as before. All locations must belong to the brand
+-- of the campaign's vendor (enforced by the API).
+CREATE TABLE IF NOT EXISTS campaign_locations (
+    campaign_id TEXT NOT NULL REFERENCES campaigns(campaign_id) ON DELETE CASCADE,
+    vendor_id TEXT NOT NULL REFERENCES vendors(vendor_id) ON DELETE CASCADE,
+    PRIMARY KEY (campaign_id, vendor_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_campaign_locations_vendor ON campaign_locations (vendor_id);
+
+-- Every (campaign, store) pair a geofence is evaluated against
+CREATE OR REPLACE VIEW campaign_sites AS
+    SELECT cl.campaign_id, cl.vendor_id
+    FROM campaign_locations cl
+    UNION ALL
+    SELECT c.campaign_id, c.vendor_id
+    FROM campaigns c
+    WHERE NOT EXISTS (
+        SELECT 1 FROM campaign_locations cl WHERE cl.campaign_id = c.campaign_id
+    );
+
+-- The store an engagement happened at, so analytics can roll up per
+-- location. Older rows are NULL and count towards the campaign's vendor.
+ALTER TABLE campaign_user_engagements
+    ADD COLUMN IF NOT EXISTS vendor_id TEXT REFERENCES vendors(vendor_id);
+
+CREATE INDEX IF NOT EXISTS idx_engagements_vendor ON campaign_user_engagements (vendor_id);
+
+INSERT INTO schema_migrations (version, description)
+VALUES (5, 'campaign locations')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,35 @@
+-- 006: Offline geocoding against an imported address dataset
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Address points imported from an OSM extract (or any CSV in the same
+-- shape) with `go run ./cmd/geoimport`. normalized is geocode.Normalize of
+-- the formatted address and is what forward lookups match against.
+CREATE TABLE IF NOT EXISTS geocode_addresses (
+    address_id BIGSERIAL PRIMARY KEY,
+    source TEXT NOT NULL DEFAULT 'osm',
+    source_id TEXT,
+    housenumber TEXT,
+    street TEXT,
+    city TEXT,
+    postcode TEXT,
+    state TEXT,
+    country TEXT,
+    normalized TEXT NOT NULL,
+    geom GEOMETRY(Point, 4326) NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_geocode_addresses_source ON geocode_addresses (source, source_id);
+CREATE INDEX IF NOT EXISTS idx_geocode_addresses_normalized ON geocode_addresses USING GIN (normalized gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_geocode_addresses_geom ON geocode_addresses USING GIST (geom);
+
+-- Normalized form of vendors.address, refreshed whenever the profile is saved
+ALTER TABLE vendors ADD COLUMN IF NOT EXISTS address_normalized TEXT;
+
+-- Nearest known address of a location event, filled in after it is stored
+ALTER TABLE user_location_events
+    ADD COLUMN IF NOT EXISTS address_id BIGINT REFERENCES geocode_addresses(address_id) ON DELETE SET NULL;
+
+INSERT INTO schema_migrations (version, description)
+VALUES (6, 'geocoding')
+ON CONFLICT (version) DO NOTHING;
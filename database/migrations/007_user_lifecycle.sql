@@ -0,0 +1,47 @@
+-- 007: User registration, OTP verification, device binding and deletion
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS msisdn_verified_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS device_bound_at TIMESTAMP;
+-- Set when the account is deleted; the row stays as an anonymous tombstone
+-- so engagements keep counting towards vendor analytics
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+-- One live account per phone number
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_msisdn ON users (msisdn) WHERE deleted_at IS NULL;
+
+-- One-time codes sent to a phone number. purpose is 'register' (code proves
+-- the caller owns msisdn) or 'rebind' (moving user_id to a new device).
+-- Only a hash of the code is stored.
+CREATE SEQUENCE IF NOT EXISTS otp_challenge_id_seq START 1;
+
+CREATE TABLE IF NOT EXISTS otp_challenges (
+    challenge_id TEXT PRIMARY KEY DEFAULT ('O' || LPAD(nextval('otp_challenge_id_seq')::text, 4, '0')),
+    purpose TEXT NOT NULL CHECK (purpose IN ('register', 'rebind')),
+    msisdn TEXT NOT NULL,
+    user_id TEXT REFERENCES users(user_id) ON DELETE CASCADE,
+    imei TEXT NOT NULL,
+    code_hash TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    verified_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_otp_challenges_msisdn ON otp_challenges (msisdn, created_at);
+
+-- Deleting a user removes their location trail outright
+ALTER TABLE user_location_events DROP CONSTRAINT IF EXISTS user_location_events_user_id_fkey;
+ALTER TABLE user_location_events
+    ADD CONSTRAINT user_location_events_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE;
+
+-- IDs entered by hand (such as the README's seed users) don't advance
+-- user_id_seq; move it past them, or registering a user collides with one
+SELECT setval('user_id_seq', MAX(substring(user_id FROM 2)::int))
+FROM users
+WHERE user_id ~ '^U[0-9]+$'
+HAVING MAX(substring(user_id FROM 2)::int) >= (SELECT last_value FROM user_id_seq);
+
+INSERT INTO schema_migrations (version, description)
+VALUES (7, 'user lifecycle')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,36 @@
+-- 008: Data export, erasure requests and the privacy audit log
+
+-- Every export and erasure step. user_id has no foreign key so entries
+-- outlive the account they are about.
+CREATE TABLE IF NOT EXISTS privacy_audit_log (
+    audit_id BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    action TEXT NOT NULL,
+    remote_addr TEXT,
+    user_agent TEXT,
+    details JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_privacy_audit_log_user ON privacy_audit_log (user_id, created_at);
+
+-- Right-to-erasure requests. They wait out a grace period (during which the
+-- user can cancel) and are then carried out by the erasure worker.
+CREATE SEQUENCE IF NOT EXISTS erasure_request_id_seq START 1;
+
+CREATE TABLE IF NOT EXISTS erasure_requests (
+    request_id TEXT PRIMARY KEY DEFAULT ('E' || LPAD(nextval('erasure_request_id_seq')::text, 4, '0')),
+    user_id TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'completed', 'cancelled')),
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    scheduled_for TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ
+);
+
+-- At most one open request per user
+CREATE UNIQUE INDEX IF NOT EXISTS idx_erasure_requests_pending ON erasure_requests (user_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_erasure_requests_due ON erasure_requests (scheduled_for) WHERE status = 'pending';
+
+INSERT INTO schema_migrations (version, description)
+VALUES (8, 'privacy export and erasure')
+ON CONFLICT (version) DO NOTHING;
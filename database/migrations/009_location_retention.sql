@@ -0,0 +1,86 @@
+-- 009: Time-partitioned location events and hourly downsampling
+
+-- Monthly partitions named user_location_events_pYYYYMM. The retention
+-- worker calls this every run to keep a few months ahead of the clock.
+CREATE OR REPLACE FUNCTION ensure_location_partitions(p_from DATE, p_months INT) RETURNS INT AS $$
+DECLARE
+    month_start DATE;
+    partition_name TEXT;
+    created INT := 0;
+BEGIN
+    FOR i IN 0 .. p_months - 1 LOOP
+        month_start := (date_trunc('month', p_from) + make_interval(months => i))::date;
+        partition_name := 'user_location_events_p' || to_char(month_start, 'YYYYMM');
+        IF to_regclass(partition_name) IS NULL THEN
+            EXECUTE format(
+                'CREATE TABLE %I PARTITION OF user_location_events FOR VALUES FROM (%L) TO (%L)',
+                partition_name, month_start, (month_start + INTERVAL '1 month')::date);
+            created := created + 1;
+        END IF;
+    END LOOP;
+    RETURN created;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Rebuild user_location_events as a partitioned table, once. The primary
+-- key has to include the partition key, so it becomes (location_id, event_time).
+DO $$
+DECLARE
+    oldest TIMESTAMP;
+    months INT;
+BEGIN
+    IF (SELECT c.relkind FROM pg_class c
+        WHERE c.oid = to_regclass('user_location_events')) = 'r' THEN
+
+        ALTER TABLE user_location_events RENAME TO user_location_events_legacy;
+        ALTER TABLE user_location_events_legacy
+            RENAME CONSTRAINT user_location_events_pkey TO user_location_events_legacy_pkey;
+
+        CREATE TABLE user_location_events (
+            user_id TEXT REFERENCES users(user_id) ON DELETE CASCADE,
+            location_id TEXT NOT NULL DEFAULT ('L' || LPAD(nextval('loc_id_seq')::text, 4, '0')),
+            event_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            lat DOUBLE PRECISION NOT NULL,
+            long DOUBLE PRECISION NOT NULL,
+            idle_time INT,
+            geom GEOMETRY(Point, 4326),
+            address_id BIGINT REFERENCES geocode_addresses(address_id) ON DELETE SET NULL,
+            PRIMARY KEY (location_id, event_time)
+        ) PARTITION BY RANGE (event_time);
+
+        -- Catches fixes with clocks far off; the worker prunes it like any other
+        CREATE TABLE user_location_events_default PARTITION OF user_location_events DEFAULT;
+
+        SELECT COALESCE(MIN(event_time), NOW()) INTO oldest FROM user_location_events_legacy;
+        months := (EXTRACT(YEAR FROM age(date_trunc('month', NOW()), date_trunc('month', oldest))) * 12
+                 + EXTRACT(MONTH FROM age(date_trunc('month', NOW()), date_trunc('month', oldest))))::int + 3;
+        PERFORM ensure_location_partitions(oldest::date, months);
+
+        INSERT INTO user_location_events
+            (user_id, location_id, event_time, lat, long, idle_time, geom, address_id)
+        SELECT user_id, location_id, COALESCE(event_time, NOW()), lat, long, idle_time, geom, address_id
+        FROM user_location_events_legacy;
+
+        DROP TABLE user_location_events_legacy;
+    END IF;
+END;
+$$;
+
+CREATE INDEX IF NOT EXISTS idx_user_location_events_user_time ON user_location_events (user_id, event_time DESC);
+CREATE INDEX IF NOT EXISTS idx_user_location_events_geom ON user_location_events USING GIST (geom);
+
+-- Hourly centroids of fixes older than the raw retention window
+CREATE TABLE IF NOT EXISTS user_location_hourly (
+    user_id TEXT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    hour TIMESTAMP NOT NULL,
+    lat DOUBLE PRECISION NOT NULL,
+    long DOUBLE PRECISION NOT NULL,
+    fixes INT NOT NULL,
+    PRIMARY KEY (user_id, hour)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_location_hourly_hour ON user_location_hourly (hour);
+
+INSERT INTO schema_migrations (version, description)
+VALUES (9, 'location retention')
+ON CONFLICT (version) DO NOTHING;
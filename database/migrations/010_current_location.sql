@@ -0,0 +1,55 @@
+-- 010: Latest location per user
+
+-- Reported GPS accuracy (radius in meters), when the app sends it
+ALTER TABLE user_location_events ADD COLUMN IF NOT EXISTS accuracy_m DOUBLE PRECISION;
+
+-- The newest fix of every user, so campaign queries don't have to search
+-- user_location_events. Kept up to date by the trigger below on every insert,
+-- whichever code path writes the event.
+CREATE TABLE IF NOT EXISTS user_current_location (
+    user_id TEXT PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+    location_id TEXT NOT NULL,
+    lat DOUBLE PRECISION NOT NULL,
+    long DOUBLE PRECISION NOT NULL,
+    accuracy_m DOUBLE PRECISION,
+    fix_time TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE OR REPLACE FUNCTION track_current_location() RETURNS trigger AS $$
+BEGIN
+    IF NEW.user_id IS NULL THEN
+        RETURN NULL;
+    END IF;
+    INSERT INTO user_current_location AS cur
+        (user_id, location_id, lat, long, accuracy_m, fix_time, updated_at)
+    VALUES (NEW.user_id, NEW.location_id, NEW.lat, NEW.long, NEW.accuracy_m, NEW.event_time, NOW())
+    ON CONFLICT (user_id) DO UPDATE
+    SET location_id = EXCLUDED.location_id,
+        lat = EXCLUDED.lat,
+        long = EXCLUDED.long,
+        accuracy_m = EXCLUDED.accuracy_m,
+        fix_time = EXCLUDED.fix_time,
+        updated_at = NOW()
+    -- Fixes delivered late don't replace a newer one
+    WHERE EXCLUDED.fix_time >= cur.fix_time;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_track_current_location ON user_location_events;
+CREATE TRIGGER trg_track_current_location
+    AFTER INSERT ON user_location_events
+    FOR EACH ROW EXECUTE FUNCTION track_current_location();
+
+-- Seed from the existing trail
+INSERT INTO user_current_location (user_id, location_id, lat, long, accuracy_m, fix_time)
+SELECT DISTINCT ON (user_id) user_id, location_id, lat, long, accuracy_m, event_time
+FROM user_location_events
+WHERE user_id IS NOT NULL
+ORDER BY user_id, event_time DESC
+ON CONFLICT (user_id) DO NOTHING;
+
+INSERT INTO schema_migrations (version, description)
+VALUES (10, 'current location')
+ON CONFLICT (version) DO NOTHING;
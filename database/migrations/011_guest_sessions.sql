@@ -0,0 +1,40 @@
+-- 011: Guest browsing before registration
+
+-- Campaigns in this segment are shown to everyone: registered users
+-- regardless of their profile, and guests
+INSERT INTO segments (segment_id, segment_name)
+VALUES ('S0000', 'everyone')
+ON CONFLICT DO NOTHING;
+
+-- Anonymous app sessions. Only a hash of the token is kept; the app holds the
+-- token itself. No location is stored for guests.
+CREATE SEQUENCE IF NOT EXISTS guest_session_id_seq START 1;
+
+CREATE TABLE IF NOT EXISTS guest_sessions (
+    session_id TEXT PRIMARY KEY DEFAULT ('G' || LPAD(nextval('guest_session_id_seq')::text, 4, '0')),
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    -- Set when the guest registers and their clicks move to the account
+    merged_user_id TEXT REFERENCES users(user_id) ON DELETE SET NULL,
+    merged_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_guest_sessions_expires ON guest_sessions (expires_at);
+
+-- Guest clicks, attributed to the store nearest to the guest at the time
+-- rather than keeping their coordinates
+CREATE TABLE IF NOT EXISTS guest_engagements (
+    engagement_id BIGSERIAL PRIMARY KEY,
+    session_id TEXT NOT NULL REFERENCES guest_sessions(session_id) ON DELETE CASCADE,
+    campaign_id TEXT NOT NULL REFERENCES campaigns(campaign_id) ON DELETE CASCADE,
+    vendor_id TEXT NOT NULL REFERENCES vendors(vendor_id) ON DELETE CASCADE,
+    engagement_time TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_guest_engagements_session ON guest_engagements (session_id, campaign_id, engagement_time);
+
+INSERT INTO schema_migrations (version, description)
+VALUES (11, 'guest sessions')
+ON CONFLICT (version) DO NOTHING;
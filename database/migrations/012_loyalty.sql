@@ -0,0 +1,48 @@
+-- 012: Loyalty points and tiers
+
+-- Points for a redemption at this store are multiplied by this
+ALTER TABLE vendors ADD COLUMN IF NOT EXISTS loyalty_multiplier DOUBLE PRECISION NOT NULL DEFAULT 1.0
+    CHECK (loyalty_multiplier >= 0);
+
+-- One row per redemption that earned points. The multiplier in effect at the
+-- time is kept so later changes don't rewrite history.
+CREATE TABLE IF NOT EXISTS loyalty_points (
+    point_id BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    campaign_id TEXT REFERENCES campaigns(campaign_id) ON DELETE SET NULL,
+    vendor_id TEXT REFERENCES vendors(vendor_id) ON DELETE SET NULL,
+    multiplier DOUBLE PRECISION NOT NULL,
+    points INT NOT NULL,
+    earned_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_loyalty_points_user ON loyalty_points (user_id, earned_at);
+
+-- Every tier change and why it happened
+CREATE TABLE IF NOT EXISTS loyalty_tier_history (
+    history_id BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    old_tier TEXT,
+    new_tier TEXT NOT NULL,
+    points INT NOT NULL,
+    reason TEXT NOT NULL,
+    changed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_loyalty_tier_history_user ON loyalty_tier_history (user_id, changed_at);
+
+-- Credit past redemptions at the default 10 points each; the next nightly
+-- recalculation assigns tiers from them
+INSERT INTO loyalty_points (user_id, campaign_id, vendor_id, multiplier, points, earned_at)
+SELECT e.user_id, e.campaign_id, v.vendor_id, v.loyalty_multiplier,
+    ROUND(10 * v.loyalty_multiplier)::int, e.engagement_time
+FROM campaign_user_engagements e
+JOIN campaigns c ON e.campaign_id = c.campaign_id
+JOIN vendors v ON v.vendor_id = COALESCE(e.vendor_id, c.vendor_id)
+JOIN users u ON u.user_id = e.user_id AND u.deleted_at IS NULL
+WHERE e.engagement_type = 'used'
+  AND NOT EXISTS (SELECT 1 FROM loyalty_points);
+
+INSERT INTO schema_migrations (version, description)
+VALUES (12, 'loyalty points and tiers')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,43 @@
+-- 013: Decaying per-user store affinities
+
+-- One score per user and vendor / vendor type, as of updated_at. Each use
+-- adds 1 and the score halves every AFFINITY_HALF_LIFE_DAYS; readers decay it
+-- to the current time. Only the strongest few per kind are kept.
+CREATE TABLE IF NOT EXISTS user_affinities (
+    user_id TEXT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('vendor', 'vendor_type')),
+    key TEXT NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    uses INT NOT NULL,
+    last_used_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, kind, key)
+);
+
+-- Seed from past redemptions with the default 30 day half-life, keeping
+-- the top 5 of each kind
+INSERT INTO user_affinities (user_id, kind, key, score, uses, last_used_at, updated_at)
+SELECT user_id, kind, key, score, uses, last_used_at, NOW()
+FROM (
+    SELECT user_id, kind, key, score, uses, last_used_at,
+        ROW_NUMBER() OVER (PARTITION BY user_id, kind ORDER BY score DESC, key) AS rank
+    FROM (
+        SELECT e.user_id, k.kind, k.key,
+            SUM(POWER(0.5, EXTRACT(EPOCH FROM (NOW() - e.engagement_time)) / (30 * 86400.0))) AS score,
+            COUNT(*) AS uses,
+            MAX(e.engagement_time) AS last_used_at
+        FROM campaign_user_engagements e
+        JOIN campaigns c ON e.campaign_id = c.campaign_id
+        JOIN vendors v ON v.vendor_id = COALESCE(e.vendor_id, c.vendor_id)
+        JOIN users u ON u.user_id = e.user_id AND u.deleted_at IS NULL
+        CROSS JOIN LATERAL (VALUES ('vendor', v.vendor_id), ('vendor_type', v.vendor_type)) AS k (kind, key)
+        WHERE e.engagement_type = 'used' AND k.key IS NOT NULL
+        GROUP BY e.user_id, k.kind, k.key
+    ) scores
+) ranked
+WHERE rank <= 5
+ON CONFLICT (user_id, kind, key) DO NOTHING;
+
+INSERT INTO schema_migrations (version, description)
+VALUES (13, 'user affinities')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,36 @@
+-- 014: Background job queue
+
+-- Jobs waiting to run or running. Workers claim the oldest due job with
+-- SELECT ... FOR UPDATE SKIP LOCKED and delete it when it succeeds.
+CREATE TABLE IF NOT EXISTS jobs (
+    job_id BIGSERIAL PRIMARY KEY,
+    job_type TEXT NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 5,
+    run_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_at TIMESTAMPTZ,
+    locked_by TEXT,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_due ON jobs (run_at, job_id);
+
+-- Jobs that ran out of attempts, kept for inspection and manual retry
+CREATE TABLE IF NOT EXISTS jobs_dead (
+    job_id BIGINT PRIMARY KEY,
+    job_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL,
+    max_attempts INT NOT NULL,
+    last_error TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    failed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_dead_failed ON jobs_dead (failed_at);
+
+INSERT INTO schema_migrations (version, description)
+VALUES (14, 'background job queue')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,10 @@
+-- 015: Trace context of queued jobs
+
+-- W3C traceparent of the request that enqueued the job, so its run is
+-- traced as part of the same trace. Kept through dead-lettering and retry.
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS trace_parent TEXT;
+ALTER TABLE jobs_dead ADD COLUMN IF NOT EXISTS trace_parent TEXT;
+
+INSERT INTO schema_migrations (version, description)
+VALUES (15, 'job trace context')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,45 @@
+-- 016: Create monthly location partitions over rows in the default partition
+
+-- A fix whose month has no partition yet (a phone clock far ahead, say)
+-- lands in user_location_events_default. Postgres refuses to create a
+-- partition while the default one holds rows in its range, which stopped
+-- the retention worker for good. Those rows are now moved out first and
+-- routed into the new partition.
+CREATE OR REPLACE FUNCTION ensure_location_partitions(p_from DATE, p_months INT) RETURNS INT AS $$
+DECLARE
+    month_start DATE;
+    month_end DATE;
+    partition_name TEXT;
+    created INT := 0;
+BEGIN
+    FOR i IN 0 .. p_months - 1 LOOP
+        month_start := (date_trunc('month', p_from) + make_interval(months => i))::date;
+        month_end := (month_start + INTERVAL '1 month')::date;
+        partition_name := 'user_location_events_p' || to_char(month_start, 'YYYYMM');
+        IF to_regclass(partition_name) IS NULL THEN
+            CREATE TEMP TABLE IF NOT EXISTS location_partition_backfill
+                (LIKE user_location_events) ON COMMIT DROP;
+            TRUNCATE location_partition_backfill;
+
+            WITH moved AS (
+                DELETE FROM user_location_events
+                WHERE tableoid = 'user_location_events_default'::regclass
+                  AND event_time >= month_start AND event_time < month_end
+                RETURNING *
+            )
+            INSERT INTO location_partition_backfill SELECT * FROM moved;
+
+            EXECUTE format(
+                'CREATE TABLE %I PARTITION OF user_location_events FOR VALUES FROM (%L) TO (%L)',
+                partition_name, month_start, month_end);
+            INSERT INTO user_location_events SELECT * FROM location_partition_backfill;
+            created := created + 1;
+        END IF;
+    END LOOP;
+    RETURN created;
+END;
+$$ LANGUAGE plpgsql;
+
+INSERT INTO schema_migrations (version, description)
+VALUES (16, 'location partition backfill')
+ON CONFLICT (version) DO NOTHING;
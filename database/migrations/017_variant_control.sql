@@ -0,0 +1,22 @@
+-- 017: Explicit control variant
+
+-- The variant the others are compared against. It used to be whichever had
+-- the lowest variant_id; existing campaigns keep that one.
+ALTER TABLE campaign_variants ADD COLUMN IF NOT EXISTS is_control BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE campaign_variants cv
+SET is_control = true
+WHERE cv.variant_id = (
+    SELECT MIN(variant_id) FROM campaign_variants WHERE campaign_id = cv.campaign_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM campaign_variants WHERE campaign_id = cv.campaign_id AND is_control
+);
+
+-- At most one control per campaign
+CREATE UNIQUE INDEX IF NOT EXISTS idx_campaign_variants_control
+    ON campaign_variants (campaign_id) WHERE is_control;
+
+INSERT INTO schema_migrations (version, description)
+VALUES (17, 'variant control')
+ON CONFLICT (version) DO NOTHING;
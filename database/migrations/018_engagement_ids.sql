@@ -0,0 +1,39 @@
+-- 018: Engagement IDs, and loyalty points tied to the redemption they credit
+
+-- Existing rows are numbered as the column is added
+ALTER TABLE campaign_user_engagements ADD COLUMN IF NOT EXISTS engagement_id BIGSERIAL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_engagements_id ON campaign_user_engagements (engagement_id);
+
+-- Points are awarded in the redemption's own transaction; the unique index
+-- stops a use from being credited twice
+ALTER TABLE loyalty_points ADD COLUMN IF NOT EXISTS engagement_id BIGINT
+    REFERENCES campaign_user_engagements (engagement_id) ON DELETE SET NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_loyalty_points_engagement ON loyalty_points (engagement_id);
+
+-- Link earlier points to the newest use of the campaign by the user at or
+-- before they were earned; points that can't be matched one to one stay
+-- unlinked
+WITH nearest AS (
+    SELECT DISTINCT ON (lp.point_id) lp.point_id, e.engagement_id
+    FROM loyalty_points lp
+    JOIN campaign_user_engagements e
+        ON e.user_id = lp.user_id
+       AND e.campaign_id = lp.campaign_id
+       AND e.engagement_type = 'used'
+       AND e.engagement_time <= lp.earned_at
+    WHERE lp.engagement_id IS NULL
+    ORDER BY lp.point_id, e.engagement_time DESC
+), linked AS (
+    SELECT DISTINCT ON (engagement_id) point_id, engagement_id
+    FROM nearest
+    ORDER BY engagement_id, point_id
+)
+UPDATE loyalty_points lp
+SET engagement_id = linked.engagement_id
+FROM linked
+WHERE lp.point_id = linked.point_id
+  AND NOT EXISTS (SELECT 1 FROM loyalty_points x WHERE x.engagement_id = linked.engagement_id);
+
+INSERT INTO schema_migrations (version, description)
+VALUES (18, 'engagement ids')
+ON CONFLICT (version) DO NOTHING;
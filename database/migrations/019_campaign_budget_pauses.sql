@@ -0,0 +1,79 @@
+-- 019: Daily budget pauses kept apart from vendor blackout dates
+
+-- A campaign whose daily cap is used up is paused for the rest of that
+-- vendor-local date. Schedule edits replace campaign_blackout_dates, so the
+-- pauses live here where only budget changes lift them.
+CREATE TABLE IF NOT EXISTS campaign_budget_pauses (
+    campaign_id TEXT NOT NULL REFERENCES campaigns(campaign_id) ON DELETE CASCADE,
+    paused_date DATE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (campaign_id, paused_date)
+);
+
+-- Move the pauses the daily cap stored as blackout dates
+INSERT INTO campaign_budget_pauses (campaign_id, paused_date)
+SELECT campaign_id, blackout_date
+FROM campaign_blackout_dates
+WHERE reason = 'daily budget exhausted'
+ON CONFLICT (campaign_id, paused_date) DO NOTHING;
+
+DELETE FROM campaign_blackout_dates WHERE reason = 'daily budget exhausted';
+
+-- Same as 001, plus budget pauses
+CREATE OR REPLACE FUNCTION campaign_is_live(p_campaign_id TEXT, p_at TIMESTAMPTZ DEFAULT NOW())
+RETURNS BOOLEAN AS $$
+    SELECT EXISTS (
+        SELECT 1
+        FROM campaigns c
+        JOIN vendors v ON v.vendor_id = c.vendor_id
+        CROSS JOIN LATERAL (
+            SELECT
+                (p_at AT TIME ZONE v.timezone)::date AS local_date,
+                (p_at AT TIME ZONE v.timezone)::time AS local_time,
+                EXTRACT(DOW FROM p_at AT TIME ZONE v.timezone)::int AS local_dow
+        ) l
+        WHERE c.campaign_id = p_campaign_id
+          AND c.enabled = true
+          AND l.local_date BETWEEN c.start_date AND c.end_date
+          AND (l.local_date > c.start_date OR l.local_time >= c.run_time::time)
+          AND NOT EXISTS (
+              SELECT 1 FROM campaign_blackout_dates b
+              WHERE b.campaign_id = c.campaign_id
+                AND b.blackout_date = l.local_date
+          )
+          AND NOT EXISTS (
+              SELECT 1 FROM campaign_budget_pauses p
+              WHERE p.campaign_id = c.campaign_id
+                AND p.paused_date = l.local_date
+          )
+          AND (
+              NOT EXISTS (
+                  SELECT 1 FROM campaign_schedules s
+                  WHERE s.campaign_id = c.campaign_id
+              )
+              OR EXISTS (
+                  SELECT 1 FROM campaign_schedules s
+                  WHERE s.campaign_id = c.campaign_id
+                    AND (
+                        -- Same-day window
+                        (s.start_time < s.end_time
+                            AND l.local_dow = ANY(s.days_of_week)
+                            AND l.local_time >= s.start_time
+                            AND l.local_time < s.end_time)
+                        -- Overnight window, evening part
+                        OR (s.start_time > s.end_time
+                            AND l.local_dow = ANY(s.days_of_week)
+                            AND l.local_time >= s.start_time)
+                        -- Overnight window, after midnight on the following day
+                        OR (s.start_time > s.end_time
+                            AND ((l.local_dow + 6) % 7) = ANY(s.days_of_week)
+                            AND l.local_time < s.end_time)
+                    )
+              )
+          )
+    );
+$$ LANGUAGE sql STABLE;
+
+INSERT INTO schema_migrations (version, description)
+VALUES (19, 'campaign budget pauses')
+ON CONFLICT (version) DO NOTHING;
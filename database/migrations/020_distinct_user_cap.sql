@@ -0,0 +1,29 @@
+-- 020: Hide campaigns at their distinct-user cap from users who haven't redeemed
+
+-- campaign_open_to_user reports whether p_user_id may still redeem the
+-- campaign under its distinct-user cap: always for users who already have,
+-- otherwise only while the cap has room. A NULL user (a guest) counts as new.
+CREATE OR REPLACE FUNCTION campaign_open_to_user(p_campaign_id TEXT, p_user_id TEXT)
+RETURNS BOOLEAN AS $$
+    SELECT NOT EXISTS (
+        SELECT 1 FROM campaign_budgets b
+        WHERE b.campaign_id = p_campaign_id
+          AND b.max_distinct_users IS NOT NULL
+          AND (
+              SELECT COUNT(DISTINCT e.user_id)
+              FROM campaign_user_engagements e
+              WHERE e.campaign_id = p_campaign_id
+                AND e.engagement_type = 'used'
+          ) >= b.max_distinct_users
+    )
+    OR EXISTS (
+        SELECT 1 FROM campaign_user_engagements e
+        WHERE e.campaign_id = p_campaign_id
+          AND e.user_id = p_user_id
+          AND e.engagement_type = 'used'
+    );
+$$ LANGUAGE sql STABLE;
+
+INSERT INTO schema_migrations (version, description)
+VALUES (20, 'distinct user cap')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,18 @@
+-- 021: geocode.Normalize keeps "saint" apart from "street"
+
+-- Normalized addresses used to shorten both "Saint" and "Street" to "st".
+-- Now an "st" at the start of an address, or right after its house number,
+-- is "saint". Rewrite that case in place; other parts ("Main St, St Louis")
+-- lost their commas when stored, so re-run `go run ./cmd/geoimport` and
+-- re-save vendor profiles to refresh them fully.
+UPDATE vendors
+SET address_normalized = regexp_replace(address_normalized, '^([0-9]+ )?st (?=[^ ])', '\1saint ')
+WHERE address_normalized ~ '^([0-9]+ )?st [^ ]';
+
+UPDATE geocode_addresses
+SET normalized = regexp_replace(normalized, '^([0-9]+ )?st (?=[^ ])', '\1saint ')
+WHERE normalized ~ '^([0-9]+ )?st [^ ]';
+
+INSERT INTO schema_migrations (version, description)
+VALUES (21, 'saint normalization')
+ON CONFLICT (version) DO NOTHING;